@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// auditRecord is the representation of an audit entry in the JSON and CSV
+// exports.
+type auditRecord struct {
+	BlockIndex int    `json:"blockIndex"`
+	Accepted   bool   `json:"accepted"`
+	Type       string `json:"type"`
+	ContractID string `json:"contractID"`
+	Command    string `json:"command"`
+	InstanceID string `json:"instanceID"`
+	// ProjectInstanceID is set for the Calypso read requests
+	ProjectInstanceID string   `json:"projectInstanceID"`
+	Signers           []string `json:"signers"`
+}
+
+// auditCSVHeader is the first line of the CSV export
+var auditCSVHeader = []string{"block_index", "accepted", "type", "contract_id",
+	"command", "instance_id", "project_instance_id", "signers"}
+
+// auditBundle holds what is needed to check an audit offline: the blocks that
+// contain the audited instructions, and the forward links that prove each
+// block is part of the chain that starts with the genesis block.
+type auditBundle struct {
+	// InstanceID is the audited instance
+	InstanceID byzcoin.InstanceID
+	// SentToOnly tells if only the instructions sent to the instance are
+	// audited, which is the case for a dataset. Otherwise the instruction that
+	// spawned the instance is also audited.
+	SentToOnly bool
+	// Genesis is the genesis block of the chain, which holds the roster that
+	// signed the first forward links.
+	Genesis *skipchain.SkipBlock
+	Blocks  []*auditBundleBlock
+}
+
+// auditBundleBlock is a block along with the forward links from the genesis
+// block to it.
+type auditBundleBlock struct {
+	Block *skipchain.SkipBlock
+	Links []*skipchain.ForwardLink
+}
+
+// newAuditRecords converts the index entries to export records
+func newAuditRecords(entries []*auditIndexEntry) []*auditRecord {
+	records := make([]*auditRecord, len(entries))
+
+	for i, entry := range entries {
+		instr := entry.Instruction
+		record := &auditRecord{
+			BlockIndex: entry.BlockIndex,
+			Accepted:   entry.Accepted,
+			Type:       instr.GetType().String(),
+			ContractID: instr.ContractID(),
+			InstanceID: instr.InstanceID.String(),
+			Signers:    make([]string, len(instr.SignerIdentities)),
+		}
+		if instr.Invoke != nil {
+			record.Command = instr.Invoke.Command
+		}
+		if instr.Spawn != nil {
+			projectInstID := instr.Spawn.Args.Search("projectInstID")
+			if projectInstID != nil {
+				record.ProjectInstanceID = hex.EncodeToString(projectInstID)
+			}
+		}
+		for j, signer := range instr.SignerIdentities {
+			record.Signers[j] = signer.String()
+		}
+		records[i] = record
+	}
+
+	return records
+}
+
+// writeAuditRecords writes the records in the given format, "json" or "csv"
+func writeAuditRecords(w io.Writer, format string, records []*auditRecord) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(records)
+		if err != nil {
+			return xerrors.Errorf("failed to encode the records: %v", err)
+		}
+	case "csv":
+		csvW := csv.NewWriter(w)
+		err := csvW.Write(auditCSVHeader)
+		if err != nil {
+			return xerrors.Errorf("failed to write the header: %v", err)
+		}
+		for _, r := range records {
+			err = csvW.Write([]string{strconv.Itoa(r.BlockIndex),
+				strconv.FormatBool(r.Accepted), r.Type, r.ContractID, r.Command,
+				r.InstanceID, r.ProjectInstanceID, strings.Join(r.Signers, " ")})
+			if err != nil {
+				return xerrors.Errorf("failed to write a record: %v", err)
+			}
+		}
+		csvW.Flush()
+		err = csvW.Error()
+		if err != nil {
+			return xerrors.Errorf("failed to flush the records: %v", err)
+		}
+	default:
+		return xerrors.Errorf("unknown format '%s'", format)
+	}
+
+	return nil
+}
+
+// writeAuditBundle fetches the blocks of the entries along with their forward
+// links, and saves them as a bundle at the given path.
+func writeAuditBundle(path string, cfg lib.Config, instID byzcoin.InstanceID,
+	sentToOnly bool, entries []*auditIndexEntry) error {
+
+	cl := skipchain.NewClient()
+
+	genesis, err := cl.GetSingleBlock(&cfg.Roster, cfg.ByzCoinID)
+	if err != nil {
+		return xerrors.Errorf("failed to get the genesis block: %v", err)
+	}
+
+	bundle := auditBundle{
+		InstanceID: instID,
+		SentToOnly: sentToOnly,
+		Genesis:    genesis,
+		Blocks:     make([]*auditBundleBlock, 0),
+	}
+
+	lastIndex := -1
+	for _, entry := range entries {
+		// The entries are sorted by block
+		if entry.BlockIndex == lastIndex {
+			continue
+		}
+		lastIndex = entry.BlockIndex
+
+		reply, err := cl.GetSingleBlockByIndex(&cfg.Roster, cfg.ByzCoinID,
+			entry.BlockIndex)
+		if err != nil {
+			return xerrors.Errorf("failed to get block %d: %v",
+				entry.BlockIndex, err)
+		}
+		bundle.Blocks = append(bundle.Blocks, &auditBundleBlock{
+			Block: reply.SkipBlock,
+			Links: reply.Links,
+		})
+	}
+
+	buf, err := protobuf.Encode(&bundle)
+	if err != nil {
+		return xerrors.Errorf("failed to encode the bundle: %v", err)
+	}
+
+	err = ioutil.WriteFile(path, buf, 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to write the bundle: %v", err)
+	}
+
+	log.Lvlf1("proof bundle with %d blocks written to %s", len(bundle.Blocks),
+		path)
+
+	return nil
+}
+
+// verifyAuditBundle checks the bundle against the ID of the chain and returns
+// the entries of the audited instance found in its blocks. It doesn't need any
+// network access.
+func verifyAuditBundle(bundle *auditBundle,
+	byzcoinID skipchain.SkipBlockID) ([]*auditIndexEntry, error) {
+
+	genesis := bundle.Genesis
+	if genesis == nil {
+		return nil, xerrors.New("the bundle has no genesis block")
+	}
+	if !genesis.CalculateHash().Equal(genesis.Hash) {
+		return nil, xerrors.New("wrong hash of the genesis block")
+	}
+	if !genesis.Hash.Equal(byzcoinID) {
+		return nil, xerrors.Errorf("the bundle is for chain %x, not %x",
+			genesis.Hash, byzcoinID)
+	}
+
+	entries := make([]*auditIndexEntry, 0)
+
+	for _, bundleBlock := range bundle.Blocks {
+		block := bundleBlock.Block
+		if block == nil {
+			return nil, xerrors.New("the bundle has an empty block")
+		}
+
+		err := verifyBlockLinks(genesis, block, bundleBlock.Links)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to verify block %d: %v",
+				block.Index, err)
+		}
+
+		blockEntries, err := getBlockEntries(block, bundle.InstanceID,
+			bundle.SentToOnly)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read block %d: %v",
+				block.Index, err)
+		}
+		entries = append(entries, blockEntries...)
+	}
+
+	return entries, nil
+}
+
+// verifyBlockLinks checks that the block is part of the chain: each forward
+// link, starting from the genesis block, must be signed by the roster of the
+// chain at this point and the last link must point to the block.
+func verifyBlockLinks(genesis, block *skipchain.SkipBlock,
+	links []*skipchain.ForwardLink) error {
+
+	if !block.CalculateHash().Equal(block.Hash) {
+		return xerrors.New("wrong hash of the block")
+	}
+
+	publics := genesis.Roster.ServicePublics(skipchain.ServiceName)
+	current := genesis.Hash
+
+	for i, link := range links {
+		// The first link can be a pointer to the genesis block that only
+		// gives its roster. We use the roster of the genesis block instead.
+		if i == 0 && link.From.IsNull() && link.To.Equal(genesis.Hash) {
+			continue
+		}
+		if !link.From.Equal(current) {
+			return xerrors.Errorf("link %d doesn't start from block %x", i,
+				current)
+		}
+		err := link.VerifyWithScheme(pairing.NewSuiteBn256(), publics,
+			block.SignatureScheme)
+		if err != nil {
+			return xerrors.Errorf("wrong signature of link %d: %v", i, err)
+		}
+		if link.NewRoster != nil {
+			publics = link.NewRoster.ServicePublics(skipchain.ServiceName)
+		}
+		current = link.To
+	}
+
+	if !current.Equal(block.Hash) {
+		return xerrors.New("the links don't lead to the block")
+	}
+
+	return nil
+}
+
+// getBlockEntries checks that the transactions of the block are the ones the
+// block has been signed with, and returns the ones that concern the instance.
+func getBlockEntries(block *skipchain.SkipBlock, instID byzcoin.InstanceID,
+	sentToOnly bool) ([]*auditIndexEntry, error) {
+
+	dataHeader := &byzcoin.DataHeader{}
+	err := protobuf.Decode(block.Data, dataHeader)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dataHeader: %v", err)
+	}
+
+	dataBody := &byzcoin.DataBody{}
+	err = protobuf.DecodeWithConstructors(block.Payload, dataBody,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dataBody: %v", err)
+	}
+
+	// The payload is not part of the hash of the block, but its hash is
+	// stored in the header.
+	if !bytes.Equal(dataBody.TxResults.Hash(), dataHeader.ClientTransactionHash) {
+		return nil, xerrors.New("the transactions don't match the header")
+	}
+
+	entries := make([]*auditIndexEntry, 0)
+	for i, txResult := range dataBody.TxResults {
+		for j, instr := range txResult.ClientTransaction.Instructions {
+			spawned := instr.GetType() == byzcoin.SpawnType &&
+				instr.DeriveID("").Equal(instID)
+			if !instr.InstanceID.Equal(instID) && (sentToOnly || !spawned) {
+				continue
+			}
+			entries = append(entries, &auditIndexEntry{
+				BlockIndex:  block.Index,
+				Timestamp:   dataHeader.Timestamp,
+				Accepted:    txResult.Accepted,
+				Spawned:     spawned,
+				Instruction: instr,
+				TxIndex:     i,
+				InstrIndex:  j,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// auditVerify checks a proof bundle offline and prints the audited entries
+func auditVerify(c *cli.Context) error {
+	bundlePath := c.String("bundle")
+	if bundlePath == "" {
+		return xerrors.New("--bundle flag is required")
+	}
+
+	byzcoinID, err := hex.DecodeString(c.String("byzcoinID"))
+	if err != nil || len(byzcoinID) == 0 {
+		return xerrors.New("please provide the hex encoded ID of the chain " +
+			"with --byzcoinID")
+	}
+
+	buf, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return xerrors.Errorf("failed to read the bundle: %v", err)
+	}
+
+	bundle := &auditBundle{}
+	err = protobuf.DecodeWithConstructors(buf, bundle,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return xerrors.Errorf("failed to decode the bundle: %v", err)
+	}
+
+	entries, err := verifyAuditBundle(bundle, byzcoinID)
+	if err != nil {
+		return xerrors.Errorf("the bundle is not valid: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "The bundle is valid: %d blocks and %d "+
+		"instructions concerning instance %s\n", len(bundle.Blocks),
+		len(entries), bundle.InstanceID)
+
+	return writeAuditRecords(os.Stdout, c.String("format"),
+		newAuditRecords(entries))
+}
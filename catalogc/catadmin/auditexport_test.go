@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+)
+
+func TestWriteAuditRecords(t *testing.T) {
+	projectInstID := []byte("project")
+	spawn := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("dataset")),
+		Spawn: &byzcoin.Spawn{
+			ContractID: "calypsoRead",
+			Args:       byzcoin.Arguments{{Name: "projectInstID", Value: projectInstID}},
+		},
+	}
+	entries := []*auditIndexEntry{{BlockIndex: 3, Accepted: true, Instruction: spawn}}
+
+	records := newAuditRecords(entries)
+	require.Len(t, records, 1)
+	require.Equal(t, "spawn", records[0].Type)
+	require.Equal(t, "calypsoRead", records[0].ContractID)
+	require.Equal(t, "70726f6a656374", records[0].ProjectInstanceID)
+
+	out := new(bytes.Buffer)
+	err := writeAuditRecords(out, "json", records)
+	require.NoError(t, err)
+	var decoded []*auditRecord
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Equal(t, records, decoded)
+
+	out.Reset()
+	err = writeAuditRecords(out, "csv", records)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, strings.Join(auditCSVHeader, ","), lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "3,true,spawn,calypsoRead,,"))
+
+	err = writeAuditRecords(out, "xml", records)
+	require.Error(t, err)
+}
+
+func TestGetBlockEntries(t *testing.T) {
+	darcID := byzcoin.NewInstanceID([]byte("darc"))
+	spawn := byzcoin.Instruction{
+		InstanceID: darcID,
+		Spawn:      &byzcoin.Spawn{ContractID: "odysseyproject"},
+	}
+	projectID := spawn.DeriveID("")
+	invoke := byzcoin.Instruction{
+		InstanceID: projectID,
+		Invoke:     &byzcoin.Invoke{ContractID: "odysseyproject", Command: "updateStatus"},
+	}
+
+	txs := byzcoin.TxResults{newTestTx(true, spawn), newTestTx(false, invoke)}
+	block := newTestBlock(t, 4, txs...)
+	header, err := protobuf.Encode(&byzcoin.DataHeader{ClientTransactionHash: txs.Hash()})
+	require.NoError(t, err)
+	block.Data = header
+
+	entries, err := getBlockEntries(block, projectID, false)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.True(t, entries[0].Spawned)
+	require.Equal(t, 4, entries[0].BlockIndex)
+	require.Equal(t, 1, entries[1].TxIndex)
+	require.False(t, entries[1].Accepted)
+
+	entries, err = getBlockEntries(block, projectID, true)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// The transactions must be the ones of the header
+	block.Payload, err = protobuf.Encode(&byzcoin.DataBody{TxResults: txs[:1]})
+	require.NoError(t, err)
+	_, err = getBlockEntries(block, projectID, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "don't match the header")
+}
+
+func TestAuditBundle_Ledger(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:odysseycatalog"}, signer.Identity())
+	require.NoError(t, err)
+	genesisMsg.BlockInterval = 500 * time.Millisecond
+	gDarc := &genesisMsg.GenesisDarc
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	// Two catalogs are spawned in separate blocks, we audit the first one.
+	var instID byzcoin.InstanceID
+	for counter := uint64(1); counter <= 2; counter++ {
+		ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: catalogc.ContractCatalogID,
+			},
+			SignerCounter: []uint64{counter},
+		})
+		require.NoError(t, err)
+		require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+		_, err = cl.AddTransactionAndWait(ctx, 10)
+		require.NoError(t, err)
+
+		if counter == 1 {
+			instID = ctx.Instructions[0].DeriveID("")
+		}
+	}
+
+	pr, err := cl.WaitProof(instID, 2*genesisMsg.BlockInterval, nil)
+	require.NoError(t, err)
+
+	skipCl := skipchain.NewClient()
+	entries := make([]*auditIndexEntry, 0)
+	for i := 1; i <= pr.Proof.Latest.Index; i++ {
+		reply, err := skipCl.GetSingleBlockByIndex(roster, cl.ID, i)
+		require.NoError(t, err)
+		blockEntries, err := getBlockEntries(reply.SkipBlock, instID, false)
+		require.NoError(t, err)
+		entries = append(entries, blockEntries...)
+	}
+	require.Len(t, entries, 1)
+
+	dir, err := ioutil.TempDir("", "catadmin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bundle.bin")
+	cfg := lib.Config{Roster: *roster, ByzCoinID: cl.ID}
+	err = writeAuditBundle(path, cfg, instID, false, entries)
+	require.NoError(t, err)
+
+	readBundle := func() *auditBundle {
+		buf, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		bundle := &auditBundle{}
+		err = protobuf.DecodeWithConstructors(buf, bundle,
+			network.DefaultConstructors(cothority.Suite))
+		require.NoError(t, err)
+		require.Len(t, bundle.Blocks, 1)
+		return bundle
+	}
+
+	// The genuine bundle
+	verified, err := verifyAuditBundle(readBundle(), cl.ID)
+	require.NoError(t, err)
+	require.Len(t, verified, 1)
+	require.True(t, verified[0].Spawned)
+	require.Equal(t, entries[0].BlockIndex, verified[0].BlockIndex)
+
+	// Another chain
+	_, err = verifyAuditBundle(readBundle(), skipchain.SkipBlockID("other"))
+	require.Error(t, err)
+
+	// A tampered signature of a forward link
+	bundle := readBundle()
+	links := bundle.Blocks[0].Links
+	require.NotEmpty(t, links)
+	links[len(links)-1].Signature.Sig[0] ^= 0xff
+	_, err = verifyAuditBundle(bundle, cl.ID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong signature")
+
+	// A tampered block with a recomputed hash: the links don't lead to it
+	bundle = readBundle()
+	block := bundle.Blocks[0].Block
+	block.Index++
+	block.Hash = block.CalculateHash()
+	_, err = verifyAuditBundle(bundle, cl.ID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "don't lead to the block")
+
+	// A tampered payload, which is not part of the hash of the block
+	bundle = readBundle()
+	block = bundle.Blocks[0].Block
+	dataBody := &byzcoin.DataBody{}
+	err = protobuf.DecodeWithConstructors(block.Payload, dataBody,
+		network.DefaultConstructors(cothority.Suite))
+	require.NoError(t, err)
+	dataBody.TxResults[0].Accepted = !dataBody.TxResults[0].Accepted
+	block.Payload, err = protobuf.Encode(dataBody)
+	require.NoError(t, err)
+	_, err = verifyAuditBundle(bundle, cl.ID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "don't match the header")
+}
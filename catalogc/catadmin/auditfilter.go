@@ -0,0 +1,164 @@
+package main
+
+import (
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+)
+
+// auditDateLayout is the short layout accepted by --since and --until
+const auditDateLayout = "2006-01-02"
+
+// auditFilter selects the entries of an audit by block index and by time. The
+// bounds are inclusive.
+type auditFilter struct {
+	fromBlock int
+	// toBlock is -1 if there is no upper bound
+	toBlock int
+	since   time.Time
+	until   time.Time
+	// backward returns the newest entries first
+	backward bool
+	// limit is the maximum number of entries returned, 0 means no limit
+	limit int
+}
+
+// auditFilterFlags are the flags used by parseAuditFilter
+var auditFilterFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "from-block",
+		Usage: "only audit the blocks from this index",
+	},
+	cli.IntFlag{
+		Name:  "to-block",
+		Value: -1,
+		Usage: "only audit the blocks up to this index, included",
+	},
+	cli.StringFlag{
+		Name:  "since",
+		Usage: "only audit the blocks created since this date, like 2020-01-01 or 2020-01-01T15:04:05Z",
+	},
+	cli.StringFlag{
+		Name:  "until",
+		Usage: "only audit the blocks created until this date, included, like 2020-03-31 or 2020-03-31T15:04:05Z",
+	},
+	cli.BoolFlag{
+		Name:  "backward",
+		Usage: "list the newest instructions first",
+	},
+	cli.IntFlag{
+		Name:  "limit",
+		Usage: "the maximum number of instructions to list, 0 for no limit",
+	},
+}
+
+// parseAuditFilter reads the filter from the flags of the command
+func parseAuditFilter(c *cli.Context) (auditFilter, error) {
+	f := auditFilter{
+		fromBlock: c.Int("from-block"),
+		toBlock:   c.Int("to-block"),
+		backward:  c.Bool("backward"),
+		limit:     c.Int("limit"),
+	}
+
+	if f.fromBlock < 0 {
+		return f, xerrors.Errorf("--from-block must be positive, got %d",
+			f.fromBlock)
+	}
+	if f.toBlock >= 0 && f.toBlock < f.fromBlock {
+		return f, xerrors.Errorf("--to-block (%d) must be after --from-block "+
+			"(%d)", f.toBlock, f.fromBlock)
+	}
+	if f.limit < 0 {
+		return f, xerrors.Errorf("--limit must be positive, got %d", f.limit)
+	}
+
+	var err error
+
+	if c.String("since") != "" {
+		f.since, err = parseAuditTime(c.String("since"), false)
+		if err != nil {
+			return f, xerrors.Errorf("failed to parse --since: %v", err)
+		}
+	}
+
+	if c.String("until") != "" {
+		f.until, err = parseAuditTime(c.String("until"), true)
+		if err != nil {
+			return f, xerrors.Errorf("failed to parse --until: %v", err)
+		}
+	}
+
+	if !f.since.IsZero() && !f.until.IsZero() && f.until.Before(f.since) {
+		return f, xerrors.New("--until must be after --since")
+	}
+
+	return f, nil
+}
+
+// parseAuditTime parses a date or an RFC3339 time. If endOfDay is true, a
+// date is the last instant of the day, so that the day is included.
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	t, err := time.Parse(auditDateLayout, value)
+	if err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+
+	t, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, xerrors.Errorf("expected a date like '%s' or an RFC3339 "+
+			"time, got '%s'", auditDateLayout, value)
+	}
+
+	return t, nil
+}
+
+// match tells if the entry is within the bounds of the filter
+func (f auditFilter) match(entry *auditIndexEntry) bool {
+	if entry.BlockIndex < f.fromBlock {
+		return false
+	}
+	if f.toBlock >= 0 && entry.BlockIndex > f.toBlock {
+		return false
+	}
+
+	at := time.Unix(0, entry.Timestamp)
+	if !f.since.IsZero() && at.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && at.After(f.until) {
+		return false
+	}
+
+	return true
+}
+
+// apply returns the entries that match the filter, in the order of the
+// filter. The entries must be sorted by position on the chain. A page never
+// ends in the middle of a block, so that the following page can be requested
+// from the block after the last one, which means that the limit can be
+// exceeded by the entries of the last block.
+func (f auditFilter) apply(entries []*auditIndexEntry) []*auditIndexEntry {
+	res := make([]*auditIndexEntry, 0, len(entries))
+
+	for i := range entries {
+		entry := entries[i]
+		if f.backward {
+			entry = entries[len(entries)-1-i]
+		}
+		if !f.match(entry) {
+			continue
+		}
+		if f.limit > 0 && len(res) >= f.limit &&
+			res[len(res)-1].BlockIndex != entry.BlockIndex {
+			break
+		}
+		res = append(res, entry)
+	}
+
+	return res
+}
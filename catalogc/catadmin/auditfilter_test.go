@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuditTime(t *testing.T) {
+	since, err := parseAuditTime("2020-01-01", false)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), since)
+
+	// The whole day is included
+	until, err := parseAuditTime("2020-03-31", true)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 3, 31, 23, 59, 59, 999999999, time.UTC), until)
+
+	at, err := parseAuditTime("2020-03-31T10:00:00Z", true)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 3, 31, 10, 0, 0, 0, time.UTC), at)
+
+	_, err = parseAuditTime("31.03.2020", false)
+	require.Error(t, err)
+}
+
+func TestAuditFilter_Apply(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	entries := make([]*auditIndexEntry, 0)
+	for i := 0; i < 5; i++ {
+		at := start.Add(time.Duration(i) * 24 * time.Hour).UnixNano()
+		// Two instructions per block
+		entries = append(entries,
+			&auditIndexEntry{BlockIndex: i, Timestamp: at, InstrIndex: 0},
+			&auditIndexEntry{BlockIndex: i, Timestamp: at, InstrIndex: 1})
+	}
+
+	blocks := func(entries []*auditIndexEntry) []int {
+		res := make([]int, len(entries))
+		for i, entry := range entries {
+			res[i] = entry.BlockIndex
+		}
+		return res
+	}
+
+	noFilter := auditFilter{toBlock: -1}
+	require.Len(t, noFilter.apply(entries), 10)
+
+	f := auditFilter{fromBlock: 1, toBlock: 2}
+	require.Equal(t, []int{1, 1, 2, 2}, blocks(f.apply(entries)))
+
+	f = auditFilter{toBlock: -1, since: start.Add(72 * time.Hour)}
+	require.Equal(t, []int{3, 3, 4, 4}, blocks(f.apply(entries)))
+
+	until, err := parseAuditTime("2020-01-02", true)
+	require.NoError(t, err)
+	f = auditFilter{toBlock: -1, until: until}
+	require.Equal(t, []int{0, 0, 1, 1}, blocks(f.apply(entries)))
+
+	// The newest first, and a page doesn't end in the middle of a block
+	f = auditFilter{toBlock: -1, backward: true, limit: 3}
+	res := f.apply(entries)
+	require.Equal(t, []int{4, 4, 3, 3}, blocks(res))
+	require.Equal(t, 1, res[0].InstrIndex)
+
+	// The next page
+	f.toBlock = 2
+	require.Equal(t, []int{2, 2, 1, 1}, blocks(f.apply(entries)))
+}
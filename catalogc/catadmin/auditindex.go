@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// The audit index is a local database that maps instance IDs to the
+// instructions that concern them. It is updated incrementally from the last
+// indexed block each time an audit command is run, so that we don't have to
+// go through the whole chain at each audit.
+
+var (
+	// metaBucket holds the state of the index
+	metaBucket = []byte("meta")
+	// entriesBucket holds the index entries. The key is the instance ID
+	// followed by the block index, the transaction index and the instruction
+	// index, so that the entries of an instance are sorted by position.
+	entriesBucket = []byte("entries")
+
+	lastBlockIDKey = []byte("lastBlockID")
+	blockCountKey  = []byte("blockCount")
+	versionKey     = []byte("version")
+)
+
+// auditIndexVersion is the version of the format of the entries. An index
+// with another version is rebuilt from scratch.
+const auditIndexVersion = 1
+
+// auditPageSize is the number of blocks we ask for each pagination request
+const auditPageSize = 10000
+
+// auditIndexEntry describes an instruction that concerns an instance
+type auditIndexEntry struct {
+	BlockIndex int
+	// Timestamp is the time of the block, in nanoseconds
+	Timestamp int64
+	Accepted  bool
+	// Spawned is true if the instance is the one spawned by the instruction,
+	// and not the instance the instruction is sent to.
+	Spawned     bool
+	Instruction byzcoin.Instruction
+	// TxIndex and InstrIndex are the positions of the transaction in the
+	// block and of the instruction in the transaction.
+	TxIndex    int
+	InstrIndex int
+}
+
+// auditIndex wraps the database of the audit index
+type auditIndex struct {
+	db *bolt.DB
+	// onEntry, if set, is called with each instruction of the newly indexed
+	// blocks, in the order of the chain.
+	onEntry func(entry *auditIndexEntry)
+}
+
+// auditIndexPath returns the path of the index of the given chain, which is
+// stored next to the config files.
+func auditIndexPath(cfg lib.Config) string {
+	return filepath.Join(lib.ConfigPath, fmt.Sprintf("audit-%x.db", cfg.ByzCoinID))
+}
+
+// openAuditIndex opens, or creates, the audit index stored at the given path
+func openAuditIndex(path string) (*auditIndex, error) {
+	// The timeout prevents from waiting forever if another audit is updating
+	// the index.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 30 * time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open the audit index: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta != nil {
+			buf := meta.Get(versionKey)
+			if buf != nil && binary.BigEndian.Uint64(buf) == auditIndexVersion {
+				return nil
+			}
+			log.Lvl1("the audit index has an old format, rebuilding it")
+			err := tx.DeleteBucket(metaBucket)
+			if err != nil {
+				return xerrors.Errorf("failed to delete the meta bucket: %v", err)
+			}
+			err = tx.DeleteBucket(entriesBucket)
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return xerrors.Errorf("failed to delete the entries bucket: %v", err)
+			}
+		}
+
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return xerrors.Errorf("failed to create the meta bucket: %v", err)
+		}
+		err = meta.Put(versionKey, appendUint64(nil, auditIndexVersion))
+		if err != nil {
+			return xerrors.Errorf("failed to save the version: %v", err)
+		}
+		_, err = tx.CreateBucket(entriesBucket)
+		if err != nil {
+			return xerrors.Errorf("failed to create the entries bucket: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &auditIndex{db: db}, nil
+}
+
+// Close closes the database of the index
+func (idx *auditIndex) Close() error {
+	return idx.db.Close()
+}
+
+// blockCount returns the number of blocks that have been indexed
+func (idx *auditIndex) blockCount() int {
+	count := 0
+	idx.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(metaBucket).Get(blockCountKey)
+		if buf != nil {
+			count = int(binary.BigEndian.Uint64(buf))
+		}
+		return nil
+	})
+	return count
+}
+
+// lastBlockID returns the ID of the last indexed block, or nil if nothing has
+// been indexed yet.
+func (idx *auditIndex) lastBlockID() skipchain.SkipBlockID {
+	var id skipchain.SkipBlockID
+	idx.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(metaBucket).Get(lastBlockIDKey)
+		if buf != nil {
+			id = append(skipchain.SkipBlockID{}, buf...)
+		}
+		return nil
+	})
+	return id
+}
+
+// update indexes the blocks that have been added to the chain since the last
+// update.
+func (idx *auditIndex) update(cl *byzcoin.Client, cfg lib.Config) error {
+	for {
+		startID := idx.lastBlockID()
+		skipFirst := true
+		if startID == nil {
+			startID = cfg.ByzCoinID
+			skipFirst = false
+		}
+
+		n, err := idx.indexPage(cl, cfg, startID, skipFirst)
+		if err != nil {
+			return err
+		}
+		// We reached the end of the chain
+		if n < auditPageSize {
+			return nil
+		}
+	}
+}
+
+// indexPage indexes the blocks of one pagination request, starting from the
+// given block. It returns the number of blocks received.
+func (idx *auditIndex) indexPage(cl *byzcoin.Client, cfg lib.Config,
+	startID skipchain.SkipBlockID, skipFirst bool) (int, error) {
+
+	msg := &byzcoin.PaginateRequest{
+		StartID:  startID,
+		PageSize: 1,
+		NumPages: auditPageSize,
+		Backward: false,
+	}
+	ret := &byzcoin.PaginateResponse{}
+	streamingCon, err := cl.Stream(cfg.Roster.RandomServerIdentity(), msg)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to call PaginateRequest: %v", err)
+	}
+	defer streamingCon.Close()
+
+	nblocks := 0
+	for ; nblocks < auditPageSize; nblocks++ {
+		err = streamingCon.ReadMessage(ret)
+		if err != nil {
+			return nblocks, xerrors.Errorf("failed to read from stream: %v", err)
+		}
+		// This is normal when it reaches the end of the chain
+		if ret.ErrorCode == 4 {
+			break
+		}
+		if ret.ErrorCode != 0 {
+			return nblocks, xerrors.Errorf("Got a non zero error code: %d, %v",
+				ret.ErrorCode, ret.ErrorText)
+		}
+		if len(ret.Blocks) == 0 {
+			return nblocks, xerrors.Errorf("Expected to have one block, but "+
+				"got: %v", ret.Blocks)
+		}
+		// The first block is the last one we indexed
+		if nblocks == 0 && skipFirst {
+			continue
+		}
+		err = idx.indexBlock(ret.Blocks[0])
+		if err != nil {
+			return nblocks, xerrors.Errorf("failed to index block %d: %v",
+				ret.Blocks[0].Index, err)
+		}
+	}
+
+	log.Lvlf2("indexed %d blocks", nblocks)
+
+	return nblocks, nil
+}
+
+// indexBlock adds the instructions of the block to the index and marks it as
+// the last indexed block.
+func (idx *auditIndex) indexBlock(block *skipchain.SkipBlock) error {
+	dataHeader := &byzcoin.DataHeader{}
+	err := protobuf.Decode(block.Data, dataHeader)
+	if err != nil {
+		return xerrors.Errorf("failed to decode dataHeader: %v", err)
+	}
+
+	dataBody := &byzcoin.DataBody{}
+	err = protobuf.Decode(block.Payload, dataBody)
+	if err != nil {
+		return xerrors.Errorf("failed to decode dataBody: %v", err)
+	}
+
+	newEntries := make([]*auditIndexEntry, 0)
+
+	err = idx.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(entriesBucket)
+
+		for i, txResult := range dataBody.TxResults {
+			for j, instr := range txResult.ClientTransaction.Instructions {
+				entry := auditIndexEntry{
+					BlockIndex:  block.Index,
+					Timestamp:   dataHeader.Timestamp,
+					Accepted:    txResult.Accepted,
+					Instruction: instr,
+					TxIndex:     i,
+					InstrIndex:  j,
+				}
+				err := putEntry(entries, instr.InstanceID, &entry)
+				if err != nil {
+					return err
+				}
+				sentTo := entry
+				newEntries = append(newEntries, &sentTo)
+				if instr.GetType() == byzcoin.SpawnType {
+					entry.Spawned = true
+					err = putEntry(entries, instr.DeriveID(""), &entry)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		meta := tx.Bucket(metaBucket)
+
+		count := uint64(0)
+		buf := meta.Get(blockCountKey)
+		if buf != nil {
+			count = binary.BigEndian.Uint64(buf)
+		}
+		countBuf := make([]byte, 8)
+		binary.BigEndian.PutUint64(countBuf, count+1)
+
+		err := meta.Put(blockCountKey, countBuf)
+		if err != nil {
+			return xerrors.Errorf("failed to save the block count: %v", err)
+		}
+		err = meta.Put(lastBlockIDKey, block.Hash)
+		if err != nil {
+			return xerrors.Errorf("failed to save the last block ID: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if idx.onEntry != nil {
+		for _, entry := range newEntries {
+			idx.onEntry(entry)
+		}
+	}
+
+	return nil
+}
+
+// putEntry saves the entry under the given instance ID
+func putEntry(bucket *bolt.Bucket, instID byzcoin.InstanceID,
+	entry *auditIndexEntry) error {
+
+	buf, err := protobuf.Encode(entry)
+	if err != nil {
+		return xerrors.Errorf("failed to encode the entry: %v", err)
+	}
+
+	key := make([]byte, 0, 32+3*8)
+	key = append(key, instID.Slice()...)
+	key = appendUint64(key, uint64(entry.BlockIndex))
+	key = appendUint64(key, uint64(entry.TxIndex))
+	key = appendUint64(key, uint64(entry.InstrIndex))
+
+	err = bucket.Put(key, buf)
+	if err != nil {
+		return xerrors.Errorf("failed to save the entry: %v", err)
+	}
+
+	return nil
+}
+
+// appendUint64 appends the big endian representation of the number, which
+// keeps the keys sorted by number.
+func appendUint64(buf []byte, n uint64) []byte {
+	nBuf := make([]byte, 8)
+	binary.BigEndian.PutUint64(nBuf, n)
+	return append(buf, nBuf...)
+}
+
+// getEntries returns the entries of the given instance, sorted by their
+// position on the chain.
+func (idx *auditIndex) getEntries(instID byzcoin.InstanceID) ([]*auditIndexEntry, error) {
+	entries := make([]*auditIndexEntry, 0)
+	prefix := instID.Slice()
+
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(entriesBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			entry := &auditIndexEntry{}
+			err := protobuf.DecodeWithConstructors(v, entry,
+				network.DefaultConstructors(cothority.Suite))
+			if err != nil {
+				return xerrors.Errorf("failed to decode entry: %v", err)
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// loadAuditIndex opens the index of the chain and brings it up to date. The
+// caller must close it.
+func loadAuditIndex(cl *byzcoin.Client, cfg lib.Config) (*auditIndex, error) {
+	return loadAuditIndexAt(cl, cfg, auditIndexPath(cfg))
+}
+
+// loadAuditIndexAt opens the index stored at the given path and brings it up
+// to date. The caller must close it.
+func loadAuditIndexAt(cl *byzcoin.Client, cfg lib.Config,
+	path string) (*auditIndex, error) {
+
+	idx, err := openAuditIndex(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = idx.update(cl, cfg)
+	if err != nil {
+		idx.Close()
+		return nil, xerrors.Errorf("failed to update the audit index: %v", err)
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+// newTestBlock returns a block that holds the given transactions
+func newTestBlock(t *testing.T, index int, txs ...byzcoin.TxResult) *skipchain.SkipBlock {
+	buf, err := protobuf.Encode(&byzcoin.DataBody{TxResults: txs})
+	require.NoError(t, err)
+
+	block := skipchain.NewSkipBlock()
+	block.Index = index
+	block.Payload = buf
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+// newTestTx returns a transaction with the given instructions
+func newTestTx(accepted bool, instrs ...byzcoin.Instruction) byzcoin.TxResult {
+	return byzcoin.TxResult{
+		ClientTransaction: byzcoin.ClientTransaction{Instructions: instrs},
+		Accepted:          accepted,
+	}
+}
+
+func TestAuditIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catadmin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.db")
+	idx, err := openAuditIndex(path)
+	require.NoError(t, err)
+
+	require.Nil(t, idx.lastBlockID())
+	require.Equal(t, 0, idx.blockCount())
+
+	darcID := byzcoin.NewInstanceID([]byte("darc"))
+	spawn := byzcoin.Instruction{
+		InstanceID: darcID,
+		Spawn:      &byzcoin.Spawn{ContractID: "odysseyproject"},
+	}
+	projectID := spawn.DeriveID("")
+	invoke := byzcoin.Instruction{
+		InstanceID: projectID,
+		Invoke:     &byzcoin.Invoke{ContractID: "odysseyproject", Command: "updateStatus"},
+	}
+	other := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("other")),
+		Invoke:     &byzcoin.Invoke{ContractID: "value", Command: "update"},
+	}
+
+	err = idx.indexBlock(newTestBlock(t, 0))
+	require.NoError(t, err)
+	err = idx.indexBlock(newTestBlock(t, 1, newTestTx(true, spawn)))
+	require.NoError(t, err)
+	block := newTestBlock(t, 2, newTestTx(false, other, invoke),
+		newTestTx(true, invoke))
+	err = idx.indexBlock(block)
+	require.NoError(t, err)
+
+	require.Equal(t, 3, idx.blockCount())
+	require.Equal(t, block.Hash, idx.lastBlockID())
+
+	entries, err := idx.getEntries(projectID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	require.True(t, entries[0].Spawned)
+	require.Equal(t, 1, entries[0].BlockIndex)
+	require.Equal(t, "odysseyproject", entries[0].Instruction.Spawn.ContractID)
+
+	require.False(t, entries[1].Spawned)
+	require.False(t, entries[1].Accepted)
+	require.Equal(t, 2, entries[1].BlockIndex)
+	require.Equal(t, 0, entries[1].TxIndex)
+	require.Equal(t, 1, entries[1].InstrIndex)
+	require.Equal(t, "updateStatus", entries[1].Instruction.Invoke.Command)
+
+	require.True(t, entries[2].Accepted)
+	require.Equal(t, 1, entries[2].TxIndex)
+
+	entries, err = idx.getEntries(darcID)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.False(t, entries[0].Spawned)
+
+	// The index is kept when it is opened again
+	require.NoError(t, idx.Close())
+	idx, err = openAuditIndex(path)
+	require.NoError(t, err)
+	defer idx.Close()
+
+	require.Equal(t, 3, idx.blockCount())
+	entries, err = idx.getEntries(projectID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/projectc"
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/calypso"
+	"golang.org/x/xerrors"
+)
+
+// auditTimeLayout is used to display the time range of the requests
+const auditTimeLayout = "2006-01-02 15:04"
+
+// auditOwner prints the read requests performed on all the datasets of an
+// owner, grouped by project.
+func auditOwner(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	instid := c.String("instid")
+	if instid == "" {
+		return xerrors.New("please provide the catalog instance ID with --instid")
+	}
+
+	identityStr := c.String("identity")
+	if identityStr == "" {
+		return xerrors.New("please provide the identity of the owner with --identity")
+	}
+
+	format := c.String("format")
+	if format != "text" && format != "json" {
+		return xerrors.Errorf("unknown format '%s'", format)
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDBuf, err := hex.DecodeString(instid)
+	if err != nil {
+		return xerrors.Errorf("failed to decode instance id: %v", err)
+	}
+
+	pr, err := cl.GetProofFromLatest(instIDBuf)
+	if err != nil {
+		return xerrors.Errorf("couldn't get proof: %v", err)
+	}
+
+	var catalogData catalogc.CatalogData
+	err = catalogc.DecodeCatalogProof(pr.Proof, instIDBuf, &catalogData)
+	if err != nil {
+		return xerrors.Errorf("couldn't get a catalog instance: %v", err)
+	}
+
+	owner := catalogData.GetOwner(identityStr)
+	if owner == nil {
+		return xerrors.Errorf("owner with identity '%s' not found", identityStr)
+	}
+
+	idx, err := loadAuditIndex(cl, cfg)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	getProject := func(instID byzcoin.InstanceID) (*projectc.ProjectData, error) {
+		return getProjectData(cl, instID)
+	}
+
+	audit, err := newOwnerAudit(owner, idx.getEntries, getProject)
+	if err != nil {
+		return xerrors.Errorf("failed to audit the owner: %v", err)
+	}
+	audit.BlocksChecked = idx.blockCount()
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(audit)
+		if err != nil {
+			return xerrors.Errorf("failed to encode the audit: %v", err)
+		}
+		return nil
+	}
+
+	fmt.Printf("Checked %d blocks for the %d datasets of %s\n\n",
+		audit.BlocksChecked, len(audit.Datasets), audit.IdentityStr)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tTITLE\tACCEPTED\tREFUSED\tDATASETS\tFROM\tTO\tREQUESTERS")
+	for _, p := range audit.Projects {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%v\n", p.ProjectInstanceID,
+			p.Title, p.Accepted, p.Refused, len(p.Datasets),
+			p.FirstRequest.Format(auditTimeLayout),
+			p.LastRequest.Format(auditTimeLayout), p.Requesters)
+	}
+	return w.Flush()
+}
+
+// newOwnerAudit gathers the read requests on the datasets of the owner. The
+// entries and the projects are provided by the functions, which makes it
+// independent of the chain.
+func newOwnerAudit(owner *catalogc.Owner,
+	getEntries func(byzcoin.InstanceID) ([]*auditIndexEntry, error),
+	getProject func(byzcoin.InstanceID) (*projectc.ProjectData, error)) (
+	*catalogc.OwnerAudit, error) {
+
+	audit := &catalogc.OwnerAudit{
+		IdentityStr: owner.IdentityStr,
+		Datasets:    make([]*catalogc.OwnerAuditDataset, 0),
+		Projects:    make([]*catalogc.OwnerAuditProject, 0),
+	}
+
+	projects := make(map[string]*catalogc.OwnerAuditProject)
+
+	for _, dataset := range owner.Datasets {
+		writeID, err := hex.DecodeString(dataset.CalypsoWriteID)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decode the ID of dataset "+
+				"'%s': %v", dataset.Title, err)
+		}
+
+		entries, err := getEntries(byzcoin.NewInstanceID(writeID))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get the entries of dataset "+
+				"'%s': %v", dataset.Title, err)
+		}
+
+		datasetAudit := &catalogc.OwnerAuditDataset{
+			CalypsoWriteID: dataset.CalypsoWriteID,
+			Title:          dataset.Title,
+		}
+		audit.Datasets = append(audit.Datasets, datasetAudit)
+
+		for _, entry := range entries {
+			instr := entry.Instruction
+			// We are only interested in the read requests on the dataset
+			if entry.Spawned || instr.Spawn == nil ||
+				instr.Spawn.ContractID != calypso.ContractReadID {
+				continue
+			}
+
+			projectID := hex.EncodeToString(instr.Spawn.Args.Search("projectInstID"))
+			project, found := projects[projectID]
+			if !found {
+				project = &catalogc.OwnerAuditProject{
+					ProjectInstanceID: projectID,
+					Requesters:        make([]string, 0),
+					Datasets:          make([]string, 0),
+				}
+				projects[projectID] = project
+				audit.Projects = append(audit.Projects, project)
+			}
+
+			if entry.Accepted {
+				datasetAudit.Accepted++
+				project.Accepted++
+			} else {
+				datasetAudit.Refused++
+				project.Refused++
+			}
+
+			project.Datasets = appendUnique(project.Datasets, dataset.CalypsoWriteID)
+			for _, signer := range instr.SignerIdentities {
+				project.Requesters = appendUnique(project.Requesters, signer.String())
+			}
+
+			at := time.Unix(0, entry.Timestamp)
+			if project.FirstRequest.IsZero() || at.Before(project.FirstRequest) {
+				project.FirstRequest = at
+			}
+			if at.After(project.LastRequest) {
+				project.LastRequest = at
+			}
+		}
+	}
+
+	for _, project := range audit.Projects {
+		projectID, err := hex.DecodeString(project.ProjectInstanceID)
+		if err != nil || len(projectID) == 0 {
+			continue
+		}
+		projectData, err := getProject(byzcoin.NewInstanceID(projectID))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get project %s: %v",
+				project.ProjectInstanceID, err)
+		}
+		if projectData != nil {
+			project.Title = projectData.Title
+			project.RequesterIdentity = projectData.RequesterIdentity
+		}
+	}
+
+	// The most recent activity first
+	sort.SliceStable(audit.Projects, func(i, j int) bool {
+		return audit.Projects[i].LastRequest.After(audit.Projects[j].LastRequest)
+	})
+
+	return audit, nil
+}
+
+// getProjectData returns the project stored at the given instance, or nil if
+// the instance doesn't exist.
+func getProjectData(cl *byzcoin.Client,
+	instID byzcoin.InstanceID) (*projectc.ProjectData, error) {
+
+	pr, err := cl.GetProofFromLatest(instID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get proof: %v", err)
+	}
+
+	exist, err := pr.Proof.InclusionProof.Exists(instID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("error while checking if proof exist: %v", err)
+	}
+	if !exist {
+		return nil, nil
+	}
+
+	_, buf, contractID, _, err := pr.Proof.KeyValue()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get value from proof: %v", err)
+	}
+	if contractID != projectc.ContractProjectID {
+		return nil, xerrors.Errorf("instance '%s' is not a project, found "+
+			"contract '%s'", instID, contractID)
+	}
+
+	projectData := &projectc.ProjectData{}
+	err = projectc.DecodeProjectData(buf, projectData)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the project: %v", err)
+	}
+
+	return projectData, nil
+}
+
+// appendUnique appends the element if it is not already in the list
+func appendUnique(list []string, el string) []string {
+	for _, e := range list {
+		if e == el {
+			return list
+		}
+	}
+	return append(list, el)
+}
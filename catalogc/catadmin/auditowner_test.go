@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/projectc"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// newTestReadEntry returns the entry of a read request from the project
+func newTestReadEntry(projectID byzcoin.InstanceID, signer darc.Identity,
+	accepted bool, at time.Time) *auditIndexEntry {
+
+	return &auditIndexEntry{
+		Timestamp: at.UnixNano(),
+		Accepted:  accepted,
+		Instruction: byzcoin.Instruction{
+			Spawn: &byzcoin.Spawn{
+				ContractID: calypso.ContractReadID,
+				Args: byzcoin.Arguments{{Name: "projectInstID",
+					Value: projectID.Slice()}},
+			},
+			SignerIdentities: []darc.Identity{signer},
+		},
+	}
+}
+
+func TestNewOwnerAudit(t *testing.T) {
+	dataset1 := byzcoin.NewInstanceID([]byte("dataset1"))
+	dataset2 := byzcoin.NewInstanceID([]byte("dataset2"))
+	project1 := byzcoin.NewInstanceID([]byte("project1"))
+	project2 := byzcoin.NewInstanceID([]byte("project2"))
+	alice := darc.NewSignerEd25519(nil, nil).Identity()
+	bob := darc.NewSignerEd25519(nil, nil).Identity()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	owner := &catalogc.Owner{
+		IdentityStr: "ed25519:owner",
+		Datasets: []*catalogc.Dataset{
+			{CalypsoWriteID: dataset1.String(), Title: "first"},
+			{CalypsoWriteID: dataset2.String(), Title: "second"},
+		},
+	}
+
+	entries := map[string][]*auditIndexEntry{
+		dataset1.String(): {
+			newTestReadEntry(project1, alice, true, start),
+			newTestReadEntry(project1, alice, false, start.Add(time.Hour)),
+			// The spawn of the dataset is not a read
+			{
+				Spawned:     true,
+				Instruction: byzcoin.Instruction{Spawn: &byzcoin.Spawn{ContractID: calypso.ContractWriteID}},
+			},
+		},
+		dataset2.String(): {
+			newTestReadEntry(project1, bob, true, start.Add(2*time.Hour)),
+			newTestReadEntry(project2, bob, false, start.Add(time.Minute)),
+		},
+	}
+
+	getEntries := func(instID byzcoin.InstanceID) ([]*auditIndexEntry, error) {
+		return entries[instID.String()], nil
+	}
+	getProject := func(instID byzcoin.InstanceID) (*projectc.ProjectData, error) {
+		// The second project doesn't exist anymore
+		if instID.Equal(project2) {
+			return nil, nil
+		}
+		return &projectc.ProjectData{Title: "Road safety",
+			RequesterIdentity: alice.String()}, nil
+	}
+
+	audit, err := newOwnerAudit(owner, getEntries, getProject)
+	require.NoError(t, err)
+
+	require.Equal(t, "ed25519:owner", audit.IdentityStr)
+	require.Len(t, audit.Datasets, 2)
+	require.Equal(t, 1, audit.Datasets[0].Accepted)
+	require.Equal(t, 1, audit.Datasets[0].Refused)
+	require.Equal(t, 1, audit.Datasets[1].Accepted)
+	require.Equal(t, 1, audit.Datasets[1].Refused)
+
+	require.Len(t, audit.Projects, 2)
+
+	p := audit.Projects[0]
+	require.Equal(t, project1.String(), p.ProjectInstanceID)
+	require.Equal(t, "Road safety", p.Title)
+	require.Equal(t, alice.String(), p.RequesterIdentity)
+	require.Equal(t, 2, p.Accepted)
+	require.Equal(t, 1, p.Refused)
+	require.Equal(t, []string{alice.String(), bob.String()}, p.Requesters)
+	require.Equal(t, []string{dataset1.String(), dataset2.String()}, p.Datasets)
+	require.True(t, start.Equal(p.FirstRequest))
+	require.True(t, start.Add(2*time.Hour).Equal(p.LastRequest))
+
+	p = audit.Projects[1]
+	require.Equal(t, project2.String(), p.ProjectInstanceID)
+	require.Equal(t, "", p.Title)
+	require.Equal(t, 0, p.Accepted)
+	require.Equal(t, 1, p.Refused)
+}
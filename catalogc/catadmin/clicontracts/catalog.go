@@ -11,8 +11,8 @@ import (
 	"time"
 
 	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/cryptutil/envelope"
 	"github.com/urfave/cli"
-	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
 	"go.dedis.ch/cothority/v3/darc"
@@ -93,7 +93,7 @@ func CatalogSpawn(c *cli.Context) error {
 	}
 
 	result := catalogc.CatalogData{}
-	err = protobuf.Decode(resultBuf, &result)
+	err = catalogc.DecodeCatalogData(resultBuf, &result)
 	if err != nil {
 		return errors.New("couldn't decode the result: " + err.Error())
 	}
@@ -438,6 +438,31 @@ func CatalogInvokeAddDataset(c *cli.Context) error {
 		SHA2:        sha2,
 	}
 
+	manifestJSON := c.String("manifest")
+	if manifestJSON != "" {
+		dataset.Manifest, err = decodeManifest(manifestJSON)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = AddDataset(cl, *signer, byzcoin.NewInstanceID(instIDBuf), identityStr,
+		calypsoWriteID, dataset)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Dataset added! (instance ID is %x)\n", instIDBuf)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// AddDataset adds a dataset to an owner of the catalog and waits for the
+// transaction to be accepted
+func AddDataset(cl *byzcoin.Client, signer darc.Signer,
+	instID byzcoin.InstanceID, identityStr, calypsoWriteID string,
+	dataset catalogc.Dataset) error {
+
 	datasetBuf, err := protobuf.Encode(&dataset)
 	if err != nil {
 		return xerrors.Errorf("failed to encode dataset: %v", err)
@@ -465,7 +490,7 @@ func CatalogInvokeAddDataset(c *cli.Context) error {
 	}
 
 	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
-		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		InstanceID:    instID,
 		Invoke:        &invoke,
 		SignerCounter: []uint64{counters.Counters[0] + 1},
 	})
@@ -473,7 +498,7 @@ func CatalogInvokeAddDataset(c *cli.Context) error {
 		return errors.New("failed to create transaction: " + err.Error())
 	}
 
-	err = ctx.FillSignersAndSignWith(*signer)
+	err = ctx.FillSignersAndSignWith(signer)
 	if err != nil {
 		return errors.New("failed to sign transaction: " + err.Error())
 	}
@@ -483,10 +508,7 @@ func CatalogInvokeAddDataset(c *cli.Context) error {
 		return errors.New("failed to add transaction: " + err.Error())
 	}
 
-	newInstID := ctx.Instructions[0].DeriveID("").Slice()
-	fmt.Printf("Dataset added! (instance ID is %x)\n", newInstID)
-
-	return lib.WaitPropagation(c, cl)
+	return nil
 }
 
 // CatalogInvokeUpdateDataset delete an owner
@@ -531,8 +553,7 @@ func CatalogInvokeUpdateDataset(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID,
-		&catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return xerrors.New("couldn't get a project instance: " + err.Error())
 	}
@@ -603,6 +624,16 @@ func CatalogInvokeUpdateDataset(c *cli.Context) error {
 		dataset.SHA2 = sha2
 	}
 
+	manifestJSON := c.String("manifest")
+	if manifestJSON == "_" {
+		dataset.Manifest = nil
+	} else if manifestJSON != "" {
+		dataset.Manifest, err = decodeManifest(manifestJSON)
+		if err != nil {
+			return err
+		}
+	}
+
 	metadataJSON := c.String("metadataJSON")
 	if metadataJSON == "_" {
 		dataset.Metadata = nil
@@ -715,8 +746,7 @@ func CatalogInvokeArchiveDataset(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID,
-		&catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return xerrors.New("couldn't get a project instance: " + err.Error())
 	}
@@ -844,8 +874,7 @@ func CatalogInvokeDeleteDataset(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID,
-		&catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return xerrors.New("couldn't get a project instance: " + err.Error())
 	}
@@ -1051,7 +1080,7 @@ func CatalogGet(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID, &catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return errors.New("couldn't get a catalog instance: " + err.Error())
 	}
@@ -1121,7 +1150,7 @@ func CatalogGetDatasets(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID, &catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return errors.New("couldn't get a catalog instance: " + err.Error())
 	}
@@ -1204,7 +1233,7 @@ func CatalogGetSingleDataset(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID, &catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return errors.New("couldn't get a catalog instance: " + err.Error())
 	}
@@ -1297,7 +1326,7 @@ func CatalogGetMetadata(c *cli.Context) error {
 	}
 
 	var catalogData catalogc.CatalogData
-	err = proof.VerifyAndDecode(cothority.Suite, catalogc.ContractCatalogID, &catalogData)
+	err = catalogc.DecodeCatalogProof(proof, instIDBuf, &catalogData)
 	if err != nil {
 		return errors.New("couldn't get a catalog instance: " + err.Error())
 	}
@@ -1333,3 +1362,15 @@ func CatalogGetMetadata(c *cli.Context) error {
 
 	return nil
 }
+
+// decodeManifest decodes a signed manifest in JSON, as printed by 'catadmin
+// dataset signManifest'
+func decodeManifest(manifestJSON string) (*envelope.SignedManifest, error) {
+	manifest := &envelope.SignedManifest{}
+	err := json.Unmarshal([]byte(manifestJSON), manifest)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the manifest: %v", err)
+	}
+
+	return manifest, nil
+}
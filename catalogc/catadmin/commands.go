@@ -172,6 +172,10 @@ var cmds = cli.Commands{
 										Name:  "sha2",
 										Usage: "sha2 of the dataset",
 									},
+									cli.StringFlag{
+										Name:  "manifest",
+										Usage: "the manifest signed by the owner, in JSON as printed by 'dataset signManifest' (optional)",
+									},
 								},
 							},
 							{
@@ -220,6 +224,10 @@ var cmds = cli.Commands{
 										Name:  "sha2",
 										Usage: "sha2 of the dataset",
 									},
+									cli.StringFlag{
+										Name:  "manifest",
+										Usage: "the manifest signed by the owner, in JSON as printed by 'dataset signManifest'. '_' removes it (optional)",
+									},
 									cli.StringFlag{
 										Name:  "metadataJSON, mJSON",
 										Usage: "the JSON representation of the Metadata struct",
@@ -416,7 +424,7 @@ var cmds = cli.Commands{
 				Name:   "dataset",
 				Usage:  "display in HTML format all the access performed on the given Calypso write ID",
 				Action: auditDataset,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{
 						Name:   "bc",
 						EnvVar: "BC",
@@ -426,13 +434,22 @@ var cmds = cli.Commands{
 						Name:  "instid, i",
 						Usage: "The Calypso write ID",
 					},
-				},
+					cli.StringFlag{
+						Name:  "format, f",
+						Value: "html",
+						Usage: "the output format: html (to the log), json or csv",
+					},
+					cli.StringFlag{
+						Name:  "bundle",
+						Usage: "if set, saves a proof bundle of the audit to this file, which can be checked offline with 'audit verify'",
+					},
+				}, auditFilterFlags...),
 			},
 			{
 				Name:   "project",
 				Usage:  "display in HTML format the evolution of the project, ie. all the instructions concerned by the given instanceID",
 				Action: auditProject,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.StringFlag{
 						Name:   "bc",
 						EnvVar: "BC",
@@ -442,8 +459,162 @@ var cmds = cli.Commands{
 						Name:  "instid, i",
 						Usage: "The project instance ID",
 					},
+					cli.StringFlag{
+						Name:  "format, f",
+						Value: "protobuf",
+						Usage: "the output format: protobuf, json or csv",
+					},
+					cli.StringFlag{
+						Name:  "bundle",
+						Usage: "if set, saves a proof bundle of the audit to this file, which can be checked offline with 'audit verify'",
+					},
+				}, auditFilterFlags...),
+			},
+			{
+				Name:   "owner",
+				Usage:  "display the read requests on all the datasets of an owner, grouped by project",
+				Action: auditOwner,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "instid, i",
+						Usage: "the catalog instance ID (required)",
+					},
+					cli.StringFlag{
+						Name:  "identity, identityStr, idStr",
+						Usage: "the identity of the owner, like 'ed25519:aef123' (required)",
+					},
+					cli.StringFlag{
+						Name:  "format, f",
+						Value: "text",
+						Usage: "the output format: text or json",
+					},
+				},
+			},
+			{
+				Name:   "verify",
+				Usage:  "check offline a proof bundle and print the instructions it contains",
+				Action: auditVerify,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "bundle",
+						Usage: "the proof bundle to check (required)",
+					},
+					cli.StringFlag{
+						Name:  "byzcoinID, id",
+						Usage: "the hex encoded ID of the chain the bundle must come from (required)",
+					},
+					cli.StringFlag{
+						Name:  "format, f",
+						Value: "json",
+						Usage: "the output format: json or csv",
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:  "dataset",
+		Usage: "handles the datasets from end to end",
+		Subcommands: cli.Commands{
+			{
+				Name:   "publish",
+				Usage:  "encrypt a dataset, upload it, create its Calypso write and add it to the catalog. Run it again to resume after a failure",
+				Action: publishDataset,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "instid, i",
+						Usage: "the catalog instance ID (required)",
+					},
+					cli.StringFlag{
+						Name:  "darc",
+						Usage: "the DARC that controls the access to the dataset (required)",
+					},
+					cli.StringFlag{
+						Name:  "sign, s",
+						Usage: "public key of the owner of the dataset, who signs its manifest (default is the admin public key)",
+					},
+					cli.StringFlag{
+						Name:  "ltsid",
+						Usage: "the instance ID of the LTS (required)",
+					},
+					cli.StringFlag{
+						Name:  "ltskey",
+						Usage: "the hex encoded public key of the LTS (required)",
+					},
+					cli.StringFlag{
+						Name:  "file, f",
+						Usage: "the dataset to publish (required)",
+					},
+					cli.StringFlag{
+						Name:  "title",
+						Usage: "the title of the dataset (required)",
+					},
+					cli.StringFlag{
+						Name:  "description",
+						Usage: "the description of the dataset (required)",
+					},
+					cli.StringFlag{
+						Name:  "compress",
+						Value: "none",
+						Usage: "compresses the dataset before the encryption, either none or gzip",
+					},
+					cli.StringFlag{
+						Name:  "bucket",
+						Value: "datasets",
+						Usage: "the bucket where the dataset is uploaded",
+					},
+					cli.StringFlag{
+						Name:  "state",
+						Usage: "the file that saves the progress, it holds the key of the dataset (default is <file>.publish.json)",
+					},
 				},
 			},
+			{
+				Name:   "signManifest",
+				Usage:  "sign the manifest of a dataset and print it in JSON, to be used with --manifest",
+				Action: signManifest,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "sign, s",
+						Usage: "public key of the owner (default is the admin public key)",
+					},
+					cli.StringFlag{
+						Name:  "manifest",
+						Usage: "the manifest in JSON, with the datasetID, ciphertextSHA2, plaintextSHA2, size and version (required)",
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:   "monitor",
+		Usage:  "follow the chain and raise alerts on rejected or unusual accesses",
+		Action: monitorChain,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use (required)",
+			},
+			cli.StringFlag{
+				Name:  "config",
+				Usage: "the TOML config of the triggers and sinks, see monitor.toml.template (default is to log all the triggers)",
+			},
 		},
 	},
 }
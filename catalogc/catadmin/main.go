@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"html"
 	"io"
 	"math/rand"
 	"os"
@@ -12,7 +14,6 @@ import (
 	"github.com/dedis/odyssey/catalogc"
 	"github.com/dedis/odyssey/projectc"
 	"github.com/urfave/cli"
-	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
 	"go.dedis.ch/onet/v3/cfgpath"
@@ -81,81 +82,91 @@ func auditDataset(c *cli.Context) error {
 		return xerrors.New("please provide a Calypso write instanceID with --instid")
 	}
 
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return err
+	}
+
 	cfg, cl, err := lib.LoadConfig(bcArg)
 	if err != nil {
 		return err
 	}
 
-	msg := &byzcoin.PaginateRequest{
-		StartID:  cfg.ByzCoinID,
-		PageSize: 1,
-		NumPages: 100000,
-		Backward: false,
+	instIDBuf, err := hex.DecodeString(instid)
+	if err != nil {
+		return xerrors.Errorf("failed to decode instance id: %v", err)
 	}
-	ret := &byzcoin.PaginateResponse{}
-	streamingCon, err := cl.Stream(cfg.Roster.RandomServerIdentity(), msg)
+
+	idx, err := loadAuditIndex(cl, cfg)
 	if err != nil {
-		return xerrors.Errorf("failed to call PaginateRequest: %v", err)
+		return err
 	}
+	defer idx.Close()
 
-	out := new(strings.Builder)
-	occurences := 0
-	nblocks := 0
+	entries, err := idx.getEntries(byzcoin.NewInstanceID(instIDBuf))
+	if err != nil {
+		return xerrors.Errorf("failed to get the entries of the dataset: %v", err)
+	}
 
-	for ; nblocks < 100000; nblocks++ {
-		err = streamingCon.ReadMessage(ret)
-		if err != nil {
-			return xerrors.Errorf("failed to read from stream: %v", err)
+	// We are only interested in the instructions sent to the dataset
+	sentTo := make([]*auditIndexEntry, 0, len(entries))
+	for _, entry := range filter.apply(entries) {
+		if !entry.Spawned {
+			sentTo = append(sentTo, entry)
 		}
-		// This is normal when it reaches the end of the chain
-		if ret.ErrorCode == 4 {
-			break
-		}
-		if ret.ErrorCode != 0 {
-			return xerrors.Errorf("Got a non zero error code: %d, %v", ret.ErrorCode, ret.ErrorText)
+	}
 
-		}
-		if len(ret.Blocks) == 0 {
-			return xerrors.Errorf("Expected to have one block, but got: %v", ret.Blocks)
-		}
-		dataBody := &byzcoin.DataBody{}
-		err := protobuf.Decode(ret.Blocks[0].Payload, dataBody)
+	if c.String("bundle") != "" {
+		err = writeAuditBundle(c.String("bundle"), cfg,
+			byzcoin.NewInstanceID(instIDBuf), true, sentTo)
 		if err != nil {
-			return xerrors.Errorf("failed to decode dataBody: %v", err)
+			return xerrors.Errorf("failed to write the proof bundle: %v", err)
 		}
-		if len(dataBody.TxResults) == 0 {
-			continue
-		}
-		for _, txResult := range dataBody.TxResults {
-			for _, instr := range txResult.ClientTransaction.Instructions {
-				if instr.InstanceID.String() == instid {
-					occurences++
-					out.WriteString("<div class=\"occurence\">")
-					fmt.Fprintf(out, "<p>Accepted? <b>%v</b><br>", txResult.Accepted)
-					fmt.Fprintf(out, "BlockIndex: %d<p>", ret.Blocks[0].Index)
-					if instr.GetType() == byzcoin.SpawnType {
-						projectInstID := instr.Spawn.Args.Search("projectInstID")
-						fmt.Fprintf(out, "<p>Project instance ID: <a href='/lifecycle?piid=%x'>%x</a></p>", projectInstID, projectInstID)
-						resp, err := cl.GetProofFromLatest(projectInstID)
-						if err != nil {
-							return xerrors.Errorf("failed to get project instance: %v", err)
-						}
-						var projectInst projectc.ProjectData
-						err = resp.Proof.VerifyAndDecode(cothority.Suite, projectc.ContractProjectID, &projectInst)
-						if err != nil {
-							return xerrors.Errorf("failed to decode project instance: %v", err)
-						}
-						out.WriteString("<details>")
-						out.WriteString("<summary>See the project attributes</summary>")
-						fmt.Fprintf(out, "<pre>%v</pre>", projectInst)
-						out.WriteString("</details>")
-						out.WriteString("</details>")
-					}
-					fmt.Fprintf(out, "<details><summary>See instruction</summary><pre>%v</pre></details>", instr)
-					out.WriteString("</div>")
-				}
+	}
+
+	switch c.String("format") {
+	case "html":
+	case "json", "csv":
+		return writeAuditRecords(os.Stdout, c.String("format"),
+			newAuditRecords(sentTo))
+	default:
+		return xerrors.Errorf("unknown format '%s'", c.String("format"))
+	}
+
+	out := new(strings.Builder)
+	occurences := 0
+	nblocks := idx.blockCount()
+
+	for _, entry := range sentTo {
+		instr := entry.Instruction
+		occurences++
+		out.WriteString("<div class=\"occurence\">")
+		fmt.Fprintf(out, "<p>Accepted? <b>%v</b><br>", entry.Accepted)
+		fmt.Fprintf(out, "BlockIndex: %d<p>", entry.BlockIndex)
+		if instr.GetType() == byzcoin.SpawnType {
+			projectInstID := instr.Spawn.Args.Search("projectInstID")
+			fmt.Fprintf(out, "<p>Project instance ID: <a href='/lifecycle?piid=%x'>%x</a></p>", projectInstID, projectInstID)
+			resp, err := cl.GetProofFromLatest(projectInstID)
+			if err != nil {
+				return xerrors.Errorf("failed to get project instance: %v", err)
 			}
+			var projectInst projectc.ProjectData
+			err = projectc.DecodeProjectProof(resp.Proof, projectInstID, &projectInst)
+			if err != nil {
+				return xerrors.Errorf("failed to decode project instance: %v", err)
+			}
+			fmt.Fprintf(out, "<p>Project: <b>%s</b> requested by %s (%s)</p>",
+				html.EscapeString(projectInst.Title),
+				html.EscapeString(projectInst.Organisation),
+				html.EscapeString(projectInst.RequesterIdentity))
+			out.WriteString("<details>")
+			out.WriteString("<summary>See the project attributes</summary>")
+			fmt.Fprintf(out, "<pre>%v</pre>", projectInst)
+			out.WriteString("</details>")
+			out.WriteString("</details>")
 		}
+		fmt.Fprintf(out, "<details><summary>See instruction</summary><pre>%v</pre></details>", instr)
+		out.WriteString("</div>")
 	}
 
 	prolog := fmt.Sprintf("<p>Checked <b>%d blocks</b> and found <b>%d requests</b>.</p>", nblocks, occurences)
@@ -176,96 +187,105 @@ func auditProject(c *cli.Context) error {
 		return xerrors.New("please provide a Calypso write instanceID with --instid")
 	}
 
-	cfg, cl, err := lib.LoadConfig(bcArg)
+	filter, err := parseAuditFilter(c)
 	if err != nil {
 		return err
 	}
 
-	msg := &byzcoin.PaginateRequest{
-		StartID:  cfg.ByzCoinID,
-		PageSize: 1,
-		NumPages: 100000,
-		Backward: false,
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
 	}
-	ret := &byzcoin.PaginateResponse{}
-	streamingCon, err := cl.Stream(cfg.Roster.RandomServerIdentity(), msg)
+
+	instIDBuf, err := hex.DecodeString(instid)
 	if err != nil {
-		return xerrors.Errorf("failed to call PaginateRequest: %v", err)
+		return xerrors.Errorf("failed to decode instance id: %v", err)
 	}
 
-	blocks := make([]*catalogc.AuditBlock, 0)
-	occurences := 0
-	nblocks := 0
+	idx, err := loadAuditIndex(cl, cfg)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
 
-	for ; nblocks < 100000; nblocks++ {
-		err = streamingCon.ReadMessage(ret)
-		if err != nil {
-			return xerrors.Errorf("failed to read from stream: %v", err)
-		}
-		// This is normal when it reaches the end of the chain
-		if ret.ErrorCode == 4 {
-			break
-		}
-		if ret.ErrorCode != 0 {
-			return xerrors.Errorf("Got a non zero error code: %d, %v", ret.ErrorCode, ret.ErrorText)
+	entries, err := idx.getEntries(byzcoin.NewInstanceID(instIDBuf))
+	if err != nil {
+		return xerrors.Errorf("failed to get the entries of the project: %v", err)
+	}
+	entries = filter.apply(entries)
 
-		}
-		if len(ret.Blocks) == 0 {
-			return xerrors.Errorf("Expected to have one block, but got: %v", ret.Blocks)
-		}
-		dataBody := &byzcoin.DataBody{}
-		err := protobuf.Decode(ret.Blocks[0].Payload, dataBody)
+	if c.String("bundle") != "" {
+		err = writeAuditBundle(c.String("bundle"), cfg,
+			byzcoin.NewInstanceID(instIDBuf), false, entries)
 		if err != nil {
-			return xerrors.Errorf("failed to decode dataBody: %v", err)
+			return xerrors.Errorf("failed to write the proof bundle: %v", err)
 		}
-		if len(dataBody.TxResults) == 0 {
-			continue
-		}
-
-		transactionsRes := make([]*catalogc.AuditTransaction, 0)
-		for _, txResult := range dataBody.TxResults {
-			instrRes := make([]*byzcoin.Instruction, 0)
+	}
 
-			for _, instr := range txResult.ClientTransaction.Instructions {
-				if instr.InstanceID.String() == instid || instr.DeriveID("").String() == instid {
-					instrRes = append(instrRes, &instr)
-					occurences++
-				}
-			}
+	switch c.String("format") {
+	case "protobuf":
+	case "json", "csv":
+		return writeAuditRecords(os.Stdout, c.String("format"),
+			newAuditRecords(entries))
+	default:
+		return xerrors.Errorf("unknown format '%s'", c.String("format"))
+	}
 
-			if len(instrRes) != 0 {
-				auditTransaction := &catalogc.AuditTransaction{
-					Accepted:     txResult.Accepted,
-					Instructions: instrRes,
-				}
-				transactionsRes = append(transactionsRes, auditTransaction)
+	blocks := make([]*catalogc.AuditBlock, 0)
+	occurences := len(entries)
+	nblocks := idx.blockCount()
+
+	// The entries are sorted by block and transaction, we group them
+	// accordingly.
+	var auditBlock *catalogc.AuditBlock
+	var auditTransaction *catalogc.AuditTransaction
+	lastTxIndex := -1
+
+	for _, entry := range entries {
+		if auditBlock == nil || auditBlock.BlockIndex != entry.BlockIndex {
+			auditBlock = &catalogc.AuditBlock{
+				BlockIndex:   entry.BlockIndex,
+				Transactions: make([]*catalogc.AuditTransaction, 0),
 			}
+			blocks = append(blocks, auditBlock)
+			auditTransaction = nil
 		}
-
-		if len(transactionsRes) != 0 {
-			auditBlock := &catalogc.AuditBlock{
-				BlockIndex:   ret.Blocks[0].Index,
-				Transactions: transactionsRes,
+		if auditTransaction == nil || lastTxIndex != entry.TxIndex {
+			auditTransaction = &catalogc.AuditTransaction{
+				Accepted:     entry.Accepted,
+				Instructions: make([]*byzcoin.Instruction, 0),
 			}
-			blocks = append(blocks, auditBlock)
+			auditBlock.Transactions = append(auditBlock.Transactions,
+				auditTransaction)
+			lastTxIndex = entry.TxIndex
 		}
+		instr := entry.Instruction
+		auditTransaction.Instructions = append(auditTransaction.Instructions,
+			&instr)
 	}
 
 	if len(blocks) > 0 {
 		blocks[0].DeltaPrevious = -1
 		blocks[len(blocks)-1].DeltaNext = -1
+		// The blocks are in reverse order with --backward
 		for i, block := range blocks[1:] {
-			block.DeltaPrevious = block.BlockIndex - blocks[i].BlockIndex - 1
+			block.DeltaPrevious = absInt(block.BlockIndex-blocks[i].BlockIndex) - 1
 		}
 		for i, block := range blocks[:len(blocks)-1] {
-			block.DeltaNext = blocks[i+1].BlockIndex - block.BlockIndex - 1
+			block.DeltaNext = absInt(blocks[i+1].BlockIndex-block.BlockIndex) - 1
 		}
 	}
 
+	outputs, err := getProjectOutputs(cl, instid)
+	if err != nil {
+		return xerrors.Errorf("failed to get the project outputs: %v", err)
+	}
+
 	result := catalogc.AuditData{
 		BlocksChecked: nblocks,
 		OccFound:      occurences,
 		Blocks:        blocks,
+		Outputs:       outputs,
 	}
 
 	resultBuf, err := protobuf.Encode(&result)
@@ -281,3 +301,48 @@ func auditProject(c *cli.Context) error {
 
 	return nil
 }
+
+// getProjectOutputs returns the outputs recorded on the given project
+// instance. It returns an empty list if the instance does not exist yet.
+func getProjectOutputs(cl *byzcoin.Client, instid string) ([]*catalogc.AuditOutput, error) {
+	instIDBuf, err := hex.DecodeString(instid)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode instance id: %v", err)
+	}
+
+	resp, err := cl.GetProofFromLatest(instIDBuf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	outputs := make([]*catalogc.AuditOutput, 0)
+
+	if !resp.Proof.InclusionProof.Match(instIDBuf) {
+		return outputs, nil
+	}
+
+	var projectData projectc.ProjectData
+	err = projectc.DecodeProjectProof(resp.Proof, instIDBuf, &projectData)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode project instance: %v", err)
+	}
+
+	for _, output := range projectData.Outputs {
+		outputs = append(outputs, &catalogc.AuditOutput{
+			Name:        output.Name,
+			Size:        output.Size,
+			SHA2:        output.SHA2,
+			Destination: output.Destination,
+		})
+	}
+
+	return outputs, nil
+}
+
+// absInt returns the absolute value of n
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
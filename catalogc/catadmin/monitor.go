@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/odyssey/projectc"
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// The monitor follows the chain with the audit index and raises an alert for
+// each suspicious access it finds in the new blocks. The triggers are:
+//
+//  - rejected_reads: too many rejected read requests on a dataset in a time
+//    window
+//  - unexpected_status: a read request from a project whose status is not
+//    "unlocking"
+//  - new_read_key: a read request with a new key from a project that already
+//    read with another key
+
+const (
+	triggerRejectedReads    = "rejected_reads"
+	triggerUnexpectedStatus = "unexpected_status"
+	triggerNewReadKey       = "new_read_key"
+)
+
+// monitorConfig is the configuration of the monitor, read from a TOML file.
+// See monitor.toml.template.
+type monitorConfig struct {
+	// Interval is the time between two updates, like "10s"
+	Interval string
+	// RejectedReads is the number of rejected reads on a dataset in the
+	// RejectedWindow that raises an alert, 0 disables the trigger.
+	RejectedReads  int
+	RejectedWindow string
+	// UnexpectedStatus and NewReadKey enable the other triggers
+	UnexpectedStatus bool
+	NewReadKey       bool
+	Sinks            monitorSinksConfig
+}
+
+// monitorSinksConfig lists where the alerts are sent
+type monitorSinksConfig struct {
+	Log bool
+	// Webhook is an URL that receives the alerts in JSON with POST requests
+	Webhook string
+	Email   *monitorEmailConfig
+}
+
+// monitorEmailConfig describes the SMTP server used to send the alerts
+type monitorEmailConfig struct {
+	// Server is the address of the SMTP server, like "smtp.example.com:587"
+	Server string
+	// Username and Password are optional
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// loadMonitorConfig reads and checks the config of the monitor
+func loadMonitorConfig(path string) (*monitorConfig, error) {
+	conf := &monitorConfig{
+		Interval:         "10s",
+		RejectedReads:    5,
+		RejectedWindow:   "1h",
+		UnexpectedStatus: true,
+		NewReadKey:       true,
+		Sinks:            monitorSinksConfig{Log: true},
+	}
+
+	if path != "" {
+		_, err := toml.DecodeFile(path, conf)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decode the monitor config: %v", err)
+		}
+	}
+
+	_, err := time.ParseDuration(conf.Interval)
+	if err != nil {
+		return nil, xerrors.Errorf("wrong Interval: %v", err)
+	}
+	_, err = time.ParseDuration(conf.RejectedWindow)
+	if err != nil {
+		return nil, xerrors.Errorf("wrong RejectedWindow: %v", err)
+	}
+	if conf.RejectedReads < 0 {
+		return nil, xerrors.Errorf("RejectedReads must be positive, got %d",
+			conf.RejectedReads)
+	}
+
+	return conf, nil
+}
+
+// alert describes a suspicious access found on the chain
+type alert struct {
+	Trigger    string    `json:"trigger"`
+	Message    string    `json:"message"`
+	BlockIndex int       `json:"blockIndex"`
+	Time       time.Time `json:"time"`
+	DatasetID  string    `json:"datasetID"`
+	ProjectID  string    `json:"projectID"`
+}
+
+// String returns a one line description of the alert
+func (a alert) String() string {
+	return fmt.Sprintf("[%s] block %d: %s", a.Trigger, a.BlockIndex, a.Message)
+}
+
+// alertSink is a destination of the alerts
+type alertSink interface {
+	Send(a *alert) error
+}
+
+// logSink writes the alerts to the log
+type logSink struct{}
+
+// Send implements alertSink
+func (logSink) Send(a *alert) error {
+	log.Warn(a.String())
+	return nil
+}
+
+// webhookSink posts the alerts in JSON to an URL
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// Send implements alertSink
+func (s webhookSink) Send(a *alert) error {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return xerrors.Errorf("failed to encode the alert: %v", err)
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return xerrors.Errorf("failed to post the alert: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return xerrors.Errorf("the webhook answered with status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// emailSink sends an email for each alert
+type emailSink struct {
+	conf *monitorEmailConfig
+}
+
+// Send implements alertSink
+func (s emailSink) Send(a *alert) error {
+	var auth smtp.Auth
+	if s.conf.Username != "" {
+		host := strings.Split(s.conf.Server, ":")[0]
+		auth = smtp.PlainAuth("", s.conf.Username, s.conf.Password, host)
+	}
+
+	msg := new(strings.Builder)
+	fmt.Fprintf(msg, "From: %s\r\n", s.conf.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(s.conf.To, ", "))
+	fmt.Fprintf(msg, "Subject: Odyssey alert: %s\r\n\r\n", a.Trigger)
+	fmt.Fprintf(msg, "%s\r\n\r\nBlock: %d\r\nTime: %s\r\nDataset: %s\r\n"+
+		"Project: %s\r\n", a.Message, a.BlockIndex, a.Time, a.DatasetID,
+		a.ProjectID)
+
+	err := smtp.SendMail(s.conf.Server, auth, s.conf.From, s.conf.To,
+		[]byte(msg.String()))
+	if err != nil {
+		return xerrors.Errorf("failed to send the email: %v", err)
+	}
+
+	return nil
+}
+
+// newAlertSinks returns the sinks enabled by the config
+func newAlertSinks(conf monitorSinksConfig) []alertSink {
+	sinks := make([]alertSink, 0)
+	if conf.Log {
+		sinks = append(sinks, logSink{})
+	}
+	if conf.Webhook != "" {
+		sinks = append(sinks, webhookSink{
+			url:    conf.Webhook,
+			client: &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+	if conf.Email != nil {
+		sinks = append(sinks, emailSink{conf: conf.Email})
+	}
+	return sinks
+}
+
+// monitor holds the state needed by the triggers
+type monitor struct {
+	conf           *monitorConfig
+	rejectedWindow time.Duration
+	// getStatus returns the current status of a project, it is used when the
+	// status has not been updated since the monitor started.
+	getStatus func(projectID byzcoin.InstanceID) (string, error)
+	// rejected holds the time of the recent rejected reads of each dataset
+	rejected map[string][]time.Time
+	// statuses holds the status of the projects, as updated on the chain
+	statuses map[string]string
+	// readKeys holds the keys used by the accepted reads of each project
+	readKeys map[string]map[string]bool
+}
+
+// newMonitor returns a monitor without any state
+func newMonitor(conf *monitorConfig,
+	getStatus func(byzcoin.InstanceID) (string, error)) *monitor {
+
+	// The duration has been checked when loading the config
+	window, _ := time.ParseDuration(conf.RejectedWindow)
+
+	return &monitor{
+		conf:           conf,
+		rejectedWindow: window,
+		getStatus:      getStatus,
+		rejected:       make(map[string][]time.Time),
+		statuses:       make(map[string]string),
+		readKeys:       make(map[string]map[string]bool),
+	}
+}
+
+// check updates the state with the instruction of the entry and returns the
+// alerts it raises. The entries must be given in the order of the chain.
+func (m *monitor) check(entry *auditIndexEntry) ([]*alert, error) {
+	instr := entry.Instruction
+
+	if instr.Invoke != nil && instr.Invoke.ContractID == projectc.ContractProjectID &&
+		instr.Invoke.Command == "updateStatus" && entry.Accepted {
+
+		m.statuses[instr.InstanceID.String()] = string(instr.Invoke.Args.Search("status"))
+		return nil, nil
+	}
+
+	if instr.Spawn == nil || instr.Spawn.ContractID != calypso.ContractReadID {
+		return nil, nil
+	}
+
+	at := time.Unix(0, entry.Timestamp)
+	datasetID := instr.InstanceID.String()
+	projectIDBuf := instr.Spawn.Args.Search("projectInstID")
+	projectID := hex.EncodeToString(projectIDBuf)
+
+	newAlert := func(trigger, msg string) *alert {
+		return &alert{
+			Trigger:    trigger,
+			Message:    msg,
+			BlockIndex: entry.BlockIndex,
+			Time:       at,
+			DatasetID:  datasetID,
+			ProjectID:  projectID,
+		}
+	}
+
+	alerts := make([]*alert, 0)
+
+	if !entry.Accepted && m.conf.RejectedReads > 0 {
+		recent := make([]time.Time, 0, len(m.rejected[datasetID])+1)
+		for _, t := range m.rejected[datasetID] {
+			if at.Sub(t) < m.rejectedWindow {
+				recent = append(recent, t)
+			}
+		}
+		recent = append(recent, at)
+
+		if len(recent) >= m.conf.RejectedReads {
+			alerts = append(alerts, newAlert(triggerRejectedReads,
+				fmt.Sprintf("%d rejected reads on dataset %s in less than %s",
+					len(recent), datasetID, m.conf.RejectedWindow)))
+			// We start counting again so that we don't raise an alert for
+			// each of the following rejections.
+			recent = recent[:0]
+		}
+		m.rejected[datasetID] = recent
+	}
+
+	if m.conf.UnexpectedStatus {
+		status, found := m.statuses[projectID]
+		if !found && len(projectIDBuf) == 32 {
+			var err error
+			status, err = m.getStatus(byzcoin.NewInstanceID(projectIDBuf))
+			if err != nil {
+				return nil, xerrors.Errorf("failed to get the status of "+
+					"project %s: %v", projectID, err)
+			}
+			m.statuses[projectID] = status
+		}
+		if status != "unlocking" {
+			alerts = append(alerts, newAlert(triggerUnexpectedStatus,
+				fmt.Sprintf("read on dataset %s (accepted: %v) from project "+
+					"'%s' whose status is '%s'", datasetID, entry.Accepted,
+					projectID, status)))
+		}
+	}
+
+	if m.conf.NewReadKey && entry.Accepted {
+		key, err := getReadKey(instr)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get the read key: %v", err)
+		}
+
+		keys, found := m.readKeys[projectID]
+		if !found {
+			keys = make(map[string]bool)
+			m.readKeys[projectID] = keys
+		}
+		if len(keys) > 0 && !keys[key] {
+			alerts = append(alerts, newAlert(triggerNewReadKey,
+				fmt.Sprintf("project '%s' read dataset %s with the new key %s",
+					projectID, datasetID, key)))
+		}
+		keys[key] = true
+	}
+
+	return alerts, nil
+}
+
+// getReadKey returns the string representation of the key the read request
+// asks the data to be re-encrypted for.
+func getReadKey(instr byzcoin.Instruction) (string, error) {
+	read := calypso.Read{}
+	err := protobuf.DecodeWithConstructors(instr.Spawn.Args.Search("read"),
+		&read, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return "", xerrors.Errorf("failed to decode the read: %v", err)
+	}
+	if read.Xc == nil {
+		return "", xerrors.New("the read has no key")
+	}
+
+	return read.Xc.String(), nil
+}
+
+// monitorIndexPath returns the path of the index used by the monitor, which is
+// stored next to the audit index.
+func monitorIndexPath(cfg lib.Config) string {
+	return filepath.Join(lib.ConfigPath, fmt.Sprintf("monitor-%x.db", cfg.ByzCoinID))
+}
+
+// monitorChain follows the chain and sends an alert to the sinks for each
+// suspicious access in the new blocks.
+func monitorChain(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	conf, err := loadMonitorConfig(c.String("config"))
+	if err != nil {
+		return err
+	}
+	// The duration has been checked when loading the config
+	interval, _ := time.ParseDuration(conf.Interval)
+
+	sinks := newAlertSinks(conf.Sinks)
+	if len(sinks) == 0 {
+		return xerrors.New("no sink enabled, the alerts would be lost")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	// The blocks created before the monitor starts are only indexed. The
+	// monitor keeps its index open for as long as it runs, so it has its own
+	// file in order not to lock out the audit commands.
+	idx, err := loadAuditIndexAt(cl, cfg, monitorIndexPath(cfg))
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	m := newMonitor(conf, func(projectID byzcoin.InstanceID) (string, error) {
+		projectData, err := getProjectData(cl, projectID)
+		if err != nil {
+			return "", err
+		}
+		if projectData == nil {
+			return "not found", nil
+		}
+		return projectData.Status.String(), nil
+	})
+
+	idx.onEntry = func(entry *auditIndexEntry) {
+		alerts, err := m.check(entry)
+		if err != nil {
+			log.Errorf("failed to check the instruction at block %d: %v",
+				entry.BlockIndex, err)
+			return
+		}
+		for _, a := range alerts {
+			for _, sink := range sinks {
+				err = sink.Send(a)
+				if err != nil {
+					log.Errorf("failed to send alert '%s': %v", a, err)
+				}
+			}
+		}
+	}
+
+	log.Infof("monitoring the chain from block %d", idx.blockCount()-1)
+
+	for {
+		time.Sleep(interval)
+
+		err = idx.update(cl, cfg)
+		if err != nil {
+			log.Errorf("failed to update the audit index: %v", err)
+		}
+	}
+}
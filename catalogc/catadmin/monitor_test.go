@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/projectc"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/protobuf"
+)
+
+var (
+	monitorDataset = byzcoin.NewInstanceID([]byte("dataset"))
+	monitorProject = byzcoin.NewInstanceID([]byte("project"))
+)
+
+// newMonitorRead returns the entry of a read request from monitorProject
+func newMonitorRead(t *testing.T, accepted bool, at time.Time,
+	key kyber.Point) *auditIndexEntry {
+
+	readBuf, err := protobuf.Encode(&calypso.Read{Write: monitorDataset, Xc: key})
+	require.NoError(t, err)
+
+	return &auditIndexEntry{
+		BlockIndex: 1,
+		Timestamp:  at.UnixNano(),
+		Accepted:   accepted,
+		Instruction: byzcoin.Instruction{
+			InstanceID: monitorDataset,
+			Spawn: &byzcoin.Spawn{
+				ContractID: calypso.ContractReadID,
+				Args: byzcoin.Arguments{
+					{Name: "read", Value: readBuf},
+					{Name: "projectInstID", Value: monitorProject.Slice()},
+				},
+			},
+		},
+	}
+}
+
+// newMonitorStatus returns the entry of a status update of monitorProject
+func newMonitorStatus(status string) *auditIndexEntry {
+	return &auditIndexEntry{
+		Accepted: true,
+		Instruction: byzcoin.Instruction{
+			InstanceID: monitorProject,
+			Invoke: &byzcoin.Invoke{
+				ContractID: projectc.ContractProjectID,
+				Command:    "updateStatus",
+				Args:       byzcoin.Arguments{{Name: "status", Value: []byte(status)}},
+			},
+		},
+	}
+}
+
+func TestLoadMonitorConfig(t *testing.T) {
+	conf, err := loadMonitorConfig("")
+	require.NoError(t, err)
+	require.Equal(t, 5, conf.RejectedReads)
+	require.True(t, conf.Sinks.Log)
+	require.Nil(t, conf.Sinks.Email)
+
+	dir, err := ioutil.TempDir("", "catadmin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "monitor.toml")
+	err = ioutil.WriteFile(path, []byte("RejectedReads = 2\nNewReadKey = false\n"+
+		"[Sinks]\nWebhook = \"http://localhost/alerts\"\n"), 0644)
+	require.NoError(t, err)
+
+	conf, err = loadMonitorConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, conf.RejectedReads)
+	require.False(t, conf.NewReadKey)
+	require.True(t, conf.UnexpectedStatus)
+	require.Len(t, newAlertSinks(conf.Sinks), 2)
+
+	err = ioutil.WriteFile(path, []byte("RejectedWindow = \"often\"\n"), 0644)
+	require.NoError(t, err)
+	_, err = loadMonitorConfig(path)
+	require.Error(t, err)
+}
+
+func TestMonitor_Check(t *testing.T) {
+	conf, err := loadMonitorConfig("")
+	require.NoError(t, err)
+	conf.RejectedReads = 2
+
+	statusCalls := 0
+	m := newMonitor(conf, func(projectID byzcoin.InstanceID) (string, error) {
+		statusCalls++
+		return "unlocking", nil
+	})
+
+	key1 := darc.NewSignerEd25519(nil, nil).Ed25519.Point
+	key2 := darc.NewSignerEd25519(nil, nil).Ed25519.Point
+	start := time.Now()
+
+	// A normal read, the status is fetched only once
+	alerts, err := m.check(newMonitorRead(t, true, start, key1))
+	require.NoError(t, err)
+	require.Len(t, alerts, 0)
+	alerts, err = m.check(newMonitorRead(t, true, start, key1))
+	require.NoError(t, err)
+	require.Len(t, alerts, 0)
+	require.Equal(t, 1, statusCalls)
+
+	// A burst of rejected reads
+	alerts, err = m.check(newMonitorRead(t, false, start, key1))
+	require.NoError(t, err)
+	require.Len(t, alerts, 0)
+	alerts, err = m.check(newMonitorRead(t, false, start.Add(time.Minute), key1))
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, triggerRejectedReads, alerts[0].Trigger)
+	require.Equal(t, monitorDataset.String(), alerts[0].DatasetID)
+	require.Equal(t, monitorProject.String(), alerts[0].ProjectID)
+
+	// The rejections are too far apart
+	alerts, err = m.check(newMonitorRead(t, false, start.Add(2*time.Hour), key1))
+	require.NoError(t, err)
+	require.Len(t, alerts, 0)
+	alerts, err = m.check(newMonitorRead(t, false, start.Add(4*time.Hour), key1))
+	require.NoError(t, err)
+	require.Len(t, alerts, 0)
+
+	// A new key
+	alerts, err = m.check(newMonitorRead(t, true, start, key2))
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, triggerNewReadKey, alerts[0].Trigger)
+
+	// A read after the project has been unlocked
+	alerts, err = m.check(newMonitorStatus("unlockedOK"))
+	require.NoError(t, err)
+	require.Len(t, alerts, 0)
+	alerts, err = m.check(newMonitorRead(t, true, start, key2))
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Equal(t, triggerUnexpectedStatus, alerts[0].Trigger)
+	require.Contains(t, alerts[0].Message, "unlockedOK")
+	require.Equal(t, 1, statusCalls)
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/catalogc/catadmin/clicontracts"
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/dedis/odyssey/cryptutil/envelope"
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/minio/minio-go/v6"
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// Publishing a dataset runs the same steps as the upload of the data owner
+// manager:
+//
+//  1. create the Calypso write that holds the key of the dataset, with the
+//     cloud URL in its extra data
+//  2. encrypt the dataset in the chunked format and upload it on the cloud,
+//     along with its manifest signed by the owner
+//  3. add the dataset to its owner in the catalog
+//
+// The progress is saved in a state file after each step, so that running the
+// same command again after a failure resumes from the last step done. The
+// state file holds the key of the dataset: it is only readable by its owner
+// and is removed once the dataset is in the catalog.
+
+// publishState is the progress of the publication of a dataset
+type publishState struct {
+	File          string
+	ObjectName    string
+	CloudURL      string
+	KeyAndInitVal string
+	// WriteID is saved before the write is sent, so that a write accepted
+	// after a timeout is found by the next run
+	WriteID  string
+	Uploaded bool
+	SHA2     string
+	Manifest *envelope.SignedManifest
+}
+
+// newPublishState returns the state of a new publication. The name of the
+// object on the cloud follows the one used by the data owner manager.
+func newPublishState(file, identityStr, title string,
+	now time.Time) *publishState {
+
+	objectName := fmt.Sprintf("%s_%s_%s%s.aes", identityStr,
+		now.Format("2006_01_02_030405"), url.QueryEscape(title),
+		filepath.Ext(file))
+
+	return &publishState{
+		File:       file,
+		ObjectName: objectName,
+		CloudURL:   "dedis/datasets/" + objectName,
+	}
+}
+
+// loadPublishState reads the state file, and returns nil if it doesn't exist
+func loadPublishState(path string) (*publishState, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the state file: %v", err)
+	}
+
+	state := &publishState{}
+	err = json.Unmarshal(buf, state)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the state file: %v", err)
+	}
+
+	return state, nil
+}
+
+// save writes the state file
+func (s *publishState) save(path string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("failed to encode the state: %v", err)
+	}
+
+	err = ioutil.WriteFile(path, buf, 0600)
+	if err != nil {
+		return xerrors.Errorf("failed to write the state file: %v", err)
+	}
+
+	return nil
+}
+
+// publisher runs the steps of a publication. The functions that talk to the
+// chain and to the cloud are fields so that they can be replaced in the tests.
+type publisher struct {
+	state       *publishState
+	statePath   string
+	catalogID   string
+	identityStr string
+	title       string
+	description string
+	bucket      string
+	compression chunked.Compression
+	out         io.Writer
+
+	// writeExists tells if the write instance is on the chain
+	writeExists func(writeID []byte) (bool, error)
+	// createWrite creates a write with the secret and the extra data. It
+	// calls save with the ID of the write before sending the transaction.
+	createWrite func(secret []byte, extraData string,
+		save func(writeID []byte) error) error
+	// upload stores the data read from r on the cloud
+	upload func(bucket, name string, r io.Reader) error
+	// sign signs a message with the key of the owner
+	sign func(msg []byte) ([]byte, error)
+	// datasetExists tells if the owner already has the dataset, and fails
+	// if the owner is not in the catalog
+	datasetExists func(writeID string) (bool, error)
+	// addDataset adds the dataset to the owner in the catalog
+	addDataset func(writeID string, dataset catalogc.Dataset) error
+}
+
+// run publishes the dataset, starting from the last step saved in the state
+func (p *publisher) run() error {
+	// Fails early if the owner is not in the catalog, and skips everything
+	// if a previous run only failed to remove the state file.
+	registered, err := p.datasetExists(p.state.WriteID)
+	if err != nil {
+		return xerrors.Errorf("failed to check the catalog: %v", err)
+	}
+
+	if !registered {
+		err = p.publish()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(p.out, "Dataset published!\n")
+	fmt.Fprintf(p.out, "Calypso write ID: %s\n", p.state.WriteID)
+	fmt.Fprintf(p.out, "Catalog ID: %s\n", p.catalogID)
+	fmt.Fprintf(p.out, "Cloud URL: %s\n", p.state.CloudURL)
+	fmt.Fprintf(p.out, "SHA2: %s\n", p.state.SHA2)
+
+	err = os.Remove(p.statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to remove the state file: %v", err)
+	}
+
+	return nil
+}
+
+// publish creates the write, uploads the dataset and adds it to the catalog
+func (p *publisher) publish() error {
+	var env *envelope.Envelope
+	var err error
+
+	if p.state.KeyAndInitVal == "" {
+		env, err = envelope.New(chunked.AES128GCM)
+	} else {
+		env, err = envelope.Decode(p.state.KeyAndInitVal)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to get the envelope: %v", err)
+	}
+	p.state.KeyAndInitVal = env.String()
+
+	if p.state.WriteID != "" {
+		writeIDBuf, err := hex.DecodeString(p.state.WriteID)
+		if err != nil {
+			return xerrors.Errorf("failed to decode the write ID: %v", err)
+		}
+		exists, err := p.writeExists(writeIDBuf)
+		if err != nil {
+			return xerrors.Errorf("failed to check the write: %v", err)
+		}
+		if exists {
+			log.Info("using the Calypso write of the previous run: " +
+				p.state.WriteID)
+		} else {
+			log.Info("the Calypso write of the previous run was not " +
+				"created, creating a new one")
+			p.state.WriteID = ""
+		}
+	}
+
+	if p.state.WriteID == "" {
+		log.Info("creating the Calypso write")
+
+		// Like the data owner manager, the enclave gets the cloud URL, the
+		// manifest URL and the owner by parsing the extra data.
+		extraData := "\"CloudURL\": \"" + p.state.CloudURL +
+			"\", \"ManifestURL\": \"" + p.state.CloudURL +
+			envelope.ManifestExtension + "\", \"IdentityStr\": \"" +
+			p.identityStr + "\""
+		secret := append(append([]byte{}, env.Key...), env.Nonce...)
+
+		err = p.createWrite(secret, extraData, func(writeID []byte) error {
+			p.state.WriteID = hex.EncodeToString(writeID)
+			p.state.Uploaded = false
+			return p.state.save(p.statePath)
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to create the write: %v", err)
+		}
+	}
+
+	if !p.state.Uploaded {
+		log.Info("encrypting and uploading the dataset to " + p.state.CloudURL)
+
+		manifest, err := p.encryptAndUpload(env)
+		if err != nil {
+			return xerrors.Errorf("failed to upload the dataset: %v", err)
+		}
+
+		signed, err := signManifestWith(p.sign, *manifest)
+		if err != nil {
+			return err
+		}
+
+		log.Info("uploading the manifest")
+
+		manifestBuf, err := json.Marshal(signed)
+		if err != nil {
+			return xerrors.Errorf("failed to encode the manifest: %v", err)
+		}
+		err = p.upload(p.bucket, p.state.ObjectName+envelope.ManifestExtension,
+			bytes.NewReader(manifestBuf))
+		if err != nil {
+			return xerrors.Errorf("failed to upload the manifest: %v", err)
+		}
+
+		p.state.Uploaded = true
+		p.state.SHA2 = manifest.PlaintextSHA2
+		p.state.Manifest = signed
+		err = p.state.save(p.statePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("adding the dataset to the catalog")
+
+	err = p.addDataset(p.state.WriteID, catalogc.Dataset{
+		Title:       p.title,
+		Description: p.description,
+		CloudURL:    p.state.CloudURL,
+		SHA2:        p.state.SHA2,
+		Manifest:    p.state.Manifest,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to add the dataset: %v", err)
+	}
+
+	return nil
+}
+
+// encryptAndUpload encrypts the file as a stream while it is uploaded, and
+// returns the manifest of the encrypted file. A resumed publication keeps the
+// key of the write, so each attempt uses a new random nonce prefix: the file
+// might have changed since the previous attempt, whose upload might have been
+// kept by the cloud.
+func (p *publisher) encryptAndUpload(env *envelope.Envelope) (*envelope.Manifest, error) {
+	file, err := os.Open(p.state.File)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open the dataset: %v", err)
+	}
+	defer file.Close()
+
+	writeIDBuf, err := hex.DecodeString(p.state.WriteID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the write ID: %v", err)
+	}
+
+	noncePrefix := make([]byte, chunked.NoncePrefixSize)
+	_, err = rand.Read(noncePrefix)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate the nonce prefix: %v",
+			err)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	errChan := make(chan error, 1)
+	var manifest *envelope.Manifest
+
+	go func() {
+		var err error
+		manifest, err = env.EncryptManifest(pipeWriter, file, envelope.Options{
+			DatasetID:   writeIDBuf,
+			Compression: p.compression,
+			NoncePrefix: noncePrefix,
+		})
+		pipeWriter.CloseWithError(err)
+		errChan <- err
+	}()
+
+	err = p.upload(p.bucket, p.state.ObjectName, pipeReader)
+	// Unblocks the encryption if the upload stopped early
+	pipeReader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = <-errChan
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encrypt: %v", err)
+	}
+
+	return manifest, nil
+}
+
+// signManifestWith signs the manifest with the given signing function
+func signManifestWith(sign func([]byte) ([]byte, error),
+	manifest envelope.Manifest) (*envelope.SignedManifest, error) {
+
+	signature, err := sign(manifest.Message())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign the manifest: %v", err)
+	}
+
+	return &envelope.SignedManifest{
+		Manifest:  manifest,
+		Signature: hex.EncodeToString(signature),
+	}, nil
+}
+
+// signManifest signs the manifest of a dataset and prints it in JSON
+func signManifest(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	manifestJSON := c.String("manifest")
+	if manifestJSON == "" {
+		return xerrors.New("please provide the manifest with --manifest")
+	}
+	manifest := envelope.Manifest{}
+	err := json.Unmarshal([]byte(manifestJSON), &manifest)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the manifest: %v", err)
+	}
+
+	cfg, _, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+
+	signed, err := signManifestWith(signer.Sign, manifest)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(c.App.Writer).Encode(signed)
+}
+
+// publishDataset encrypts a dataset, uploads it, creates its Calypso write
+// and adds it to the catalog
+func publishDataset(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	catalogID := c.String("instid")
+	if catalogID == "" {
+		return xerrors.New("please provide the catalog instance ID with --instid")
+	}
+	catalogIDBuf, err := hex.DecodeString(catalogID)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the catalog ID: %v", err)
+	}
+
+	file := c.String("file")
+	if file == "" {
+		return xerrors.New("please provide the dataset with --file")
+	}
+
+	title := c.String("title")
+	if title == "" {
+		return xerrors.New("please provide the title with --title")
+	}
+
+	description := c.String("description")
+	if description == "" {
+		return xerrors.New("please provide the description with --description")
+	}
+
+	ltsIDBuf, err := hex.DecodeString(c.String("ltsid"))
+	if err != nil || len(ltsIDBuf) != 32 {
+		return xerrors.New("please provide the LTS instance ID with --ltsid")
+	}
+
+	ltsKeyBuf, err := hex.DecodeString(c.String("ltskey"))
+	if err != nil {
+		return xerrors.Errorf("failed to decode the LTS key: %v", err)
+	}
+	ltsKey := cothority.Suite.Point()
+	err = ltsKey.UnmarshalBinary(ltsKeyBuf)
+	if err != nil {
+		return xerrors.Errorf("please provide the LTS key with --ltskey: %v", err)
+	}
+
+	compression, err := chunked.CompressionFromString(c.String("compress"))
+	if err != nil {
+		return xerrors.Errorf("failed to get the compression: %v", err)
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	dstr := c.String("darc")
+	if dstr == "" {
+		return xerrors.New("please provide the DARC of the dataset with --darc")
+	}
+	d, err := lib.GetDarcByString(cl, dstr)
+	if err != nil {
+		return xerrors.Errorf("failed to get the darc: %v", err)
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to parse the signer: %v", err)
+	}
+
+	// The owner signs the manifest, which is checked by the catalog
+	identityStr := signer.Identity().String()
+
+	cloudClient, err := helpers.NewMinioCloudClient()
+	if err != nil {
+		return xerrors.Errorf("failed to get the cloud client: %v", err)
+	}
+
+	statePath := c.String("state")
+	if statePath == "" {
+		statePath = file + ".publish.json"
+	}
+
+	state, err := loadPublishState(statePath)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = newPublishState(file, identityStr, title, time.Now())
+	} else if state.File != file {
+		return xerrors.Errorf("the state file %s is for %s, not %s",
+			statePath, state.File, file)
+	} else {
+		log.Info("resuming the publication from " + statePath)
+	}
+
+	p := &publisher{
+		state:       state,
+		statePath:   statePath,
+		catalogID:   catalogID,
+		identityStr: identityStr,
+		title:       title,
+		description: description,
+		bucket:      c.String("bucket"),
+		compression: compression,
+		out:         os.Stdout,
+
+		writeExists: func(writeID []byte) (bool, error) {
+			pr, err := cl.GetProofFromLatest(writeID)
+			if err != nil {
+				return false, xerrors.Errorf("couldn't get proof: %v", err)
+			}
+			if !pr.Proof.InclusionProof.Match(writeID) {
+				return false, nil
+			}
+			_, contractID, _, err := pr.Proof.Get(writeID)
+			if err != nil {
+				return false, xerrors.Errorf("failed to get the instance: %v", err)
+			}
+			if contractID != calypso.ContractWriteID {
+				return false, xerrors.Errorf("instance %x is a %s, not a write",
+					writeID, contractID)
+			}
+			return true, nil
+		},
+
+		createWrite: func(secret []byte, extraData string,
+			save func([]byte) error) error {
+
+			write := calypso.NewWrite(cothority.Suite,
+				byzcoin.NewInstanceID(ltsIDBuf), d.GetBaseID(), ltsKey, secret)
+			write.ExtraData = []byte(extraData)
+
+			writeBuf, err := protobuf.Encode(write)
+			if err != nil {
+				return xerrors.Errorf("failed to encode the write: %v", err)
+			}
+
+			counters, err := cl.GetSignerCounters(signer.Identity().String())
+			if err != nil {
+				return xerrors.Errorf("failed to get counters: %v", err)
+			}
+
+			ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+				InstanceID: byzcoin.NewInstanceID(d.GetBaseID()),
+				Spawn: &byzcoin.Spawn{
+					ContractID: calypso.ContractWriteID,
+					Args: byzcoin.Arguments{
+						{Name: "write", Value: writeBuf},
+					},
+				},
+				SignerCounter: []uint64{counters.Counters[0] + 1},
+			})
+			if err != nil {
+				return xerrors.Errorf("failed to create transaction: %v", err)
+			}
+
+			err = ctx.FillSignersAndSignWith(*signer)
+			if err != nil {
+				return xerrors.Errorf("failed to sign transaction: %v", err)
+			}
+
+			err = save(ctx.Instructions[0].DeriveID("").Slice())
+			if err != nil {
+				return err
+			}
+
+			_, err = cl.AddTransactionAndWait(ctx, 10)
+			if err != nil {
+				return xerrors.Errorf("failed to add transaction: %v", err)
+			}
+
+			return nil
+		},
+
+		upload: func(bucket, name string, r io.Reader) error {
+			_, err := cloudClient.PutObject(bucket, name, r, -1,
+				minio.PutObjectOptions{})
+			return err
+		},
+
+		sign: signer.Sign,
+
+		datasetExists: func(writeID string) (bool, error) {
+			pr, err := cl.GetProofFromLatest(catalogIDBuf)
+			if err != nil {
+				return false, xerrors.Errorf("couldn't get proof: %v", err)
+			}
+
+			var catalogData catalogc.CatalogData
+			err = catalogc.DecodeCatalogProof(pr.Proof, catalogIDBuf,
+				&catalogData)
+			if err != nil {
+				return false, xerrors.Errorf("couldn't get a catalog instance: %v", err)
+			}
+
+			owner := catalogData.GetOwner(identityStr)
+			if owner == nil {
+				return false, xerrors.Errorf("owner with identity '%s' not "+
+					"found", identityStr)
+			}
+
+			return writeID != "" && owner.GetDataset(writeID) != nil, nil
+		},
+
+		addDataset: func(writeID string, dataset catalogc.Dataset) error {
+			return clicontracts.AddDataset(cl, *signer,
+				byzcoin.NewInstanceID(catalogIDBuf), identityStr, writeID, dataset)
+		},
+	}
+
+	err = p.run()
+	if err != nil {
+		return xerrors.Errorf("failed to publish, run the same command to "+
+			"resume: %v", err)
+	}
+
+	return lib.WaitPropagation(c, cl)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/dedis/odyssey/cryptutil/envelope"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// fakePublishChain keeps the writes, the uploads and the datasets of the
+// publisher in memory, and fails the steps on demand
+type fakePublishChain struct {
+	writes   map[string][]byte
+	uploads  map[string][]byte
+	datasets map[string]catalogc.Dataset
+
+	writeCount  int
+	uploadCount int
+
+	failWrite  bool
+	failUpload bool
+	failAdd    bool
+	// failAfterUpload fails the uploads once the data has been stored, like
+	// a connection lost before the response of the cloud
+	failAfterUpload bool
+}
+
+func newFakePublishChain() *fakePublishChain {
+	return &fakePublishChain{
+		writes:   make(map[string][]byte),
+		uploads:  make(map[string][]byte),
+		datasets: make(map[string]catalogc.Dataset),
+	}
+}
+
+// newPublisher returns a publisher of the file that uses the fake chain
+func (f *fakePublishChain) newPublisher(file, statePath string,
+	out io.Writer) (*publisher, error) {
+
+	state, err := loadPublishState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		state = newPublishState(file, "ed25519:aef123", "my title",
+			time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	}
+
+	return &publisher{
+		state:       state,
+		statePath:   statePath,
+		catalogID:   "cc",
+		identityStr: "ed25519:aef123",
+		title:       "my title",
+		description: "my description",
+		bucket:      "datasets",
+		compression: chunked.Gzip,
+		out:         out,
+
+		writeExists: func(writeID []byte) (bool, error) {
+			_, ok := f.writes[hex.EncodeToString(writeID)]
+			return ok, nil
+		},
+		createWrite: func(secret []byte, extraData string,
+			save func([]byte) error) error {
+
+			f.writeCount++
+			writeID := bytes.Repeat([]byte{byte(f.writeCount)}, 32)
+			err := save(writeID)
+			if err != nil {
+				return err
+			}
+			if f.failWrite {
+				return xerrors.New("write failed")
+			}
+			f.writes[hex.EncodeToString(writeID)] = secret
+			return nil
+		},
+		upload: func(bucket, name string, r io.Reader) error {
+			f.uploadCount++
+			if f.failUpload {
+				return xerrors.New("upload failed")
+			}
+			buf, err := ioutil.ReadAll(r)
+			f.uploads[bucket+"/"+name] = buf
+			if err == nil && f.failAfterUpload {
+				return xerrors.New("upload failed")
+			}
+			return err
+		},
+		sign: func(msg []byte) ([]byte, error) {
+			return []byte("signature"), nil
+		},
+		datasetExists: func(writeID string) (bool, error) {
+			_, ok := f.datasets[writeID]
+			return ok, nil
+		},
+		addDataset: func(writeID string, dataset catalogc.Dataset) error {
+			if f.failAdd {
+				return xerrors.New("add failed")
+			}
+			f.datasets[writeID] = dataset
+			return nil
+		},
+	}, nil
+}
+
+// checkPublished checks that the dataset can be decrypted with the secret of
+// its write
+func (f *fakePublishChain) checkPublished(t *testing.T, writeID string,
+	data []byte) {
+
+	dataset, ok := f.datasets[writeID]
+	require.True(t, ok)
+	require.Equal(t, "my title", dataset.Title)
+	require.Equal(t, "dedis/datasets/ed25519:aef123_2020_01_02_030405_my+title.csv.aes",
+		dataset.CloudURL)
+
+	secret := f.writes[writeID]
+	env, err := envelope.Decode(hex.EncodeToString(secret))
+	require.NoError(t, err)
+
+	writeIDBuf, err := hex.DecodeString(writeID)
+	require.NoError(t, err)
+
+	encrypted := f.uploads["datasets/ed25519:aef123_2020_01_02_030405_my+title.csv.aes"]
+	r, err := env.NewReader(bytes.NewReader(encrypted), writeIDBuf)
+	require.NoError(t, err)
+	decrypted, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	sha2, err := envelope.Hash(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(sha2), dataset.SHA2)
+
+	// The signed manifest is in the catalog and next to the dataset
+	require.NotNil(t, dataset.Manifest)
+	require.Equal(t, hex.EncodeToString([]byte("signature")),
+		dataset.Manifest.Signature)
+	require.True(t, dataset.Manifest.Manifest.IsManifestOf(writeID, dataset.SHA2))
+	require.NoError(t, dataset.Manifest.Manifest.Check(bytes.NewReader(encrypted)))
+
+	manifest := &envelope.SignedManifest{}
+	err = json.Unmarshal(f.uploads["datasets/ed25519:aef123_2020_01_02_030405_my+title.csv.aes.manifest"],
+		manifest)
+	require.NoError(t, err)
+	require.Equal(t, dataset.Manifest, manifest)
+}
+
+func TestPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publish")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "data.csv")
+	data := bytes.Repeat([]byte("a,b,c\n"), 1000)
+	require.NoError(t, ioutil.WriteFile(file, data, 0644))
+	statePath := file + ".publish.json"
+
+	f := newFakePublishChain()
+	out := new(bytes.Buffer)
+	p, err := f.newPublisher(file, statePath, out)
+	require.NoError(t, err)
+
+	err = p.run()
+	require.NoError(t, err)
+
+	writeID := hex.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	f.checkPublished(t, writeID, data)
+	require.Contains(t, out.String(), "Calypso write ID: "+writeID)
+	require.Contains(t, out.String(), "Catalog ID: cc")
+
+	_, err = os.Stat(statePath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestPublish_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publish")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "data.csv")
+	data := bytes.Repeat([]byte("a,b,c\n"), 1000)
+	require.NoError(t, ioutil.WriteFile(file, data, 0644))
+	statePath := file + ".publish.json"
+	writeID := hex.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+	f := newFakePublishChain()
+	f.failUpload = true
+
+	p, err := f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	err = p.run()
+	require.EqualError(t, err, "failed to upload the dataset: upload failed")
+
+	// The write is saved and only readable by the owner
+	info, err := os.Stat(statePath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	f.failUpload = false
+	f.failAdd = true
+
+	p, err = f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	require.Equal(t, writeID, p.state.WriteID)
+	err = p.run()
+	require.EqualError(t, err, "failed to add the dataset: add failed")
+
+	f.failAdd = false
+
+	p, err = f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	require.True(t, p.state.Uploaded)
+	err = p.run()
+	require.NoError(t, err)
+
+	// The write and the uploads are not done again
+	require.Equal(t, 1, f.writeCount)
+	require.Equal(t, 3, f.uploadCount)
+	f.checkPublished(t, writeID, data)
+}
+
+func TestPublish_LostWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publish")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "data.csv")
+	data := []byte("a,b,c\n")
+	require.NoError(t, ioutil.WriteFile(file, data, 0644))
+	statePath := file + ".publish.json"
+
+	// The write is saved in the state but never reaches the chain
+	f := newFakePublishChain()
+	f.failWrite = true
+
+	p, err := f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	err = p.run()
+	require.EqualError(t, err, "failed to create the write: write failed")
+
+	f.failWrite = false
+
+	p, err = f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	err = p.run()
+	require.NoError(t, err)
+
+	require.Equal(t, 2, f.writeCount)
+	require.Equal(t, 2, f.uploadCount)
+	f.checkPublished(t, hex.EncodeToString(bytes.Repeat([]byte{2}, 32)), data)
+}
+
+func TestPublish_ResumeNewNonce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publish")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "data.csv")
+	data := bytes.Repeat([]byte("a,b,c\n"), 1000)
+	require.NoError(t, ioutil.WriteFile(file, data, 0644))
+	statePath := file + ".publish.json"
+	object := "datasets/ed25519:aef123_2020_01_02_030405_my+title.csv.aes"
+
+	// The cloud keeps the upload of the first attempt
+	f := newFakePublishChain()
+	f.failAfterUpload = true
+
+	p, err := f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	err = p.run()
+	require.EqualError(t, err, "failed to upload the dataset: upload failed")
+
+	firstHeader, err := chunked.ReadHeader(bytes.NewReader(f.uploads[object]))
+	require.NoError(t, err)
+
+	// The file changes before the publication is resumed with the same key
+	data = bytes.Repeat([]byte("d,e,f\n"), 1000)
+	require.NoError(t, ioutil.WriteFile(file, data, 0644))
+	f.failAfterUpload = false
+
+	p, err = f.newPublisher(file, statePath, ioutil.Discard)
+	require.NoError(t, err)
+	err = p.run()
+	require.NoError(t, err)
+
+	secondHeader, err := chunked.ReadHeader(bytes.NewReader(f.uploads[object]))
+	require.NoError(t, err)
+	require.NotEqual(t, firstHeader.NoncePrefix, secondHeader.NoncePrefix)
+
+	require.Equal(t, 1, f.writeCount)
+	f.checkPublished(t, hex.EncodeToString(bytes.Repeat([]byte{1}, 32)), data)
+}
@@ -27,7 +27,7 @@ type contractCatalog struct {
 
 func contractCatalogFromBytes(in []byte) (byzcoin.Contract, error) {
 	cc := &contractCatalog{}
-	err := protobuf.Decode(in, &cc.CatalogData)
+	err := DecodeCatalogData(in, &cc.CatalogData)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +46,7 @@ func (c *contractCatalog) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Inst
 		return
 	}
 
-	catalogData := CatalogData{}
+	catalogData := CatalogData{Version: CatalogDataVersion}
 	catalogDataBuf, err := protobuf.Encode(&catalogData)
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to encode the catalog data: %v", err)
@@ -230,6 +230,11 @@ func (c *contractCatalog) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 		// By default a dataset is not in an "archived" state
 		dataset.IsArchived = false
 
+		err = dataset.VerifyManifest()
+		if err != nil {
+			return nil, nil, xerrors.Errorf("wrong manifest: %v", err)
+		}
+
 		err = owner.AddDataset(dataset)
 		if err != nil {
 			return nil, nil, xerrors.Errorf("failed to add dataset: %v", err)
@@ -294,6 +299,11 @@ func (c *contractCatalog) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 			dataset.CalypsoWriteID = newCalypsoWriteID
 		}
 
+		err = dataset.VerifyManifest()
+		if err != nil {
+			return nil, nil, xerrors.Errorf("wrong manifest: %v", err)
+		}
+
 		err = owner.ReplaceDataset(calypsoWriteID, dataset)
 		if err != nil {
 			return nil, nil, xerrors.Errorf("failed to replace dataset: %v", err)
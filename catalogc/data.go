@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/dedis/odyssey/cryptutil/envelope"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"golang.org/x/xerrors"
 )
@@ -13,6 +15,10 @@ import (
 type CatalogData struct {
 	Owners   []*Owner
 	Metadata *Metadata
+	// Version is the version of the encoding, see DecodeCatalogData. It must
+	// stay the last field and keep its explicit tag so that it can be read
+	// from any version of the encoding.
+	Version uint32 `protobuf:"100"`
 }
 
 // String returns a human readable string representation of the project data
@@ -40,6 +46,17 @@ func (cd CatalogData) GetOwner(identityStr string) *Owner {
 	return nil
 }
 
+// GetDatasetOwner returns the owner of the dataset that has the given calypso
+// write ID, or nil
+func (cd CatalogData) GetDatasetOwner(calypsoWriteID string) *Owner {
+	for _, owner := range cd.Owners {
+		if owner != nil && owner.GetDataset(calypsoWriteID) != nil {
+			return owner
+		}
+	}
+	return nil
+}
+
 // AddOwner adds a new owner if not already present
 func (cd *CatalogData) AddOwner(owner *Owner) error {
 	foundOwner := cd.GetOwner(owner.IdentityStr)
@@ -196,6 +213,9 @@ type Dataset struct {
 	SHA2        string    `json:"sha2"`
 	IsArchived  bool      `json:"is_archived"`
 	Metadata    *Metadata `json:"metadata"`
+	// Manifest is signed by the owner and describes the encrypted dataset on
+	// the cloud. It is nil for the datasets published before the manifests.
+	Manifest *envelope.SignedManifest `json:"manifest"`
 }
 
 // String returns a human readable string representation of a datasets
@@ -209,6 +229,17 @@ func (d Dataset) String() string {
 	fmt.Fprintf(out, "-- SHA2: %s\n", d.SHA2)
 	fmt.Fprintf(out, "-- IdentityStr: %s\n", d.IdentityStr)
 	fmt.Fprintf(out, "-- IsArchived: %v\n", d.IsArchived)
+	if d.Manifest != nil {
+		out.WriteString("-- Manifest:\n")
+		fmt.Fprintf(out, "--- CiphertextSHA2: %s\n", d.Manifest.Manifest.CiphertextSHA2)
+		fmt.Fprintf(out, "--- Size: %d\n", d.Manifest.Manifest.Size)
+		fmt.Fprintf(out, "--- Version: %d\n", d.Manifest.Manifest.Version)
+		fmt.Fprintf(out, "--- Signature: %s\n", d.Manifest.Signature)
+		for _, f := range d.Manifest.Manifest.Files {
+			fmt.Fprintf(out, "--- File: %s (%d bytes, SHA2 %s)\n", f.Path,
+				f.Size, f.PlaintextSHA2)
+		}
+	}
 	out.WriteString("-- Metadata:\n")
 	if d.Metadata != nil {
 		out.WriteString(eachLine.ReplaceAllString(d.Metadata.String(), "--$1"))
@@ -216,6 +247,34 @@ func (d Dataset) String() string {
 	return out.String()
 }
 
+// VerifyManifest checks that the manifest is signed by the owner and that it
+// describes this dataset. It returns nil if the dataset has no manifest.
+func (d Dataset) VerifyManifest() error {
+	if d.Manifest == nil {
+		return nil
+	}
+
+	if !d.Manifest.Manifest.IsManifestOf(d.CalypsoWriteID, d.SHA2) {
+		return xerrors.Errorf("the manifest is the one of dataset %s with "+
+			"SHA2 %s, not %s with SHA2 %s", d.Manifest.Manifest.DatasetID,
+			d.Manifest.Manifest.PlaintextSHA2, d.CalypsoWriteID, d.SHA2)
+	}
+
+	if d.Manifest.Manifest.IsMultiFile() {
+		err := d.Manifest.Manifest.CheckFileList()
+		if err != nil {
+			return xerrors.Errorf("wrong files in the manifest: %v", err)
+		}
+	}
+
+	err := d.Manifest.Verify(d.IdentityStr)
+	if err != nil {
+		return xerrors.Errorf("failed to verify the manifest: %v", err)
+	}
+
+	return nil
+}
+
 // DelegatedForm prints the form where the data scientist has to agree on custum
 // text attributes that can not be automatically checked. It fills the value
 // attribute if it finds an attribute that has the same id in the given metadata
@@ -363,10 +422,13 @@ func (m *Metadata) Reset() {
 }
 
 // Darc print the DARC representation of the metadata. Outputs something like
-// "attr:allowed:ID1=value1&ID2=value2& attr:must_have:ID2=value2&ID3=value3"
+// "attr:allowed:ID1=value1&ID2=value2& attr:must_have:ID2=value2&ID3=value3".
+// The "rate_limit" rule is only added if a rate limit attribute is set, ie.
+// "& attr:rate_limit:ID4=1%2Funlock&".
 func (m Metadata) Darc(calypsoWriteID string) string {
 	allowedAttr := m.GetActiveAttributesByRuleType("allowed")
 	mustHaveAttr := m.GetActiveAttributesByRuleType("must_have")
+	rateLimitAttr := m.GetActiveAttributesByRuleType("rate_limit")
 
 	outAllowed := new(strings.Builder)
 	outMustHave := new(strings.Builder)
@@ -383,7 +445,18 @@ func (m Metadata) Darc(calypsoWriteID string) string {
 	for _, attr := range allowedAttr {
 		outAllowed.WriteString(attr.Darc(calypsoWriteID))
 	}
-	outAllowed.WriteString(outMustHave.String() + " )")
+	outAllowed.WriteString(outMustHave.String())
+
+	// The value of a rate limit is not compared with the project, so it
+	// doesn't need to be made unique with the calypso write ID.
+	if len(rateLimitAttr) > 0 {
+		outAllowed.WriteString(" & attr:rate_limit:")
+		for _, attr := range rateLimitAttr {
+			outAllowed.WriteString(attr.ID + "=" + url.QueryEscape(attr.Value) + "&")
+		}
+	}
+
+	outAllowed.WriteString(" )")
 	return outAllowed.String()
 }
 
@@ -877,6 +950,17 @@ type AuditData struct {
 	OccFound int
 	// Blocks contains the list of audit blocks
 	Blocks []*AuditBlock
+	// Outputs contains the list of outputs that left the enclave, as recorded
+	// on the project instance. Only filled when auditing a project.
+	Outputs []*AuditOutput
+}
+
+// AuditOutput describes an output that has been exported from an enclave
+type AuditOutput struct {
+	Name        string
+	Size        uint64
+	SHA2        string
+	Destination string
 }
 
 // AuditBlock is a tailored version of a skipblock that we need to display
@@ -899,3 +983,37 @@ type AuditTransaction struct {
 	Accepted     bool
 	Instructions []*byzcoin.Instruction
 }
+
+// OwnerAudit is used by the catadmin cli to return the accesses performed on
+// all the datasets of an owner, grouped by project.
+type OwnerAudit struct {
+	IdentityStr string `json:"identityStr"`
+	// BlocksChecked is the number of blocks checked
+	BlocksChecked int                  `json:"blocksChecked"`
+	Datasets      []*OwnerAuditDataset `json:"datasets"`
+	Projects      []*OwnerAuditProject `json:"projects"`
+}
+
+// OwnerAuditDataset summarizes the read requests on a dataset of the owner
+type OwnerAuditDataset struct {
+	CalypsoWriteID string `json:"calypsoWriteID"`
+	Title          string `json:"title"`
+	Accepted       int    `json:"accepted"`
+	Refused        int    `json:"refused"`
+}
+
+// OwnerAuditProject summarizes the read requests of a project on the datasets
+// of an owner. The time range goes from the first to the last request.
+type OwnerAuditProject struct {
+	ProjectInstanceID string `json:"projectInstanceID"`
+	// Title and RequesterIdentity are empty if the project instance can't be
+	// found.
+	Title             string    `json:"title"`
+	RequesterIdentity string    `json:"requesterIdentity"`
+	Requesters        []string  `json:"requesters"`
+	Datasets          []string  `json:"datasets"`
+	Accepted          int       `json:"accepted"`
+	Refused           int       `json:"refused"`
+	FirstRequest      time.Time `json:"firstRequest"`
+	LastRequest       time.Time `json:"lastRequest"`
+}
@@ -0,0 +1,67 @@
+package catalogc
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/dedis/odyssey/cryptutil/envelope"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestDataset_VerifyManifest(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+
+	manifest := envelope.Manifest{
+		DatasetID:      "abcdef1234",
+		CiphertextSHA2: "aa",
+		PlaintextSHA2:  "abcd",
+		Size:           42,
+		Version:        3,
+	}
+	signature, err := signer.Sign(manifest.Message())
+	require.NoError(t, err)
+
+	dataset := Dataset{
+		Title:          "title",
+		CalypsoWriteID: "abcdef1234",
+		IdentityStr:    signer.Identity().String(),
+		SHA2:           "abcd",
+	}
+
+	// Datasets without a manifest are not checked
+	require.NoError(t, dataset.VerifyManifest())
+
+	dataset.Manifest = &envelope.SignedManifest{
+		Manifest:  manifest,
+		Signature: hex.EncodeToString(signature),
+	}
+	require.NoError(t, dataset.VerifyManifest())
+
+	// The manifest of another dataset
+	other := dataset
+	other.SHA2 = "abcdef"
+	err = other.VerifyManifest()
+	require.EqualError(t, err, "the manifest is the one of dataset abcdef1234 "+
+		"with SHA2 abcd, not abcdef1234 with SHA2 abcdef")
+
+	// A multi-file dataset with a file outside of its directory
+	files := []envelope.File{{Path: "../a.csv", Object: "0000.aes"}}
+	other = dataset
+	other.SHA2 = envelope.FilesSHA2(files)
+	other.Manifest = &envelope.SignedManifest{
+		Manifest: envelope.Manifest{
+			DatasetID:     "abcdef1234",
+			PlaintextSHA2: other.SHA2,
+			Files:         files,
+		},
+	}
+	err = other.VerifyManifest()
+	require.EqualError(t, err, "wrong files in the manifest: the path "+
+		"'../a.csv' is not a clean relative path")
+
+	// The manifest signed by someone else
+	other = dataset
+	other.IdentityStr = darc.NewSignerEd25519(nil, nil).Identity().String()
+	require.Error(t, other.VerifyManifest())
+}
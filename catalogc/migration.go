@@ -0,0 +1,140 @@
+package catalogc
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// CatalogDataVersion is the version of the CatalogData encoding produced by
+// this package. It must be incremented, along with a new entry in
+// catalogMigrations, each time a change to CatalogData (or one of its nested
+// types) can not be read by the previous decoder.
+const CatalogDataVersion uint32 = 1
+
+// catalogMigrations upgrades an encoded CatalogData from the version used as
+// key to the next one. Encodings made before the version tag existed have the
+// version 0.
+var catalogMigrations = Migrations{
+	0: migrateCatalogDataV0,
+}
+
+// Migrations upgrades an encoding from the version used as key to the next
+// one. It is shared by the contracts whose data carries a version in a field
+// with the tag 100.
+type Migrations map[uint32]func([]byte) ([]byte, error)
+
+// versionHeader is used to read the version of an encoding without knowing
+// its layout. The protobuf decoder skips the fields it doesn't know.
+type versionHeader struct {
+	Version uint32 `protobuf:"100"`
+}
+
+// Upgrade runs the migrations needed to bring the encoding to the current
+// version. The name of the data is used in the errors.
+func (m Migrations) Upgrade(buf []byte, name string,
+	current uint32) ([]byte, error) {
+
+	header := versionHeader{}
+	err := protobuf.Decode(buf, &header)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the version: %v", err)
+	}
+
+	if header.Version > current {
+		return nil, xerrors.Errorf("%s has version %d, but this version "+
+			"only understands up to %d", name, header.Version, current)
+	}
+
+	for version := header.Version; version < current; version++ {
+		migrate, found := m[version]
+		if !found {
+			return nil, xerrors.Errorf("no migration found for %s version %d",
+				name, version)
+		}
+		buf, err = migrate(buf)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to migrate %s from version "+
+				"%d: %v", name, version, err)
+		}
+	}
+
+	return buf, nil
+}
+
+// DecodeCatalogData decodes a CatalogData, upgrading it first if it has been
+// encoded with a previous version. It must be used instead of protobuf.Decode
+// on every CatalogData read from the ledger.
+func DecodeCatalogData(buf []byte, cd *CatalogData) error {
+	buf, err := catalogMigrations.Upgrade(buf, "catalog data",
+		CatalogDataVersion)
+	if err != nil {
+		return err
+	}
+
+	err = protobuf.Decode(buf, cd)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the catalog data: %v", err)
+	}
+
+	return nil
+}
+
+// DecodeCatalogProof verifies the proof, like byzcoin.Proof.VerifyAndDecode
+// does, and decodes the catalog instance with the given ID that it holds with
+// DecodeCatalogData.
+func DecodeCatalogProof(proof byzcoin.Proof, instID []byte,
+	cd *CatalogData) error {
+
+	buf, err := GetInstanceFromProof(proof, instID, ContractCatalogID)
+	if err != nil {
+		return err
+	}
+
+	return DecodeCatalogData(buf, cd)
+}
+
+// GetInstanceFromProof verifies the proof against the chain it comes from and
+// returns the value of the instance with the given ID, which must be an
+// instance of the given contract. The value must then be decoded with the
+// Decode function of the contract.
+func GetInstanceFromProof(proof byzcoin.Proof, instID []byte,
+	contractID string) ([]byte, error) {
+
+	err := proof.Verify(proof.Latest.SkipChainID())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to verify the proof: %v", err)
+	}
+
+	buf, cid, _, err := proof.Get(instID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get the instance: %v", err)
+	}
+	if cid != contractID {
+		return nil, xerrors.Errorf("instance %x is a %s, not a %s", instID,
+			cid, contractID)
+	}
+
+	return buf, nil
+}
+
+// migrateCatalogDataV0 tags an unversioned encoding with the version 1. The
+// layout didn't change, which is why we can use the current struct. A
+// migration that changes the layout must decode into a frozen copy of the old
+// struct instead.
+func migrateCatalogDataV0(buf []byte) ([]byte, error) {
+	cd := CatalogData{}
+	err := protobuf.Decode(buf, &cd)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode: %v", err)
+	}
+
+	cd.Version = 1
+
+	buf, err = protobuf.Encode(&cd)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode: %v", err)
+	}
+
+	return buf, nil
+}
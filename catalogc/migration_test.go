@@ -0,0 +1,59 @@
+package catalogc
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+)
+
+// loadFixture reads an hex encoded fixture from the testdata folder
+func loadFixture(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	buf, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	require.NoError(t, err)
+	return buf
+}
+
+// The v0 fixture has been encoded with the layout that had no version tag.
+func TestDecodeCatalogData_V0(t *testing.T) {
+	buf := loadFixture(t, "catalog_v0.hex")
+
+	cd := CatalogData{}
+	err := DecodeCatalogData(buf, &cd)
+	require.NoError(t, err)
+
+	require.Equal(t, CatalogDataVersion, cd.Version)
+	require.Len(t, cd.Owners, 1)
+	require.Equal(t, "John", cd.Owners[0].Firstname)
+	require.Equal(t, "Doe", cd.Owners[0].Lastname)
+	require.Equal(t, "ed25519:cafe", cd.Owners[0].IdentityStr)
+	require.Len(t, cd.Owners[0].Datasets, 1)
+
+	dataset := cd.Owners[0].Datasets[0]
+	require.Equal(t, "aa", dataset.CalypsoWriteID)
+	require.Equal(t, "Accidents", dataset.Title)
+	require.Equal(t, "s3://datasets/accidents", dataset.CloudURL)
+	require.False(t, dataset.IsArchived)
+	require.Len(t, dataset.Metadata.AttributesGroups, 1)
+
+	attr := dataset.Metadata.AttributesGroups[0].Attributes[0]
+	require.Equal(t, "use_restricted", attr.ID)
+	require.Equal(t, "must_have", attr.RuleType)
+
+	require.Equal(t, "ed25519:cafe", cd.GetDatasetOwner("aa").IdentityStr)
+	require.Len(t, cd.Metadata.AttributesGroups, 1)
+}
+
+func TestDecodeCatalogData_Future(t *testing.T) {
+	buf, err := protobuf.Encode(&CatalogData{Version: CatalogDataVersion + 1})
+	require.NoError(t, err)
+
+	err = DecodeCatalogData(buf, &CatalogData{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only understands up to")
+}
@@ -0,0 +1,95 @@
+package chunked
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/xerrors"
+)
+
+// Algorithm identifies the AEAD used to seal the chunks
+type Algorithm byte
+
+const (
+	// AES128GCM is AES-GCM with a 128 bits key
+	AES128GCM Algorithm = 1
+	// AES256GCM is AES-GCM with a 256 bits key
+	AES256GCM Algorithm = 2
+	// ChaCha20Poly1305 is ChaCha20-Poly1305 as defined in RFC 8439
+	ChaCha20Poly1305 Algorithm = 3
+)
+
+// Algorithms lists the supported algorithms
+var Algorithms = []Algorithm{AES128GCM, AES256GCM, ChaCha20Poly1305}
+
+// String returns the name of the algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case AES128GCM:
+		return "AES-128-GCM"
+	case AES256GCM:
+		return "AES-256-GCM"
+	case ChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	default:
+		return "unknown"
+	}
+}
+
+// KeySize returns the size of the key in bytes, or 0 if the algorithm is
+// unknown.
+func (a Algorithm) KeySize() int {
+	switch a {
+	case AES128GCM:
+		return 16
+	case AES256GCM:
+		return 32
+	case ChaCha20Poly1305:
+		return chacha20poly1305.KeySize
+	default:
+		return 0
+	}
+}
+
+// NewAEAD returns the AEAD of the algorithm with the given key
+func (a Algorithm) NewAEAD(key []byte) (cipher.AEAD, error) {
+	if a.KeySize() == 0 {
+		return nil, xerrors.Errorf("unknown algorithm %d", a)
+	}
+	if len(key) != a.KeySize() {
+		return nil, xerrors.Errorf("%s needs a %d bits key, not %d", a,
+			a.KeySize()*8, len(key)*8)
+	}
+
+	if a == ChaCha20Poly1305 {
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+		}
+		return aead, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+	}
+
+	return aead, nil
+}
+
+// AlgorithmFromString returns the algorithm from its name
+func AlgorithmFromString(name string) (Algorithm, error) {
+	for _, a := range Algorithms {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+
+	return 0, xerrors.Errorf("unknown algorithm '%s', must be one of %v",
+		name, Algorithms)
+}
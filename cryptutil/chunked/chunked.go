@@ -0,0 +1,689 @@
+// Package chunked implements a streaming authenticated encryption format, so
+// that large datasets can be encrypted and decrypted with a constant amount of
+// memory. The encrypted data is self-describing: it tells which algorithm was
+// used and which dataset it belongs to.
+//
+// The data is optionally compressed, then split in chunks that are sealed
+// separately with an AEAD. The encrypted data starts with a header:
+//
+//	magic (4 bytes) || version (1 byte) || algorithm (1 byte) ||
+//	compression (1 byte) || chunk size (4 bytes, big endian) ||
+//	nonce prefix (7 bytes) || dataset ID length (2 bytes, big endian) ||
+//	dataset ID
+//
+// followed by the sealed chunks, each one holding "chunk size" bytes of
+// (compressed) data, except the last one which can be shorter or empty, and by
+// the SHA-256 of the unencrypted and uncompressed data, which commits to the
+// content of the dataset. The nonce of a chunk is
+//
+//	nonce prefix (7 bytes) || chunk index (4 bytes, big endian) || last (1 byte)
+//
+// where "last" is 1 for the last chunk and 0 otherwise. The index prevents
+// the chunks from being reordered, and the last flag prevents the data from
+// being truncated at a chunk boundary. The header is authenticated as the
+// additional data of every chunk, and the SHA-256 as additional data of the
+// last chunk, so that the dataset ID and the hash cannot be changed.
+//
+// The previous versions of the format can still be read. The first one had a
+// shorter header, without the algorithm and the dataset ID, always used
+// AES-128-GCM and had no SHA-256. The second one had no compression.
+package chunked
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// Magic starts the encrypted data
+	Magic = "ODYC"
+	// Version is the version of the format written by the Writer
+	Version byte = 3
+	// Version1 is the first version of the format, which can only be read
+	Version1 byte = 1
+	// Version2 is the version without compression, which can only be read
+	Version2 byte = 2
+	// NoncePrefixSize is the size of the random part of the nonces
+	NoncePrefixSize = 7
+	// HashSize is the size of the SHA-256 following the chunks
+	HashSize = sha256.Size
+	// MaxDatasetIDSize bounds the size of the dataset ID
+	MaxDatasetIDSize = math.MaxUint16
+	// DefaultChunkSize is the chunk size used by cryptutil and the data owner
+	// manager.
+	DefaultChunkSize = 64 * 1024
+	// MaxChunkSize bounds the memory used to decrypt a chunk
+	MaxChunkSize = 16 * 1024 * 1024
+)
+
+// prefixSize is the size of the magic and the version, which are common to all
+// the versions.
+const prefixSize = len(Magic) + 1
+
+// nonceSize is the size of the nonces, which all the algorithms must use
+const nonceSize = NoncePrefixSize + 4 + 1
+
+// IsChunked tells if the data starts with the header of the format. It only
+// needs the first 5 bytes.
+func IsChunked(buf []byte) bool {
+	return len(buf) >= prefixSize && string(buf[:len(Magic)]) == Magic &&
+		buf[len(Magic)] >= Version1 && buf[len(Magic)] <= Version
+}
+
+// Header describes the encrypted data
+type Header struct {
+	Version     byte
+	Algorithm   Algorithm
+	Compression Compression
+	ChunkSize   int
+	NoncePrefix []byte
+	// DatasetID is the Calypso write instance ID of the dataset. It is empty
+	// with the first version.
+	DatasetID []byte
+}
+
+// Encode returns the binary representation of the header
+func (h *Header) Encode() ([]byte, error) {
+	if h.ChunkSize <= 0 || h.ChunkSize > MaxChunkSize {
+		return nil, xerrors.Errorf("the chunk size must be between 1 and %d, "+
+			"not %d", MaxChunkSize, h.ChunkSize)
+	}
+	if len(h.NoncePrefix) != NoncePrefixSize {
+		return nil, xerrors.Errorf("the nonce prefix must be %d bytes, not %d",
+			NoncePrefixSize, len(h.NoncePrefix))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(Magic)
+	buf.WriteByte(h.Version)
+
+	if h.Version < Version1 || h.Version > Version {
+		return nil, xerrors.Errorf("unknown version %d", h.Version)
+	}
+	if h.Version == Version1 && (h.Algorithm != AES128GCM ||
+		len(h.DatasetID) != 0) {
+
+		return nil, xerrors.New("the first version only supports " +
+			"AES-128-GCM and no dataset ID")
+	}
+	if h.Version < Version && h.Compression != NoCompression {
+		return nil, xerrors.Errorf("version %d doesn't support compression",
+			h.Version)
+	}
+	if h.Algorithm.KeySize() == 0 {
+		return nil, xerrors.Errorf("unknown algorithm %d", h.Algorithm)
+	}
+	if !h.Compression.valid() {
+		return nil, xerrors.Errorf("unknown compression %d", h.Compression)
+	}
+	if len(h.DatasetID) > MaxDatasetIDSize {
+		return nil, xerrors.Errorf("the dataset ID must be at most %d "+
+			"bytes, not %d", MaxDatasetIDSize, len(h.DatasetID))
+	}
+
+	if h.Version >= Version2 {
+		buf.WriteByte(byte(h.Algorithm))
+	}
+	if h.Version >= Version {
+		buf.WriteByte(byte(h.Compression))
+	}
+
+	binary.Write(buf, binary.BigEndian, uint32(h.ChunkSize))
+	buf.Write(h.NoncePrefix)
+
+	if h.Version >= Version2 {
+		binary.Write(buf, binary.BigEndian, uint16(len(h.DatasetID)))
+		buf.Write(h.DatasetID)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ReadHeader reads the header at the beginning of the encrypted data. It can
+// be used without the key.
+func ReadHeader(r io.Reader) (*Header, error) {
+	header, _, err := readHeader(r)
+	return header, err
+}
+
+// readHeader reads the header and returns it with its binary representation
+func readHeader(r io.Reader) (*Header, []byte, error) {
+	buf := make([]byte, prefixSize)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to read the header: %v", err)
+	}
+	if !IsChunked(buf) {
+		return nil, nil, xerrors.New("wrong header, the data is not in the " +
+			"chunked format or uses an unknown version")
+	}
+
+	h := &Header{
+		Version:   buf[len(Magic)],
+		Algorithm: AES128GCM,
+	}
+
+	// The fixed part following the prefix
+	fixedSize := 4 + NoncePrefixSize
+	if h.Version >= Version2 {
+		fixedSize += 1 + 2
+	}
+	if h.Version >= Version {
+		fixedSize++
+	}
+
+	fixed := make([]byte, fixedSize)
+	_, err = io.ReadFull(r, fixed)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to read the header: %v", err)
+	}
+	buf = append(buf, fixed...)
+
+	if h.Version >= Version2 {
+		h.Algorithm = Algorithm(fixed[0])
+		fixed = fixed[1:]
+	}
+	if h.Version >= Version {
+		h.Compression = Compression(fixed[0])
+		fixed = fixed[1:]
+	}
+
+	h.ChunkSize = int(binary.BigEndian.Uint32(fixed))
+	if h.ChunkSize == 0 || h.ChunkSize > MaxChunkSize {
+		return nil, nil, xerrors.Errorf("wrong chunk size %d", h.ChunkSize)
+	}
+	h.NoncePrefix = fixed[4 : 4+NoncePrefixSize]
+
+	if h.Algorithm.KeySize() == 0 {
+		return nil, nil, xerrors.Errorf("unknown algorithm %d", h.Algorithm)
+	}
+	if !h.Compression.valid() {
+		return nil, nil, xerrors.Errorf("unknown compression %d", h.Compression)
+	}
+
+	if h.Version >= Version2 {
+		idSize := binary.BigEndian.Uint16(fixed[4+NoncePrefixSize:])
+		h.DatasetID = make([]byte, idSize)
+		_, err = io.ReadFull(r, h.DatasetID)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to read the dataset ID: %v",
+				err)
+		}
+		buf = append(buf, h.DatasetID...)
+	}
+
+	return h, buf, nil
+}
+
+// trailerSize returns the size of the data following the chunks
+func (h *Header) trailerSize() int {
+	if h.Version == Version1 {
+		return 0
+	}
+	return HashSize
+}
+
+// nonce returns the nonce of the given chunk
+func nonce(prefix []byte, index uint32, last bool) []byte {
+	n := make([]byte, nonceSize)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[NoncePrefixSize:], index)
+	if last {
+		n[len(n)-1] = 1
+	}
+	return n
+}
+
+// newAEAD returns the AEAD of the header with the given key
+func (h *Header) newAEAD(key []byte) (cipher.AEAD, error) {
+	aead, err := h.Algorithm.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if aead.NonceSize() != nonceSize {
+		return nil, xerrors.Errorf("the AEAD must use %d bytes nonces, not %d",
+			nonceSize, aead.NonceSize())
+	}
+	return aead, nil
+}
+
+// Writer encrypts the data written to it. It must be closed to write the last
+// chunk and the SHA-256 of the data.
+type Writer struct {
+	chunks *chunkWriter
+	// compressor compresses the data before it is split in chunks. It is nil
+	// without compression.
+	compressor io.WriteCloser
+	hash       hash.Hash
+	closed     bool
+}
+
+// NewWriter writes the header to w and returns a writer that encrypts the data
+// with the given key. The version of the header is set to the current one. The
+// nonce prefix must never be used twice with the same key.
+func NewWriter(w io.Writer, key []byte, header Header) (*Writer, error) {
+	header.Version = Version
+
+	headerBuf, err := header.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := header.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(headerBuf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to write the header: %v", err)
+	}
+
+	writer := &Writer{
+		chunks: &chunkWriter{
+			w:         w,
+			aead:      aead,
+			header:    headerBuf,
+			prefix:    append([]byte{}, header.NoncePrefix...),
+			chunkSize: header.ChunkSize,
+			buf:       make([]byte, 0, header.ChunkSize+aead.Overhead()),
+		},
+		hash: sha256.New(),
+	}
+
+	if header.Compression == Gzip {
+		writer.compressor = gzip.NewWriter(writer.chunks)
+	}
+
+	return writer, nil
+}
+
+// Write implements io.Writer. A chunk is written each time enough data is
+// provided.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, xerrors.New("the writer is closed")
+	}
+
+	w.hash.Write(p)
+
+	if w.compressor != nil {
+		n, err := w.compressor.Write(p)
+		if err != nil {
+			return n, xerrors.Errorf("failed to compress: %v", err)
+		}
+		return n, nil
+	}
+
+	return w.chunks.Write(p)
+}
+
+// Sum returns the SHA-256 of the data written so far
+func (w *Writer) Sum() []byte {
+	return w.hash.Sum(nil)
+}
+
+// Close writes the last chunk and the SHA-256 of the data. It doesn't close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.compressor != nil {
+		err := w.compressor.Close()
+		if err != nil {
+			return xerrors.Errorf("failed to compress: %v", err)
+		}
+	}
+
+	return w.chunks.writeChunk(true, w.Sum())
+}
+
+// chunkWriter splits the data in chunks and seals them
+type chunkWriter struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	header    []byte
+	prefix    []byte
+	chunkSize int
+	index     uint32
+	// buf holds the data of the current chunk
+	buf []byte
+}
+
+// Write implements io.Writer
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only written when more data comes, so that the last
+		// chunk is always written by Close.
+		if len(w.buf) == w.chunkSize {
+			err := w.writeChunk(false, nil)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		toCopy := w.chunkSize - len(w.buf)
+		if toCopy > len(p) {
+			toCopy = len(p)
+		}
+		w.buf = append(w.buf, p[:toCopy]...)
+		p = p[toCopy:]
+		n += toCopy
+	}
+
+	return n, nil
+}
+
+// writeChunk seals the current chunk and writes it, followed by the SHA-256 if
+// it is the last one.
+func (w *chunkWriter) writeChunk(last bool, sum []byte) error {
+	if w.index == math.MaxUint32 {
+		return xerrors.New("too many chunks")
+	}
+
+	aad := w.header
+	if last {
+		aad = append(append([]byte{}, w.header...), sum...)
+	}
+
+	sealed := w.aead.Seal(w.buf[:0], nonce(w.prefix, w.index, last), w.buf,
+		aad)
+	_, err := w.w.Write(sealed)
+	if err != nil {
+		return xerrors.Errorf("failed to write chunk %d: %v", w.index, err)
+	}
+
+	if last {
+		_, err = w.w.Write(sum)
+		if err != nil {
+			return xerrors.Errorf("failed to write the SHA-256: %v", err)
+		}
+	}
+
+	w.index++
+	w.buf = w.buf[:0]
+
+	return nil
+}
+
+// Reader decrypts the data read from the underlying reader. The data of a
+// chunk is only returned once the chunk has been authenticated, and an error
+// is returned if the data has been truncated.
+type Reader struct {
+	chunks *chunkReader
+	// plain returns the decrypted data, it is the chunk reader or the
+	// decompressor reading from it.
+	plain  io.Reader
+	header *Header
+	hash   hash.Hash
+	sum    []byte
+}
+
+// NewReader reads the header from r and returns a reader that decrypts the
+// chunks with the given key.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	header, headerBuf, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := header.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedSize := header.ChunkSize + aead.Overhead()
+
+	chunks := &chunkReader{
+		r:         r,
+		aead:      aead,
+		header:    header,
+		headerBuf: headerBuf,
+		buf:       make([]byte, sealedSize+header.trailerSize()+1),
+		plainBuf:  make([]byte, 0, header.ChunkSize),
+	}
+
+	reader := &Reader{
+		chunks: chunks,
+		plain:  chunks,
+		header: header,
+	}
+	if header.Version != Version1 {
+		reader.hash = sha256.New()
+	}
+
+	if header.Compression == Gzip {
+		// Reads the gzip header, which is in the first chunk
+		reader.plain, err = gzip.NewReader(chunks)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decompress: %v", err)
+		}
+	}
+
+	return reader, nil
+}
+
+// Header returns the header of the encrypted data
+func (r *Reader) Header() *Header {
+	return r.header
+}
+
+// Sum returns the SHA-256 of the data, which is only available once all the
+// data has been read and authenticated. It is nil with the first version of
+// the format.
+func (r *Reader) Sum() []byte {
+	return r.sum
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.plain.Read(p)
+
+	if r.hash != nil {
+		r.hash.Write(p[:n])
+	}
+
+	if err == io.EOF && r.hash != nil && r.sum == nil {
+		sum := r.hash.Sum(nil)
+		if !bytes.Equal(sum, r.chunks.trailer) {
+			return n, xerrors.New("the SHA-256 of the data doesn't match " +
+				"the one of the header")
+		}
+		r.sum = sum
+	}
+
+	return n, err
+}
+
+// chunkReader reads and opens the chunks
+type chunkReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	header    *Header
+	headerBuf []byte
+	index     uint32
+	// buf holds the sealed chunk being read and the first bytes of what
+	// follows it, which tells if the chunk is the last one. buffered is the
+	// number of bytes of buf already read.
+	buf      []byte
+	buffered int
+	// plain is the part of the decrypted chunk that has not been returned yet
+	plainBuf []byte
+	plain    []byte
+	// trailer is the SHA-256 following the last chunk, once it has been
+	// authenticated
+	trailer []byte
+	done    bool
+}
+
+// Read implements io.Reader
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		err := r.readChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+
+	return n, nil
+}
+
+// readChunk reads and opens the next chunk
+func (r *chunkReader) readChunk() error {
+	sealedSize := len(r.buf) - r.header.trailerSize() - 1
+
+	n, err := io.ReadFull(r.r, r.buf[r.buffered:])
+	n += r.buffered
+	last := false
+
+	switch err {
+	case nil:
+		// More than a chunk and the trailer follows, so it is not the last
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return xerrors.Errorf("failed to read chunk %d: %v", r.index, err)
+	}
+
+	sealed := r.buf[:sealedSize]
+	aad := r.headerBuf
+	var trailer []byte
+
+	if last {
+		if n < r.aead.Overhead()+r.header.trailerSize() {
+			return xerrors.Errorf("chunk %d is too short, the data has been "+
+				"truncated", r.index)
+		}
+		sealed = r.buf[:n-r.header.trailerSize()]
+		trailer = r.buf[len(sealed):n]
+		aad = append(append([]byte{}, r.headerBuf...), trailer...)
+	}
+
+	plain, err := r.aead.Open(r.plainBuf[:0], nonce(r.header.NoncePrefix,
+		r.index, last), sealed, aad)
+	if err != nil {
+		return xerrors.Errorf("failed to authenticate chunk %d, the data has "+
+			"been modified, reordered or truncated: %v", r.index, err)
+	}
+
+	if last {
+		r.trailer = trailer
+	} else {
+		// Keeps what follows the chunk for the next one
+		r.buffered = copy(r.buf, r.buf[sealedSize:n])
+	}
+
+	r.index++
+	r.plain = plain
+	r.done = last
+
+	return nil
+}
+
+// Decrypt returns a reader of the decrypted data that accepts both the chunked
+// format and the data sealed at once by AES-GCM with the given nonce. The
+// latter is read entirely in memory. The reader is a *Reader if the data is in
+// the chunked format.
+func Decrypt(r io.Reader, key, legacyNonce []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	start, err := br.Peek(prefixSize)
+	if err != nil && err != io.EOF {
+		return nil, xerrors.Errorf("failed to read the data: %v", err)
+	}
+
+	if IsChunked(start) {
+		return NewReader(br, key)
+	}
+
+	buf, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the data: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+	}
+
+	plain, err := aead.Open(buf[:0], legacyNonce, buf, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decrypt: %v", err)
+	}
+
+	return bytes.NewReader(plain), nil
+}
+
+// Inspect reads the header and the SHA-256 of the encrypted data, without the
+// key. The data is read until the end, or skipped if r is an io.Seeker. The
+// SHA-256 is nil with the first version of the format.
+func Inspect(r io.Reader) (*Header, []byte, error) {
+	header, err := ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header.Version == Version1 {
+		return header, nil, nil
+	}
+
+	seeker, ok := r.(io.Seeker)
+	if ok {
+		_, err = seeker.Seek(-HashSize, io.SeekEnd)
+		ok = err == nil
+	}
+	if !ok {
+		// Keeps the last bytes while reading the data, which is needed for
+		// the standard input.
+		tail := make([]byte, 0, 2*HashSize)
+		chunk := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(chunk)
+			tail = append(tail, chunk[:n]...)
+			if len(tail) > HashSize {
+				tail = append(tail[:0], tail[len(tail)-HashSize:]...)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, xerrors.Errorf("failed to read the data: %v",
+					err)
+			}
+		}
+		r = bytes.NewReader(tail)
+	}
+
+	sum := make([]byte, HashSize)
+	_, err = io.ReadFull(r, sum)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to read the SHA-256: %v", err)
+	}
+
+	return header, sum, nil
+}
@@ -0,0 +1,376 @@
+package chunked
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testChunkSize = 16
+
+// overhead is the size of the tag of the AEADs
+const overhead = 16
+
+var (
+	testKey       = []byte("0123456789abcdef")
+	testDatasetID = []byte("dataset")
+)
+
+// testHeader returns the header used by the tests
+func testHeader() Header {
+	return Header{
+		Algorithm:   AES128GCM,
+		ChunkSize:   testChunkSize,
+		NoncePrefix: []byte("prefix!"),
+		DatasetID:   testDatasetID,
+	}
+}
+
+// headerSize is the size of the encoded testHeader
+var headerSize = len(Magic) + 1 + 1 + 1 + 4 + NoncePrefixSize + 2 +
+	len(testDatasetID)
+
+// encrypt returns the data encrypted with chunks of testChunkSize bytes
+func encrypt(t *testing.T, data []byte) []byte {
+	out := new(bytes.Buffer)
+	w, err := NewWriter(out, testKey, testHeader())
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return out.Bytes()
+}
+
+// decrypt returns the decrypted data, or an error
+func decrypt(data []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data), testKey)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestChunked_RoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, testChunkSize - 1, testChunkSize,
+		testChunkSize + 1, 3 * testChunkSize, 1000} {
+
+		data := bytes.Repeat([]byte{0xab}, size)
+		encrypted := encrypt(t, data)
+
+		// There is always a last chunk, even if empty
+		chunks := (size + testChunkSize - 1) / testChunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		require.Len(t, encrypted, headerSize+size+chunks*overhead+HashSize)
+		require.True(t, IsChunked(encrypted))
+
+		r, err := NewReader(bytes.NewReader(encrypted), testKey)
+		require.NoError(t, err)
+		decrypted, err := ioutil.ReadAll(r)
+		require.NoError(t, err, size)
+		require.Equal(t, data, decrypted, size)
+
+		sum := sha256.Sum256(data)
+		require.Equal(t, sum[:], r.Sum())
+		require.Equal(t, testDatasetID, r.Header().DatasetID)
+	}
+}
+
+func TestChunked_Algorithms(t *testing.T) {
+	data := []byte("Hello world, this is a longer message.")
+
+	for _, a := range Algorithms {
+		key := bytes.Repeat([]byte{0x42}, a.KeySize())
+		header := testHeader()
+		header.Algorithm = a
+
+		out := new(bytes.Buffer)
+		w, err := NewWriter(out, key, header)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		r, err := NewReader(bytes.NewReader(out.Bytes()), key)
+		require.NoError(t, err, a)
+		require.Equal(t, a, r.Header().Algorithm)
+		decrypted, err := ioutil.ReadAll(r)
+		require.NoError(t, err, a)
+		require.Equal(t, data, decrypted, a)
+
+		_, err = NewReader(bytes.NewReader(out.Bytes()), key[1:])
+		require.Error(t, err)
+
+		name, err := AlgorithmFromString(a.String())
+		require.NoError(t, err)
+		require.Equal(t, a, name)
+	}
+
+	_, err := AlgorithmFromString("DES")
+	require.Error(t, err)
+
+	header := testHeader()
+	header.Algorithm = 42
+	_, err = NewWriter(new(bytes.Buffer), testKey, header)
+	require.Error(t, err)
+}
+
+func TestChunked_SmallWrites(t *testing.T) {
+	data := []byte("Hello world, this is a longer message.")
+
+	out := new(bytes.Buffer)
+	w, err := NewWriter(out, testKey, testHeader())
+	require.NoError(t, err)
+	for i := range data {
+		_, err = w.Write(data[i : i+1])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	require.Equal(t, encrypt(t, data), out.Bytes())
+
+	_, err = w.Write(data)
+	require.Error(t, err)
+}
+
+func TestChunked_Tampering(t *testing.T) {
+	// Three chunks, the last one is not full
+	data := bytes.Repeat([]byte("0123456789"), 4)
+	encrypted := encrypt(t, data)
+	sealedSize := testChunkSize + overhead
+
+	chunk := func(i int) []byte {
+		start := headerSize + i*sealedSize
+		end := start + sealedSize
+		if end > len(encrypted)-HashSize {
+			end = len(encrypted) - HashSize
+		}
+		return encrypted[start:end]
+	}
+
+	concat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	header := encrypted[:headerSize]
+	sum := encrypted[len(encrypted)-HashSize:]
+
+	// Truncated at a chunk boundary
+	_, err := decrypt(concat(header, chunk(0), chunk(1), sum))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "chunk 1")
+
+	// Truncated in the middle of a chunk
+	_, err = decrypt(encrypted[:len(encrypted)-5])
+	require.Error(t, err)
+
+	// Reordered chunks
+	_, err = decrypt(concat(header, chunk(1), chunk(0), chunk(2), sum))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "chunk 0")
+
+	// Modified dataset ID
+	modified := concat(encrypted)
+	modified[headerSize-1] ^= 1
+	_, err = decrypt(modified)
+	require.Error(t, err)
+
+	// Modified data
+	modified = concat(encrypted)
+	modified[headerSize+sealedSize+2] ^= 1
+	_, err = decrypt(modified)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "chunk 1")
+
+	// Modified SHA-256
+	modified = concat(encrypted)
+	modified[len(modified)-1] ^= 1
+	_, err = decrypt(modified)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "chunk 2")
+
+	// Wrong header
+	_, err = decrypt([]byte("not encrypted"))
+	require.Error(t, err)
+}
+
+// encryptOld returns the data encrypted in a previous version of the format
+func encryptOld(t *testing.T, version byte, data []byte) []byte {
+	header := testHeader()
+	header.Version = version
+	if version == Version1 {
+		header.DatasetID = nil
+	}
+	headerBuf, err := header.Encode()
+	require.NoError(t, err)
+
+	aead, err := AES128GCM.NewAEAD(testKey)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(data)
+	out := bytes.NewBuffer(headerBuf)
+	for i := 0; ; i++ {
+		size := testChunkSize
+		if len(data) <= size {
+			size = len(data)
+		}
+		last := len(data) <= testChunkSize
+		aad := headerBuf
+		if last && version != Version1 {
+			aad = append(append([]byte{}, headerBuf...), sum[:]...)
+		}
+		out.Write(aead.Seal(nil, nonce(header.NoncePrefix, uint32(i), last),
+			data[:size], aad))
+		data = data[size:]
+		if last {
+			if version != Version1 {
+				out.Write(sum[:])
+			}
+			return out.Bytes()
+		}
+	}
+}
+
+func TestChunked_OldVersions(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 4)
+
+	for _, version := range []byte{Version1, Version2} {
+		for _, size := range []int{0, testChunkSize, len(data)} {
+			encrypted := encryptOld(t, version, data[:size])
+			r, err := NewReader(bytes.NewReader(encrypted), testKey)
+			require.NoError(t, err)
+			require.Equal(t, version, r.Header().Version)
+			require.Equal(t, AES128GCM, r.Header().Algorithm)
+			require.Equal(t, NoCompression, r.Header().Compression)
+
+			decrypted, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, data[:size], decrypted)
+			if version == Version1 {
+				require.Nil(t, r.Sum())
+			} else {
+				require.NotNil(t, r.Sum())
+			}
+		}
+	}
+
+	// Truncated at a chunk boundary
+	encrypted := encryptOld(t, Version1, data)
+	_, err := decrypt(encrypted[:16+2*(testChunkSize+overhead)])
+	require.Error(t, err)
+}
+
+func TestChunked_Compression(t *testing.T) {
+	data := bytes.Repeat([]byte("a,b,c\n1,2,3\n"), 1000)
+	header := testHeader()
+	header.Compression = Gzip
+
+	out := new(bytes.Buffer)
+	w, err := NewWriter(out, testKey, header)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	encrypted := out.Bytes()
+	require.True(t, len(encrypted) < len(data)/10)
+
+	r, err := NewReader(bytes.NewReader(encrypted), testKey)
+	require.NoError(t, err)
+	require.Equal(t, Gzip, r.Header().Compression)
+	decrypted, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	// The SHA-256 is the one of the uncompressed data
+	sum := sha256.Sum256(data)
+	require.Equal(t, sum[:], r.Sum())
+	_, inspected, err := Inspect(bytes.NewReader(encrypted))
+	require.NoError(t, err)
+	require.Equal(t, sum[:], inspected)
+
+	// Truncated data
+	_, err = decrypt(encrypted[:len(encrypted)-HashSize-1])
+	require.Error(t, err)
+
+	name, err := CompressionFromString("gzip")
+	require.NoError(t, err)
+	require.Equal(t, Gzip, name)
+	_, err = CompressionFromString("zip")
+	require.Error(t, err)
+
+	header.Compression = 42
+	_, err = NewWriter(out, testKey, header)
+	require.Error(t, err)
+}
+
+func TestDecrypt(t *testing.T) {
+	data := []byte("Hello world.")
+
+	r, err := Decrypt(bytes.NewReader(encrypt(t, data)), testKey, nil)
+	require.NoError(t, err)
+	decrypted, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	// The data sealed at once is still readable
+	aead, err := AES128GCM.NewAEAD(testKey)
+	require.NoError(t, err)
+	legacyNonce := []byte("0123456789ab")
+	sealed := aead.Seal(nil, legacyNonce, data, nil)
+
+	r, err = Decrypt(bytes.NewReader(sealed), testKey, legacyNonce)
+	require.NoError(t, err)
+	decrypted, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	_, err = Decrypt(bytes.NewReader(sealed), testKey, []byte("ba9876543210"))
+	require.Error(t, err)
+}
+
+// onlyReader hides the io.Seeker of a reader
+type onlyReader struct {
+	r *bytes.Reader
+}
+
+func (r onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func TestInspect(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	encrypted := encrypt(t, data)
+	sum := sha256.Sum256(data)
+
+	header, inspected, err := Inspect(bytes.NewReader(encrypted))
+	require.NoError(t, err)
+	require.Equal(t, Version, header.Version)
+	require.Equal(t, AES128GCM, header.Algorithm)
+	require.Equal(t, testChunkSize, header.ChunkSize)
+	require.Equal(t, []byte("prefix!"), header.NoncePrefix)
+	require.Equal(t, testDatasetID, header.DatasetID)
+	require.Equal(t, sum[:], inspected)
+
+	_, inspected, err = Inspect(onlyReader{bytes.NewReader(encrypted)})
+	require.NoError(t, err)
+	require.Equal(t, sum[:], inspected)
+
+	header, inspected, err = Inspect(bytes.NewReader(encryptOld(t, Version1, data)))
+	require.NoError(t, err)
+	require.Equal(t, Version1, header.Version)
+	require.Nil(t, inspected)
+
+	// A header with a dataset ID that is too long
+	buf := append([]byte{}, encrypted[:headerSize]...)
+	binary.BigEndian.PutUint16(buf[headerSize-len(testDatasetID)-2:], 1000)
+	_, _, err = Inspect(bytes.NewReader(buf))
+	require.Error(t, err)
+
+	_, _, err = Inspect(bytes.NewReader(data))
+	require.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package chunked
+
+import "golang.org/x/xerrors"
+
+// Compression identifies how the data is compressed before being encrypted
+type Compression byte
+
+const (
+	// NoCompression leaves the data as it is
+	NoCompression Compression = 0
+	// Gzip compresses the data with gzip, as defined in RFC 1952
+	Gzip Compression = 1
+)
+
+// Compressions lists the supported compressions
+var Compressions = []Compression{NoCompression, Gzip}
+
+// String returns the name of the compression
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	default:
+		return "unknown"
+	}
+}
+
+// valid tells if the compression is supported
+func (c Compression) valid() bool {
+	return c == NoCompression || c == Gzip
+}
+
+// CompressionFromString returns the compression from its name
+func CompressionFromString(name string) (Compression, error) {
+	for _, c := range Compressions {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+
+	return 0, xerrors.Errorf("unknown compression '%s', must be one of %v",
+		name, Compressions)
+}
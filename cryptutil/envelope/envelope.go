@@ -0,0 +1,273 @@
+// Package envelope provides the encryption of the datasets. Each dataset is
+// encrypted with its own key and 96 bits initialization value, which form the
+// envelope. The envelope is then stored as the secret of a Calypso write
+// instance, encoded as the hexadecimal string of the key followed by the
+// initialization value. This is the "keyAndInitVal" used by cryptutil and the
+// enclave.
+//
+// The data can either be sealed at once with AES-GCM, or as a stream in the
+// format of the "chunked" package, where the nonce prefix is the beginning of
+// the initialization value. The latter can also compress the data.
+//
+// Note that the secret of a Calypso write is limited to 29 bytes, so only
+// AES-128-GCM can be used for the datasets stored in a Calypso write. The 256
+// bits keys of the other algorithms are for datasets whose key is shared by
+// other means.
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"golang.org/x/xerrors"
+)
+
+// NonceSize is the size of the initialization value, 12 bytes = 96 bits
+const NonceSize = 12
+
+// Envelope holds the algorithm, the key and the initialization value used to
+// encrypt a dataset
+type Envelope struct {
+	Algorithm chunked.Algorithm
+	Key       []byte
+	Nonce     []byte
+}
+
+// New returns an envelope with a random key and initialization value for the
+// given algorithm
+func New(algorithm chunked.Algorithm) (*Envelope, error) {
+	if algorithm.KeySize() == 0 {
+		return nil, xerrors.Errorf("unknown algorithm %d", algorithm)
+	}
+
+	e := &Envelope{
+		Algorithm: algorithm,
+		Key:       make([]byte, algorithm.KeySize()),
+		Nonce:     make([]byte, NonceSize),
+	}
+
+	_, err := rand.Read(e.Key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate the key: %v", err)
+	}
+	_, err = rand.Read(e.Nonce)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate the init val: %v", err)
+	}
+
+	return e, nil
+}
+
+// Decode returns the envelope from its keyAndInitVal encoding, which is the
+// hexadecimal string of the key followed by the initialization value. The
+// algorithm is AES-GCM with the size of the key, and can be changed after.
+func Decode(keyAndInitVal string) (*Envelope, error) {
+	buf, err := hex.DecodeString(keyAndInitVal)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode keyAndInitVal: %v", err)
+	}
+
+	algorithm := algorithmFromKeySize(len(buf) - NonceSize)
+	if algorithm == 0 {
+		return nil, xerrors.Errorf("length of key + initVal must be %d or %d "+
+			"bits, not %d", (16+NonceSize)*8, (32+NonceSize)*8, len(buf)*8)
+	}
+
+	return &Envelope{
+		Algorithm: algorithm,
+		Key:       buf[:len(buf)-NonceSize],
+		Nonce:     buf[len(buf)-NonceSize:],
+	}, nil
+}
+
+// DecodeKeyAndNonce returns the envelope from the hexadecimal strings of the
+// key and of the initialization value. The algorithm is set like with Decode.
+func DecodeKeyAndNonce(key, nonce string) (*Envelope, error) {
+	keyBuf, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode key as hexadecimal: %v", err)
+	}
+
+	algorithm := algorithmFromKeySize(len(keyBuf))
+	if algorithm == 0 {
+		return nil, xerrors.Errorf("length of key must be 128 or 256 bits, "+
+			"not %d", len(keyBuf)*8)
+	}
+
+	nonceBuf, err := hex.DecodeString(nonce)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode initVal as hexadecimal: %v",
+			err)
+	}
+	if len(nonceBuf) != NonceSize {
+		return nil, xerrors.Errorf("length of initialization value must be %d "+
+			"bits, not %d", NonceSize*8, len(nonceBuf)*8)
+	}
+
+	return &Envelope{
+		Algorithm: algorithm,
+		Key:       keyBuf,
+		Nonce:     nonceBuf,
+	}, nil
+}
+
+// algorithmFromKeySize returns the AES-GCM algorithm using keys of the given
+// size, or 0.
+func algorithmFromKeySize(size int) chunked.Algorithm {
+	switch size {
+	case chunked.AES128GCM.KeySize():
+		return chunked.AES128GCM
+	case chunked.AES256GCM.KeySize():
+		return chunked.AES256GCM
+	default:
+		return 0
+	}
+}
+
+// String returns the keyAndInitVal encoding of the envelope
+func (e *Envelope) String() string {
+	return hex.EncodeToString(e.Key) + hex.EncodeToString(e.Nonce)
+}
+
+// aesGCM returns the AES-GCM cipher of the envelope, which is used to seal
+// the data at once.
+func (e *Envelope) aesGCM() (cipher.AEAD, error) {
+	if e.Algorithm == chunked.ChaCha20Poly1305 {
+		return nil, xerrors.New("only AES-GCM can be used to seal the data at " +
+			"once, use the chunked format")
+	}
+
+	block, err := aes.NewCipher(e.Key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create new cipher: %v", err)
+	}
+
+	return aesgcm, nil
+}
+
+// Seal encrypts the data at once with AES-GCM
+func (e *Envelope) Seal(data []byte) ([]byte, error) {
+	aead, err := e.aesGCM()
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nil, e.Nonce, data, nil), nil
+}
+
+// Open decrypts data sealed at once with AES-GCM
+func (e *Envelope) Open(ciphertext []byte) ([]byte, error) {
+	aead, err := e.aesGCM()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := aead.Open(nil, e.Nonce, ciphertext, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decrypt: %v", err)
+	}
+
+	return data, nil
+}
+
+// Options are the options of the chunked format
+type Options struct {
+	// DatasetID is the Calypso write instance ID of the dataset, which is
+	// stored in the header. It can be nil if it is not known.
+	DatasetID []byte
+	// Compression is applied before the encryption
+	Compression chunked.Compression
+	// ChunkSize defaults to chunked.DefaultChunkSize
+	ChunkSize int
+	// NoncePrefix defaults to the beginning of the initialization value. It
+	// must be different for each data encrypted with the same key, like the
+	// files of a multi-file dataset.
+	NoncePrefix []byte
+}
+
+// NewWriter returns a writer that encrypts the data written to it in the
+// chunked format. The writer must be closed to write the last chunk.
+func (e *Envelope) NewWriter(w io.Writer, opts Options) (*chunked.Writer, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = chunked.DefaultChunkSize
+	}
+
+	noncePrefix := opts.NoncePrefix
+	if noncePrefix == nil {
+		noncePrefix = e.Nonce[:chunked.NoncePrefixSize]
+	}
+
+	return chunked.NewWriter(w, e.Key, chunked.Header{
+		Algorithm:   e.Algorithm,
+		Compression: opts.Compression,
+		ChunkSize:   chunkSize,
+		NoncePrefix: noncePrefix,
+		DatasetID:   opts.DatasetID,
+	})
+}
+
+// NewReader returns a reader of the decrypted data. The data can either be in
+// the chunked format, which is decrypted and decompressed as a stream, or
+// sealed at once, which is read entirely in memory. If the dataset ID is not nil and the data holds
+// one, they must be equal.
+func (e *Envelope) NewReader(r io.Reader, datasetID []byte) (io.Reader, error) {
+	reader, err := chunked.Decrypt(r, e.Key, e.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkedReader, ok := reader.(*chunked.Reader)
+	if ok && datasetID != nil && len(chunkedReader.Header().DatasetID) != 0 &&
+		!bytes.Equal(datasetID, chunkedReader.Header().DatasetID) {
+
+		return nil, xerrors.Errorf("the data belongs to dataset %x, not %x",
+			chunkedReader.Header().DatasetID, datasetID)
+	}
+
+	return reader, nil
+}
+
+// Encrypt encrypts the data read from r to w in the chunked format and
+// returns the SHA-256 of the unencrypted data.
+func (e *Envelope) Encrypt(w io.Writer, r io.Reader, opts Options) ([]byte, error) {
+	encWriter, err := e.NewWriter(w, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(encWriter, r)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encrypt: %v", err)
+	}
+
+	err = encWriter.Close()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encrypt: %v", err)
+	}
+
+	return encWriter.Sum(), nil
+}
+
+// Hash returns the SHA-256 of the data read from r, which is how the datasets
+// are identified.
+func Hash(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to hash the data: %v", err)
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,158 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/stretchr/testify/require"
+)
+
+// The known answers, that are also used by cryptutil/test.sh
+const (
+	testKeyAndInitVal = "00112233445566778899aabbccddeeff00112233445566778899aabb"
+	testData          = "Hello world."
+	testSealed        = "ef5a516eddc4a6656a3f17351b7ffebbe9f8b8c8b282470b59b72c09"
+	// testData in the chunked format, with chunks of 4 bytes and testDatasetID
+	testChunked = "4f445943030100000000040011223344556600076461746173657400414b7c04" +
+		"8b394c458aa8ae96a1364640c3cccf0ba3d387528438f50bdac88535512ca757" +
+		"e6b52fb7b67a6b7170e16e19240ca090b2d31b301e78acaa3ec16e6acc809d8b" +
+		"2818662276256abfd2f1b441cb51574933f3d4bd115d11"
+	// testData in the second version of the chunked format
+	testChunkedV2 = "4f4459430201000000040011223344556600076461746173657400414b7cec0b" +
+		"2c8675966d72976c3f448c24237b0ba3d387ba042d3f3bc60d59349c25a59b01" +
+		"5a9bb7b67a6b969c480ac85552f90a4c2e0f8d128799aa3ec16e6acc809d8b28" +
+		"18662276256abfd2f1b441cb51574933f3d4bd115d11"
+)
+
+var testDatasetID = []byte("dataset")
+
+func TestDecode(t *testing.T) {
+	env, err := Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+	require.Equal(t, "00112233445566778899aabbccddeeff", hex.EncodeToString(env.Key))
+	require.Equal(t, "00112233445566778899aabb", hex.EncodeToString(env.Nonce))
+	require.Equal(t, chunked.AES128GCM, env.Algorithm)
+	require.Equal(t, testKeyAndInitVal, env.String())
+
+	// A 256 bits key
+	env, err = Decode("00112233445566778899aabbccddeeff" + testKeyAndInitVal)
+	require.NoError(t, err)
+	require.Equal(t, chunked.AES256GCM, env.Algorithm)
+	require.Len(t, env.Key, 32)
+
+	env, err = Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+	env2, err := DecodeKeyAndNonce("00112233445566778899aabbccddeeff",
+		"00112233445566778899aabb")
+	require.NoError(t, err)
+	require.Equal(t, env, env2)
+
+	_, err = Decode(testKeyAndInitVal[2:])
+	require.Error(t, err)
+	_, err = Decode(testKeyAndInitVal[1:])
+	require.Error(t, err)
+	_, err = DecodeKeyAndNonce("0011", "00112233445566778899aabb")
+	require.Error(t, err)
+	_, err = DecodeKeyAndNonce("00112233445566778899aabbccddeeff", "xx")
+	require.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	env, err := New(chunked.AES128GCM)
+	require.NoError(t, err)
+	require.Len(t, env.Key, 16)
+	require.Len(t, env.Nonce, NonceSize)
+
+	env2, err := Decode(env.String())
+	require.NoError(t, err)
+	require.Equal(t, env, env2)
+
+	env, err = New(chunked.ChaCha20Poly1305)
+	require.NoError(t, err)
+	require.Len(t, env.Key, 32)
+
+	// Only the chunked format is supported by ChaCha20-Poly1305
+	_, err = env.Seal([]byte(testData))
+	require.Error(t, err)
+
+	_, err = New(0)
+	require.Error(t, err)
+}
+
+func TestEnvelope_Seal(t *testing.T) {
+	env, err := Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+
+	sealed, err := env.Seal([]byte(testData))
+	require.NoError(t, err)
+	require.Equal(t, testSealed, hex.EncodeToString(sealed))
+
+	data, err := env.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, testData, string(data))
+
+	sealed[0] ^= 1
+	_, err = env.Open(sealed)
+	require.Error(t, err)
+}
+
+func TestEnvelope_Encrypt(t *testing.T) {
+	env, err := Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	sha2, err := env.Encrypt(out, bytes.NewBufferString(testData),
+		Options{DatasetID: testDatasetID, ChunkSize: 4})
+	require.NoError(t, err)
+	require.Equal(t, testChunked, hex.EncodeToString(out.Bytes()))
+
+	expected := sha256.Sum256([]byte(testData))
+	require.Equal(t, expected[:], sha2)
+
+	hash, err := Hash(bytes.NewBufferString(testData))
+	require.NoError(t, err)
+	require.Equal(t, expected[:], hash)
+
+	// With compression, the SHA-256 is the one of the uncompressed data
+	out.Reset()
+	sha2, err = env.Encrypt(out, bytes.NewBufferString(testData),
+		Options{Compression: chunked.Gzip})
+	require.NoError(t, err)
+	require.Equal(t, expected[:], sha2)
+
+	r, err := env.NewReader(out, nil)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, testData, string(data))
+}
+
+func TestEnvelope_NewReader(t *testing.T) {
+	env, err := Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+
+	// Both formats are accepted
+	for _, encrypted := range []string{testSealed, testChunkedV2, testChunked} {
+		buf, err := hex.DecodeString(encrypted)
+		require.NoError(t, err)
+
+		r, err := env.NewReader(bytes.NewReader(buf), testDatasetID)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, testData, string(data))
+	}
+
+	// The data of another dataset
+	buf, err := hex.DecodeString(testChunked)
+	require.NoError(t, err)
+	_, err = env.NewReader(bytes.NewReader(buf), []byte("another"))
+	require.Error(t, err)
+
+	_, err = env.NewReader(bytes.NewReader(buf), nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,289 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"golang.org/x/xerrors"
+)
+
+// File is a file of a multi-file dataset, like a table, a codebook or an
+// image. Each file is encrypted with the key of the dataset and stored as its
+// own object on the cloud, under the cloud URL of the dataset. All the hashes
+// are hex encoded.
+type File struct {
+	// Path is the path of the file in the directory of the dataset, like
+	// 'tables/patients.csv'
+	Path string `json:"path"`
+	// Object is the name of the encrypted file on the cloud, relative to the
+	// cloud URL of the dataset
+	Object string `json:"object"`
+	// CiphertextSHA2 is the SHA-256 of the encrypted file
+	CiphertextSHA2 string `json:"ciphertextSHA2"`
+	// PlaintextSHA2 is the SHA-256 of the unencrypted file
+	PlaintextSHA2 string `json:"plaintextSHA2"`
+	// Size is the size of the encrypted file in bytes
+	Size int64 `json:"size"`
+}
+
+// FileObject returns the name of the object of the i-th file of a dataset.
+// The paths are not used so that they don't have to be escaped.
+func FileObject(i int) string {
+	return fmt.Sprintf("%04d.aes", i)
+}
+
+// CheckPath checks that the path of a file stays in the directory of the
+// dataset once restored. It must be relative, with '/' as separator, and
+// without '..' or control characters.
+func CheckPath(p string) error {
+	if p == "" {
+		return xerrors.New("the path is empty")
+	}
+	if strings.IndexFunc(p, unicode.IsControl) != -1 ||
+		strings.Contains(p, "\\") {
+
+		return xerrors.Errorf("the path '%s' has forbidden characters", p)
+	}
+	if path.IsAbs(p) || path.Clean(p) != p || p == "." ||
+		p == ".." || strings.HasPrefix(p, "../") {
+
+		return xerrors.Errorf("the path '%s' is not a clean relative path", p)
+	}
+
+	return nil
+}
+
+// EncryptFile encrypts a file of a multi-file dataset read from r to w, with
+// a random nonce prefix, and returns its entry in the manifest. The nonce
+// prefix of the options is not used.
+func (e *Envelope) EncryptFile(w io.Writer, r io.Reader, filePath,
+	object string, opts Options) (*File, error) {
+
+	err := CheckPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.NoncePrefix = make([]byte, chunked.NoncePrefixSize)
+	_, err = rand.Read(opts.NoncePrefix)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate the nonce prefix: %v",
+			err)
+	}
+
+	manifest, err := e.EncryptManifest(w, r, opts)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encrypt '%s': %v", filePath, err)
+	}
+
+	return &File{
+		Path:           filePath,
+		Object:         object,
+		CiphertextSHA2: manifest.CiphertextSHA2,
+		PlaintextSHA2:  manifest.PlaintextSHA2,
+		Size:           manifest.Size,
+	}, nil
+}
+
+// NewFilesManifest returns the manifest of a multi-file dataset. Its
+// unencrypted SHA2 is the one of its files, see FilesSHA2. The manifest still
+// has to be signed by the owner.
+func NewFilesManifest(datasetID []byte, files []File) (*Manifest, error) {
+	m := &Manifest{
+		DatasetID:     hex.EncodeToString(datasetID),
+		PlaintextSHA2: FilesSHA2(files),
+		Version:       uint32(chunked.Version),
+		Files:         files,
+	}
+
+	err := m.CheckFileList()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// FilesSHA2 returns the SHA2 of a multi-file dataset, which is the SHA-256 of
+// the paths and the unencrypted SHA2 of its files. It is stored as the SHA2 of
+// the dataset in the catalog.
+func FilesSHA2(files []File) string {
+	hash := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(hash, "%s\n%s\n", f.Path, f.PlaintextSHA2)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// IsMultiFile tells if the manifest is the one of a multi-file dataset
+func (m Manifest) IsMultiFile() bool {
+	return len(m.Files) != 0
+}
+
+// CheckFile reads an encrypted file of the dataset from r and checks that it
+// matches its entry in the manifest
+func (m Manifest) CheckFile(f File, r io.Reader) error {
+	err := m.fileManifest(f).Check(r)
+	if err != nil {
+		return xerrors.Errorf("the file '%s' doesn't match the manifest: %v",
+			f.Path, err)
+	}
+
+	return nil
+}
+
+// CheckFiles checks all the files of a multi-file dataset, opened by their
+// object name with open
+func (m Manifest) CheckFiles(open func(object string) (io.ReadCloser,
+	error)) error {
+
+	if !m.IsMultiFile() {
+		return xerrors.New("the manifest is not the one of a multi-file " +
+			"dataset")
+	}
+
+	err := m.CheckFileList()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range m.Files {
+		r, err := open(f.Object)
+		if err != nil {
+			return xerrors.Errorf("failed to open the file '%s': %v", f.Path,
+				err)
+		}
+
+		err = m.CheckFile(f, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreFiles checks and decrypts the files of a multi-file dataset, whose
+// objects are in srcDir, to the directory layout of the dataset in dstDir.
+// The signature of the manifest must have been verified before.
+func (e *Envelope) RestoreFiles(m Manifest, srcDir, dstDir string) error {
+	open := func(object string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(srcDir, filepath.FromSlash(object)))
+	}
+
+	err := m.CheckFiles(open)
+	if err != nil {
+		return err
+	}
+
+	datasetID, err := hex.DecodeString(m.DatasetID)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the dataset ID: %v", err)
+	}
+
+	for _, f := range m.Files {
+		err = e.restoreFile(f, datasetID, open, filepath.Join(dstDir,
+			filepath.FromSlash(f.Path)))
+		if err != nil {
+			return xerrors.Errorf("failed to restore '%s': %v", f.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreFile decrypts a file of a multi-file dataset to dst
+func (e *Envelope) restoreFile(f File, datasetID []byte,
+	open func(string) (io.ReadCloser, error), dst string) error {
+
+	r, err := open(f.Object)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	plainReader, err := e.NewReader(r, datasetID)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, plainReader)
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return out.Close()
+}
+
+// fileManifest returns the manifest of a single file of the dataset
+func (m Manifest) fileManifest(f File) Manifest {
+	return Manifest{
+		DatasetID:      m.DatasetID,
+		CiphertextSHA2: f.CiphertextSHA2,
+		PlaintextSHA2:  f.PlaintextSHA2,
+		Size:           f.Size,
+		Version:        m.Version,
+	}
+}
+
+// CheckFileList checks the paths and the objects of the files of a multi-file
+// dataset, and its unencrypted SHA2, without the files themselves
+func (m Manifest) CheckFileList() error {
+	if m.CiphertextSHA2 != "" || m.Size != 0 {
+		return xerrors.New("the manifest of a multi-file dataset must not " +
+			"describe a single object")
+	}
+
+	paths := make(map[string]bool)
+	objects := make(map[string]bool)
+
+	for _, f := range m.Files {
+		err := CheckPath(f.Path)
+		if err != nil {
+			return err
+		}
+		err = CheckPath(f.Object)
+		if err != nil {
+			return xerrors.Errorf("wrong object: %v", err)
+		}
+
+		if paths[f.Path] {
+			return xerrors.Errorf("the path '%s' is used twice", f.Path)
+		}
+		if objects[f.Object] {
+			return xerrors.Errorf("the object '%s' is used twice", f.Object)
+		}
+		paths[f.Path] = true
+		objects[f.Object] = true
+	}
+
+	filesSHA2 := FilesSHA2(m.Files)
+	if filesSHA2 != m.PlaintextSHA2 {
+		return xerrors.Errorf("expected the SHA2 of the files %s, got %s",
+			m.PlaintextSHA2, filesSHA2)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package envelope
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPath(t *testing.T) {
+	for _, p := range []string{"a.csv", "tables/a.csv", "a b/c..d"} {
+		require.NoError(t, CheckPath(p), p)
+	}
+
+	for _, p := range []string{"", ".", "..", "../a", "a/../../b", "/a",
+		"a/", "a//b", "./a", "a\\b", "a\nb"} {
+
+		require.Error(t, CheckPath(p), p)
+	}
+}
+
+func TestRestoreFiles(t *testing.T) {
+	env, err := Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+
+	srcDir, err := ioutil.TempDir("", "files")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+
+	data := map[string]string{
+		"codebook.txt":      "a: the first column",
+		"tables/first.csv":  testData,
+		"tables/second.csv": "",
+	}
+	paths := []string{"codebook.txt", "tables/first.csv", "tables/second.csv"}
+
+	files := make([]File, len(paths))
+	for i, p := range paths {
+		encrypted := new(bytes.Buffer)
+		f, err := env.EncryptFile(encrypted, bytes.NewBufferString(data[p]), p,
+			FileObject(i), Options{DatasetID: testDatasetID,
+				Compression: chunked.Gzip})
+		require.NoError(t, err)
+		require.Equal(t, p, f.Path)
+		require.Equal(t, int64(encrypted.Len()), f.Size)
+		files[i] = *f
+
+		err = ioutil.WriteFile(filepath.Join(srcDir, f.Object),
+			encrypted.Bytes(), 0644)
+		require.NoError(t, err)
+	}
+
+	// Each file has its own nonce prefix
+	first, err := os.Open(filepath.Join(srcDir, FileObject(0)))
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := os.Open(filepath.Join(srcDir, FileObject(1)))
+	require.NoError(t, err)
+	defer second.Close()
+	firstHeader, err := chunked.ReadHeader(first)
+	require.NoError(t, err)
+	secondHeader, err := chunked.ReadHeader(second)
+	require.NoError(t, err)
+	require.NotEqual(t, firstHeader.NoncePrefix, secondHeader.NoncePrefix)
+
+	manifest, err := NewFilesManifest(testDatasetID, files)
+	require.NoError(t, err)
+	require.True(t, manifest.IsMultiFile())
+	require.Equal(t, FilesSHA2(files), manifest.PlaintextSHA2)
+	require.Contains(t, string(manifest.Message()), "file:tables/first.csv\n")
+
+	err = manifest.Check(bytes.NewReader(nil))
+	require.EqualError(t, err, "the manifest is the one of a multi-file "+
+		"dataset, its files must be checked one by one")
+
+	dstDir, err := ioutil.TempDir("", "files")
+	require.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+
+	err = env.RestoreFiles(*manifest, srcDir, dstDir)
+	require.NoError(t, err)
+
+	for _, p := range paths {
+		buf, err := ioutil.ReadFile(filepath.Join(dstDir, filepath.FromSlash(p)))
+		require.NoError(t, err)
+		require.Equal(t, data[p], string(buf))
+	}
+
+	// Swapped files
+	swapped := *manifest
+	swapped.Files = append([]File{}, files...)
+	swapped.Files[0].Object, swapped.Files[1].Object = files[1].Object,
+		files[0].Object
+	err = env.RestoreFiles(swapped, srcDir, dstDir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the file 'codebook.txt' doesn't match "+
+		"the manifest")
+
+	// A file with another path
+	moved := *manifest
+	moved.Files = append([]File{}, files...)
+	moved.Files[0].Path = "other.txt"
+	err = env.RestoreFiles(moved, srcDir, dstDir)
+	require.EqualError(t, err, "expected the SHA2 of the files "+
+		manifest.PlaintextSHA2+", got "+FilesSHA2(moved.Files))
+
+	// A file outside of the directory
+	outside := append([]File{}, files...)
+	outside[0].Path = "../codebook.txt"
+	_, err = NewFilesManifest(testDatasetID, outside)
+	require.EqualError(t, err, "the path '../codebook.txt' is not a clean "+
+		"relative path")
+
+	// A modified file
+	err = ioutil.WriteFile(filepath.Join(srcDir, FileObject(2)), []byte("x"),
+		0644)
+	require.NoError(t, err)
+	err = manifest.CheckFiles(func(object string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(srcDir, object))
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the file 'tables/second.csv' doesn't "+
+		"match the manifest")
+}
@@ -0,0 +1,187 @@
+package envelope
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"go.dedis.ch/kyber/v3/group/edwards25519"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"golang.org/x/xerrors"
+)
+
+// ManifestExtension is appended to the name of an encrypted dataset on the
+// cloud to get the name of its signed manifest
+const ManifestExtension = ".manifest"
+
+// suite is the suite of the ed25519 identities, like cothority.Suite
+var suite = edwards25519.NewBlakeSHA256Ed25519()
+
+// Manifest describes an encrypted dataset. It is signed by the owner of the
+// dataset so that the enclave and the data scientist manager can check that
+// the data on the cloud is the one that has been published. All the hashes
+// are hex encoded. The manifest of a multi-file dataset lists its files
+// instead of describing a single encrypted object, see NewFilesManifest.
+type Manifest struct {
+	// DatasetID is the Calypso write instance ID of the dataset
+	DatasetID string `json:"datasetID"`
+	// CiphertextSHA2 is the SHA-256 of the encrypted dataset, as stored on
+	// the cloud
+	CiphertextSHA2 string `json:"ciphertextSHA2"`
+	// PlaintextSHA2 is the SHA-256 of the unencrypted dataset, which is the
+	// SHA2 of the catalog
+	PlaintextSHA2 string `json:"plaintextSHA2"`
+	// Size is the size of the encrypted dataset in bytes
+	Size int64 `json:"size"`
+	// Version is the version of the chunked format of the encrypted dataset
+	Version uint32 `json:"version"`
+	// Files are the files of a multi-file dataset. It is empty for the
+	// datasets made of a single file.
+	Files []File `json:"files,omitempty"`
+}
+
+// Message returns the message signed by the owner
+func (m Manifest) Message() []byte {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "odyssey dataset manifest\ndatasetID:%s\n"+
+		"ciphertextSHA2:%s\nplaintextSHA2:%s\nsize:%d\nversion:%d\n",
+		m.DatasetID, m.CiphertextSHA2, m.PlaintextSHA2, m.Size, m.Version)
+	for _, f := range m.Files {
+		fmt.Fprintf(out, "file:%s\nobject:%s\nciphertextSHA2:%s\n"+
+			"plaintextSHA2:%s\nsize:%d\n", f.Path, f.Object, f.CiphertextSHA2,
+			f.PlaintextSHA2, f.Size)
+	}
+	return []byte(out.String())
+}
+
+// Check reads the encrypted dataset from r and checks that it matches the
+// manifest. The header and the SHA-256 of the unencrypted data stored at the
+// end of the chunked format must also match, which doesn't need the key.
+func (m Manifest) Check(r io.Reader) error {
+	if m.IsMultiFile() {
+		return xerrors.New("the manifest is the one of a multi-file " +
+			"dataset, its files must be checked one by one")
+	}
+
+	hash := sha256.New()
+	counter := &countWriter{}
+
+	header, sum, err := chunked.Inspect(io.TeeReader(r,
+		io.MultiWriter(hash, counter)))
+	if err != nil {
+		return xerrors.Errorf("failed to read the encrypted dataset: %v", err)
+	}
+
+	// Inspect stops at the end of the header with the first version
+	_, err = io.Copy(io.MultiWriter(hash, counter), r)
+	if err != nil {
+		return xerrors.Errorf("failed to read the encrypted dataset: %v", err)
+	}
+
+	if counter.n != m.Size {
+		return xerrors.Errorf("expected %d bytes, got %d", m.Size, counter.n)
+	}
+	ciphertextSHA2 := hex.EncodeToString(hash.Sum(nil))
+	if ciphertextSHA2 != m.CiphertextSHA2 {
+		return xerrors.Errorf("expected the SHA2 %s, got %s", m.CiphertextSHA2,
+			ciphertextSHA2)
+	}
+	if uint32(header.Version) != m.Version {
+		return xerrors.Errorf("expected the version %d, got %d", m.Version,
+			header.Version)
+	}
+	datasetID := hex.EncodeToString(header.DatasetID)
+	if datasetID != m.DatasetID {
+		return xerrors.Errorf("the data belongs to dataset %s, not %s",
+			datasetID, m.DatasetID)
+	}
+	if sum != nil && hex.EncodeToString(sum) != m.PlaintextSHA2 {
+		return xerrors.Errorf("expected the unencrypted SHA2 %s, got %x",
+			m.PlaintextSHA2, sum)
+	}
+
+	return nil
+}
+
+// SignedManifest is a manifest with the signature of the owner of the dataset
+type SignedManifest struct {
+	Manifest Manifest `json:"manifest"`
+	// Signature is the hex encoded signature of the manifest message
+	Signature string `json:"signature"`
+}
+
+// Verify checks the signature of the manifest with the identity of the owner,
+// like 'ed25519:aef123'. Only the ed25519 identities are supported.
+func (sm SignedManifest) Verify(identityStr string) error {
+	if !strings.HasPrefix(identityStr, "ed25519:") {
+		return xerrors.Errorf("only ed25519 identities are supported, "+
+			"got '%s'", identityStr)
+	}
+
+	pointBuf, err := hex.DecodeString(strings.TrimPrefix(identityStr,
+		"ed25519:"))
+	if err != nil {
+		return xerrors.Errorf("failed to decode the identity: %v", err)
+	}
+	public := suite.Point()
+	err = public.UnmarshalBinary(pointBuf)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the identity: %v", err)
+	}
+
+	signature, err := hex.DecodeString(sm.Signature)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the signature: %v", err)
+	}
+
+	err = schnorr.Verify(suite, public, sm.Manifest.Message(), signature)
+	if err != nil {
+		return xerrors.Errorf("wrong signature of the manifest by '%s': %v",
+			identityStr, err)
+	}
+
+	return nil
+}
+
+// EncryptManifest encrypts the data read from r to w like Encrypt, and
+// returns the manifest of the encrypted data. The manifest still has to be
+// signed by the owner.
+func (e *Envelope) EncryptManifest(w io.Writer, r io.Reader,
+	opts Options) (*Manifest, error) {
+
+	hash := sha256.New()
+	counter := &countWriter{}
+
+	plaintextSHA2, err := e.Encrypt(io.MultiWriter(w, hash, counter), r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manifest{
+		DatasetID:      hex.EncodeToString(opts.DatasetID),
+		CiphertextSHA2: hex.EncodeToString(hash.Sum(nil)),
+		PlaintextSHA2:  hex.EncodeToString(plaintextSHA2),
+		Size:           counter.n,
+		Version:        uint32(chunked.Version),
+	}, nil
+}
+
+// countWriter counts the bytes written to it
+type countWriter struct {
+	n int64
+}
+
+// Write implements io.Writer
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// IsManifestOf tells if the manifest is the one of the given dataset and
+// unencrypted SHA2, as found in the catalog
+func (m Manifest) IsManifestOf(datasetID, plaintextSHA2 string) bool {
+	return m.DatasetID == datasetID && m.PlaintextSHA2 == plaintextSHA2
+}
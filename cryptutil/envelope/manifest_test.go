@@ -0,0 +1,110 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+)
+
+func TestManifest_Check(t *testing.T) {
+	env, err := Decode(testKeyAndInitVal)
+	require.NoError(t, err)
+
+	encrypted := new(bytes.Buffer)
+	manifest, err := env.EncryptManifest(encrypted, bytes.NewBufferString(testData),
+		Options{DatasetID: testDatasetID, Compression: chunked.Gzip})
+	require.NoError(t, err)
+
+	sha2, err := Hash(bytes.NewBufferString(testData))
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(testDatasetID), manifest.DatasetID)
+	require.Equal(t, hex.EncodeToString(sha2), manifest.PlaintextSHA2)
+	require.Equal(t, int64(encrypted.Len()), manifest.Size)
+	require.Equal(t, uint32(chunked.Version), manifest.Version)
+	require.True(t, manifest.IsManifestOf(hex.EncodeToString(testDatasetID),
+		hex.EncodeToString(sha2)))
+
+	err = manifest.Check(bytes.NewReader(encrypted.Bytes()))
+	require.NoError(t, err)
+
+	// A modified dataset
+	modified := append([]byte{}, encrypted.Bytes()...)
+	modified[len(modified)-chunked.HashSize-1] ^= 1
+	err = manifest.Check(bytes.NewReader(modified))
+	require.EqualError(t, err, "expected the SHA2 "+manifest.CiphertextSHA2+
+		", got "+hex.EncodeToString(hashOf(t, modified)))
+
+	// A truncated dataset
+	err = manifest.Check(bytes.NewReader(encrypted.Bytes()[:encrypted.Len()-1]))
+	require.Error(t, err)
+
+	// The manifest of another dataset
+	other := *manifest
+	other.DatasetID = "aa"
+	err = other.Check(bytes.NewReader(encrypted.Bytes()))
+	require.EqualError(t, err, "the data belongs to dataset "+
+		hex.EncodeToString(testDatasetID)+", not aa")
+
+	other = *manifest
+	other.PlaintextSHA2 = "aa"
+	err = other.Check(bytes.NewReader(encrypted.Bytes()))
+	require.EqualError(t, err, "expected the unencrypted SHA2 aa, got "+
+		hex.EncodeToString(sha2))
+
+	// The second version of the format is checked the same way
+	v2, err := hex.DecodeString(testChunkedV2)
+	require.NoError(t, err)
+	err = (Manifest{
+		DatasetID:      hex.EncodeToString(testDatasetID),
+		CiphertextSHA2: hex.EncodeToString(hashOf(t, v2)),
+		PlaintextSHA2:  hex.EncodeToString(sha2),
+		Size:           int64(len(v2)),
+		Version:        2,
+	}).Check(bytes.NewReader(v2))
+	require.NoError(t, err)
+}
+
+func TestSignedManifest_Verify(t *testing.T) {
+	secret := suite.Scalar().Pick(suite.RandomStream())
+	identityStr := "ed25519:" + suite.Point().Mul(secret, nil).String()
+
+	manifest := Manifest{
+		DatasetID:      hex.EncodeToString(testDatasetID),
+		CiphertextSHA2: "aa",
+		PlaintextSHA2:  "bb",
+		Size:           42,
+		Version:        uint32(chunked.Version),
+	}
+	signature, err := schnorr.Sign(suite, secret, manifest.Message())
+	require.NoError(t, err)
+
+	signed := SignedManifest{
+		Manifest:  manifest,
+		Signature: hex.EncodeToString(signature),
+	}
+	require.NoError(t, signed.Verify(identityStr))
+
+	// Another owner
+	otherSecret := suite.Scalar().Pick(suite.RandomStream())
+	otherIdentityStr := "ed25519:" + suite.Point().Mul(otherSecret, nil).String()
+	require.Error(t, signed.Verify(otherIdentityStr))
+
+	// A modified manifest
+	modified := signed
+	modified.Manifest.Size = 43
+	require.Error(t, modified.Verify(identityStr))
+
+	err = signed.Verify("x509ec:aa")
+	require.EqualError(t, err, "only ed25519 identities are supported, got 'x509ec:aa'")
+}
+
+// hashOf returns the SHA-256 of the data
+func hashOf(t *testing.T, data []byte) []byte {
+	sha2, err := Hash(bytes.NewReader(data))
+	require.NoError(t, err)
+	return sha2
+}
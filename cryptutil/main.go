@@ -1,14 +1,14 @@
 // This package provides a utility command line to encrypt and decrypt data with
-// the "crypto/aes" library on AES-128 GCM.
+// AES-128 GCM, using the "envelope" package. With --chunked, the data is
+// encrypted as a stream in the format of the "chunked" package.
 // Install with "go install" and see help with "cryptutil -h"
 
 package main
 
 import (
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -16,8 +16,12 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/dedis/odyssey/cryptutil/envelope"
 	"github.com/urfave/cli"
 )
 
@@ -27,7 +31,7 @@ var gitTag = "dev"
 
 func init() {
 	cliApp.Name = "cryptutil"
-	cliApp.Usage = "Encrypt and decrypt data with AES-128 GCM."
+	cliApp.Usage = "Encrypt and decrypt data with AES-GCM or ChaCha20-Poly1305."
 	cliApp.Version = gitTag
 	cliApp.Commands = cli.Commands{
 		cli.Command{
@@ -42,7 +46,7 @@ func init() {
 				},
 				cli.StringFlag{
 					Name:  "key, k",
-					Usage: "the 128 bit key to use encoded as hexadecimal string (= 16 hex chars)",
+					Usage: "the 128 or 256 bits key to use encoded as hexadecimal string (= 32 or 64 hex chars)",
 				},
 				cli.StringFlag{
 					Name:  "initVal, iv",
@@ -50,7 +54,7 @@ func init() {
 				},
 				cli.StringFlag{
 					Name:  "keyAndInitVal",
-					Usage: "The key and initialization value as one 56 chars hex string (key || initVal). If used, the arguments --key and --initVal are not used.",
+					Usage: "The key and initialization value as one 56 or 88 chars hex string (key || initVal). If used, the arguments --key and --initVal are not used.",
 				},
 				cli.BoolFlag{
 					Name:  "readData, rd",
@@ -60,12 +64,34 @@ func init() {
 					Name:  "export, x",
 					Usage: "do not print the encrypted data but sends it to stdout",
 				},
+				cli.BoolFlag{
+					Name:  "chunked",
+					Usage: "use the chunked format, which encrypts the data as a stream with a constant amount of memory. The first 7 bytes of the initialization value are used as the nonce prefix",
+				},
+				cli.IntFlag{
+					Name:  "chunkSize",
+					Value: chunked.DefaultChunkSize,
+					Usage: "the size of the chunks in bytes, used with --chunked",
+				},
+				cli.StringFlag{
+					Name:  "algorithm",
+					Usage: "the algorithm used with --chunked, one of AES-128-GCM, AES-256-GCM or ChaCha20-Poly1305. By default, AES-GCM with the size of the key",
+				},
+				cli.StringFlag{
+					Name:  "datasetID",
+					Usage: "the Calypso write instance ID of the dataset, as hexadecimal string, stored in the header with --chunked",
+				},
+				cli.StringFlag{
+					Name:  "compress",
+					Value: chunked.NoCompression.String(),
+					Usage: "compresses the data before the encryption with --chunked, either none or gzip. The decryption decompresses the data",
+				},
 			},
 		},
 		cli.Command{
 			Name:    "decrypt",
 			Aliases: []string{"d"},
-			Usage:   "Decrypts data",
+			Usage:   "Decrypts data, in the chunked or in the single-shot format",
 			Action:  decrypt,
 			Flags: []cli.Flag{
 				cli.StringFlag{
@@ -74,7 +100,7 @@ func init() {
 				},
 				cli.StringFlag{
 					Name:  "key, k",
-					Usage: "the 128 bit key to use encoded in hexadecimal (32 hex chars)",
+					Usage: "the 128 or 256 bits key to use encoded in hexadecimal (32 or 64 hex chars)",
 				},
 				cli.StringFlag{
 					Name:  "initVal, iv",
@@ -82,7 +108,7 @@ func init() {
 				},
 				cli.StringFlag{
 					Name:  "keyAndInitVal",
-					Usage: "The key and initialization value as one 56 chars hex string (key || initVal). If used, the arguments --key and --initVal are not used.",
+					Usage: "The key and initialization value as one 56 or 88 chars hex string (key || initVal). If used, the arguments --key and --initVal are not used.",
 				},
 				cli.BoolFlag{
 					Name:  "readData, rd",
@@ -92,6 +118,72 @@ func init() {
 					Name:  "export, x",
 					Usage: "do not print the encrypted data but sends it to stdout",
 				},
+				cli.StringFlag{
+					Name:  "datasetID",
+					Usage: "if set, checks that the data belongs to this dataset, given by its Calypso write instance ID as hexadecimal string",
+				},
+			},
+		},
+		cli.Command{
+			Name:    "inspect",
+			Aliases: []string{"i"},
+			Usage:   "Prints the header of data encrypted in the chunked format, without the key",
+			Action:  inspect,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "the encrypted file. By default, reads the data from stdin",
+				},
+			},
+		},
+		cli.Command{
+			Name:   "verify",
+			Usage:  "Checks encrypted data against the manifest signed by the owner of the dataset, without the key",
+			Action: verify,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "manifest, m",
+					Usage: "the file of the signed manifest, in JSON (required)",
+				},
+				cli.StringFlag{
+					Name:  "identity, id",
+					Usage: "the identity of the owner that signed the manifest, like 'ed25519:aef123' (required)",
+				},
+				cli.StringFlag{
+					Name:  "datasetID",
+					Usage: "if set, checks that the manifest is the one of this dataset, given by its Calypso write instance ID as hexadecimal string",
+				},
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "the encrypted file. By default, reads the data from stdin",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "the directory of the encrypted files of a multi-file dataset, named after their object in the manifest. Replaces --file for multi-file datasets",
+				},
+			},
+		},
+		cli.Command{
+			Name:   "restore",
+			Usage:  "Checks and decrypts the files of a multi-file dataset, restoring its directory layout. The manifest must have been verified with 'verify' before",
+			Action: restore,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "manifest, m",
+					Usage: "the file of the signed manifest, in JSON (required)",
+				},
+				cli.StringFlag{
+					Name:  "keyAndInitVal",
+					Usage: "The key and initialization value as one 56 or 88 chars hex string (key || initVal) (required)",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "the directory of the encrypted files, named after their object in the manifest (required)",
+				},
+				cli.StringFlag{
+					Name:  "out, o",
+					Usage: "the directory where the files are decrypted (required)",
+				},
 			},
 		},
 	}
@@ -107,80 +199,46 @@ func main() {
 
 func encrypt(c *cli.Context) error {
 
-	var dataBuf []byte
+	var dataReader io.Reader
 	var err error
 
 	if c.Bool("readData") {
-		dataBuf, err = ioutil.ReadAll(os.Stdin)
-		if err != nil {
-			return errors.New("failed to read data from stdin")
-		}
+		dataReader = os.Stdin
 	} else {
 		data := c.String("data")
 		if data == "" {
 			return errors.New("please provide data with --data")
 		}
-		dataBuf = []byte(data)
+		dataReader = strings.NewReader(data)
 	}
 
-	var key, iv string
-	var keyBuf, ivBuf []byte
-
-	keyAndInitVal := c.String("keyAndInitVal")
-	if keyAndInitVal != "" {
-		keyAndInitValBuf, err := hex.DecodeString(keyAndInitVal)
-		if err != nil {
-			return errors.New("failed to decode keyAndInitVal: " + err.Error())
-		}
-		// 16 bytes = 128 bits, 12 bytes = 96 bits
-		if len(keyAndInitValBuf) != 16+12 {
-			return fmt.Errorf("length of key + initVal must be 224 bits, not %d",
-				len(keyAndInitValBuf)*8)
-		}
-		keyBuf = keyAndInitValBuf[:16]
-		ivBuf = keyAndInitValBuf[16:]
-	} else {
-		key = c.String("key")
-		if key == "" {
-			return errors.New("please provide a key with --key")
-		}
-
-		iv = c.String("initVal")
-		if iv == "" {
-			return errors.New("please provice an initialization value with --initVal")
-		}
+	env, err := getEnvelope(c)
+	if err != nil {
+		return err
+	}
 
-		keyBuf, err = hex.DecodeString(key)
+	algorithm := c.String("algorithm")
+	if algorithm != "" {
+		env.Algorithm, err = chunked.AlgorithmFromString(algorithm)
 		if err != nil {
-			return errors.New("failed to decode key as hexadecimal: " + err.Error())
-		}
-		if len(keyBuf) != 16 {
-			return fmt.Errorf("length of key must be 128 bits, not %d",
-				len(keyBuf)*8)
+			return err
 		}
+	}
 
-		ivBuf, err = hex.DecodeString(iv)
-		if err != nil {
-			return errors.New("failed to decode initVal as hexadecimal: " + err.Error())
-		}
-		if len(ivBuf) != 12 {
-			return fmt.Errorf("length of initialization value must be 96 bits, not %d",
-				len(ivBuf)*8)
-		}
+	if c.Bool("chunked") {
+		return encryptChunked(c, env, dataReader)
 	}
 
-	block, err := aes.NewCipher(keyBuf)
+	dataBuf, err := ioutil.ReadAll(dataReader)
 	if err != nil {
-		return errors.New("failed to create new cipher: " + err.Error())
+		return errors.New("failed to read data: " + err.Error())
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
+	ciphertext, err := env.Seal(dataBuf)
 	if err != nil {
-		return errors.New("failed to create new cipher: " + err.Error())
+		return err
 	}
 
-	ciphertext := aesgcm.Seal(nil, ivBuf, dataBuf, nil)
-
 	if c.Bool("export") {
 		reader := bytes.NewReader(ciphertext)
 		_, err = io.Copy(os.Stdout, reader)
@@ -196,95 +254,272 @@ func encrypt(c *cli.Context) error {
 
 func decrypt(c *cli.Context) error {
 
-	var dataBuf []byte
+	var dataReader io.Reader
 	var err error
 
 	if c.Bool("readData") {
-		dataBuf, err = ioutil.ReadAll(os.Stdin)
-		if err != nil {
-			return errors.New("failed to read data from stdin")
-		}
+		dataReader = os.Stdin
 	} else {
 		data := c.String("data")
 		if data == "" {
 			return errors.New("please provide data with --data")
 		}
-		dataBuf, err = hex.DecodeString(data)
+		dataBuf, err := hex.DecodeString(data)
 		if err != nil {
 			return errors.New("failed to decode data string: " + err.Error())
 		}
+		dataReader = bytes.NewReader(dataBuf)
 	}
 
-	var key, iv string
-	var keyBuf, ivBuf []byte
+	env, err := getEnvelope(c)
+	if err != nil {
+		return err
+	}
 
-	keyAndInitVal := c.String("keyAndInitVal")
-	if keyAndInitVal != "" {
-		keyAndInitValBuf, err := hex.DecodeString(keyAndInitVal)
+	// The chunked format is decrypted as a stream, the single-shot one is
+	// read entirely in memory.
+	var datasetID []byte
+	if c.String("datasetID") != "" {
+		datasetID, err = hex.DecodeString(c.String("datasetID"))
 		if err != nil {
-			return errors.New("failed to decode keyAndInitVal: " + err.Error())
-		}
-		// 16 bytes = 128 bits, 12 bytes = 96 bits
-		if len(keyAndInitValBuf) != 16+12 {
-			return fmt.Errorf("length of key + initVal must be 224 bits, not %d",
-				len(keyAndInitValBuf)*8)
-		}
-		keyBuf = keyAndInitValBuf[:16]
-		ivBuf = keyAndInitValBuf[16:]
-	} else {
-		key = c.String("key")
-		if key == "" {
-			return errors.New("please provide a key with --key")
+			return errors.New("failed to decode datasetID: " + err.Error())
 		}
+	}
 
-		iv = c.String("initVal")
-		if iv == "" {
-			return errors.New("please provice an initialization value with --initVal")
-		}
+	plainReader, err := env.NewReader(dataReader, datasetID)
+	if err != nil {
+		return errors.New("failed to decode: " + err.Error())
+	}
 
-		keyBuf, err = hex.DecodeString(key)
+	if c.Bool("export") {
+		_, err = io.Copy(os.Stdout, plainReader)
 		if err != nil {
-			return errors.New("failed to decode key as hexadecimal: " + err.Error())
-		}
-		if len(keyBuf) != 16 {
-			return fmt.Errorf("length of key must be 128 bits, not %d",
-				len(keyBuf)*8)
+			return errors.New("failed to copy to stdout: " + err.Error())
 		}
+		return nil
+	}
 
-		ivBuf, err = hex.DecodeString(iv)
+	_, err = io.Copy(c.App.Writer, plainReader)
+	if err != nil {
+		return errors.New("failed to decode: " + err.Error())
+	}
+	fmt.Fprintln(c.App.Writer)
+	return nil
+}
+
+// encryptChunked encrypts the data as a stream in the chunked format
+func encryptChunked(c *cli.Context, env *envelope.Envelope,
+	dataReader io.Reader) error {
+
+	var out io.Writer = os.Stdout
+	if !c.Bool("export") {
+		out = hex.NewEncoder(c.App.Writer)
+	}
+
+	datasetID, err := hex.DecodeString(c.String("datasetID"))
+	if err != nil {
+		return errors.New("failed to decode datasetID: " + err.Error())
+	}
+
+	compression, err := chunked.CompressionFromString(c.String("compress"))
+	if err != nil {
+		return err
+	}
+
+	writer, err := env.NewWriter(out, envelope.Options{
+		DatasetID:   datasetID,
+		Compression: compression,
+		ChunkSize:   c.Int("chunkSize"),
+	})
+	if err != nil {
+		return errors.New("failed to create the writer: " + err.Error())
+	}
+
+	_, err = io.Copy(writer, dataReader)
+	if err != nil {
+		return errors.New("failed to encrypt: " + err.Error())
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return errors.New("failed to encrypt: " + err.Error())
+	}
+
+	if !c.Bool("export") {
+		fmt.Fprintln(c.App.Writer)
+	}
+	return nil
+}
+
+// inspect prints the header of data encrypted in the chunked format
+func inspect(c *cli.Context) error {
+	var dataReader io.Reader = os.Stdin
+
+	if c.String("file") != "" {
+		file, err := os.Open(c.String("file"))
 		if err != nil {
-			return errors.New("failed to decode initVal as hexadecimal: " + err.Error())
-		}
-		if len(ivBuf) != 12 {
-			return fmt.Errorf("length of initialization value must be 96 bits, not %d",
-				len(ivBuf)*8)
+			return errors.New("failed to open file: " + err.Error())
 		}
+		defer file.Close()
+		dataReader = file
 	}
 
-	block, err := aes.NewCipher(keyBuf)
+	header, sum, err := chunked.Inspect(dataReader)
 	if err != nil {
-		return errors.New("failed to create new cipher: " + err.Error())
+		return errors.New("failed to inspect the data, it might be sealed at " +
+			"once, a format without header: " + err.Error())
 	}
 
-	aesgcm, err := cipher.NewGCM(block)
+	fmt.Fprintf(c.App.Writer, "Version: %d\n", header.Version)
+	fmt.Fprintf(c.App.Writer, "Algorithm: %s\n", header.Algorithm)
+	fmt.Fprintf(c.App.Writer, "Compression: %s\n", header.Compression)
+	fmt.Fprintf(c.App.Writer, "Chunk size: %d\n", header.ChunkSize)
+	fmt.Fprintf(c.App.Writer, "Nonce prefix: %x\n", header.NoncePrefix)
+	fmt.Fprintf(c.App.Writer, "Dataset ID: %x\n", header.DatasetID)
+	fmt.Fprintf(c.App.Writer, "SHA-256: %x\n", sum)
+
+	return nil
+}
+
+// verify checks the signature of a manifest and that the encrypted data
+// matches it
+func verify(c *cli.Context) error {
+	if c.String("manifest") == "" {
+		return errors.New("please provide the manifest with --manifest")
+	}
+	identity := c.String("identity")
+	if identity == "" {
+		return errors.New("please provide the identity of the owner with " +
+			"--identity")
+	}
+
+	signed, err := readManifest(c.String("manifest"))
 	if err != nil {
-		return errors.New("failed to create new cipher: " + err.Error())
+		return err
 	}
 
-	ciphertext, err := aesgcm.Open(nil, ivBuf, dataBuf, nil)
+	err = signed.Verify(identity)
 	if err != nil {
-		return errors.New("failed to decode: " + err.Error())
+		return err
 	}
 
-	if c.Bool("export") {
-		reader := bytes.NewReader(ciphertext)
-		_, err = io.Copy(os.Stdout, reader)
+	datasetID := c.String("datasetID")
+	if datasetID != "" && datasetID != signed.Manifest.DatasetID {
+		return errors.New("the manifest is the one of dataset " +
+			signed.Manifest.DatasetID + ", not " + datasetID)
+	}
+
+	if signed.Manifest.IsMultiFile() {
+		dir := c.String("dir")
+		if dir == "" {
+			return errors.New("the manifest is the one of a multi-file " +
+				"dataset, please provide the directory of its files with --dir")
+		}
+
+		err = signed.Manifest.CheckFiles(func(object string) (io.ReadCloser,
+			error) {
+			return os.Open(filepath.Join(dir, filepath.FromSlash(object)))
+		})
 		if err != nil {
-			return errors.New("failed to copy to stdout: " + err.Error())
+			return errors.New("the data doesn't match the manifest: " +
+				err.Error())
 		}
+
+		fmt.Fprintf(c.App.Writer, "The %d files match the manifest of "+
+			"dataset %s signed by %s\n", len(signed.Manifest.Files),
+			signed.Manifest.DatasetID, identity)
 		return nil
 	}
 
-	fmt.Fprintf(c.App.Writer, "%s\n", string(ciphertext))
+	var dataReader io.Reader = os.Stdin
+
+	if c.String("file") != "" {
+		file, err := os.Open(c.String("file"))
+		if err != nil {
+			return errors.New("failed to open file: " + err.Error())
+		}
+		defer file.Close()
+		dataReader = file
+	}
+
+	err = signed.Manifest.Check(dataReader)
+	if err != nil {
+		return errors.New("the data doesn't match the manifest: " + err.Error())
+	}
+
+	fmt.Fprintf(c.App.Writer, "The data matches the manifest of dataset %s "+
+		"signed by %s\n", signed.Manifest.DatasetID, identity)
+
 	return nil
 }
+
+// restore checks and decrypts the files of a multi-file dataset
+func restore(c *cli.Context) error {
+	if c.String("manifest") == "" {
+		return errors.New("please provide the manifest with --manifest")
+	}
+	if c.String("keyAndInitVal") == "" {
+		return errors.New("please provide the key with --keyAndInitVal")
+	}
+	if c.String("dir") == "" || c.String("out") == "" {
+		return errors.New("please provide the directories with --dir and --out")
+	}
+
+	signed, err := readManifest(c.String("manifest"))
+	if err != nil {
+		return err
+	}
+
+	env, err := envelope.Decode(c.String("keyAndInitVal"))
+	if err != nil {
+		return err
+	}
+
+	err = env.RestoreFiles(signed.Manifest, c.String("dir"), c.String("out"))
+	if err != nil {
+		return errors.New("failed to restore the files: " + err.Error())
+	}
+
+	for _, f := range signed.Manifest.Files {
+		fmt.Fprintln(c.App.Writer, f.Path)
+	}
+
+	return nil
+}
+
+// readManifest reads a signed manifest from a JSON file
+func readManifest(path string) (*envelope.SignedManifest, error) {
+	manifestBuf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("failed to read the manifest: " + err.Error())
+	}
+
+	signed := &envelope.SignedManifest{}
+	err = json.Unmarshal(manifestBuf, signed)
+	if err != nil {
+		return nil, errors.New("failed to decode the manifest: " + err.Error())
+	}
+
+	return signed, nil
+}
+
+// getEnvelope returns the envelope from either --keyAndInitVal or --key and
+// --initVal
+func getEnvelope(c *cli.Context) (*envelope.Envelope, error) {
+	keyAndInitVal := c.String("keyAndInitVal")
+	if keyAndInitVal != "" {
+		return envelope.Decode(keyAndInitVal)
+	}
+
+	key := c.String("key")
+	if key == "" {
+		return nil, errors.New("please provide a key with --key")
+	}
+
+	iv := c.String("initVal")
+	if iv == "" {
+		return nil, errors.New("please provice an initialization value with --initVal")
+	}
+
+	return envelope.DecodeKeyAndNonce(key, iv)
+}
@@ -7,6 +7,7 @@ main() {
     setUp
     testEncrypt
     testDecrypt
+    testChunked
     endUp
 }
 
@@ -154,4 +155,73 @@ testDecrypt() {
     matchOK "$OUTRES" "^$expected$"
 }
 
+testChunked() {
+    echo "* testChunked"
+    key="00112233445566778899aabbccddeeff00112233445566778899aabb"
+    testFail $cryptutil encrypt --data "Hello world." --keyAndInitVal $key --chunked --chunkSize -1
+
+    # The chunked format starts with the "ODYC" magic, the version and the algorithm
+    OUTRES=$($cryptutil encrypt --data "Hello world." --keyAndInitVal $key --chunked --chunkSize 4)
+    matchOK "$OUTRES" "^4f4459430301"
+    OUTRES=$($cryptutil decrypt --data "$OUTRES" --keyAndInitVal $key)
+    matchOK "$OUTRES" "^Hello world.$"
+
+    # Streaming from a file that spans several chunks
+    head -c 300000 /dev/urandom > $test_folder/random.bin
+    $cryptutil encrypt --keyAndInitVal $key --chunked --readData -x < $test_folder/random.bin > $test_folder/random.bin.aes
+    $cryptutil decrypt --keyAndInitVal $key --readData -x < $test_folder/random.bin.aes > $test_folder/random.bin.dec
+    testOK cmp $test_folder/random.bin $test_folder/random.bin.dec
+
+    # The header can be read without the key
+    testFail $cryptutil inspect --file $test_folder/random.bin
+    OUTRES=$($cryptutil inspect --file $test_folder/random.bin.aes)
+    matchOK "$OUTRES" "Algorithm: AES-128-GCM"
+    sum=$(sha256sum $test_folder/random.bin | cut -d ' ' -f 1)
+    matchOK "$OUTRES" "SHA-256: $sum"
+    OUTRES=$($cryptutil inspect < $test_folder/random.bin.aes)
+    matchOK "$OUTRES" "SHA-256: $sum"
+
+    # The dataset ID is checked
+    $cryptutil encrypt --keyAndInitVal $key --chunked --datasetID "aabb" --readData -x < $test_folder/random.bin > $test_folder/random.bin.aes
+    OUTRES=$($cryptutil inspect --file $test_folder/random.bin.aes)
+    matchOK "$OUTRES" "Dataset ID: aabb"
+    testOK $cryptutil decrypt --keyAndInitVal $key --datasetID "aabb" --readData -x < $test_folder/random.bin.aes > /dev/null
+    testFail $cryptutil decrypt --keyAndInitVal $key --datasetID "aabc" --readData -x < $test_folder/random.bin.aes > /dev/null
+
+    # The verification needs the manifest signed by the owner
+    testFail $cryptutil verify --file $test_folder/random.bin.aes
+    testFail $cryptutil verify --manifest $test_folder/missing.manifest --identity "ed25519:aa" --file $test_folder/random.bin.aes
+    testFail $cryptutil restore --manifest $test_folder/missing.manifest --keyAndInitVal $key --dir $test_folder --out $test_folder/restored
+
+    # Other algorithms, with a 256 bits key
+    key256="00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899aabb"
+    testFail $cryptutil encrypt --data "Hello world." --keyAndInitVal $key --chunked --algorithm "ChaCha20-Poly1305"
+    for algorithm in "AES-256-GCM" "ChaCha20-Poly1305"; do
+        $cryptutil encrypt --keyAndInitVal $key256 --chunked --algorithm $algorithm --readData -x < $test_folder/random.bin > $test_folder/random.bin.aes
+        OUTRES=$($cryptutil inspect --file $test_folder/random.bin.aes)
+        matchOK "$OUTRES" "Algorithm: $algorithm"
+        $cryptutil decrypt --keyAndInitVal $key256 --readData -x < $test_folder/random.bin.aes > $test_folder/random.bin.dec
+        testOK cmp $test_folder/random.bin $test_folder/random.bin.dec
+    done
+
+    # Compression before the encryption
+    testFail $cryptutil encrypt --data "Hello world." --keyAndInitVal $key --chunked --compress zip
+    yes "a,b,c,1,2,3" | head -n 100000 > $test_folder/data.csv
+    $cryptutil encrypt --keyAndInitVal $key --chunked --compress gzip --readData -x < $test_folder/data.csv > $test_folder/data.csv.aes
+    OUTRES=$($cryptutil inspect --file $test_folder/data.csv.aes)
+    matchOK "$OUTRES" "Compression: gzip"
+    sum=$(sha256sum $test_folder/data.csv | cut -d ' ' -f 1)
+    matchOK "$OUTRES" "SHA-256: $sum"
+    if [ $(stat -c %s $test_folder/data.csv.aes) -ge $(stat -c %s $test_folder/data.csv) ]; then
+        fail "the compressed dataset is not smaller"
+    fi
+    $cryptutil decrypt --keyAndInitVal $key --readData -x < $test_folder/data.csv.aes > $test_folder/data.csv.dec
+    testOK cmp $test_folder/data.csv $test_folder/data.csv.dec
+
+    # Truncated data must be rejected
+    $cryptutil encrypt --keyAndInitVal $key --chunked --readData -x < $test_folder/random.bin > $test_folder/random.bin.aes
+    head -c 100000 $test_folder/random.bin.aes > $test_folder/random.bin.trunc
+    testFail $cryptutil decrypt --keyAndInitVal $key --readData -x < $test_folder/random.bin.trunc > /dev/null
+}
+
 main
\ No newline at end of file
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/domanager/app/models"
+	xhelpers "github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/gorilla/sessions"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+var auditDateR = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`)
+
+// auditFilter holds the filters of the audit pages, as provided in the query
+// of the URL. They are passed to the audit commands of catadmin.
+type auditFilter struct {
+	FromBlock string
+	ToBlock   string
+	// Since and Until are dates like 2020-01-31
+	Since    string
+	Until    string
+	Backward bool
+	// Hidden holds the parameters of the page that must be kept when the
+	// filter form is submitted.
+	Hidden map[string]string
+}
+
+// parseAuditFilter reads and checks the filter from the query of the request
+func parseAuditFilter(r *http.Request) (auditFilter, error) {
+	query := r.URL.Query()
+	f := auditFilter{
+		FromBlock: query.Get("from_block"),
+		ToBlock:   query.Get("to_block"),
+		Since:     query.Get("since"),
+		Until:     query.Get("until"),
+		Backward:  query.Get("backward") == "on",
+		Hidden:    make(map[string]string),
+	}
+
+	for _, block := range []string{f.FromBlock, f.ToBlock} {
+		if block == "" {
+			continue
+		}
+		n, err := strconv.Atoi(block)
+		if err != nil || n < 0 {
+			return f, xerrors.Errorf("the block index must be a positive "+
+				"number, got '%s'", block)
+		}
+	}
+
+	for _, date := range []string{f.Since, f.Until} {
+		if date != "" && !auditDateR.MatchString(date) {
+			return f, xerrors.Errorf("the date must be like 2020-01-31, got "+
+				"'%s'", date)
+		}
+	}
+
+	return f, nil
+}
+
+// args returns the arguments of the audit commands of catadmin
+func (f auditFilter) args() []string {
+	args := make([]string, 0)
+	if f.FromBlock != "" {
+		args = append(args, "--from-block", f.FromBlock)
+	}
+	if f.ToBlock != "" {
+		args = append(args, "--to-block", f.ToBlock)
+	}
+	if f.Since != "" {
+		args = append(args, "--since", f.Since)
+	}
+	if f.Until != "" {
+		args = append(args, "--until", f.Until)
+	}
+	if f.Backward {
+		args = append(args, "--backward")
+	}
+	return args
+}
+
+// IsSet tells if only a part of the chain is audited
+func (f auditFilter) IsSet() bool {
+	return f.FromBlock != "" || f.ToBlock != "" || f.Since != "" ||
+		f.Until != ""
+}
+
+// ShowOwnerAudit ...
+func ShowOwnerAudit(store sessions.Store, conf *models.Config) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			ownerAuditGet(w, r, store, conf)
+		}
+	}
+}
+
+// ownerAuditGet displays the read requests performed on all the datasets of
+// the logged owner, grouped by project.
+func ownerAuditGet(w http.ResponseWriter, r *http.Request,
+	store sessions.Store, conf *models.Config) {
+
+	type viewData struct {
+		Title      string
+		Flash      []xhelpers.Flash
+		Session    *models.Session
+		OwnerAudit catalogc.OwnerAudit
+	}
+
+	session, err := models.GetSession(store, r)
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", "failed to get session: "+
+			err.Error(), w, r, store)
+		return
+	}
+	if !session.IsLogged() {
+		xhelpers.RedirectWithWarningFlash("/", "You need to be logged in to "+
+			"access this page", w, r, store)
+		return
+	}
+
+	identityStr := session.Cfg.AdminIdentity.String()
+	cmd := exec.Command("./catadmin", "-c", conf.ConfigPath, "audit", "owner",
+		"-i", conf.CatalogID, "-identity", identityStr, "-format", "json",
+		"-bc", session.BcPath)
+
+	log.Info(fmt.Sprintf("command created: %s", cmd.Args))
+	var outb, errb bytes.Buffer
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	err = cmd.Run()
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", fmt.Sprintf("failed to get the "+
+			"audit: %s - Output: %s - Err: %s", err.Error(),
+			outb.String(), errb.String()), w, r, store)
+		return
+	}
+
+	ownerAudit := catalogc.OwnerAudit{}
+	err = json.Unmarshal(outb.Bytes(), &ownerAudit)
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", "failed to unmarshal the audit: "+
+			err.Error(), w, r, store)
+		return
+	}
+
+	t, err := template.New("audit").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04")
+		},
+	}).ParseFiles("views/layout.gohtml", "views/audit.gohtml")
+	if err != nil {
+		fmt.Printf("Error with template: %s\n", err.Error())
+		xhelpers.RedirectWithErrorFlash("/",
+			fmt.Sprintf("<pre>Error with template:\n%s</pre>", err.Error()), w, r, store)
+		return
+	}
+
+	flashes, err := xhelpers.ExtractFlash(w, r, store)
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", "failed to extract flash", w, r, store)
+		return
+	}
+
+	p := &viewData{
+		Title:      "Access report",
+		Flash:      flashes,
+		Session:    session,
+		OwnerAudit: ownerAudit,
+	}
+
+	err = t.ExecuteTemplate(w, "layout", p)
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", fmt.Sprintf(
+			"Error while executing template: %s\n", err.Error()), w, r, store)
+		return
+	}
+}
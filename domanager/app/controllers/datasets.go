@@ -1,18 +1,18 @@
 package controllers
 
 import (
+	"archive/zip"
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -20,6 +20,8 @@ import (
 	"time"
 
 	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/cryptutil/chunked"
+	"github.com/dedis/odyssey/cryptutil/envelope"
 	"github.com/dedis/odyssey/domanager/app/models"
 	xhelpers "github.com/dedis/odyssey/dsmanager/app/helpers"
 	enclavemodels "github.com/dedis/odyssey/enclavem/app/models"
@@ -27,6 +29,7 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/minio/minio-go/v6"
 	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
 )
 
 // DatasetIndexHandler ...
@@ -295,6 +298,20 @@ func datasetsPost(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	// The dataset is compressed before the encryption. The compression is
+	// recorded in the header of the encrypted dataset, so that the enclave
+	// decompresses it when decrypting.
+	compression := chunked.NoCompression
+	if r.PostFormValue("compression") != "" {
+		compression, err = chunked.CompressionFromString(
+			r.PostFormValue("compression"))
+		if err != nil {
+			xhelpers.RedirectWithErrorFlash("/datasets/new", err.Error(), w, r,
+				store)
+			return
+		}
+	}
+
 	// creating the task
 	tef := xhelpers.NewTaskEventFactory("DO Manager")
 	task := conf.TaskManager.NewTask(fmt.Sprintf("Upload of the dataset '%s'", title))
@@ -407,83 +424,62 @@ func datasetsPost(w http.ResponseWriter, r *http.Request,
 		}
 		defer file.Close()
 
-		// Generating the symetric key and the initialization value. We need 16
-		// bytes for the key and 12 bytes for the initialization value
-		task.AddInfo(tef.Source, "generating a symmetric key",
-			"generating a 16 byte symmetric key")
-		key := make([]byte, 16)
-		_, err = rand.Read(key)
-		if err != nil {
-			task.CloseError(tef.Source, "failed to generate key", err.Error())
-			return
-		}
-		task.AddInfo(tef.Source, "generating an nonce", "generating a 12 byte nonce")
-		iv := make([]byte, 12)
-		_, err = rand.Read(iv)
-		if err != nil {
-			task.CloseError(tef.Source, "failed to generate init val", err.Error())
-			return
-		}
-
-		keyHex := hex.EncodeToString(key)
-		ivHex := hex.EncodeToString(iv)
-
-		// Encrypting the dataset
-		task.AddInfo(tef.Source, "encrypting the dataset",
-			"encrypting with AES using the Galois Counter Mode")
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			task.CloseError(tef.Source, "failed to create new cipher", err.Error())
-		}
+		// A dataset made of several files, uploaded together or as a zip
+		// archive, is encrypted file by file with the same key
+		var files []datasetFile
+		headers := r.MultipartForm.File["dataset-file"]
+		if len(headers) > 1 || strings.EqualFold(
+			filepath.Ext(handler.Filename), ".zip") {
 
-		aesgcm, err := cipher.NewGCM(block)
-		if err != nil {
-			task.CloseError(tef.Source, "failed to create new cipher", err.Error())
+			var closeFiles func() error
+			files, closeFiles, err = getDatasetFiles(headers)
+			if err != nil {
+				task.CloseError(tef.Source, "failed to read the files of the "+
+					"dataset", err.Error())
+				return
+			}
+			defer closeFiles()
+			task.AddInfof(tef.Source, "got a multi-file dataset",
+				"found %d files", len(files))
 		}
 
-		fileBuf, err := ioutil.ReadAll(file)
+		// Generating the symetric key and the initialization value. We need 16
+		// bytes for the key and 12 bytes for the initialization value. Only
+		// AES-128 keys fit in the secret of a Calypso write.
+		task.AddInfo(tef.Source, "generating a symmetric key",
+			"generating a 16 byte symmetric key and a 12 byte nonce")
+		env, err := envelope.New(chunked.AES128GCM)
 		if err != nil {
-			task.CloseError(tef.Source, "failed to readAll the file", err.Error())
+			task.CloseError(tef.Source, "failed to generate the envelope",
+				err.Error())
 			return
 		}
-		ciphertext := aesgcm.Seal(nil, iv, fileBuf, nil)
-		ciphertextReader := bytes.NewReader(ciphertext)
-
-		// Uploading the dataset on the cloud
-
-		extension := filepath.Ext(handler.Filename)
-		newFileName := fmt.Sprintf("%s_%s_%s%s.aes", session.GetIdentity(),
-			time.Now().Format("2006_01_02_030405"), url.QueryEscape(title), extension)
-		cloudURL := fmt.Sprintf("dedis/datasets/%s", newFileName)
 
-		task.AddInfof(tef.Source, "uploading the encrypted dataset on the cloud",
-			"saving the encrypted dataset at %s", cloudURL)
-
-		conf.CloudClient.PutObject("datasets", newFileName, ciphertextReader, -1,
-			minio.PutObjectOptions{})
-		if err != nil {
-			task.CloseError(tef.Source, "failed to upload the dataset on the cloud",
-				err.Error())
+		// The name of the encrypted dataset on the cloud. The files of a
+		// multi-file dataset are stored under this name.
+		newFileName := fmt.Sprintf("%s_%s_%s", session.GetIdentity(),
+			time.Now().Format("2006_01_02_030405"), url.QueryEscape(title))
+		if files == nil {
+			newFileName += filepath.Ext(handler.Filename) + ".aes"
 		}
-
-		// Computing the SHA2 of the unencrypted dataset
-
-		task.AddInfo(tef.Source, "computing the SHA2",
-			"using the unencrypted file to compute the SHA2")
-		h := sha256.New()
-		h.Write(fileBuf)
-		sha2 := hex.EncodeToString(h.Sum(nil))
+		cloudURL := fmt.Sprintf("dedis/datasets/%s", newFileName)
 
 		// Creating the calypso write. We need to store the cloud URL because
 		// the enclave will get it by parsing the extra data of the write
-		// instance with `perl -n -e '/"CloudURL": "(.*?)",/ && print $1'`
+		// instance with `perl -n -e '/"CloudURL": "(.*?)",/ && print $1'`. The
+		// URL of the signed manifest tells the enclave that it must check the
+		// dataset before using it. The write is created before the upload so
+		// that its instance ID can be stored in the header of the encrypted
+		// dataset. If the upload fails, the write stays but the dataset is not
+		// added to the catalog.
 		task.AddInfo(tef.Source, "creating a Calypso write", "using csadmin "+
 			"to create the calypso write that contains the symetric key and the nonce")
 		identityStr := session.Cfg.AdminIdentity.String()
 		args := []string{"./csadmin", "-c", conf.ConfigPath, "contract",
 			"write", "spawn", "--darc", newDarcID, "--sign", identityStr, "--bc",
-			session.BcPath, "--instid", conf.LtsID, "--secret", keyHex + ivHex,
+			session.BcPath, "--instid", conf.LtsID, "--secret", env.String(),
 			"--key", conf.LtsKey, "--extraData", "\"CloudURL\": \"" + cloudURL +
+				"\", \"ManifestURL\": \"" + cloudURL + envelope.ManifestExtension +
 				"\", \"IdentityStr\": \"" + identityStr + "\""}
 		outb, err := conf.Executor.Run(args...)
 		log.Info(fmt.Sprintf("command executed: %s", args))
@@ -514,6 +510,128 @@ func datasetsPost(w http.ResponseWriter, r *http.Request,
 
 		log.Info("got this write instance id: " + writeInstID)
 
+		// Encrypting the dataset. The dataset is encrypted as a stream while
+		// it is uploaded, and the SHA2 of the unencrypted dataset is computed
+		// along the way, so that the dataset is never entirely loaded in
+		// memory. The write instance ID is authenticated with the data.
+		writeInstIDBuf, err := hex.DecodeString(writeInstID)
+		if err != nil {
+			task.CloseError(tef.Source, "failed to decode the write ID",
+				err.Error())
+			return
+		}
+
+		opts := envelope.Options{
+			DatasetID:   writeInstIDBuf,
+			Compression: compression,
+		}
+		var manifest *envelope.Manifest
+
+		if files == nil {
+			task.AddInfof(tef.Source, "encrypting the dataset",
+				"encrypting with AES using the Galois Counter Mode, in chunks "+
+					"of %d bytes, with compression '%s'",
+				chunked.DefaultChunkSize, compression)
+
+			task.AddInfof(tef.Source, "uploading the encrypted dataset on the "+
+				"cloud", "saving the encrypted dataset at %s", cloudURL)
+
+			err = encryptAndUpload(conf, newFileName, func(w io.Writer) error {
+				var encryptErr error
+				manifest, encryptErr = env.EncryptManifest(w, file, opts)
+				return encryptErr
+			})
+			if err != nil {
+				task.CloseError(tef.Source, "failed to encrypt and upload the "+
+					"dataset on the cloud", err.Error())
+				return
+			}
+		} else {
+			task.AddInfof(tef.Source, "encrypting the dataset",
+				"encrypting each of the %d files with AES using the Galois "+
+					"Counter Mode, in chunks of %d bytes, with compression '%s'",
+				len(files), chunked.DefaultChunkSize, compression)
+
+			task.AddInfof(tef.Source, "uploading the encrypted dataset on the "+
+				"cloud", "saving the %d encrypted files in %s/", len(files),
+				cloudURL)
+
+			manifestFiles := make([]envelope.File, len(files))
+			for i, f := range files {
+				object := envelope.FileObject(i)
+				err = encryptAndUpload(conf, newFileName+"/"+object,
+					func(w io.Writer) error {
+						r, err := f.open()
+						if err != nil {
+							return err
+						}
+						defer r.Close()
+
+						manifestFile, err := env.EncryptFile(w, r, f.path,
+							object, opts)
+						if err != nil {
+							return err
+						}
+						manifestFiles[i] = *manifestFile
+						return nil
+					})
+				if err != nil {
+					task.CloseError(tef.Source, "failed to encrypt and upload "+
+						"the dataset on the cloud", fmt.Sprintf("failed to "+
+						"upload '%s': %v", f.path, err))
+					return
+				}
+			}
+
+			manifest, err = envelope.NewFilesManifest(writeInstIDBuf,
+				manifestFiles)
+			if err != nil {
+				task.CloseError(tef.Source, "failed to create the manifest",
+					err.Error())
+				return
+			}
+		}
+
+		task.AddInfo(tef.Source, "computing the SHA2",
+			"using the unencrypted file to compute the SHA2")
+		sha2 := manifest.PlaintextSHA2
+
+		// Signing the manifest of the encrypted dataset. The signed manifest
+		// is stored in the catalog and next to the dataset on the cloud, so
+		// that the enclave and the data scientist manager can check that the
+		// dataset has not been modified.
+		manifestBuf, err := json.Marshal(manifest)
+		if err != nil {
+			task.CloseError(tef.Source, "failed to marshal the manifest",
+				err.Error())
+			return
+		}
+
+		task.AddInfo(tef.Source, "signing the manifest", "using catadmin to "+
+			"sign the manifest with the identity of the owner")
+		outb, err = conf.Executor.Run("./catadmin", "-c", conf.ConfigPath,
+			"dataset", "signManifest", "--bc", session.BcPath, "--sign",
+			identityStr, "--manifest", string(manifestBuf))
+		if err != nil {
+			task.CloseError(tef.Source, "failed to sign the manifest",
+				err.Error())
+			return
+		}
+		signedManifest := strings.TrimSpace(outb.String())
+
+		task.AddInfof(tef.Source, "uploading the manifest",
+			"saving the signed manifest at %s%s", cloudURL,
+			envelope.ManifestExtension)
+		_, err = conf.CloudClient.PutObject("datasets",
+			newFileName+envelope.ManifestExtension,
+			strings.NewReader(signedManifest), int64(len(signedManifest)),
+			minio.PutObjectOptions{ContentType: "application/json"})
+		if err != nil {
+			task.CloseError(tef.Source, "failed to upload the manifest",
+				err.Error())
+			return
+		}
+
 		log.Info("now trying to update the catalog")
 
 		args = []string{"./catadmin", "-c", conf.ConfigPath, "contract",
@@ -521,7 +639,8 @@ func datasetsPost(w http.ResponseWriter, r *http.Request,
 			session.Cfg.AdminIdentity.String(), "--bc", session.BcPath,
 			"--instid", conf.CatalogID, "--identityStr", identityStr,
 			"--calypsoWriteID", writeInstID, "--title", title, "--description",
-			description, "--cloudURL", cloudURL, "--sha2", sha2}
+			description, "--cloudURL", cloudURL, "--sha2", sha2,
+			"--manifest", signedManifest}
 		outb, err = conf.Executor.Run(args...)
 		task.AddInfof(tef.Source, "updating the catalog",
 			"using the following command: %v", args)
@@ -1527,8 +1646,16 @@ func datasetsShowAuditGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	cmd := exec.Command("./catadmin", "-c", conf.ConfigPath, "audit",
-		"dataset", "-instid", id, "-bc", session.BcPath)
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash(fmt.Sprintf("/datasets/%s/audit", id),
+			"wrong filter: "+err.Error(), w, r, store)
+		return
+	}
+
+	args := []string{"-c", conf.ConfigPath, "audit", "dataset", "-instid", id,
+		"-bc", session.BcPath}
+	cmd := exec.Command("./catadmin", append(args, filter.args()...)...)
 
 	log.Info(fmt.Sprintf("command created: %s", cmd.Args))
 	var outb, errb bytes.Buffer
@@ -1549,9 +1676,11 @@ func datasetsShowAuditGet(w http.ResponseWriter, r *http.Request,
 		AuditHTML string
 		ID        string
 		ShortID   string
+		Filter    auditFilter
 	}
 
-	t, err := template.ParseFiles("views/layout.gohtml", "views/datasets/audit.gohtml")
+	t, err := template.ParseFiles("views/layout.gohtml", "views/datasets/audit.gohtml",
+		"views/auditfilter.gohtml")
 	if err != nil {
 		fmt.Printf("Error with template: %s\n", err.Error())
 		xhelpers.RedirectWithErrorFlash("/",
@@ -1572,6 +1701,7 @@ func datasetsShowAuditGet(w http.ResponseWriter, r *http.Request,
 		AuditHTML: outb.String(),
 		ID:        id,
 		ShortID:   id[:8] + "...",
+		Filter:    filter,
 	}
 
 	err = t.ExecuteTemplate(w, "layout", p)
@@ -1694,3 +1824,124 @@ func datasetsShowDebugGet(w http.ResponseWriter, r *http.Request,
 	}
 
 }
+
+// datasetFile is a file of a multi-file dataset, uploaded as is or found in a
+// zip archive
+type datasetFile struct {
+	// path is the path of the file in the directory of the dataset
+	path string
+	open func() (io.ReadCloser, error)
+}
+
+// getDatasetFiles returns the files of a multi-file dataset, uploaded either
+// as several files or as a zip archive, whose directories are kept. Only the
+// names of the uploaded files are kept, since the browsers don't send their
+// directory. The returned function must be called once the files have been
+// read.
+func getDatasetFiles(headers []*multipart.FileHeader) ([]datasetFile,
+	func() error, error) {
+
+	if len(headers) == 1 {
+		return getZipFiles(headers[0])
+	}
+
+	files := make([]datasetFile, len(headers))
+	for i, header := range headers {
+		header := header
+		files[i] = datasetFile{
+			path: path.Base(filepath.ToSlash(header.Filename)),
+			open: func() (io.ReadCloser, error) {
+				return header.Open()
+			},
+		}
+	}
+
+	return files, func() error { return nil }, nil
+}
+
+// getZipFiles returns the files of a zip archive. The directories and the
+// metadata added by macOS are skipped. The returned function closes the
+// archive.
+func getZipFiles(header *multipart.FileHeader) ([]datasetFile, func() error,
+	error) {
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to open the archive: %v", err)
+	}
+
+	files, err := readZipFiles(file, header.Size)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return files, file.Close, nil
+}
+
+// readZipFiles reads the list of files of a zip archive. The files are read
+// from r when they are opened.
+func readZipFiles(r io.ReaderAt, size int64) ([]datasetFile, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the archive: %v", err)
+	}
+
+	files := []datasetFile{}
+	for _, zipFile := range zipReader.File {
+		if zipFile.FileInfo().IsDir() ||
+			strings.HasPrefix(zipFile.Name, "__MACOSX/") {
+
+			continue
+		}
+
+		err = envelope.CheckPath(zipFile.Name)
+		if err != nil {
+			return nil, xerrors.Errorf("wrong file in the archive: %v", err)
+		}
+
+		zipFile := zipFile
+		files = append(files, datasetFile{
+			path: zipFile.Name,
+			open: func() (io.ReadCloser, error) {
+				return zipFile.Open()
+			},
+		})
+	}
+
+	if len(files) == 0 {
+		return nil, xerrors.New("the archive is empty")
+	}
+
+	return files, nil
+}
+
+// encryptAndUpload uploads an object on the cloud while it is encrypted by
+// encrypt, as a stream, so that the data is never entirely loaded in memory
+func encryptAndUpload(conf *models.Config, objectName string,
+	encrypt func(w io.Writer) error) error {
+
+	pipeReader, pipeWriter := io.Pipe()
+	encryptChan := make(chan error, 1)
+
+	go func() {
+		err := encrypt(pipeWriter)
+		pipeWriter.CloseWithError(err)
+		encryptChan <- err
+	}()
+
+	_, err := conf.CloudClient.PutObject("datasets", objectName, pipeReader,
+		-1, minio.PutObjectOptions{})
+	// Unblocks the encryption if the upload stopped early, so that we can
+	// wait for it in any case
+	pipeReader.Close()
+	encryptErr := <-encryptChan
+	if err != nil {
+		return xerrors.Errorf("failed to upload: %v", err)
+	}
+	if encryptErr != nil {
+		return xerrors.Errorf("failed to encrypt: %v", encryptErr)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os/exec"
@@ -11,7 +12,9 @@ import (
 	"github.com/dedis/odyssey/catalogc"
 	"github.com/dedis/odyssey/domanager/app/models"
 	xhelpers "github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/dedis/odyssey/projectc"
 	"github.com/gorilla/sessions"
+	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/protobuf"
 	"golang.org/x/xerrors"
@@ -40,6 +43,11 @@ func lifecycleGet(w http.ResponseWriter, r *http.Request,
 		DataScientistID  string
 		EnclaveManagerID string
 		EnclaveID        string
+		// Descriptive fields of the project, read from its instance
+		ProjectTitle        string
+		ProjectDescription  string
+		ProjectOrganisation string
+		Filter              auditFilter
 	}
 
 	session, err := models.GetSession(store, r)
@@ -73,8 +81,17 @@ func lifecycleGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	cmd := exec.Command("./catadmin", "-c", conf.ConfigPath, "audit",
-		"project", "-i", piid[0], "-bc", session.BcPath)
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/lifecycle?piid="+piid[0],
+			"wrong filter: "+err.Error(), w, r, store)
+		return
+	}
+	filter.Hidden["piid"] = piid[0]
+
+	args := []string{"-c", conf.ConfigPath, "audit", "project", "-i", piid[0],
+		"-bc", session.BcPath}
+	cmd := exec.Command("./catadmin", append(args, filter.args()...)...)
 
 	log.Info(fmt.Sprintf("command created: %s", cmd.Args))
 	var outb, errb bytes.Buffer
@@ -94,21 +111,38 @@ func lifecycleGet(w http.ResponseWriter, r *http.Request,
 		xhelpers.RedirectWithErrorFlash("/", "failed to decode audit data: "+err.Error(), w, r, store)
 	}
 
-	dataScientistID, err := func() (string, error) {
+	spawnInstr, err := func() (*byzcoin.Instruction, error) {
 		for _, block := range auditData.Blocks {
 			for _, tx := range block.Transactions {
 				for _, instr := range tx.Instructions {
 					// we assume that only the data scientist signs the spawn request
 					if instr.Spawn != nil {
-						return instr.SignerIdentities[0].String(), nil
+						return instr, nil
 					}
 				}
 			}
 		}
-		return "", xerrors.New("spawn instruction not found")
+		return nil, xerrors.New("spawn instruction not found")
 	}()
-	if err != nil {
+	// The spawn instruction can be out of the range of the filter, in which
+	// case we only display the instructions.
+	if err != nil && !filter.IsSet() {
 		xhelpers.RedirectWithErrorFlash("/", "failed to get the datascientist id: "+err.Error(), w, r, store)
+		return
+	}
+
+	dataScientistID := ""
+	if spawnInstr != nil {
+		dataScientistID = spawnInstr.SignerIdentities[0].String()
+	}
+
+	// The descriptive fields are read from the state of the instance rather
+	// than from the spawn arguments, which may have been changed since.
+	projectData, err := getProjectData(session, piid[0])
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", "failed to get the project: "+
+			err.Error(), w, r, store)
+		return
 	}
 
 	// return an empty string if the invoke:setURL instruction is not found
@@ -147,7 +181,8 @@ func lifecycleGet(w http.ResponseWriter, r *http.Request,
 		"toString": func(buf []byte) string {
 			return string(buf)
 		},
-	}).ParseFiles("views/layout.gohtml", "views/lifecycle.gohtml")
+	}).ParseFiles("views/layout.gohtml", "views/lifecycle.gohtml",
+		"views/auditfilter.gohtml")
 	if err != nil {
 		fmt.Printf("Error with template: %s\n", err.Error())
 		xhelpers.RedirectWithErrorFlash("/",
@@ -170,6 +205,11 @@ func lifecycleGet(w http.ResponseWriter, r *http.Request,
 		DataScientistID:  dataScientistID,
 		EnclaveManagerID: enclaveManagerID,
 		EnclaveID:        enclaveID,
+
+		ProjectTitle:        projectData.Title,
+		ProjectDescription:  projectData.Description,
+		ProjectOrganisation: projectData.Organisation,
+		Filter:              filter,
 	}
 
 	err = t.ExecuteTemplate(w, "layout", p)
@@ -180,3 +220,29 @@ func lifecycleGet(w http.ResponseWriter, r *http.Request,
 	}
 
 }
+
+// getProjectData fetches the project instance with the given hex encoded ID
+// and decodes it.
+func getProjectData(session *models.Session,
+	piid string) (*projectc.ProjectData, error) {
+
+	instIDBuf, err := hex.DecodeString(piid)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the instance id: %v", err)
+	}
+
+	cl := byzcoin.NewClient(session.Cfg.ByzCoinID, session.Cfg.Roster)
+
+	pr, err := cl.GetProofFromLatest(instIDBuf)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get proof: %v", err)
+	}
+
+	projectData := &projectc.ProjectData{}
+	err = projectc.DecodeProjectProof(pr.Proof, instIDBuf, projectData)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get a project instance: %v", err)
+	}
+
+	return projectData, nil
+}
@@ -3,8 +3,6 @@ package main
 import (
 	"context"
 	"encoding/gob"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -14,6 +12,7 @@ import (
 	"os/signal"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dedis/odyssey/domanager/app/controllers"
@@ -23,8 +22,6 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	xlog "go.dedis.ch/onet/v3/log"
-	bolt "go.etcd.io/bbolt"
-	"golang.org/x/xerrors"
 )
 
 type key int
@@ -59,10 +56,17 @@ func main() {
 
 	xlog.LLvl1("here is the catalog id:", conf.CatalogID)
 
-	xlog.Info("loading db into memory")
-	err = loadDb()
+	xlog.Info("opening the db")
+	doStore, err := xhelpers.OpenStore("my.db", "Sessions", "Tasks")
 	if err != nil {
-		log.Fatal("failed to import DB: " + err.Error())
+		log.Fatal("failed to open the DB: " + err.Error())
+	}
+	// The sessions and the tasks are saved each time they change. The sessions
+	// are read when they are needed.
+	models.SetSessionStore(doStore)
+	conf.TaskManager, err = xhelpers.NewStoredTaskManager(doStore, "Tasks")
+	if err != nil {
+		log.Fatal("failed to restore the tasks: " + err.Error())
 	}
 
 	flag.StringVar(&listenAddr, "listen-addr", ":5002", "server listen address")
@@ -94,6 +98,7 @@ func main() {
 	// This endpoint is used by the API to get the task updates with http flush.
 	router.Handle("/tasks/{id}", http.HandlerFunc(dsmanagercontrollers.TasksShowHandler(store, conf.TaskManager)))
 	router.Handle("/lifecycle", http.HandlerFunc(controllers.ShowLifecycle(store, conf)))
+	router.Handle("/audit", http.HandlerFunc(controllers.ShowOwnerAudit(store, conf)))
 
 	nextRequestID := func() string {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
@@ -110,18 +115,12 @@ func main() {
 
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-quit
 		logger.Println("Server is shutting down...")
 
-		logger.Println("Saving memory variables into DB...")
-		err := saveDb()
-		if err != nil {
-			xlog.Error("failed to save the db: " + err.Error())
-		}
-
 		atomic.StoreInt32(&healthy, 0)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -148,6 +147,11 @@ func main() {
 	}
 
 	<-done
+
+	err = doStore.Close()
+	if err != nil {
+		xlog.Error("failed to close the db: " + err.Error())
+	}
 	logger.Println("Server stopped")
 }
 
@@ -193,143 +197,3 @@ func tracing(nextRequestID func() string) func(http.Handler) http.Handler {
 		})
 	}
 }
-
-func loadDb() error {
-	db, err := bolt.Open("my.db", 0600, nil)
-	if err != nil {
-		return errors.New("failed to open DB: " + err.Error())
-	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("Sessions"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to create 'Sessions' bucket: " + err.Error())
-	}
-
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Sessions"))
-		b.ForEach(func(k, v []byte) error {
-			session := &models.Session{}
-			err := json.Unmarshal(v, session)
-			if err != nil {
-				xlog.Error("failed to unmarshal session: " + err.Error())
-				return errors.New("failed to unmarshal session: " + err.Error())
-			}
-			err = session.PrepareAfterUnmarshal()
-			if err != nil {
-				xlog.Error("failed to prepare after marshal: " + err.Error())
-				return errors.New("failed to prepare after marshal: " + err.Error())
-			}
-
-			models.SessionsMap[string(k)] = session
-			return nil
-		})
-		return nil
-	})
-
-	// Tasks
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("Tasks"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to create 'Tasks' bucket: " + err.Error())
-	}
-
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Tasks"))
-		tempTaskList := make([]xhelpers.TaskI, 0)
-		b.ForEach(func(k, v []byte) error {
-			task := &xhelpers.Task{}
-			err := task.UnmarshalBinary(v)
-			if err != nil {
-				xlog.Error("failed to unmarshal task: " + err.Error())
-				return errors.New("failed to unmarshal task: " + err.Error())
-			}
-
-			tempTaskList = append(tempTaskList, task)
-			return nil
-		})
-		err = conf.TaskManager.RestoreTasks(tempTaskList)
-		if err != nil {
-			xlog.Errorf("failed to restore task: %v", err)
-			return xerrors.Errorf("failed to restore task: %v", err)
-		}
-
-		return nil
-	})
-
-	return nil
-}
-
-func saveDb() error {
-	db, err := bolt.Open("my.db", 0600, nil)
-	if err != nil {
-		return errors.New("failed to open DB: " + err.Error())
-	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte("Sessions"))
-		if err != nil {
-			return errors.New("failed to delete the Sessions bucket: " + err.Error())
-		}
-		b, err := tx.CreateBucketIfNotExists([]byte("Sessions"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		for k, session := range models.SessionsMap {
-			session.PrepareBeforeMarshal()
-			sessionBuf, err := json.Marshal(session)
-			if err != nil {
-				return errors.New("failed to marshal session: " + err.Error())
-			}
-			err = b.Put([]byte(k), sessionBuf)
-			if err != nil {
-				return errors.New("failed to save session buf: " + err.Error())
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to update 'Sessions' bucket: " + err.Error())
-	}
-
-	// Task
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte("Tasks"))
-		if err != nil {
-			return errors.New("failed to delete the Tasks bucket: " + err.Error())
-		}
-		b, err := tx.CreateBucketIfNotExists([]byte("Tasks"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-
-		for _, task := range conf.TaskManager.GetSortedTasks() {
-			taskBuf, err := task.MarshalBinary()
-			if err != nil {
-				return xerrors.Errorf("failed to marshall task: %v", err)
-			}
-
-			err = b.Put([]byte(task.GetData().ID), taskBuf)
-			if err != nil {
-				return errors.New("failed to save task buf: " + err.Error())
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to update 'Tasks' bucket: " + err.Error())
-	}
-	return nil
-}
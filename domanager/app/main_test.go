@@ -1,8 +1,10 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/gob"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,11 +13,13 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dedis/odyssey/cryptutil/chunked"
 	"github.com/dedis/odyssey/domanager/app/controllers"
 	"github.com/dedis/odyssey/domanager/app/models"
 	xhelpers "github.com/dedis/odyssey/dsmanager/app/helpers"
@@ -317,7 +321,7 @@ func Test_Dataset_POST(t *testing.T) {
 	}
 	require.Equal(t, "DO Manager", event.Source)
 	require.Equal(t, "generating a symmetric key", event.Message)
-	require.Equal(t, "generating a 16 byte symmetric key", event.Details)
+	require.Equal(t, "generating a 16 byte symmetric key and a 12 byte nonce", event.Details)
 
 	select {
 	case event = <-task.eventChan:
@@ -325,8 +329,17 @@ func Test_Dataset_POST(t *testing.T) {
 		t.Error("event didn't come after timeout")
 	}
 	require.Equal(t, "DO Manager", event.Source)
-	require.Equal(t, "generating an nonce", event.Message)
-	require.Equal(t, "generating a 12 byte nonce", event.Details)
+	require.Equal(t, "creating a Calypso write", event.Message)
+	require.Equal(t, "using csadmin to create the calypso write that contains the symetric key and the nonce", event.Details)
+
+	select {
+	case event = <-task.eventChan:
+	case <-time.After(timeout):
+		t.Error("event didn't come after timeout")
+	}
+	require.Equal(t, "DO Manager", event.Source)
+	require.Equal(t, "getting the write instance ID", event.Message)
+	require.Equal(t, "parsing the output of csadmin to extract the write instance ID", event.Details)
 
 	select {
 	case event = <-task.eventChan:
@@ -335,7 +348,7 @@ func Test_Dataset_POST(t *testing.T) {
 	}
 	require.Equal(t, "DO Manager", event.Source)
 	require.Equal(t, "encrypting the dataset", event.Message)
-	require.Equal(t, "encrypting with AES using the Galois Counter Mode", event.Details)
+	require.Equal(t, "encrypting with AES using the Galois Counter Mode, in chunks of 65536 bytes, with compression 'none'", event.Details)
 
 	select {
 	case event = <-task.eventChan:
@@ -346,9 +359,6 @@ func Test_Dataset_POST(t *testing.T) {
 	require.Equal(t, "uploading the encrypted dataset on the cloud", event.Message)
 	require.True(t, strings.HasSuffix(event.Details, "_dataset+title.txt.aes"))
 
-	// The cloud client should have been called
-	require.True(t, cloudClient.called)
-
 	select {
 	case event = <-task.eventChan:
 	case <-time.After(timeout):
@@ -364,8 +374,7 @@ func Test_Dataset_POST(t *testing.T) {
 		t.Error("event didn't come after timeout")
 	}
 	require.Equal(t, "DO Manager", event.Source)
-	require.Equal(t, "creating a Calypso write", event.Message)
-	require.Equal(t, "using csadmin to create the calypso write that contains the symetric key and the nonce", event.Details)
+	require.Equal(t, "signing the manifest", event.Message)
 
 	select {
 	case event = <-task.eventChan:
@@ -373,8 +382,9 @@ func Test_Dataset_POST(t *testing.T) {
 		t.Error("event didn't come after timeout")
 	}
 	require.Equal(t, "DO Manager", event.Source)
-	require.Equal(t, "getting the write instance ID", event.Message)
-	require.Equal(t, "parsing the output of csadmin to extract the write instance ID", event.Details)
+	require.Equal(t, "uploading the manifest", event.Message)
+	require.True(t, strings.HasSuffix(event.Details, "_dataset+title.txt.aes.manifest"))
+	manifestURL := event.Details
 
 	select {
 	case event = <-task.eventChan:
@@ -384,6 +394,7 @@ func Test_Dataset_POST(t *testing.T) {
 	require.Equal(t, "DO Manager", event.Source)
 	require.Equal(t, "updating the catalog", event.Message)
 	require.True(t, strings.HasPrefix(event.Details, "using the following command: [./catadmin"), "got this instead: %s", event.Details)
+	require.True(t, strings.HasSuffix(event.Details, "--manifest "+fakeSignedManifest+"]"), "got this instead: %s", event.Details)
 
 	select {
 	case event = <-task.eventChan:
@@ -398,6 +409,124 @@ func Test_Dataset_POST(t *testing.T) {
 	case <-time.After(time.Second):
 		t.Error("the task is not done after timeout")
 	}
+
+	// The cloud client should have been called with the encrypted dataset,
+	// which holds the ID of the write instance, and its signed manifest
+	require.True(t, cloudClient.called)
+	require.Len(t, cloudClient.data, 2)
+	dataName := strings.TrimSuffix(path.Base(manifestURL), ".manifest")
+	header, err := chunked.ReadHeader(bytes.NewReader(cloudClient.data[dataName]))
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("aa", 32), hex.EncodeToString(header.DatasetID))
+	require.Equal(t, fakeSignedManifest,
+		string(cloudClient.data[dataName+".manifest"]))
+}
+
+// If I upload a zip archive, each of its files should be encrypted and
+// uploaded as its own object, and listed in the manifest.
+func Test_Dataset_POST_Zip(t *testing.T) {
+	gob.Register(xhelpers.Flash{})
+	gob.Register(models.Session{})
+
+	taskManager := newFakeTaskManager()
+	cloudClient := &fakeCloudClient{}
+
+	store := sessions.NewCookieStore([]byte("TOBECHANGEDOFCOURSE"))
+	conf := &models.Config{
+		TOMLConfig:  &models.TOMLConfig{Standalone: true},
+		TaskManager: taskManager,
+		Executor:    fakeExecutor{},
+		CloudClient: cloudClient,
+	}
+
+	mux := mux.NewRouter()
+	mux.Handle("/showtasks/{id}", controllers.ShowtasksShowHandler(store, conf))
+	mux.Handle("/datasets", controllers.DatasetIndexHandler(store, conf))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+
+	cookie := setSession(t, server.URL)
+
+	// An archive with a directory
+	archive := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(archive)
+	for _, name := range []string{"tables/", "tables/a.csv", "codebook.txt"} {
+		w, err := zipWriter.Create(name)
+		require.NoError(t, err)
+		if !strings.HasSuffix(name, "/") {
+			w.Write([]byte("content of " + name))
+		}
+	}
+	require.NoError(t, zipWriter.Close())
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("dataset-file", "dataset.zip")
+	require.NoError(t, err)
+	part.Write(archive.Bytes())
+	require.NoError(t, writer.WriteField("title", "dataset title"))
+	require.NoError(t, writer.WriteField("description", "dataset description"))
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequest("POST", server.URL+"/datasets", body)
+	require.NoError(t, err)
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	req.Header.Add("Cookie", cookie)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	select {
+	case <-taskManager.called:
+	case <-time.After(time.Second):
+		t.Error("the taskmanager should have been called")
+	}
+	task := taskManager.taskList[0]
+
+	var event xhelpers.TaskEvent
+	var messages []string
+	done := false
+	for !done {
+		select {
+		case event = <-task.eventChan:
+			messages = append(messages, event.Message)
+			if event.Message == "got a multi-file dataset" {
+				require.Equal(t, "found 2 files", event.Details)
+			}
+		case <-task.doneChan:
+			done = true
+		case <-time.After(time.Second):
+			t.Fatal("the task is not done after timeout")
+		}
+	}
+	require.Contains(t, messages, "got a multi-file dataset")
+	require.Equal(t, "dataset created", event.Message, "got this instead: %s",
+		event.Details)
+
+	// The files are stored under the name of the dataset, next to its
+	// manifest
+	require.Len(t, cloudClient.data, 3)
+	var manifestName string
+	for name := range cloudClient.data {
+		if strings.HasSuffix(name, ".manifest") {
+			manifestName = name
+		}
+	}
+	require.True(t, strings.HasSuffix(manifestName, "_dataset+title.manifest"))
+	dataName := strings.TrimSuffix(manifestName, ".manifest")
+	for _, object := range []string{"0000.aes", "0001.aes"} {
+		header, err := chunked.ReadHeader(bytes.NewReader(
+			cloudClient.data[dataName+"/"+object]))
+		require.NoError(t, err)
+		require.Equal(t, strings.Repeat("aa", 32),
+			hex.EncodeToString(header.DatasetID))
+	}
 }
 
 // -----------------------------------------------------------------------------
@@ -417,7 +546,8 @@ func setSession(t *testing.T, url string) string {
 	bcPath := "test/bc-test.cfg"
 	cfg, _, err := lib.LoadConfig(bcPath)
 	require.NoError(t, err)
-	models.SaveSession(randKey, bcPath, &cfg)
+	err = models.SaveSession(randKey, bcPath, &cfg)
+	require.NoError(t, err)
 	err = session.Save(req, w)
 	require.NoError(t, err)
 
@@ -540,20 +670,35 @@ func (fe fakeExecutor) Run(args ...string) (bytes.Buffer, error) {
 		outb.WriteString("blabla\naaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
 	}
 
+	if strings.HasPrefix(cmdString, "./catadmin -c  dataset signManifest ") {
+		outb.WriteString(fakeSignedManifest + "\n")
+	}
+
 	return outb, nil
 }
 
+// fakeSignedManifest is the output of the fake executor when signing a
+// manifest
+const fakeSignedManifest = `{"manifest":{"datasetID":"aa"},"signature":"bb"}`
+
 // Cloud Client
 
 type fakeCloudClient struct {
 	called bool
+	// data contains the uploaded objects by name
+	data map[string][]byte
 }
 
 func (fcc *fakeCloudClient) PutObject(bucketName, objectName string, reader io.Reader, objectSize int64,
 	opts interface{}) (n int64, err error) {
 	fcc.called = true
 
-	return 0, nil
+	if fcc.data == nil {
+		fcc.data = make(map[string][]byte)
+	}
+	buf, err := ioutil.ReadAll(reader)
+	fcc.data[objectName] = buf
+	return int64(len(buf)), err
 }
 
 // GetObject gets an object
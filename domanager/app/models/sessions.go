@@ -1,18 +1,41 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
 	"github.com/gorilla/sessions"
 	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
 	"go.dedis.ch/onet/v3/log"
 	"golang.org/x/xerrors"
 )
 
-// SessionsMap holds the session. It is public so that we can save and restore
-// them from the main.go
-var SessionsMap = map[string]*Session{}
+// sessionsBucket is the bucket of the store that holds the sessions
+const sessionsBucket = "Sessions"
+
+var (
+	// sessionsMap holds the sessions that have been created or read from the
+	// store. It must be used with sessionsLock.
+	sessionsMap  = map[string]*Session{}
+	sessionsLock sync.Mutex
+
+	// sessionStore saves the sessions when they are created or destroyed.
+	// Without it, which is the case in the tests, the sessions are only kept
+	// in memory.
+	sessionStore *helpers.Store
+)
+
+// SetSessionStore sets the store where the sessions are saved and read from.
+// The sessions are only read when they are needed.
+func SetSessionStore(store *helpers.Store) {
+	sessionsLock.Lock()
+	sessionStore = store
+	sessionsMap = map[string]*Session{}
+	sessionsLock.Unlock()
+}
 
 // Session ...
 type Session struct {
@@ -33,16 +56,73 @@ func GetSession(store sessions.Store, r *http.Request) (*Session, error) {
 		return emptySession(), nil
 	}
 
-	sess, found := SessionsMap[key.(string)]
-	if !found {
+	sess, err := loadSession(key.(string))
+	if err != nil {
+		return emptySession(), xerrors.Errorf("failed to load the session: %v",
+			err)
+	}
+	if sess == nil {
 		return emptySession(), nil
 	}
 	return sess, nil
 }
 
-// SaveSession saved the session to the static map
-func SaveSession(ID string, bcPath string, cfg *lib.Config) {
-	SessionsMap[ID] = &Session{bcPath, cfg}
+// loadSession returns the session with the given key, or nil if there is
+// none. It reads it from the store if it has not been used since the start.
+func loadSession(key string) (*Session, error) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	sess, found := sessionsMap[key]
+	if found || sessionStore == nil {
+		return sess, nil
+	}
+
+	buf, err := sessionStore.Get(sessionsBucket, key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read session: %v", err)
+	}
+	if buf == nil {
+		return nil, nil
+	}
+
+	sess = &Session{}
+	err = json.Unmarshal(buf, sess)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal session: %v", err)
+	}
+	err = sess.PrepareAfterUnmarshal()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to prepare after unmarshal: %v", err)
+	}
+
+	sessionsMap[key] = sess
+	return sess, nil
+}
+
+// SaveSession saves the session to the static map and to the store
+func SaveSession(ID string, bcPath string, cfg *lib.Config) error {
+	sess := &Session{bcPath, cfg}
+
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+
+	if sessionStore != nil {
+		// The config is loaded from the bcPath, see PrepareAfterUnmarshal
+		saved := *sess
+		saved.PrepareBeforeMarshal()
+		buf, err := json.Marshal(saved)
+		if err != nil {
+			return xerrors.Errorf("failed to marshal session: %v", err)
+		}
+		err = sessionStore.Put(sessionsBucket, ID, buf)
+		if err != nil {
+			return xerrors.Errorf("failed to save session: %v", err)
+		}
+	}
+
+	sessionsMap[ID] = sess
+	return nil
 }
 
 func emptySession() *Session {
@@ -69,7 +149,10 @@ func LogIn(bcPath string, store sessions.Store, r *http.Request, w http.Response
 	randKey := lib.RandString(12)
 	sess.Values["key"] = randKey
 
-	SaveSession(randKey, bcPath, &cfg)
+	err = SaveSession(randKey, bcPath, &cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to save the session: %v", err)
+	}
 
 	err = sess.Save(r, w)
 	if err != nil {
@@ -137,13 +220,24 @@ func (s Session) Destroy(store sessions.Store, r *http.Request,
 		return xerrors.Errorf("key value not found in the session")
 	}
 
-	_, found = SessionsMap[key.(string)]
-	if !found {
+	saved, err := loadSession(key.(string))
+	if err != nil {
+		return xerrors.Errorf("failed to load the session: %v", err)
+	}
+	if saved == nil {
 		return xerrors.Errorf("session with key '%s' not found in the map", key.(string))
 	}
 
 	log.Info("deleting the session with key", key.(string))
-	delete(SessionsMap, key.(string))
+	sessionsLock.Lock()
+	if sessionStore != nil {
+		err = sessionStore.Delete(sessionsBucket, key.(string))
+	}
+	delete(sessionsMap, key.(string))
+	sessionsLock.Unlock()
+	if err != nil {
+		return xerrors.Errorf("failed to delete the session: %v", err)
+	}
 	delete(sess.Values, key)
 
 	sess.Save(r, w)
@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/dedis/odyssey/dsmanager/app/models"
+	"github.com/gorilla/mux"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// APIPrefix is the path under which the JSON API is served. The API is
+// versioned so that clients like notebooks and pipelines don't break when it
+// evolves.
+const APIPrefix = "/api/v1"
+
+// apiRoute describes an endpoint of the JSON API. The same description is used
+// to register the handler and to generate the OpenAPI document, so that both
+// can't diverge.
+type apiRoute struct {
+	// name is the operationId of the endpoint
+	name    string
+	method  string
+	path    string
+	summary string
+	// request is the type of the JSON body, nil if there is none
+	request interface{}
+	// response is the type of the JSON response, or of each event of a
+	// stream, nil if there is none
+	response interface{}
+	// status is the HTTP status of a successful response
+	status int
+	// stream tells if the response is a stream of events, see writeEvent
+	stream  bool
+	handler func(conf *models.Config) apiHandler
+}
+
+// apiHandler handles a request of the JSON API. The error, if any, is sent to
+// the client as an apiError.
+type apiHandler func(w http.ResponseWriter, r *http.Request) error
+
+// apiParams describes the path parameters of the JSON API
+var apiParams = map[string]struct {
+	description string
+	integer     bool
+}{
+	"id":    {"UID of the project", false},
+	"pid":   {"UID of the project", false},
+	"rid":   {"index of the request in the project", true},
+	"tid":   {"index of the task in the request", true},
+	"index": {"index of the task in the task manager", true},
+}
+
+// apiRoutes lists all the endpoints of the JSON API
+var apiRoutes = []apiRoute{
+	{
+		name: "listDatasets", method: http.MethodGet, path: "/datasets",
+		summary:  "List the datasets of the catalog that are not archived",
+		response: []catalogc.Dataset{}, status: http.StatusOK,
+		handler: apiDatasetsGet,
+	},
+	{
+		name: "listProjects", method: http.MethodGet, path: "/projects",
+		summary:  "List the projects, without their requests",
+		response: []apiProject{}, status: http.StatusOK,
+		handler: apiProjectsGet,
+	},
+	{
+		name: "createProject", method: http.MethodPost, path: "/projects",
+		summary: "Create a project and request the preparation of its " +
+			"enclave",
+		request: apiNewProject{}, response: apiProject{},
+		status: http.StatusAccepted, handler: apiProjectsPost,
+	},
+	{
+		name: "getProject", method: http.MethodGet, path: "/projects/{id}",
+		summary:  "Get a project and its requests",
+		response: apiProject{}, status: http.StatusOK,
+		handler: apiProjectGet,
+	},
+	{
+		name: "deleteProject", method: http.MethodDelete,
+		path: "/projects/{id}", summary: "Delete a project from the " +
+			"manager. Its enclave is not deleted.",
+		status: http.StatusNoContent, handler: apiProjectDelete,
+	},
+	{
+		name: "getProjectStatusStream", method: http.MethodGet,
+		path: "/projects/{id}/status/stream", summary: "Stream the " +
+			"status of a project, starting with the current one, until it " +
+			"stops changing",
+		response: apiStatus{}, status: http.StatusOK, stream: true,
+		handler: apiProjectStatusStream,
+	},
+	{
+		name: "getProjectAttributes", method: http.MethodGet,
+		path: "/projects/{id}/attributes", summary: "Get the attributes " +
+			"of a project, the attributes of the catalog and the datasets " +
+			"of the project",
+		response: apiAttributes{}, status: http.StatusOK,
+		handler: apiProjectAttributesGet,
+	},
+	{
+		name: "updateProjectAttributes", method: http.MethodPut,
+		path: "/projects/{id}/attributes", summary: "Request the update " +
+			"of the attributes of a project",
+		request: apiAttributesUpdate{}, response: apiProject{},
+		status: http.StatusAccepted, handler: apiProjectAttributesPut,
+	},
+	{
+		name: "getProjectEnclave", method: http.MethodGet,
+		path: "/projects/{id}/enclave", summary: "Get the URL of the " +
+			"enclave of a project",
+		response: apiEnclave{}, status: http.StatusOK,
+		handler: apiProjectEnclaveGet,
+	},
+	{
+		name: "prepareProjectEnclave", method: http.MethodPost,
+		path: "/projects/{id}/enclave", summary: "Request the " +
+			"preparation of the enclave of a project, for example after " +
+			"a failure",
+		response: apiProject{}, status: http.StatusAccepted,
+		handler: apiProjectEnclavePost,
+	},
+	{
+		name: "deleteProjectEnclave", method: http.MethodDelete,
+		path: "/projects/{id}/enclave", summary: "Request the deletion " +
+			"of the enclave of a project",
+		response: apiProject{}, status: http.StatusAccepted,
+		handler: apiProjectEnclaveDelete,
+	},
+	{
+		name: "unlockProjectEnclave", method: http.MethodPost,
+		path: "/projects/{id}/unlock", summary: "Request the unlock of " +
+			"the enclave of a project",
+		response: apiProject{}, status: http.StatusAccepted,
+		handler: apiProjectUnlockPost,
+	},
+	{
+		name: "listRequests", method: http.MethodGet,
+		path:     "/projects/{pid}/requests",
+		summary:  "List the requests of a project, oldest first",
+		response: []apiRequest{}, status: http.StatusOK,
+		handler: apiRequestsGet,
+	},
+	{
+		name: "getRequest", method: http.MethodGet,
+		path:     "/projects/{pid}/requests/{rid}",
+		summary:  "Get a request of a project and its tasks",
+		response: apiRequest{}, status: http.StatusOK,
+		handler: apiRequestGet,
+	},
+	{
+		name: "getRequestStatusStream", method: http.MethodGet,
+		path: "/projects/{pid}/requests/{rid}/status/stream",
+		summary: "Stream the status of a request, starting with the " +
+			"current one, until it stops changing",
+		response: apiStatus{}, status: http.StatusOK, stream: true,
+		handler: apiRequestStatusStream,
+	},
+	{
+		name: "getRequestTask", method: http.MethodGet,
+		path:     "/projects/{pid}/requests/{rid}/tasks/{tid}",
+		summary:  "Get a task of a request and its events",
+		response: apiTask{}, status: http.StatusOK,
+		handler: apiRequestTaskGet,
+	},
+	{
+		name: "getRequestTaskStream", method: http.MethodGet,
+		path: "/projects/{pid}/requests/{rid}/tasks/{tid}/stream",
+		summary: "Stream the events of a task of a request, starting " +
+			"with the past ones, until the task ends",
+		response: helpers.TaskEvent{}, status: http.StatusOK, stream: true,
+		handler: apiRequestTaskStream,
+	},
+	{
+		name: "listTasks", method: http.MethodGet, path: "/tasks",
+		summary:  "List the tasks of the manager, newest first",
+		response: []apiTask{}, status: http.StatusOK,
+		handler: apiTasksGet,
+	},
+	{
+		name: "getTask", method: http.MethodGet, path: "/tasks/{index}",
+		summary:  "Get a task of the manager and its events",
+		response: apiTask{}, status: http.StatusOK,
+		handler: apiTaskGet,
+	},
+	{
+		name: "getTaskStream", method: http.MethodGet,
+		path: "/tasks/{index}/stream", summary: "Stream the events of a " +
+			"task of the manager, starting with the past ones, until the " +
+			"task ends",
+		response: helpers.TaskEvent{}, status: http.StatusOK, stream: true,
+		handler: apiTaskStream,
+	},
+}
+
+// apiError is the body of the responses of the JSON API that failed
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiStatusError is an error that sets the HTTP status of the response
+type apiStatusError struct {
+	status int
+	err    error
+}
+
+func (e apiStatusError) Error() string {
+	return e.err.Error()
+}
+
+// apiErrorf returns an error sent with the given HTTP status
+func apiErrorf(status int, format string, args ...interface{}) error {
+	return apiStatusError{status: status, err: xerrors.Errorf(format, args...)}
+}
+
+// RegisterAPI registers the routes of the JSON API and the route of its
+// OpenAPI document on the router.
+func RegisterAPI(router *mux.Router, conf *models.Config) {
+	sub := router.PathPrefix(APIPrefix).Subrouter()
+
+	for _, route := range apiRoutes {
+		sub.Handle(route.path, serveAPI(route.method, route.handler(conf))).
+			Methods(route.method)
+	}
+
+	sub.Handle("/openapi.json", serveAPI(http.MethodGet, apiOpenAPIGet)).
+		Methods(http.MethodGet)
+}
+
+// serveAPI converts an apiHandler to an http.Handler that sends the errors as
+// JSON. Only the GET routes can be read from any origin. The other routes
+// change something and require the JSON content type, even without body: a
+// page from another origin can only send it after a preflight request, which
+// is not answered, so it can't trigger them.
+func serveAPI(method string, handler apiHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if method == http.MethodGet {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Credentials", "false")
+			err = handler(w, r)
+		} else if !isJSONRequest(r) {
+			err = apiErrorf(http.StatusUnsupportedMediaType, "the request "+
+				"must have the 'application/json' Content-Type header")
+		} else {
+			err = handler(w, r)
+		}
+		if err == nil {
+			return
+		}
+
+		status := http.StatusInternalServerError
+		statusErr, ok := err.(apiStatusError)
+		if ok {
+			status = statusErr.status
+		}
+
+		log.Errorf("%s %s failed: %v", r.Method, r.URL.Path, err)
+		writeJSON(w, status, apiError{Error: err.Error()})
+	})
+}
+
+// writeJSON sends value as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		// The header is already sent, we can only log it
+		log.Errorf("failed to encode the response: %v", err)
+	}
+
+	return nil
+}
+
+// isJSONRequest tells if the request has the JSON content type
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// readJSON decodes the JSON body of the request into value
+func readJSON(r *http.Request, value interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(value)
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, "failed to decode the JSON "+
+			"body: %v", err)
+	}
+
+	return nil
+}
+
+// intParam returns the path parameter with the given name as an int
+func intParam(r *http.Request, name string) (int, error) {
+	value, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil {
+		return 0, apiErrorf(http.StatusBadRequest, "the parameter '%s' is "+
+			"not an int: %v", name, err)
+	}
+
+	return value, nil
+}
+
+// eventWriter writes the events of a stream either as server-sent events,
+// which is the default, or as newline delimited JSON if the client asks for it
+// with the 'application/x-ndjson' Accept header or the 'format=ndjson' query.
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ndjson  bool
+}
+
+// newEventWriter checks that the response can be streamed and sends its
+// header
+func newEventWriter(w http.ResponseWriter, r *http.Request) (*eventWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, xerrors.New("the response writer does not support " +
+			"streaming")
+	}
+
+	ndjson := r.URL.Query().Get("format") == "ndjson" ||
+		strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventWriter{w: w, flusher: flusher, ndjson: ndjson}, nil
+}
+
+// writeEvent sends an event of the stream
+func (e *eventWriter) writeEvent(event interface{}) {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("failed to marshal the event: %v", err)
+		return
+	}
+
+	if e.ndjson {
+		fmt.Fprintf(e.w, "%s\n", buf)
+	} else {
+		fmt.Fprintf(e.w, "data: %s\n\n", buf)
+	}
+	e.flusher.Flush()
+}
@@ -0,0 +1,747 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/dedis/odyssey/dsmanager/app/models"
+	"github.com/dedis/odyssey/projectc"
+	"github.com/gorilla/mux"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// datasetIDRegex matches the calypso write IDs of the datasets
+var datasetIDRegex = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// apiNewProject is the body of the request that creates a project
+type apiNewProject struct {
+	// DatasetIDs are the calypso write IDs of the datasets
+	DatasetIDs  []string `json:"datasetIDs"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	// EnclaveManager is the base URL of the enclave manager that must boot
+	// the enclave, one of the configuration. By default the enclave managers
+	// are tried in order.
+	EnclaveManager string `json:"enclaveManager,omitempty"`
+}
+
+// apiProject is the JSON representation of a project
+type apiProject struct {
+	UID         string    `json:"uid"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	InstanceID  string    `json:"instanceID"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// EnclaveManager is empty until an enclave manager accepts to boot the
+	// enclave, unless it was chosen when the project was created
+	EnclaveManager string `json:"enclaveManager"`
+	// Requests is only set when a single project is returned
+	Requests []apiRequest `json:"requests,omitempty"`
+}
+
+// apiRequest is the JSON representation of a request of a project
+type apiRequest struct {
+	Index       int       `json:"index"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	Tasks       []apiTask `json:"tasks"`
+}
+
+// apiTask is the JSON representation of a task
+type apiTask struct {
+	Index       int    `json:"index"`
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	// History is only set when a single task is returned, oldest event first
+	History []*helpers.TaskEvent `json:"history,omitempty"`
+}
+
+// apiStatus is an event of the status streams
+type apiStatus struct {
+	Status string `json:"status"`
+}
+
+// apiAttributes holds the attributes of a project
+type apiAttributes struct {
+	// Metadata holds all the attributes of the catalog
+	Metadata *catalogc.Metadata `json:"metadata"`
+	// ProjectMetadata holds the attributes set on the project
+	ProjectMetadata *catalogc.Metadata  `json:"projectMetadata"`
+	Datasets        []*catalogc.Dataset `json:"datasets"`
+}
+
+// apiAttributesUpdate is the body of the request that updates the attributes
+// of a project
+type apiAttributesUpdate struct {
+	// Attributes maps the ID of the attributes to their new value
+	Attributes map[string]string `json:"attributes"`
+}
+
+// apiEnclave holds the URL of the enclave of a project
+type apiEnclave struct {
+	URL string `json:"url"`
+}
+
+func apiDatasetsGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		datasets, err := getDatasets(conf)
+		if err != nil {
+			return xerrors.Errorf("failed to get the datasets: %v", err)
+		}
+
+		return writeJSON(w, http.StatusOK, datasets)
+	}
+}
+
+func apiProjectsGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		projects, err := models.GetProjects()
+		if err != nil {
+			return err
+		}
+
+		result := make([]apiProject, len(projects))
+		for i, project := range projects {
+			result[i] = toAPIProject(project, false)
+		}
+
+		return writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func apiProjectsPost(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		newProject := apiNewProject{}
+		err := readJSON(r, &newProject)
+		if err != nil {
+			return err
+		}
+
+		if len(newProject.DatasetIDs) == 0 {
+			return apiErrorf(http.StatusBadRequest, "please provide at "+
+				"least one dataset ID")
+		}
+		for _, datasetID := range newProject.DatasetIDs {
+			if !datasetIDRegex.MatchString(datasetID) {
+				return apiErrorf(http.StatusBadRequest, "wrong dataset ID "+
+					"'%s'", datasetID)
+			}
+		}
+
+		if newProject.EnclaveManager != "" &&
+			!conf.IsEnclaveManager(newProject.EnclaveManager) {
+
+			return apiErrorf(http.StatusBadRequest, "unknown enclave manager "+
+				"'%s'", newProject.EnclaveManager)
+		}
+
+		project := models.NewProject(newProject.Title, newProject.Description)
+
+		if newProject.EnclaveManager != "" {
+			project.EnclaveManager = strings.TrimRight(
+				newProject.EnclaveManager, "/")
+			err = project.Save()
+			if err != nil {
+				return xerrors.Errorf("failed to save the project: %v", err)
+			}
+		}
+
+		go func() {
+			request, task := project.RequestCreateProjectInstance(
+				newProject.DatasetIDs, conf)
+			// if either ones are nil that means an error happened and we
+			// must abort.
+			if request == nil || task == nil {
+				return
+			}
+			project.RequestBootEnclave(request, task, conf)
+		}()
+
+		w.Header().Set("Location", APIPrefix+"/projects/"+project.UID)
+		return writeJSON(w, http.StatusAccepted, toAPIProject(project, false))
+	}
+}
+
+func apiProjectGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetProject(r, "id")
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, toAPIProject(project, true))
+	}
+}
+
+func apiProjectDelete(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetProject(r, "id")
+		if err != nil {
+			return err
+		}
+
+		err = models.DeleteProject(project.UID)
+		if err != nil {
+			return err
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func apiProjectStatusStream(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetProject(r, "id")
+		if err != nil {
+			return err
+		}
+
+		events, err := newEventWriter(w, r)
+		if err != nil {
+			return err
+		}
+
+		// We subscribe first so that we can't miss an update
+		client := project.StatusNotifier.Subscribe()
+		streamStatus(r, events, client, string(project.Status))
+		return nil
+	}
+}
+
+func apiProjectAttributesGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetInstantiatedProject(r)
+		if err != nil {
+			return err
+		}
+
+		projectData, err := getProjectData(conf, project.InstanceID)
+		if err != nil {
+			return err
+		}
+
+		datasets := make([]*catalogc.Dataset, len(projectData.Datasets))
+		for i, calypsoWriteID := range projectData.Datasets {
+			datasets[i], err = getDataset(conf, calypsoWriteID.String())
+			if err != nil {
+				return err
+			}
+		}
+
+		metadata, err := getMetadata(conf)
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, apiAttributes{
+			Metadata:        metadata,
+			ProjectMetadata: projectData.Metadata,
+			Datasets:        datasets,
+		})
+	}
+}
+
+func apiProjectAttributesPut(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetInstantiatedProject(r)
+		if err != nil {
+			return err
+		}
+
+		update := apiAttributesUpdate{}
+		err = readJSON(r, &update)
+		if err != nil {
+			return err
+		}
+
+		if len(update.Attributes) == 0 {
+			return apiErrorf(http.StatusBadRequest, "please provide at "+
+				"least one attribute")
+		}
+
+		// We use the same format as the form of the attributes page
+		values := url.Values{}
+		for id, value := range update.Attributes {
+			if id == "" || strings.HasPrefix(id, "_") || value == "" {
+				return apiErrorf(http.StatusBadRequest, "wrong attribute "+
+					"'%s' with value '%s'", id, value)
+			}
+			values.Set(id, value)
+		}
+
+		go func() {
+			project.RequestUpdateAttributes(values, conf)
+		}()
+
+		return writeJSON(w, http.StatusAccepted, toAPIProject(project, false))
+	}
+}
+
+func apiProjectEnclaveGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetInstantiatedProject(r)
+		if err != nil {
+			return err
+		}
+
+		projectData, err := getProjectData(conf, project.InstanceID)
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, apiEnclave{
+			URL: strings.TrimSpace(projectData.EnclaveURL),
+		})
+	}
+}
+
+func apiProjectEnclavePost(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetInstantiatedProject(r)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			project.RequestBootEnclave(nil, nil, conf)
+		}()
+
+		return writeJSON(w, http.StatusAccepted, toAPIProject(project, false))
+	}
+}
+
+func apiProjectEnclaveDelete(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetInstantiatedProject(r)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			project.RequestDeleteEnclave(conf)
+		}()
+
+		return writeJSON(w, http.StatusAccepted, toAPIProject(project, false))
+	}
+}
+
+func apiProjectUnlockPost(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetInstantiatedProject(r)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			project.RequestUnlockEnclave(conf)
+		}()
+
+		return writeJSON(w, http.StatusAccepted, toAPIProject(project, false))
+	}
+}
+
+func apiRequestsGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		project, err := apiGetProject(r, "pid")
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, toAPIProject(project, true).Requests)
+	}
+}
+
+func apiRequestGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		_, request, err := apiGetRequest(r)
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, toAPIRequest(request))
+	}
+}
+
+func apiRequestStatusStream(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		_, request, err := apiGetRequest(r)
+		if err != nil {
+			return err
+		}
+
+		events, err := newEventWriter(w, r)
+		if err != nil {
+			return err
+		}
+
+		client := request.StatusNotifier.Subscribe()
+		streamStatus(r, events, client, string(request.Status))
+		return nil
+	}
+}
+
+func apiRequestTaskGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		task, err := apiGetRequestTask(r)
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, toAPITask(task, true))
+	}
+}
+
+func apiRequestTaskStream(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		task, err := apiGetRequestTask(r)
+		if err != nil {
+			return err
+		}
+
+		events, err := newEventWriter(w, r)
+		if err != nil {
+			return err
+		}
+
+		streamTask(r, events, task)
+		return nil
+	}
+}
+
+func apiTasksGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		tasks := conf.TaskManager.GetSortedTasks()
+
+		result := make([]apiTask, len(tasks))
+		for i, task := range tasks {
+			result[i] = toAPITask(task, false)
+		}
+
+		return writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func apiTaskGet(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		task, err := apiGetTask(r, conf)
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, http.StatusOK, toAPITask(task, true))
+	}
+}
+
+func apiTaskStream(conf *models.Config) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		task, err := apiGetTask(r, conf)
+		if err != nil {
+			return err
+		}
+
+		events, err := newEventWriter(w, r)
+		if err != nil {
+			return err
+		}
+
+		streamTask(r, events, task)
+		return nil
+	}
+}
+
+// apiGetProject returns the project whose UID is the path parameter with the
+// given name
+func apiGetProject(r *http.Request, name string) (*models.Project, error) {
+	id := mux.Vars(r)[name]
+
+	project, ok := models.GetProject(id)
+	if !ok || project == nil {
+		return nil, apiErrorf(http.StatusNotFound, "project '%s' not found",
+			id)
+	}
+
+	return project, nil
+}
+
+// apiGetInstantiatedProject returns the project of the 'id' path parameter if
+// its project instance is created
+func apiGetInstantiatedProject(r *http.Request) (*models.Project, error) {
+	project, err := apiGetProject(r, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	if project.InstanceID == "" {
+		return nil, apiErrorf(http.StatusConflict, "the instance ID of the "+
+			"project is not set yet, either it is being created or its "+
+			"creation failed")
+	}
+
+	return project, nil
+}
+
+// apiGetRequest returns the request of the 'pid' and 'rid' path parameters
+func apiGetRequest(r *http.Request) (*models.Project, *models.Request, error) {
+	project, err := apiGetProject(r, "pid")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rid, err := intParam(r, "rid")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rid < 0 || rid >= len(project.Requests) {
+		return nil, nil, apiErrorf(http.StatusNotFound, "request %d not "+
+			"found in project '%s'", rid, project.UID)
+	}
+
+	return project, project.Requests[rid], nil
+}
+
+// apiGetRequestTask returns the task of the 'pid', 'rid' and 'tid' path
+// parameters
+func apiGetRequestTask(r *http.Request) (helpers.TaskI, error) {
+	_, request, err := apiGetRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tid, err := intParam(r, "tid")
+	if err != nil {
+		return nil, err
+	}
+
+	if tid < 0 || tid >= len(request.Tasks) {
+		return nil, apiErrorf(http.StatusNotFound, "task %d not found in "+
+			"request %d", tid, request.Index)
+	}
+
+	return request.Tasks[tid], nil
+}
+
+// apiGetTask returns the task of the task manager of the 'index' path
+// parameter
+func apiGetTask(r *http.Request, conf *models.Config) (helpers.TaskI, error) {
+	index, err := intParam(r, "index")
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= conf.TaskManager.NumTasks() {
+		return nil, apiErrorf(http.StatusNotFound, "task %d not found", index)
+	}
+
+	return conf.TaskManager.GetTask(index), nil
+}
+
+// streamStatus sends the current status and the updates of a status notifier
+// until it is terminated or the client leaves
+func streamStatus(r *http.Request, events *eventWriter,
+	client *helpers.StatusNotifierSubscriber, current string) {
+
+	events.writeEvent(apiStatus{Status: current})
+
+	for {
+		select {
+		case status := <-client.NotifyStream:
+			events.writeEvent(apiStatus{Status: status})
+		case <-client.Done:
+			// We ensure we empty the stream before exiting
+			for {
+				select {
+				case status := <-client.NotifyStream:
+					events.writeEvent(apiStatus{Status: status})
+				default:
+					return
+				}
+			}
+		case <-r.Context().Done():
+			// The notifier still sends the updates to the client, which must
+			// not block it.
+			go func() {
+				for {
+					select {
+					case <-client.NotifyStream:
+					case <-client.Done:
+						return
+					}
+				}
+			}()
+			return
+		}
+	}
+}
+
+// streamTask sends the past and the new events of a task until it ends or the
+// client leaves
+func streamTask(r *http.Request, events *eventWriter, task helpers.TaskI) {
+	client := task.Subscribe()
+
+	// The history is sorted from the newest to the oldest event
+	for i := len(client.PastEvents) - 1; i >= 0; i-- {
+		events.writeEvent(client.PastEvents[i])
+	}
+
+	for {
+		select {
+		case event := <-client.TaskStream:
+			events.writeEvent(event)
+		case <-client.Done:
+			// We ensure we empty the stream before exiting
+			for {
+				select {
+				case event := <-client.TaskStream:
+					events.writeEvent(event)
+				default:
+					return
+				}
+			}
+		case <-r.Context().Done():
+			// The task still sends its events to the client, which must not
+			// block it.
+			go func() {
+				for {
+					select {
+					case <-client.TaskStream:
+					case <-client.Done:
+						return
+					}
+				}
+			}()
+			return
+		}
+	}
+}
+
+func toAPIProject(project *models.Project, withRequests bool) apiProject {
+	result := apiProject{
+		UID:            project.UID,
+		Title:          project.Title,
+		Description:    project.Description,
+		Status:         string(project.Status),
+		InstanceID:     project.InstanceID,
+		CreatedAt:      project.CreatedAt,
+		EnclaveManager: project.EnclaveManager,
+	}
+
+	if withRequests {
+		result.Requests = make([]apiRequest, len(project.Requests))
+		for i, request := range project.Requests {
+			result.Requests[i] = toAPIRequest(request)
+		}
+	}
+
+	return result
+}
+
+func toAPIRequest(request *models.Request) apiRequest {
+	result := apiRequest{
+		Index:       request.Index,
+		Description: request.Description,
+		Status:      string(request.Status),
+		Tasks:       make([]apiTask, len(request.Tasks)),
+	}
+
+	for i, task := range request.Tasks {
+		result.Tasks[i] = toAPITask(task, false)
+	}
+
+	return result
+}
+
+func toAPITask(task helpers.TaskI, withHistory bool) apiTask {
+	data := task.GetData()
+
+	result := apiTask{
+		Index:       data.Index,
+		ID:          data.ID,
+		Description: data.Description,
+		Status:      string(data.Status),
+		Start:       data.StartD,
+		End:         data.EndD,
+	}
+
+	if withHistory {
+		result.History = make([]*helpers.TaskEvent, len(data.History))
+		for i, event := range data.History {
+			result.History[len(data.History)-1-i] = event
+		}
+	}
+
+	return result
+}
+
+// getProjectData returns the project instance with the given ID
+func getProjectData(conf *models.Config,
+	instanceID string) (*projectc.ProjectData, error) {
+
+	outb, err := conf.Executor.Run("./pcadmin", "contract", "project", "get",
+		"-i", instanceID, "-bc", conf.BCPath, "-x")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get the project instance: %v",
+			err)
+	}
+
+	projectData := &projectc.ProjectData{}
+	err = projectc.DecodeProjectData(outb.Bytes(), projectData)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the project instance: %v",
+			err)
+	}
+
+	return projectData, nil
+}
+
+// getDataset returns the dataset of the catalog with the given calypso write
+// ID
+func getDataset(conf *models.Config, calypsoWriteID string) (*catalogc.Dataset,
+	error) {
+
+	outb, err := conf.Executor.Run("./catadmin", "contract", "catalog",
+		"getSingleDataset", "-i", conf.CatalogID, "--calypsoWriteID",
+		calypsoWriteID, "--bc", conf.BCPath, "--export")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get the dataset '%s': %v",
+			calypsoWriteID, err)
+	}
+
+	dataset := &catalogc.Dataset{}
+	err = protobuf.Decode(outb.Bytes(), dataset)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the dataset: %v", err)
+	}
+
+	return dataset, nil
+}
+
+// getMetadata returns the attributes of the catalog
+func getMetadata(conf *models.Config) (*catalogc.Metadata, error) {
+	outb, err := conf.Executor.Run("./catadmin", "-c", conf.ConfigPath,
+		"contract", "catalog", "getMetadata", "-i", conf.CatalogID, "-bc",
+		conf.BCPath, "--export")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get the metadata: %v", err)
+	}
+
+	metadata := &catalogc.Metadata{}
+	err = protobuf.Decode(outb.Bytes(), metadata)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the metadata: %v", err)
+	}
+	metadata.Reset()
+
+	return metadata, nil
+}
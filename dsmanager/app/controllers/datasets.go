@@ -10,7 +10,6 @@ import (
 	"github.com/dedis/odyssey/dsmanager/app/models"
 	"github.com/gorilla/sessions"
 	"go.dedis.ch/onet/v3/log"
-	"go.dedis.ch/protobuf"
 	"golang.org/x/xerrors"
 )
 
@@ -72,7 +71,7 @@ func getDatasets(conf *models.Config) ([]*catalogc.Dataset, error) {
 	}
 
 	catalog := catalogc.CatalogData{}
-	err = protobuf.Decode(outb.Bytes(), &catalog)
+	err = catalogc.DecodeCatalogData(outb.Bytes(), &catalog)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to decode dataset buffer: %v", err)
 	}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIVersion is the version of the OpenAPI specification of the document
+const openAPIVersion = "3.0.2"
+
+// pathParamRegex matches the path parameters of the routes, like {id}
+var pathParamRegex = regexp.MustCompile(`{([^}]+)}`)
+
+// openAPIObject is a JSON object of the OpenAPI document
+type openAPIObject map[string]interface{}
+
+func apiOpenAPIGet(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, http.StatusOK, openAPIDocument())
+}
+
+// openAPIDocument generates the OpenAPI document of the JSON API from its
+// routes. The schemas are derived from the Go types of the requests and the
+// responses.
+func openAPIDocument() openAPIObject {
+	schemas := openAPIObject{}
+	paths := openAPIObject{}
+
+	for _, route := range apiRoutes {
+		path, ok := paths[route.path].(openAPIObject)
+		if !ok {
+			path = openAPIObject{}
+			paths[route.path] = path
+		}
+		path[strings.ToLower(route.method)] = openAPIOperation(route, schemas)
+	}
+
+	paths["/openapi.json"] = openAPIObject{
+		"get": openAPIObject{
+			"operationId": "getOpenAPI",
+			"summary":     "Get this document",
+			"responses": openAPIObject{
+				"200": openAPIObject{
+					"description": "the OpenAPI document",
+					"content": openAPIObject{
+						"application/json": openAPIObject{
+							"schema": openAPIObject{"type": "object"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return openAPIObject{
+		"openapi": openAPIVersion,
+		"info": openAPIObject{
+			"title": "Data Scientist Manager API",
+			"description": "JSON API of the data scientist manager. The " +
+				"streams send JSON events either as server-sent events or, " +
+				"with the 'application/x-ndjson' Accept header or the " +
+				"'format=ndjson' query, as newline delimited JSON. The " +
+				"requests that are not GET must have the " +
+				"'application/json' Content-Type header, even without body.",
+			"version": "1.0.0",
+		},
+		"servers": []openAPIObject{{"url": APIPrefix}},
+		"paths":   paths,
+		"components": openAPIObject{
+			"schemas": schemas,
+		},
+	}
+}
+
+// openAPIOperation returns the operation object of a route
+func openAPIOperation(route apiRoute, schemas openAPIObject) openAPIObject {
+	operation := openAPIObject{
+		"operationId": route.name,
+		"summary":     route.summary,
+	}
+
+	parameters := []openAPIObject{}
+	for _, match := range pathParamRegex.FindAllStringSubmatch(route.path, -1) {
+		name := match[1]
+		param := apiParams[name]
+		paramType := "string"
+		if param.integer {
+			paramType = "integer"
+		}
+		parameters = append(parameters, openAPIObject{
+			"name":        name,
+			"in":          "path",
+			"required":    true,
+			"description": param.description,
+			"schema":      openAPIObject{"type": paramType},
+		})
+	}
+	if route.stream {
+		parameters = append(parameters, openAPIObject{
+			"name":        "format",
+			"in":          "query",
+			"description": "'ndjson' to get newline delimited JSON",
+			"schema": openAPIObject{
+				"type": "string",
+				"enum": []string{"ndjson"},
+			},
+		})
+	}
+	if len(parameters) != 0 {
+		operation["parameters"] = parameters
+	}
+
+	if route.request != nil {
+		operation["requestBody"] = openAPIObject{
+			"required": true,
+			"content": openAPIObject{
+				"application/json": openAPIObject{
+					"schema": openAPISchema(reflect.TypeOf(route.request),
+						schemas),
+				},
+			},
+		}
+	}
+
+	success := openAPIObject{"description": http.StatusText(route.status)}
+	if route.response != nil {
+		schema := openAPISchema(reflect.TypeOf(route.response), schemas)
+		if route.stream {
+			success["description"] = "a stream of events"
+			success["content"] = openAPIObject{
+				"text/event-stream":    openAPIObject{"schema": schema},
+				"application/x-ndjson": openAPIObject{"schema": schema},
+			}
+		} else {
+			success["content"] = openAPIObject{
+				"application/json": openAPIObject{"schema": schema},
+			}
+		}
+	}
+
+	operation["responses"] = openAPIObject{
+		strconv.Itoa(route.status): success,
+		"default": openAPIObject{
+			"description": "an error",
+			"content": openAPIObject{
+				"application/json": openAPIObject{
+					"schema": openAPISchema(reflect.TypeOf(apiError{}),
+						schemas),
+				},
+			},
+		},
+	}
+
+	return operation
+}
+
+// openAPISchema returns the schema of a type. The structs are added to the
+// schemas and referenced, which also handles the recursive types.
+func openAPISchema(t reflect.Type, schemas openAPIObject) openAPIObject {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return openAPIObject{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return openAPIObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64:
+
+		return openAPIObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return openAPIObject{"type": "number"}
+	case reflect.String:
+		return openAPIObject{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes the bytes in base64
+			return openAPIObject{"type": "string", "format": "byte"}
+		}
+		return openAPIObject{
+			"type":  "array",
+			"items": openAPISchema(t.Elem(), schemas),
+		}
+	case reflect.Map:
+		return openAPIObject{
+			"type":                 "object",
+			"additionalProperties": openAPISchema(t.Elem(), schemas),
+		}
+	case reflect.Struct:
+		name := openAPISchemaName(t)
+		ref := openAPIObject{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+
+		properties := openAPIObject{}
+		object := openAPIObject{"type": "object", "properties": properties}
+		// Set before the fields so that a recursive type stops here
+		schemas[name] = object
+		openAPIProperties(t, properties, schemas)
+
+		return ref
+	default:
+		// Any JSON value
+		return openAPIObject{}
+	}
+}
+
+// openAPIProperties adds the properties of the fields of a struct, following
+// the rules of encoding/json
+func openAPIProperties(t reflect.Type, properties, schemas openAPIObject) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				openAPIProperties(fieldType, properties, schemas)
+				continue
+			}
+		}
+
+		// unexported
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = openAPISchema(field.Type, schemas)
+	}
+}
+
+// openAPISchemaName returns the name of the schema of a struct. The 'api'
+// prefix of the types of this API is removed, so that apiProject is described
+// as Project.
+func openAPISchemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return "Object"
+	}
+
+	if strings.HasPrefix(name, "api") {
+		return strings.TrimPrefix(name, "api")
+	}
+
+	return name
+}
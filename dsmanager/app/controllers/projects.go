@@ -269,12 +269,8 @@ func ProjectsRequestsTasksShowStatusHandler(gs sessions.Store,
 	}
 }
 
-// @Summary Create a new project
-// @Description This will initialize, create and store a new project.
-// @Produce  html
-// @Accept multipart/form-data
-// @Param datasetIDs formData string true "list of dataset IDs separated by commas"
-// @Router /projects [post]
+// projectsPost creates a new project from the form and requests the creation
+// of its enclave. The JSON equivalent is apiProjectsPost.
 func projectsPost(w http.ResponseWriter, r *http.Request,
 	store sessions.Store, conf *models.Config) {
 
@@ -294,7 +290,8 @@ func projectsPost(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project := models.NewProject("", "")
+	project := models.NewProject(r.PostForm.Get("title"),
+		r.PostForm.Get("description"))
 
 	go func() {
 		request, task := project.RequestCreateProjectInstance(datasetIDs, conf)
@@ -312,10 +309,7 @@ func projectsPost(w http.ResponseWriter, r *http.Request,
 			project.UID, project.Title), w, r, store)
 }
 
-// @Summary Gets the list of projects
-// @Description Return every project found in the DB.
-// @Produce  html
-// @Router /projects [get]
+// projectsIndexGet renders the list of projects
 func projectsIndexGet(w http.ResponseWriter, r *http.Request,
 	store sessions.Store, conf *models.Config) {
 
@@ -336,9 +330,11 @@ func projectsIndexGet(w http.ResponseWriter, r *http.Request,
 		log.Errorf("Failed to get flash: %s\n", err.Error())
 	}
 
-	projectSlice := []*models.Project{}
-	for _, value := range models.ProjectList {
-		projectSlice = append(projectSlice, value)
+	projectSlice, err := models.GetProjects()
+	if err != nil {
+		helpers.RedirectWithErrorFlash("/", "failed to get the projects: "+
+			err.Error(), w, r, store)
+		return
 	}
 
 	sort.Sort(sort.Reverse(models.ProjectSorter(projectSlice)))
@@ -467,7 +463,7 @@ func projectsShowGet(w http.ResponseWriter, r *http.Request,
 		ProjectContractData *projectc.ProjectData
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -506,7 +502,7 @@ func projectsShowGet(w http.ResponseWriter, r *http.Request,
 
 		cmdOut := outb.Bytes()
 		projectContractData = &projectc.ProjectData{}
-		err = protobuf.Decode(cmdOut, projectContractData)
+		err = projectc.DecodeProjectData(cmdOut, projectContractData)
 		if err != nil {
 			helpers.RedirectWithErrorFlash("/projects", "failed to decode "+
 				"project innstance: "+err.Error(), w, r, store)
@@ -580,7 +576,7 @@ func projectsShowPut(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -610,7 +606,7 @@ func projectsShowPut(w http.ResponseWriter, r *http.Request,
 
 	cmdOut := outb.Bytes()
 	projectContractData := &projectc.ProjectData{}
-	err = protobuf.Decode(cmdOut, projectContractData)
+	err = projectc.DecodeProjectData(cmdOut, projectContractData)
 	if err != nil {
 		helpers.RedirectWithErrorFlash("/projects", "failed to decode "+
 			"project instance: "+err.Error(), w, r, store)
@@ -641,13 +637,18 @@ func projectsShowDelete(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
 	}
 
-	delete(models.ProjectList, id)
+	err := models.DeleteProject(project.UID)
+	if err != nil {
+		helpers.RedirectWithErrorFlash("/projects/"+id, "failed to delete "+
+			"the project: "+err.Error(), w, r, store)
+		return
+	}
 
 	helpers.RedirectWithInfoFlash("/projects", "Project '"+id+
 		"' deleted", w, r, store)
@@ -679,7 +680,7 @@ func projectsShowAttributesGet(w http.ResponseWriter, r *http.Request,
 
 	// Let's get the project instance
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -700,7 +701,7 @@ func projectsShowAttributesGet(w http.ResponseWriter, r *http.Request,
 
 	cmdOut := outb.Bytes()
 	projectContractData := &projectc.ProjectData{}
-	err = protobuf.Decode(cmdOut, projectContractData)
+	err = projectc.DecodeProjectData(cmdOut, projectContractData)
 	if err != nil {
 		helpers.RedirectWithErrorFlash("/projects", "failed to decode "+
 			"project innstance: "+err.Error(), w, r, store)
@@ -808,7 +809,7 @@ func projectsShowAttributesPut(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -847,7 +848,7 @@ func projectsShowEnclaveGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -867,7 +868,7 @@ func projectsShowEnclaveGet(w http.ResponseWriter, r *http.Request,
 	}
 	cmdOut := outb.Bytes()
 	projectContractData := &projectc.ProjectData{}
-	err = protobuf.Decode(cmdOut, projectContractData)
+	err = projectc.DecodeProjectData(cmdOut, projectContractData)
 	if err != nil {
 		helpers.RedirectWithErrorFlash("/projects", "failed to decode "+
 			"project innstance: "+err.Error(), w, r, store)
@@ -905,7 +906,7 @@ func projectsShowEnclaveDelete(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -932,7 +933,7 @@ func projectsShowUnlockPut(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -970,7 +971,7 @@ func projectShowDebugGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -1004,7 +1005,7 @@ func projectsShowStatusPut(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -1017,6 +1018,12 @@ func projectsShowStatusPut(w http.ResponseWriter, r *http.Request,
 	}
 
 	project.Status = models.ProjectStatus(status)
+	err := project.Save()
+	if err != nil {
+		helpers.RedirectWithErrorFlash("/projects/"+project.UID, "failed to "+
+			"save the project: "+err.Error(), w, r, store)
+		return
+	}
 
 	helpers.RedirectWithInfoFlash("/projects/"+project.UID, fmt.Sprintf(
 		"Project '%s' updated with status '%s'", project.Title, project.Status), w, r, store)
@@ -1047,7 +1054,7 @@ func projectsShowStatusStreamGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[id]
+	project, ok := models.GetProject(id)
 	if !ok || project == nil {
 		fmt.Fprintf(w, "data: %s\n\n", "project not found")
 		return
@@ -1136,7 +1143,7 @@ func projectsRequestShowGet(w http.ResponseWriter, r *http.Request,
 		log.Errorf("Failed to get flash: %s\n", err.Error())
 	}
 
-	project, ok := models.ProjectList[pid]
+	project, ok := models.GetProject(pid)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "Project not found", w, r, store)
 		return
@@ -1224,7 +1231,7 @@ func projectsRequestShowCloudstreamGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[pid]
+	project, ok := models.GetProject(pid)
 	if !ok || project == nil {
 		fmt.Fprintf(w, "data: %s\n\n", "project not found")
 		flusher.Flush()
@@ -1321,7 +1328,7 @@ func projectsRequestShowStatusStreamGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[pid]
+	project, ok := models.GetProject(pid)
 	if !ok || project == nil {
 		fmt.Fprintf(w, "data: %s\n\n", "project not found")
 		flusher.Flush()
@@ -1428,7 +1435,7 @@ func projectsRequestTasksShowStream(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[pid]
+	project, ok := models.GetProject(pid)
 	if !ok || project == nil {
 		fmt.Fprintf(w, "data: %s\n\n", "project not found")
 		flusher.Flush()
@@ -1531,7 +1538,7 @@ func projectsRequestTasksShowDebugGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[pid]
+	project, ok := models.GetProject(pid)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "project not found", w, r, store)
 		return
@@ -1622,7 +1629,7 @@ func projectsRequestTasksShowStatusPut(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	project, ok := models.ProjectList[pid]
+	project, ok := models.GetProject(pid)
 	if !ok || project == nil {
 		helpers.RedirectWithErrorFlash("/", "project not found", w, r, store)
 		return
@@ -1671,6 +1678,13 @@ func projectsRequestTasksShowStatusPut(w http.ResponseWriter, r *http.Request,
 		task.GetData().Status = helpers.StatusTask(status)
 	}
 
+	err = project.Save()
+	if err != nil {
+		helpers.RedirectWithErrorFlash("/projects/"+project.UID, "failed to "+
+			"save the project: "+err.Error(), w, r, store)
+		return
+	}
+
 	helpers.RedirectWithInfoFlash("/projects/"+project.UID+"/requests/"+ridStr, fmt.Sprintf(
 		"Task updated with status '%s'", status), w, r, store)
 }
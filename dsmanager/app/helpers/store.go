@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// Store persists the state of a manager in a bbolt database. Each change is
+// written in its own transaction when it happens, so that a crash or a kill
+// doesn't lose what was in memory. The values are loaded only when they are
+// needed.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens, or creates, the database at path with the given buckets.
+// It fails if another process holds the database for more than 30 seconds.
+func OpenStore(path string, buckets ...string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 30 * time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open the db: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range buckets {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return xerrors.Errorf("failed to create bucket '%s': %v",
+					bucket, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Put saves the value under the key in the bucket. It returns once the value
+// is on disk.
+func (s *Store) Put(bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+		err = b.Put([]byte(key), value)
+		if err != nil {
+			return xerrors.Errorf("failed to save '%s' in '%s': %v", key,
+				bucket, err)
+		}
+		return nil
+	})
+}
+
+// Get returns the value saved under the key in the bucket, or nil if there is
+// none.
+func (s *Store) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+		// The buffers of bbolt are only valid during the transaction
+		buf := b.Get([]byte(key))
+		if buf != nil {
+			value = append([]byte{}, buf...)
+		}
+		return nil
+	})
+
+	return value, err
+}
+
+// Delete removes the key from the bucket. Removing a key that doesn't exist
+// is not an error.
+func (s *Store) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+		err = b.Delete([]byte(key))
+		if err != nil {
+			return xerrors.Errorf("failed to delete '%s' from '%s': %v", key,
+				bucket, err)
+		}
+		return nil
+	})
+}
+
+// ForEach calls fn with each key and value of the bucket, in the order of the
+// keys. It stops at the first error returned by fn.
+func (s *Store) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b, err := s.bucket(tx, bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), append([]byte{}, v...))
+		})
+	})
+}
+
+// Close closes the database. All the changes are already saved.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) bucket(tx *bolt.Tx, bucket string) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, xerrors.Errorf("bucket '%s' not found", bucket)
+	}
+	return b, nil
+}
@@ -0,0 +1,190 @@
+package helpers_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/dedis/odyssey/dsmanager/app/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := helpers.OpenStore(filepath.Join(dir, "my.db"), "Tasks")
+	require.NoError(t, err)
+	defer store.Close()
+
+	value, err := store.Get("Tasks", "a")
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	require.NoError(t, store.Put("Tasks", "a", []byte("1")))
+	require.NoError(t, store.Put("Tasks", "b", []byte("2")))
+	require.NoError(t, store.Put("Tasks", "a", []byte("3")))
+
+	value, err = store.Get("Tasks", "a")
+	require.NoError(t, err)
+	require.Equal(t, "3", string(value))
+
+	require.NoError(t, store.Delete("Tasks", "b"))
+	require.NoError(t, store.Delete("Tasks", "c"))
+
+	keys := []string{}
+	err = store.ForEach("Tasks", func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+
+	err = store.Put("Other", "a", []byte("1"))
+	require.EqualError(t, err, "bucket 'Other' not found")
+}
+
+// TestStore_Crash kills a process that uses a stored task manager and a
+// project store, without letting it close the store, and checks that all its
+// tasks and its projects are restored once the store is opened again.
+func TestStore_Crash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "my.db")
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestStore_CrashHelper")
+	cmd.Env = append(os.Environ(), "STORE_CRASH_PATH="+path)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() && scanner.Text() != "saved" {
+	}
+	require.NoError(t, cmd.Process.Kill())
+	cmd.Wait()
+
+	store, err := helpers.OpenStore(path, "Tasks", "Projects")
+	require.NoError(t, err)
+	defer store.Close()
+
+	manager, err := helpers.NewStoredTaskManager(store, "Tasks")
+	require.NoError(t, err)
+	require.Equal(t, 10, manager.NumTasks())
+
+	for i := 0; i < 10; i++ {
+		task := manager.GetTask(i)
+		require.Equal(t, i, task.GetData().Index)
+		require.Equal(t, fmt.Sprintf("task %d", i), task.GetData().Description)
+		require.Len(t, task.GetData().History, 2)
+	}
+	require.Equal(t, helpers.StatusFinished, string(manager.GetTask(3).GetData().Status))
+	require.Equal(t, helpers.StatusWorking, string(manager.GetTask(4).GetData().Status))
+
+	// The restored tasks are still saved when they change
+	manager.GetTask(4).CloseError("test", "killed", "")
+	manager.DeleteAllTasks()
+	manager.NewTask("task after the crash")
+
+	manager, err = helpers.NewStoredTaskManager(store, "Tasks")
+	require.NoError(t, err)
+	require.Equal(t, 1, manager.NumTasks())
+	require.Equal(t, "task after the crash", manager.GetTask(0).GetData().Description)
+
+	// The project was preparing its enclave, its request is interrupted but
+	// the events before the crash are kept
+	models.SetProjectStore(store)
+	defer models.SetProjectStore(nil)
+	require.NoError(t, models.RecoverProjects())
+
+	projects, err := models.GetProjects()
+	require.NoError(t, err)
+	require.Len(t, projects, 1)
+	project := projects[0]
+	require.Equal(t, "crash", project.Title)
+	require.Equal(t, "TEST_PUBKEY", project.PubKey)
+	require.Equal(t, models.ProjectStatus(models.ProjectStatusPreparingEnclaveErrored),
+		project.Status)
+	require.Len(t, project.Requests, 1)
+	require.Equal(t, models.RequestStatus(models.RequestStatusErrored),
+		project.Requests[0].Status)
+
+	history := project.Requests[0].Tasks[0].GetData().History
+	require.Len(t, history, 3)
+	require.Equal(t, "task interrupted", history[0].Message)
+	require.Equal(t, "Trying now to read the public key", history[1].Message)
+	require.Equal(t, helpers.StatusErrored,
+		string(project.Requests[0].Tasks[0].GetData().Status))
+}
+
+// TestStore_CrashHelper is the process killed by TestStore_Crash. It updates
+// its tasks and waits to be killed.
+func TestStore_CrashHelper(t *testing.T) {
+	path := os.Getenv("STORE_CRASH_PATH")
+	if path == "" {
+		t.Skip("only used by TestStore_Crash")
+	}
+
+	store, err := helpers.OpenStore(path, "Tasks", "Projects")
+	require.NoError(t, err)
+
+	manager, err := helpers.NewStoredTaskManager(store, "Tasks")
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		task := manager.NewTask(fmt.Sprintf("task %d", i))
+		task.AddInfo("test", "started", "")
+		if i%2 == 1 {
+			task.CloseOK("test", "done", "")
+		} else {
+			task.AddInfo("test", "still working", "")
+		}
+	}
+
+	// The creation of the project instance never ends, the project is saved
+	// with the events of its task that happened before
+	pubKeyPath := filepath.Join(filepath.Dir(path), "key.txt")
+	require.NoError(t, ioutil.WriteFile(pubKeyPath, []byte("TEST_PUBKEY"), 0600))
+
+	models.SetProjectStore(store)
+	project := models.NewProject("crash", "")
+	go project.RequestCreateProjectInstance([]string{
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+	}, &models.Config{
+		TOMLConfig:  &models.TOMLConfig{PubKeyPath: pubKeyPath},
+		TaskManager: helpers.NewDefaultTaskManager(),
+		Executor:    blockingExecutor{},
+	})
+
+	for {
+		buf, err := store.Get("Projects", project.UID)
+		require.NoError(t, err)
+		saved := &models.Project{}
+		if buf != nil && saved.UnmarshalBinary(buf) == nil &&
+			saved.PubKey != "" && len(saved.Requests) == 1 &&
+			len(saved.Requests[0].Tasks[0].GetData().History) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fmt.Println("saved")
+	time.Sleep(time.Minute)
+}
+
+// blockingExecutor is an executor whose commands never end
+type blockingExecutor struct{}
+
+func (blockingExecutor) Run(args ...string) (bytes.Buffer, error) {
+	select {}
+}
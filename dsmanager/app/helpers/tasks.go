@@ -60,6 +60,9 @@ type TaskManagerI interface {
 type DefaultTaskManager struct {
 	sync.Mutex
 	taskList []*Task
+	// If set, the tasks are saved in the bucket each time they change
+	store  *Store
+	bucket string
 }
 
 // NewDefaultTaskManager return a new DefaultTaskManager
@@ -69,6 +72,47 @@ func NewDefaultTaskManager() *DefaultTaskManager {
 	}
 }
 
+// NewStoredTaskManager returns a new DefaultTaskManager that saves its tasks in
+// the bucket of the store each time they change. The tasks already in the
+// bucket are restored.
+func NewStoredTaskManager(store *Store, bucket string) (*DefaultTaskManager, error) {
+	tasks := make([]*Task, 0)
+	err := store.ForEach(bucket, func(key string, value []byte) error {
+		task := &Task{}
+		err := task.UnmarshalBinary(value)
+		if err != nil {
+			return xerrors.Errorf("failed to unmarshal task '%s': %v", key, err)
+		}
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the tasks: %v", err)
+	}
+
+	// The tasks are stored by ID, but the manager retrieves them by index
+	sort.Sort(TaskSorter(tasks))
+	restored := make([]TaskI, len(tasks))
+	for i, task := range tasks {
+		restored[i] = task
+	}
+
+	dtm := NewDefaultTaskManager()
+	err = dtm.RestoreTasks(restored)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to restore the tasks: %v", err)
+	}
+
+	dtm.store = store
+	dtm.bucket = bucket
+	for _, task := range dtm.taskList {
+		task.store = store
+		task.bucket = bucket
+	}
+
+	return dtm, nil
+}
+
 // NewTask return a new Task
 //
 // - implements TaskManagerI
@@ -87,9 +131,14 @@ func (dtm *DefaultTaskManager) NewTask(title string) TaskI {
 			StartD:      time.Now().Format("02-01-2006 15:04:05..999"),
 			EndD:        "?",
 		},
+		store:  dtm.store,
+		bucket: dtm.bucket,
 	}
 	dtm.taskList = append(dtm.taskList, task)
 	dtm.Unlock()
+	task.Lock()
+	task.save()
+	task.Unlock()
 	return task
 }
 
@@ -126,6 +175,14 @@ func (dtm *DefaultTaskManager) GetSortedTasks() []TaskI {
 //
 // - implements TaskManagerI
 func (dtm *DefaultTaskManager) DeleteAllTasks() {
+	if dtm.store != nil {
+		for _, task := range dtm.taskList {
+			err := dtm.store.Delete(dtm.bucket, task.Data.ID)
+			if err != nil {
+				log.Errorf("failed to delete task '%s': %v", task.Data.ID, err)
+			}
+		}
+	}
 	dtm.taskList = make([]*Task, 0)
 }
 
@@ -194,6 +251,9 @@ type TaskData struct {
 type Task struct {
 	sync.Mutex
 	Data *TaskData
+	// If set, the task is saved in the bucket each time it changes
+	store  *Store
+	bucket string
 }
 
 // used for marshal/unmarshal
@@ -317,9 +377,29 @@ func (t *Task) AddTaskEvent(event TaskEvent) {
 			t.Data.Status = StatusErrored
 		}
 	}
+	t.save()
 	t.Unlock()
 }
 
+// save writes the task to the store, if there is one. It must be called with
+// the lock held so that an older version can't overwrite a newer one.
+func (t *Task) save() {
+	if t.store == nil {
+		return
+	}
+
+	buf, err := t.MarshalBinary()
+	if err != nil {
+		log.Errorf("failed to marshal task '%s': %v", t.Data.ID, err)
+		return
+	}
+
+	err = t.store.Put(t.bucket, t.Data.ID, buf)
+	if err != nil {
+		log.Errorf("failed to save task '%s': %v", t.Data.ID, err)
+	}
+}
+
 // GetData returns the data of the task
 //
 // - implements TaskI
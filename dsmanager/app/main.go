@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"encoding/gob"
-	"errors"
 	"flag"
 	"fmt"
 	"html/template"
@@ -12,6 +11,7 @@ import (
 	"os"
 	"os/signal"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dedis/odyssey/dsmanager/app/controllers"
@@ -21,9 +21,6 @@ import (
 	"github.com/gorilla/sessions"
 	xlog "go.dedis.ch/onet/v3/log"
 	bolt "go.etcd.io/bbolt"
-
-	// http-swagger middleware
-	_ "github.com/swaggo/http-swagger/example/go-chi/docs" // docs is generated by Swag CLI, you have to import it.
 )
 
 type key int
@@ -40,12 +37,6 @@ var (
 	db         *bolt.DB
 )
 
-// @title Data Scientist Manager REST API
-// @version 1.0
-// @description REST functionalities provided by the Data Scientist Manager
-
-// @host localhost:5001
-// @BasePath /v2
 func main() {
 	// Register the struct so encoding/gob knows about it
 	gob.Register(helpers.Flash{})
@@ -58,10 +49,21 @@ func main() {
 
 	xlog.LLvl1("here is the catalog id:", conf.CatalogID)
 
-	xlog.Info("loading db into memory")
-	err = loadDb()
+	xlog.Info("opening the db")
+	projectStore, err := helpers.OpenStore("my.db", "Projects", "Tasks")
+	if err != nil {
+		log.Fatal("failed to open the DB: " + err.Error())
+	}
+	// The projects and the tasks are saved each time they change. The
+	// projects are read when they are needed.
+	models.SetProjectStore(projectStore)
+	err = models.RecoverProjects()
 	if err != nil {
-		log.Fatal("failed to import DB: " + err.Error())
+		log.Fatal("failed to recover the projects: " + err.Error())
+	}
+	conf.TaskManager, err = helpers.NewStoredTaskManager(projectStore, "Tasks")
+	if err != nil {
+		log.Fatal("failed to restore the tasks: " + err.Error())
 	}
 
 	flag.StringVar(&listenAddr, "listen-addr", ":5001", "server listen address")
@@ -101,8 +103,8 @@ func main() {
 	router.Handle("/test", http.HandlerFunc(testHandler))
 	router.Handle("/authorize", http.HandlerFunc(controllers.AuthorizeHandler(store)))
 
-	fs := http.FileServer(http.Dir("./docs/"))
-	router.PathPrefix("/docs/").Handler(http.StripPrefix("/docs/", fs))
+	// The JSON API and its OpenAPI document, under /api/v1
+	controllers.RegisterAPI(router, conf)
 
 	nextRequestID := func() string {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
@@ -119,18 +121,12 @@ func main() {
 
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-quit
 		logger.Println("Server is shutting down...")
 
-		logger.Println("Saving memory variables into DB...")
-		err := saveDb()
-		if err != nil {
-			xlog.Error("failed to save the db: " + err.Error())
-		}
-
 		atomic.StoreInt32(&healthy, 0)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -150,75 +146,12 @@ func main() {
 	}
 
 	<-done
-	logger.Println("Server stopped")
-}
-
-func loadDb() error {
-	db, err := bolt.Open("my.db", 0600, nil)
-	if err != nil {
-		return errors.New("failed to open DB: " + err.Error())
-	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("Projects"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to create 'Projects' bucket: " + err.Error())
-	}
-
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Projects"))
-		b.ForEach(func(k, v []byte) error {
-			project := &models.Project{}
-			err := project.UnmarshalBinary(v)
-			if err != nil {
-				xlog.Error("failed to unmarshal project: " + err.Error())
-				return errors.New("failed to unmarshal project: " + err.Error())
-			}
-			models.ProjectList[string(k)] = project
-			return nil
-		})
-		return nil
-	})
-
-	return nil
-}
 
-func saveDb() error {
-	db, err := bolt.Open("my.db", 0600, nil)
-	if err != nil {
-		return errors.New("failed to open DB: " + err.Error())
-	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte("Projects"))
-		if err != nil {
-			return errors.New("failed to delete the Projects bucket: " + err.Error())
-		}
-		b, err := tx.CreateBucketIfNotExists([]byte("Projects"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		for k, project := range models.ProjectList {
-			projectBuf, err := project.MarshalBinary()
-			if err != nil {
-				return errors.New("failed to marshal project: " + err.Error())
-			}
-			err = b.Put([]byte(k), projectBuf)
-			if err != nil {
-				return errors.New("failed to save project buf: " + err.Error())
-			}
-		}
-		return nil
-	})
+	err = projectStore.Close()
 	if err != nil {
-		return errors.New("failed to update 'Projects' bucket: " + err.Error())
+		xlog.Error("failed to close the db: " + err.Error())
 	}
-	return nil
+	logger.Println("Server stopped")
 }
 
 func healthz() http.Handler {
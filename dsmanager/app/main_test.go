@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -17,6 +19,7 @@ import (
 	"github.com/dedis/odyssey/dsmanager/app/controllers"
 	"github.com/dedis/odyssey/dsmanager/app/helpers"
 	"github.com/dedis/odyssey/dsmanager/app/models"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/stretchr/testify/require"
 )
@@ -186,7 +189,7 @@ func Test_Projects_POST(t *testing.T) {
 	}
 	require.Equal(t, "DS Manager", event.Source)
 	require.Equal(t, "Sending a request to the enclave manager", event.Message)
-	require.Equal(t, "POST localhost:5000/vapps", event.Details)
+	require.Equal(t, "POST "+models.DefaultEnclaveManager+"/vapps", event.Details)
 
 	select {
 	case <-fakeRunHTTP.called:
@@ -207,6 +210,295 @@ func Test_Projects_POST(t *testing.T) {
 	// to test it there
 }
 
+// The OpenAPI document should describe every route of the JSON API
+func Test_API_OpenAPI(t *testing.T) {
+	router := mux.NewRouter()
+	controllers.RegisterAPI(router, &models.Config{})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + controllers.APIPrefix + "/openapi.json")
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	doc := struct {
+		OpenAPI string                                       `json:"openapi"`
+		Servers []struct{ URL string }                       `json:"servers"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	require.NoError(t, err)
+
+	require.Equal(t, "3.0.2", doc.OpenAPI)
+	require.Len(t, doc.Servers, 1)
+	require.Equal(t, controllers.APIPrefix, doc.Servers[0].URL)
+
+	expected := map[string][]string{
+		"/datasets":                                         {"get"},
+		"/projects":                                         {"get", "post"},
+		"/projects/{id}":                                    {"get", "delete"},
+		"/projects/{id}/status/stream":                      {"get"},
+		"/projects/{id}/attributes":                         {"get", "put"},
+		"/projects/{id}/enclave":                            {"get", "post", "delete"},
+		"/projects/{id}/unlock":                             {"post"},
+		"/projects/{pid}/requests":                          {"get"},
+		"/projects/{pid}/requests/{rid}":                    {"get"},
+		"/projects/{pid}/requests/{rid}/status/stream":      {"get"},
+		"/projects/{pid}/requests/{rid}/tasks/{tid}":        {"get"},
+		"/projects/{pid}/requests/{rid}/tasks/{tid}/stream": {"get"},
+		"/tasks":                {"get"},
+		"/tasks/{index}":        {"get"},
+		"/tasks/{index}/stream": {"get"},
+		"/openapi.json":         {"get"},
+	}
+	require.Len(t, doc.Paths, len(expected))
+
+	for path, methods := range expected {
+		require.Contains(t, doc.Paths, path)
+		require.Len(t, doc.Paths[path], len(methods), path)
+		for _, method := range methods {
+			operation, ok := doc.Paths[path][method]
+			require.True(t, ok, "%s %s", method, path)
+			require.NotEmpty(t, operation["operationId"], "%s %s", method, path)
+		}
+	}
+}
+
+// I should be able to create a project with the JSON API and then get it
+func Test_API_Projects(t *testing.T) {
+	conf := &models.Config{
+		TOMLConfig: &models.TOMLConfig{
+			PubKeyPath: "test/key.txt",
+		},
+		TaskManager: newFakeTaskManager(),
+		Executor:    fakeExecutor{},
+		RunHTTP:     newFakeRunHTTP(),
+	}
+
+	router := mux.NewRouter()
+	controllers.RegisterAPI(router, conf)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	apiURL := server.URL + controllers.APIPrefix
+
+	body := `{"datasetIDs": ["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"], "title": "API project"}`
+	resp, err := http.Post(apiURL+"/projects", "application/json",
+		strings.NewReader(body))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	created := struct {
+		UID   string `json:"uid"`
+		Title string `json:"title"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	require.NoError(t, err)
+	require.NotEmpty(t, created.UID)
+	require.Equal(t, "API project", created.Title)
+	require.Equal(t, controllers.APIPrefix+"/projects/"+created.UID,
+		resp.Header.Get("Location"))
+
+	resp, err = http.Get(server.URL + resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	project := struct {
+		UID   string `json:"uid"`
+		Title string `json:"title"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&project)
+	require.NoError(t, err)
+	require.Equal(t, created, project)
+
+	resp, err = http.Get(apiURL + "/projects")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	projects := []struct {
+		UID string `json:"uid"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&projects)
+	require.NoError(t, err)
+
+	found := false
+	for _, p := range projects {
+		if p.UID == created.UID {
+			found = true
+		}
+	}
+	require.True(t, found, "project %s not in %v", created.UID, projects)
+}
+
+// The JSON API should return its errors as JSON with the right status
+func Test_API_Errors(t *testing.T) {
+	router := mux.NewRouter()
+	controllers.RegisterAPI(router, &models.Config{
+		TOMLConfig: &models.TOMLConfig{},
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	apiURL := server.URL + controllers.APIPrefix
+
+	apiErr := struct {
+		Error string `json:"error"`
+	}{}
+
+	resp, err := http.Get(apiURL + "/projects/unknown")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	require.NoError(t, err)
+	require.Equal(t, "project 'unknown' not found", apiErr.Error)
+
+	resp, err = http.Post(apiURL+"/projects", "application/json",
+		strings.NewReader(`{"unknown": true}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	require.NoError(t, err)
+	require.Contains(t, apiErr.Error, "failed to decode the JSON body")
+
+	resp, err = http.Post(apiURL+"/projects", "application/json",
+		strings.NewReader(`{"datasetIDs": ["nope"]}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	require.NoError(t, err)
+	require.Equal(t, "wrong dataset ID 'nope'", apiErr.Error)
+
+	resp, err = http.Post(apiURL+"/projects", "application/json",
+		strings.NewReader(`{"datasetIDs": ["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"], "enclaveManager": "http://unknown:5000"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	err = json.NewDecoder(resp.Body).Decode(&apiErr)
+	require.NoError(t, err)
+	require.Equal(t, "unknown enclave manager 'http://unknown:5000'",
+		apiErr.Error)
+
+	// The routes that change something need the JSON content type, which a
+	// page from another origin can't send without a preflight request
+	resp, err = http.Post(apiURL+"/projects", "text/plain",
+		strings.NewReader(`{"datasetIDs": ["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"]}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	resp, err = http.Post(apiURL+"/projects/unknown/unlock",
+		"application/x-www-form-urlencoded", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete,
+		apiURL+"/projects/unknown/enclave", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The read-only routes can still be read from any origin
+	resp, err = http.Get(apiURL + "/projects/unknown")
+	require.NoError(t, err)
+	require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+// The enclave managers should be tried in order until one accepts to boot the
+// enclave, which then handles all the requests of the project
+func Test_Projects_EnclaveManagers(t *testing.T) {
+	hosts := make(chan string, 10)
+	runHTTP := fakeRunHTTPFunc(func(req *http.Request) (*http.Response, error) {
+		hosts <- req.URL.Host
+		if req.URL.Host == "em1:5000" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Body:       ioutil.NopCloser(bytes.NewBuffer([]byte{})),
+		}, nil
+	})
+
+	conf := &models.Config{
+		TOMLConfig: &models.TOMLConfig{
+			EnclaveManagers: []string{"http://em1:5000/", "http://em2:5000"},
+		},
+		TaskManager: helpers.NewDefaultTaskManager(),
+		RunHTTP:     runHTTP,
+	}
+
+	project := models.NewProject("enclave managers", "")
+	project.InstanceID = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+
+	project.RequestBootEnclave(nil, nil, conf)
+
+	require.Equal(t, "em1:5000", <-hosts)
+	require.Equal(t, "em2:5000", <-hosts)
+	require.Equal(t, "http://em2:5000", project.EnclaveManager)
+
+	// A new boot request goes to the same enclave manager
+	project.RequestBootEnclave(nil, nil, conf)
+
+	require.Equal(t, "em2:5000", <-hosts)
+	require.Len(t, hosts, 0)
+
+	// The enclave manager is saved with the project
+	buf, err := project.MarshalBinary()
+	require.NoError(t, err)
+	loaded := &models.Project{}
+	err = loaded.UnmarshalBinary(buf)
+	require.NoError(t, err)
+	require.Equal(t, "http://em2:5000", loaded.EnclaveManager)
+}
+
+// I should be able to follow a task as newline delimited JSON
+func Test_API_TaskStream(t *testing.T) {
+	taskManager := helpers.NewDefaultTaskManager()
+	conf := &models.Config{TaskManager: taskManager}
+
+	task := taskManager.NewTask("API task")
+	task.AddInfo("test", "first", "")
+
+	router := mux.NewRouter()
+	controllers.RegisterAPI(router, conf)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + controllers.APIPrefix +
+		"/tasks/0/stream?format=ndjson")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	go func() {
+		task.AddInfo("test", "second", "")
+		task.CloseOK("test", "done", "")
+	}()
+
+	messages := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	// The stream ends with the task
+	for scanner.Scan() {
+		event := helpers.TaskEvent{}
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		require.NoError(t, err, "got: %s", scanner.Text())
+		messages = append(messages, event.Message)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Equal(t, []string{"first", "second", "done"}, messages)
+}
+
 // -----------------------------------------------------------------------------
 // Utility functions
 
@@ -343,3 +635,10 @@ func newFakeRunHTTP() *fakeRunHTTP {
 		called: make(chan interface{}),
 	}
 }
+
+// fakeRunHTTPFunc lets a test decide the response of each request
+type fakeRunHTTPFunc func(req *http.Request) (*http.Response, error)
+
+func (f fakeRunHTTPFunc) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	return f(req)
+}
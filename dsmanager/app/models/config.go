@@ -2,12 +2,19 @@ package models
 
 import (
 	"errors"
+	"net/url"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/dedis/odyssey/dsmanager/app/helpers"
 	"golang.org/x/xerrors"
 )
 
+// DefaultEnclaveManager is the base URL of the enclave manager used when none
+// is configured. The projects saved before the enclave managers were
+// configurable were all booted by it.
+const DefaultEnclaveManager = "http://localhost:5000"
+
 // Config holds the global configuration of the server
 type Config struct {
 	*TOMLConfig
@@ -26,6 +33,58 @@ type TOMLConfig struct {
 	KeyID      string
 	ConfigPath string
 	PubKeyPath string
+	// Organisation is the name of the organisation the data scientist belongs
+	// to. It is stored on-chain with each project.
+	Organisation string
+	// EnclaveManagers are the base URLs of the enclave managers, like
+	// "http://localhost:5000", in order of preference. See
+	// GetEnclaveManagers.
+	EnclaveManagers []string
+}
+
+// GetEnclaveManagers returns the base URLs of the enclave managers, without
+// their trailing slash, or the default one if none is configured.
+func (c TOMLConfig) GetEnclaveManagers() []string {
+	if len(c.EnclaveManagers) == 0 {
+		return []string{DefaultEnclaveManager}
+	}
+
+	managers := make([]string, len(c.EnclaveManagers))
+	for i, manager := range c.EnclaveManagers {
+		managers[i] = strings.TrimRight(manager, "/")
+	}
+
+	return managers
+}
+
+// IsEnclaveManager tells if the base URL is one of the enclave managers
+func (c TOMLConfig) IsEnclaveManager(manager string) bool {
+	for _, m := range c.GetEnclaveManagers() {
+		if m == strings.TrimRight(manager, "/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkEnclaveManagers checks that the enclave managers are absolute http
+// URLs
+func (c TOMLConfig) checkEnclaveManagers() error {
+	for _, manager := range c.EnclaveManagers {
+		u, err := url.Parse(manager)
+		if err != nil {
+			return xerrors.Errorf("failed to parse the enclave manager "+
+				"'%s': %v", manager, err)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return xerrors.Errorf("the enclave manager '%s' is not an "+
+				"http(s) URL like %s", manager, DefaultEnclaveManager)
+		}
+	}
+
+	return nil
 }
 
 // NewConfig creates a new Config
@@ -36,6 +95,11 @@ func NewConfig() (*Config, error) {
 		return nil, errors.New("failed to read config: " + err.Error())
 	}
 
+	err = tomlConf.checkEnclaveManagers()
+	if err != nil {
+		return nil, xerrors.Errorf("wrong config: %v", err)
+	}
+
 	cloudClient, err := helpers.NewMinioCloudClient()
 	if err != nil {
 		return nil, xerrors.Errorf("failed to create minion cloud client: %v", err)
@@ -16,18 +16,31 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dedis/odyssey/catalogc"
 	"github.com/dedis/odyssey/dsmanager/app/helpers"
 	"github.com/dedis/odyssey/projectc"
+	"github.com/minio/minio-go/v6"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/protobuf"
 	"golang.org/x/xerrors"
 )
 
-// ProjectList holds all the project created
-var ProjectList = make(map[string]*Project)
+// projectsBucket is the bucket of the store that holds the projects
+const projectsBucket = "Projects"
+
+var (
+	// projectList holds the projects that have been created or read from the
+	// store. It must be used with projectListLock.
+	projectList     = make(map[string]*Project)
+	projectListLock sync.Mutex
+
+	// projectStore saves the projects each time they change. Without it, which
+	// is the case in the tests, the projects are only kept in memory.
+	projectStore *helpers.Store
+)
 
 // ProjectStatus indicates the status of a project
 type ProjectStatus string
@@ -94,18 +107,24 @@ type Project struct {
 	StatusNotifier *helpers.StatusNotifier
 	CreatedAt      time.Time
 	PubKey         string
+	// EnclaveManager is the base URL of the enclave manager that boots the
+	// enclave and then handles all the requests of the project. It is set by
+	// the first enclave manager that accepts to boot the enclave, unless it is
+	// chosen when the project is created.
+	EnclaveManager string
 }
 
 // Used for marshal/unmarshal
 type projectWrap struct {
-	Status      ProjectStatus
-	UID         string
-	Title       string
-	Description string
-	InstanceID  string
-	Requests    [][]byte
-	CreatedAt   time.Time
-	PubKey      string
+	Status         ProjectStatus
+	UID            string
+	Title          string
+	Description    string
+	InstanceID     string
+	Requests       [][]byte
+	CreatedAt      time.Time
+	PubKey         string
+	EnclaveManager string
 }
 
 // Request holds a request for a project
@@ -236,15 +255,195 @@ func NewProject(title, description string) *Project {
 		StatusNotifier: helpers.NewStatusNotifier(),
 		CreatedAt:      time.Now(),
 	}
-	ProjectList[idStr] = project
+	projectListLock.Lock()
+	projectList[idStr] = project
+	projectListLock.Unlock()
+	project.save()
 	return project
 }
 
+// SetProjectStore sets the store where the projects are saved and read from.
+// The projects are only read when they are needed.
+func SetProjectStore(store *helpers.Store) {
+	projectListLock.Lock()
+	projectStore = store
+	projectList = make(map[string]*Project)
+	projectListLock.Unlock()
+}
+
+// GetProject returns the project with the given UID. It reads it from the
+// store if it has not been used since the start.
+func GetProject(id string) (*Project, bool) {
+	projectListLock.Lock()
+	defer projectListLock.Unlock()
+
+	project, ok := projectList[id]
+	if ok || projectStore == nil {
+		return project, ok
+	}
+
+	buf, err := projectStore.Get(projectsBucket, id)
+	if err != nil {
+		log.Errorf("failed to read project '%s': %v", id, err)
+		return nil, false
+	}
+	if buf == nil {
+		return nil, false
+	}
+
+	project = &Project{}
+	err = project.UnmarshalBinary(buf)
+	if err != nil {
+		log.Errorf("failed to unmarshal project '%s': %v", id, err)
+		return nil, false
+	}
+
+	projectList[id] = project
+	return project, true
+}
+
+// GetProjects returns all the projects, in no particular order
+func GetProjects() ([]*Project, error) {
+	projectListLock.Lock()
+	defer projectListLock.Unlock()
+
+	if projectStore == nil {
+		projects := make([]*Project, 0, len(projectList))
+		for _, project := range projectList {
+			projects = append(projects, project)
+		}
+		return projects, nil
+	}
+
+	projects := []*Project{}
+	err := projectStore.ForEach(projectsBucket, func(id string, buf []byte) error {
+		project, ok := projectList[id]
+		if !ok {
+			project = &Project{}
+			err := project.UnmarshalBinary(buf)
+			if err != nil {
+				return xerrors.Errorf("failed to unmarshal project '%s': %v",
+					id, err)
+			}
+			projectList[id] = project
+		}
+		projects = append(projects, project)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the projects: %v", err)
+	}
+
+	return projects, nil
+}
+
+// interruptedStatuses maps the statuses of the projects that are waiting for
+// a request to end to the status they get when the request is interrupted.
+var interruptedStatuses = map[ProjectStatus]ProjectStatus{
+	ProjectStatusPreparingEnclave:   ProjectStatusPreparingEnclaveErrored,
+	ProjectStatusUpdatingAttributes: ProjectStatusAttributesUpdatedErrored,
+	ProjectStatusUnlockingEnclave:   ProjectStatusUnlockingEnclaveErrored,
+	ProjectStatusDeletingEnclave:    ProjectStatusDeletingEnclaveErrored,
+}
+
+// RecoverProjects marks the requests that were running when the manager
+// stopped as errored, since nothing follows them anymore, and sets the status
+// of their project accordingly. It must be called at startup, once the store
+// is set.
+func RecoverProjects() error {
+	projects, err := GetProjects()
+	if err != nil {
+		return xerrors.Errorf("failed to get the projects: %v", err)
+	}
+
+	for _, project := range projects {
+		interrupted := false
+		for _, request := range project.Requests {
+			if request.Status != RequestStatusRunning {
+				continue
+			}
+			interrupted = true
+			request.Status = RequestStatusErrored
+			for _, task := range request.Tasks {
+				if task.GetData().Status == helpers.StatusWorking {
+					task.CloseError("DS Manager", "task interrupted", "the "+
+						"data scientist manager stopped before the end of "+
+						"the task")
+				}
+			}
+		}
+
+		status, found := interruptedStatuses[project.Status]
+		if found {
+			interrupted = true
+			project.Status = status
+		}
+
+		if interrupted {
+			log.Lvlf1("project '%s' has been interrupted, its status is "+
+				"now '%s'", project.UID, project.Status)
+			err = project.Save()
+			if err != nil {
+				return xerrors.Errorf("failed to save project '%s': %v",
+					project.UID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteProject deletes the project with the given UID
+func DeleteProject(id string) error {
+	projectListLock.Lock()
+	defer projectListLock.Unlock()
+
+	if projectStore != nil {
+		err := projectStore.Delete(projectsBucket, id)
+		if err != nil {
+			return xerrors.Errorf("failed to delete project: %v", err)
+		}
+	}
+
+	delete(projectList, id)
+	return nil
+}
+
+// Save writes the project to the store. It must be called each time the
+// project, one of its requests or one of their tasks is updated.
+func (p *Project) Save() error {
+	if projectStore == nil {
+		return nil
+	}
+
+	buf, err := p.MarshalBinary()
+	if err != nil {
+		return xerrors.Errorf("failed to marshal project: %v", err)
+	}
+
+	err = projectStore.Put(projectsBucket, p.UID, buf)
+	if err != nil {
+		return xerrors.Errorf("failed to save project: %v", err)
+	}
+
+	return nil
+}
+
+// save saves the project and only logs the error, which is what we can do
+// from the goroutines that follow the requests.
+func (p *Project) save() {
+	err := p.Save()
+	if err != nil {
+		log.Errorf("failed to save project '%s': %v", p.UID, err)
+	}
+}
+
 // AddRequest adds a new request to the project by prepending the request to the
 // list of existing requests.
 func (p *Project) AddRequest(request *Request) {
 	request.Index = len(p.Requests)
 	p.Requests = append(p.Requests, request)
+	p.save()
 }
 
 // MarshalBinary implements encoding.BinaryMarshaler
@@ -267,6 +466,7 @@ func (p *Project) MarshalBinary() ([]byte, error) {
 	}
 	wrap.CreatedAt = p.CreatedAt
 	wrap.PubKey = p.PubKey
+	wrap.EnclaveManager = p.EnclaveManager
 
 	buf := new(bytes.Buffer)
 	enc := gob.NewEncoder(buf)
@@ -305,6 +505,7 @@ func (p *Project) UnmarshalBinary(data []byte) error {
 	}
 	p.CreatedAt = wrap.CreatedAt
 	p.PubKey = wrap.PubKey
+	p.EnclaveManager = wrap.EnclaveManager
 
 	p.StatusNotifier = helpers.NewStatusNotifier()
 	p.StatusNotifier.Terminated = true
@@ -378,6 +579,9 @@ func (p *Project) RequestCreateProjectInstance(datasetIDs []string, conf *Config
 					request.StatusNotifier.UpdateStatusAndClose(
 						RequestStatusDone)
 				}
+				// Each event is saved with the project, so that the
+				// tasks survive a crash
+				p.save()
 			default:
 				select {
 				case <-client.Done:
@@ -416,8 +620,9 @@ func (p *Project) RequestCreateProjectInstance(datasetIDs []string, conf *Config
 	log.Lvl1("Here is the pubKey: ", pubKeyStr)
 
 	p.PubKey = pubKeyStr
+	p.save()
 
-	output, err := createProjectInstace(idStr, pubKeyStr, conf)
+	output, err := createProjectInstace(idStr, pubKeyStr, p.Title, p.Description, conf)
 	if err != nil {
 		task.CloseError(tef.Source, "failed to create project instance", err.Error())
 		return nil, nil
@@ -441,6 +646,7 @@ func (p *Project) RequestCreateProjectInstance(datasetIDs []string, conf *Config
 	}
 
 	p.InstanceID = projectInstID
+	p.save()
 	task.AddInfo(tef.Source, "Got the right project instance id", "Project instance ID: "+p.InstanceID)
 
 	return request, task
@@ -499,6 +705,9 @@ func (p *Project) RequestBootEnclave(request *Request, task helpers.TaskI, conf
 							RequestStatusDone)
 
 					}
+					// Each event is saved with the project, so that the
+					// tasks survive a crash
+					p.save()
 				default:
 					select {
 					case <-client.Done:
@@ -511,37 +720,15 @@ func (p *Project) RequestBootEnclave(request *Request, task helpers.TaskI, conf
 		}()
 	}
 
-	task.AddInfo(tef.Source, "Sending a request to the enclave manager", "POST localhost:5000/vapps")
-
-	formData := url.Values{
-		"projectInstID": {p.InstanceID},
-		"projectUID":    {p.UID},
-		"requestIndex":  {strconv.Itoa(request.Index)},
-	}
-	req, err := http.NewRequest(http.MethodPost, "http://localhost:5000/vapps", strings.NewReader(formData.Encode()))
+	resp, err := p.sendBootRequest(request, task, conf)
 	if err != nil {
-		log.Infof("Failed to create request: %s", err.Error())
-		task.CloseError(tef.Source, "Failed to create request", err.Error())
-		return
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := conf.RunHTTP.Do(&http.Client{}, req)
-	if err != nil {
-		log.Infof("Failed to send request: %s", err.Error())
-		task.CloseError(tef.Source, "Failed to send request", err.Error())
+		log.Infof("No enclave manager accepted the request: %s", err.Error())
+		task.CloseError(tef.Source, "No enclave manager accepted the request",
+			err.Error())
 		return
 	}
 	defer resp.Body.Close()
 
-	task.AddInfo(tef.Source, "Reading the status code", "Status code: "+resp.Status)
-
-	if resp.StatusCode != 200 {
-		log.Infof("Got an unexpected response: %s", resp.Status)
-		task.CloseError(tef.Source, "Got an unexpected response", "Response: "+resp.Status)
-		return
-	}
-
 	reader := bufio.NewReader(resp.Body)
 
 	for {
@@ -585,10 +772,94 @@ func (p *Project) RequestBootEnclave(request *Request, task helpers.TaskI, conf
 	}
 }
 
-func createProjectInstace(idStr, pubKey string, conf *Config) (string, error) {
+// sendBootRequest sends the request to boot the enclave to the enclave manager
+// of the project. If the project doesn't have one yet, the enclave managers
+// are tried in order until one of them accepts the request, and it becomes the
+// enclave manager of the project.
+func (p *Project) sendBootRequest(request *Request, task helpers.TaskI,
+	conf *Config) (*http.Response, error) {
+
+	tef := helpers.NewTaskEventFactory("DS Manager")
+
+	managers := conf.GetEnclaveManagers()
+	if p.EnclaveManager != "" {
+		managers = []string{p.EnclaveManager}
+	}
+
+	formData := url.Values{
+		"projectInstID": {p.InstanceID},
+		"projectUID":    {p.UID},
+		"requestIndex":  {strconv.Itoa(request.Index)},
+	}
+
+	failures := make([]string, 0, len(managers))
+
+	for _, manager := range managers {
+		urlStr := manager + "/vapps"
+		task.AddInfo(tef.Source, "Sending a request to the enclave manager",
+			"POST "+urlStr)
+
+		req, err := http.NewRequest(http.MethodPost, urlStr,
+			strings.NewReader(formData.Encode()))
+		if err != nil {
+			log.Infof("Failed to create request: %s", err.Error())
+			failures = append(failures, fmt.Sprintf("%s: failed to create "+
+				"request: %v", manager, err))
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := conf.RunHTTP.Do(&http.Client{}, req)
+		if err != nil {
+			log.Infof("Failed to send request: %s", err.Error())
+			task.AddInfo(tef.Source, "Failed to send request", err.Error())
+			failures = append(failures, fmt.Sprintf("%s: failed to send "+
+				"request: %v", manager, err))
+			continue
+		}
+
+		task.AddInfo(tef.Source, "Reading the status code", "Status code: "+resp.Status)
+
+		if resp.StatusCode != 200 {
+			log.Infof("Got an unexpected response: %s", resp.Status)
+			resp.Body.Close()
+			failures = append(failures, fmt.Sprintf("%s: got an unexpected "+
+				"response: %s", manager, resp.Status))
+			continue
+		}
+
+		if p.EnclaveManager == "" {
+			p.EnclaveManager = manager
+			p.save()
+			task.AddInfo(tef.Source, "Enclave manager selected", "The "+
+				"requests of the project are now sent to "+manager)
+		}
+
+		return resp, nil
+	}
+
+	return nil, xerrors.New(strings.Join(failures, "\n"))
+}
+
+// getEnclaveManager returns the base URL of the enclave manager of the
+// project. The projects that don't have one were booted before the enclave
+// managers were configurable, by the default one.
+func (p *Project) getEnclaveManager() string {
+	if p.EnclaveManager == "" {
+		return DefaultEnclaveManager
+	}
+
+	return p.EnclaveManager
+}
+
+func createProjectInstace(idStr, pubKey, title, description string,
+	conf *Config) (string, error) {
+
 	outb, err := conf.Executor.Run("./pcadmin", "-c", conf.ConfigPath, "contract",
 		"project", "spawn", "-is", idStr, "-bc", conf.BCPath, "-sign",
-		conf.KeyID, "-darc", conf.DarcID, "-pubKey", pubKey)
+		conf.KeyID, "-darc", conf.DarcID, "-pubKey", pubKey, "--title", title,
+		"--description", description, "--organisation", conf.Organisation,
+		"--catalogID", conf.CatalogID)
 	if err != nil {
 		return "", xerrors.Errorf("failed to run the command: %v", err.Error())
 	}
@@ -666,6 +937,9 @@ func (p *Project) RequestUpdateAttributes(values url.Values, conf *Config) {
 					request.StatusNotifier.UpdateStatusAndClose(
 						RequestStatusDone)
 				}
+				// Each event is saved with the project, so that the
+				// tasks survive a crash
+				p.save()
 			default:
 				select {
 				case <-client.Done:
@@ -800,15 +1074,10 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 					// Here we must check the error message and update the
 					// FailedReasons of each attribute accordingly.
 					_, latestDetails := p.GetLastestTaskMsg()
-					splitMsg := strings.SplitN(latestDetails, "verification failed, here is why:\n", 2)
-					log.LLvl1("here is the split", splitMsg)
-					if len(splitMsg) == 2 {
-						failedReasonsJSONStr := splitMsg[1]
-						failedReasons := &catalogc.FailedReasons{}
-						err := json.Unmarshal([]byte(failedReasonsJSONStr), failedReasons)
-						if err != nil {
-							log.Errorf("failed to unmarshal failed reasons: %s", err.Error())
-						}
+					failedReasons, err := ParseFailedReasons(latestDetails)
+					if err != nil {
+						log.Errorf("failed to parse failed reasons: %s", err.Error())
+					} else if failedReasons != nil {
 						p.updateFailedReasons(failedReasons, conf)
 					}
 
@@ -825,6 +1094,9 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 				//   nothing to do because there is still the cloud logs that
 				//   must be closed OK
 				// }
+				// Each event is saved with the project, so that the
+				// tasks survive a crash
+				p.save()
 			default:
 				select {
 				case <-client.Done:
@@ -836,6 +1108,17 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 		}
 	}()
 
+	// The enclave checks the datasets it downloads, but we don't want to boot
+	// it for datasets that have been modified on the cloud.
+	task.AddInfo(tef.Source, "checking the datasets", "checking that the "+
+		"datasets on the cloud match the manifests signed by their owner")
+	err := p.checkDatasets(conf)
+	if err != nil {
+		log.Infof("failed to check the datasets: %s", err.Error())
+		task.CloseError(tef.Source, "dataset integrity check failed", err.Error())
+		return
+	}
+
 	aliasName, bucketName, prefix := request.GetCloudAttributes(p.UID)
 	cloudNotifier, err := helpers.NewCloudNotifier(aliasName, bucketName, prefix)
 	if err != nil {
@@ -856,6 +1139,7 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 					request.Status = RequestStatusErrored
 					request.StatusNotifier.UpdateStatusAndClose(
 						RequestStatusErrored)
+					p.save()
 
 				} else if taskEl.Type == helpers.TypeCloseOK {
 
@@ -866,6 +1150,7 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 					request.Status = RequestStatusDone
 					request.StatusNotifier.UpdateStatusAndClose(
 						RequestStatusDone)
+					p.save()
 
 				}
 			default:
@@ -879,7 +1164,8 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 		}
 	}()
 
-	urlStr := fmt.Sprintf("http://localhost:5000/eprojects/%s/unlock", p.InstanceID)
+	urlStr := fmt.Sprintf("%s/eprojects/%s/unlock", p.getEnclaveManager(),
+		p.InstanceID)
 
 	task.AddInfo(tef.Source, "Sending a request to the enclave manager", " PUT "+urlStr)
 
@@ -946,6 +1232,113 @@ func (p *Project) RequestUnlockEnclave(conf *Config) {
 	}
 }
 
+// checkDatasets checks that the datasets of the project on the cloud match the
+// manifests signed by their owner. Datasets added to the catalog without a
+// manifest are not checked.
+func (p *Project) checkDatasets(conf *Config) error {
+	outb, err := conf.Executor.Run("./pcadmin", "contract", "project", "get",
+		"-i", p.InstanceID, "-bc", conf.BCPath, "-x")
+	if err != nil {
+		return xerrors.Errorf("failed to get the project instance: %v", err)
+	}
+
+	projectContractData := &projectc.ProjectData{}
+	err = projectc.DecodeProjectData(outb.Bytes(), projectContractData)
+	if err != nil {
+		return xerrors.Errorf("failed to decode project instance: %v", err)
+	}
+
+	for _, instanceID := range projectContractData.Datasets {
+		outb, err = conf.Executor.Run("./catadmin", "contract", "catalog",
+			"getSingleDataset", "-calypsoWriteID", instanceID.String(), "-i",
+			conf.CatalogID, "-bc", conf.BCPath, "--export")
+		if err != nil {
+			return xerrors.Errorf("failed to get the dataset %s: %v",
+				instanceID, err)
+		}
+
+		var dataset catalogc.Dataset
+		err = protobuf.Decode(outb.Bytes(), &dataset)
+		if err != nil {
+			return xerrors.Errorf("failed to decode the dataset %s: %v",
+				instanceID, err)
+		}
+
+		if dataset.Manifest == nil {
+			log.Infof("dataset %s has no manifest, not checking it",
+				dataset.CalypsoWriteID)
+			continue
+		}
+
+		err = dataset.VerifyManifest()
+		if err != nil {
+			return xerrors.Errorf("wrong manifest for the dataset '%s': %v",
+				dataset.Title, err)
+		}
+
+		// The cloud URL is like 'dedis/datasets/name', where 'dedis' is the
+		// alias of the cloud
+		urlSplit := strings.SplitN(dataset.CloudURL, "/", 3)
+		if len(urlSplit) != 3 {
+			return xerrors.Errorf("unexpected cloud URL of the dataset "+
+				"'%s': %s", dataset.Title, dataset.CloudURL)
+		}
+
+		// The files of a multi-file dataset are stored under its cloud URL
+		if dataset.Manifest.Manifest.IsMultiFile() {
+			err = dataset.Manifest.Manifest.CheckFiles(func(object string) (
+				io.ReadCloser, error) {
+
+				return conf.CloudClient.GetObject(urlSplit[1],
+					urlSplit[2]+"/"+object, minio.GetObjectOptions{})
+			})
+			if err != nil {
+				return xerrors.Errorf("the dataset '%s' at %s does not match "+
+					"its signed manifest: %v", dataset.Title, dataset.CloudURL,
+					err)
+			}
+			continue
+		}
+
+		object, err := conf.CloudClient.GetObject(urlSplit[1], urlSplit[2],
+			minio.GetObjectOptions{})
+		if err != nil {
+			return xerrors.Errorf("failed to get the dataset '%s' from the "+
+				"cloud: %v", dataset.Title, err)
+		}
+
+		err = dataset.Manifest.Manifest.Check(object)
+		object.Close()
+		if err != nil {
+			return xerrors.Errorf("the dataset '%s' at %s does not match its "+
+				"signed manifest: %v", dataset.Title, dataset.CloudURL, err)
+		}
+	}
+
+	return nil
+}
+
+// ParseFailedReasons extracts the FailedReasons from the details of the event
+// that closed a failed unlock request. It returns nil if the failure is not
+// caused by the verification of the attributes.
+func ParseFailedReasons(details string) (*catalogc.FailedReasons, error) {
+	// The interpreters of the conode return an error like "attr:allowed
+	// verification failed, here is why:\n{...}", which may then be wrapped.
+	splitMsg := strings.SplitN(details, "verification failed, here is why:\n", 2)
+	if len(splitMsg) != 2 {
+		return nil, nil
+	}
+
+	failedReasons := &catalogc.FailedReasons{}
+	// The decoder ignores what follows the JSON, if the error was wrapped
+	err := json.NewDecoder(strings.NewReader(splitMsg[1])).Decode(failedReasons)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal failed reasons: %v", err)
+	}
+
+	return failedReasons, nil
+}
+
 func (p *Project) updateFailedReasons(failedReasons *catalogc.FailedReasons,
 	conf *Config) error {
 
@@ -965,7 +1358,7 @@ func (p *Project) updateFailedReasons(failedReasons *catalogc.FailedReasons,
 
 	cmdOut := outb.Bytes()
 	projectContractData = &projectc.ProjectData{}
-	err = protobuf.Decode(cmdOut, projectContractData)
+	err = projectc.DecodeProjectData(cmdOut, projectContractData)
 	if err != nil {
 		return errors.New("failed to decode project innstance: " + err.Error())
 	}
@@ -1050,6 +1443,9 @@ func (p *Project) RequestDeleteEnclave(conf *Config) {
 					request.StatusNotifier.UpdateStatusAndClose(
 						RequestStatusDone)
 				}
+				// Each event is saved with the project, so that the
+				// tasks survive a crash
+				p.save()
 			default:
 				select {
 				case <-client.Done:
@@ -1061,10 +1457,14 @@ func (p *Project) RequestDeleteEnclave(conf *Config) {
 		}
 	}()
 
+	urlStr := p.getEnclaveManager() + "/eprojects/" + p.InstanceID
+
+	task.AddInfo(tef.Source, "Sending a request to the enclave manager", "DELETE "+urlStr)
+
 	formData := url.Values{
 		"_method": {"delete"},
 	}
-	resp, err := http.PostForm("http://localhost:5000/eprojects/"+p.InstanceID, formData)
+	resp, err := http.PostForm(urlStr, formData)
 	if err != nil {
 		log.Infof("Failed to send request: %s", err.Error())
 		task.CloseError(tef.Source, "Failed to send request", err.Error())
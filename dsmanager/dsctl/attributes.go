@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"sort"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// The attributes file answers the form of the attributes of the web interface.
+// It maps the name of each attribute to its value, which is:
+//
+//   - the ID of the selected option for a group of radio buttons
+//   - "checked" for a checkbox that is selected
+//   - the text for the other attributes
+//
+// For example:
+//
+//   access: opt_in
+//   use_restrictions: checked
+//   purpose: "analysis of the customers churn"
+
+// loadAttributes reads the attributes file and returns the values expected by
+// the request that updates the attributes.
+func loadAttributes(path string) (url.Values, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the attributes file: %v", err)
+	}
+
+	return parseAttributes(buf)
+}
+
+// parseAttributes decodes the YAML of an attributes file
+func parseAttributes(buf []byte) (url.Values, error) {
+	attributes := make(map[string]string)
+	err := yaml.UnmarshalStrict(buf, &attributes)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the attributes: %v", err)
+	}
+
+	if len(attributes) == 0 {
+		return nil, xerrors.New("the attributes file is empty")
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := url.Values{}
+	for _, name := range names {
+		// Those are the special keys of the form, like '_method'
+		if name == "" || name[0] == '_' {
+			return nil, xerrors.Errorf("wrong attribute name '%s'", name)
+		}
+		if attributes[name] == "" {
+			return nil, xerrors.Errorf("the attribute '%s' has no value", name)
+		}
+		values.Set(name, attributes[name])
+	}
+
+	return values, nil
+}
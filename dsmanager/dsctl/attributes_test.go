@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAttributes(t *testing.T) {
+	values, err := parseAttributes([]byte(`
+access: opt_in
+use_restrictions: checked
+purpose: "analysis of the customers churn"
+retention: 30
+`))
+	require.NoError(t, err)
+	require.Len(t, values, 4)
+	require.Equal(t, "opt_in", values.Get("access"))
+	require.Equal(t, "checked", values.Get("use_restrictions"))
+	require.Equal(t, "analysis of the customers churn", values.Get("purpose"))
+	require.Equal(t, "30", values.Get("retention"))
+}
+
+func TestParseAttributes_Wrong(t *testing.T) {
+	_, err := parseAttributes([]byte(""))
+	require.EqualError(t, err, "the attributes file is empty")
+
+	_, err = parseAttributes([]byte("access: [a, b]"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to decode the attributes")
+
+	_, err = parseAttributes([]byte("access: a\naccess: b"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to decode the attributes")
+
+	_, err = parseAttributes([]byte("_method: put"))
+	require.EqualError(t, err, "wrong attribute name '_method'")
+
+	_, err = parseAttributes([]byte("purpose: \"\""))
+	require.EqualError(t, err, "the attribute 'purpose' has no value")
+}
+
+func TestLoadAttributes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dsctl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "attributes.yaml")
+	err = ioutil.WriteFile(path, []byte("access: opt_in\n"), 0600)
+	require.NoError(t, err)
+
+	values, err := loadAttributes(path)
+	require.NoError(t, err)
+	require.Equal(t, "opt_in", values.Get("access"))
+
+	_, err = loadAttributes(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to read the attributes file")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// requestFlags are the flags shared by all the commands that run requests
+var requestFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "db",
+		Value: "my.db",
+		Usage: "the database where the projects are saved",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Value: time.Hour,
+		Usage: "the maximum time to wait for each request",
+	},
+}
+
+// projectFlags are the flags of the commands that run a request on an existing
+// project
+var projectFlags = append([]cli.Flag{
+	cli.StringFlag{
+		Name:  "project, p",
+		Usage: "the UID of the project (required)",
+	},
+}, requestFlags...)
+
+// newProjectFlags are the flags of the commands that create a project
+var newProjectFlags = append([]cli.Flag{
+	cli.StringSliceFlag{
+		Name:  "dataset, ds",
+		Usage: "the calypso write ID of a dataset of the project, can be repeated (required)",
+	},
+	cli.StringFlag{
+		Name:  "title",
+		Usage: "the title of the project, random if empty",
+	},
+	cli.StringFlag{
+		Name:  "description",
+		Usage: "the purpose of the project",
+	},
+	cli.StringFlag{
+		Name:  "enclave-manager",
+		Usage: "the base URL of the enclave manager that boots the enclave, one of the config (default is to try them in order)",
+	},
+}, requestFlags...)
+
+var cmds = cli.Commands{
+	{
+		Name:   "create",
+		Usage:  "create a project and boot its enclave, then print the UID of the project",
+		Action: createProject,
+		Flags:  newProjectFlags,
+	},
+	{
+		Name:   "boot",
+		Usage:  "boot the enclave of a project again, for example after a failure",
+		Action: bootEnclave,
+		Flags:  projectFlags,
+	},
+	{
+		Name:   "attributes",
+		Usage:  "update the attributes of a project with the answers of a YAML file",
+		Action: updateAttributes,
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "file, f",
+				Usage: "the YAML file that maps the name of the attributes to their value (required)",
+			},
+		}, projectFlags...),
+	},
+	{
+		Name:   "unlock",
+		Usage:  "unlock the enclave of a project, fails with the reasons if the attributes are not verified",
+		Action: unlockEnclave,
+		Flags:  projectFlags,
+	},
+	{
+		Name:   "delete",
+		Usage:  "delete the enclave of a project",
+		Action: deleteEnclave,
+		Flags:  projectFlags,
+	},
+	{
+		Name:   "run",
+		Usage:  "create a project, boot its enclave, update its attributes and unlock it",
+		Action: runProject,
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "file, f",
+				Usage: "the YAML file that maps the name of the attributes to their value (required)",
+			},
+		}, newProjectFlags...),
+	},
+}
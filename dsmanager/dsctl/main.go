@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/onet/v3/log"
+)
+
+var cliApp = cli.NewApp()
+
+var gitTag = "dev"
+
+func init() {
+	cliApp.Name = "dsctl"
+	cliApp.Usage = "Handle the projects of the data scientist manager without its web interface"
+	cliApp.Description = "dsctl runs the same requests as the data scientist " +
+		"manager and must be run from its folder, where it finds the " +
+		"'config.toml' file and the bcadmin, catadmin, csadmin and pcadmin " +
+		"executables. The projects are saved in the same database as the data " +
+		"scientist manager, which must not be running at the same time."
+	cliApp.Version = gitTag
+	// The events of the requests are printed on stderr, so that stdout only
+	// holds the results, like the UID of a new project
+	cliApp.ErrWriter = os.Stderr
+	cliApp.Commands = cmds // stored in "commands.go"
+	cliApp.Flags = []cli.Flag{
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+	}
+	cliApp.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		return nil
+	}
+}
+
+func main() {
+	rand.Seed(time.Now().Unix())
+	err := cliApp.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
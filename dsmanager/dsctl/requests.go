@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/dedis/odyssey/dsmanager/app/models"
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+)
+
+// projectsBucket is the bucket of the store that holds the projects, the same
+// as the data scientist manager
+const projectsBucket = "Projects"
+
+// printTimeout is the time given to the printers to print the last events once
+// a request is done
+const printTimeout = 5 * time.Second
+
+// session holds what the requests of a command need
+type session struct {
+	conf    *models.Config
+	store   *helpers.Store
+	printer *printTaskManager
+	timeout time.Duration
+}
+
+// openSession loads the configuration and the projects the same way as the
+// data scientist manager, except that the events of the tasks are printed.
+func openSession(c *cli.Context) (*session, error) {
+	conf, err := models.NewConfig()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	store, err := helpers.OpenStore(c.String("db"), projectsBucket)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open the database: %v", err)
+	}
+	models.SetProjectStore(store)
+
+	printer := newPrintTaskManager(conf.TaskManager, c.App.ErrWriter)
+	conf.TaskManager = printer
+
+	return &session{
+		conf:    conf,
+		store:   store,
+		printer: printer,
+		timeout: c.Duration("timeout"),
+	}, nil
+}
+
+// close closes the database, which saves the projects
+func (s *session) close() {
+	s.store.Close()
+}
+
+// getProject returns the project of the --project flag
+func (s *session) getProject(c *cli.Context) (*models.Project, error) {
+	uid := c.String("project")
+	if uid == "" {
+		return nil, xerrors.New("--project flag is required")
+	}
+
+	project, ok := models.GetProject(uid)
+	if !ok || project == nil {
+		return nil, xerrors.Errorf("project '%s' not found", uid)
+	}
+
+	return project, nil
+}
+
+// getInstantiatedProject returns the project of the --project flag if its
+// project instance is created
+func (s *session) getInstantiatedProject(c *cli.Context) (*models.Project,
+	error) {
+
+	project, err := s.getProject(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if project.InstanceID == "" {
+		return nil, xerrors.Errorf("the instance ID of the project '%s' is "+
+			"not set, please boot it first", project.UID)
+	}
+
+	return project, nil
+}
+
+// wait waits for the end of the last request of the project and returns an
+// error if it failed
+func (s *session) wait(project *models.Project) error {
+	if len(project.Requests) == 0 {
+		return xerrors.New("the project has no request")
+	}
+	request := project.Requests[len(project.Requests)-1]
+
+	status, err := waitRequest(request, s.timeout)
+	// We want the events that explain the result
+	s.printer.wait(printTimeout)
+	if err != nil {
+		return err
+	}
+
+	if status != models.RequestStatusDone {
+		msg, details := project.GetLastestTaskMsg()
+		return xerrors.Errorf("the request '%s' failed with the project in "+
+			"status '%s': %s\n%s", request.Description, project.Status, msg,
+			details)
+	}
+
+	return nil
+}
+
+// waitRequest waits until the status of the request is final and returns it
+func waitRequest(request *models.Request, timeout time.Duration) (string,
+	error) {
+
+	client := request.StatusNotifier.Subscribe()
+	timer := time.After(timeout)
+
+	for {
+		select {
+		case <-client.NotifyStream:
+		case <-client.Done:
+			request.StatusNotifier.Lock()
+			status := request.StatusNotifier.Status
+			request.StatusNotifier.Unlock()
+			return status, nil
+		case <-timer:
+			return "", xerrors.Errorf("the request '%s' did not end after %s",
+				request.Description, timeout)
+		}
+	}
+}
+
+func createProject(c *cli.Context) error {
+	s, err := openSession(c)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	project, err := s.create(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.App.Writer, project.UID)
+	return nil
+}
+
+// create creates a new project and boots its enclave
+func (s *session) create(c *cli.Context) (*models.Project, error) {
+	datasetIDs := c.StringSlice("dataset")
+	if len(datasetIDs) == 0 {
+		return nil, xerrors.New("--dataset flag is required")
+	}
+
+	enclaveManager := strings.TrimRight(c.String("enclave-manager"), "/")
+	if enclaveManager != "" && !s.conf.IsEnclaveManager(enclaveManager) {
+		return nil, xerrors.Errorf("unknown enclave manager '%s', it must be "+
+			"one of %v", enclaveManager, s.conf.GetEnclaveManagers())
+	}
+
+	project := models.NewProject(c.String("title"), c.String("description"))
+	fmt.Fprintf(c.App.ErrWriter, "created project '%s' with UID %s\n",
+		project.Title, project.UID)
+
+	if enclaveManager != "" {
+		project.EnclaveManager = enclaveManager
+		err := project.Save()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to save the project: %v", err)
+		}
+	}
+
+	request, task := project.RequestCreateProjectInstance(datasetIDs, s.conf)
+	// if either ones are nil that means an error happened and the request
+	// is already closed.
+	if request != nil && task != nil {
+		project.RequestBootEnclave(request, task, s.conf)
+	}
+
+	err := s.wait(project)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to boot the enclave of the "+
+			"project %s: %v", project.UID, err)
+	}
+
+	return project, nil
+}
+
+func bootEnclave(c *cli.Context) error {
+	s, err := openSession(c)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	project, err := s.getInstantiatedProject(c)
+	if err != nil {
+		return err
+	}
+
+	project.RequestBootEnclave(nil, nil, s.conf)
+
+	return s.wait(project)
+}
+
+func updateAttributes(c *cli.Context) error {
+	values, err := loadAttributes(c.String("file"))
+	if err != nil {
+		return err
+	}
+
+	s, err := openSession(c)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	project, err := s.getInstantiatedProject(c)
+	if err != nil {
+		return err
+	}
+
+	project.RequestUpdateAttributes(values, s.conf)
+
+	return s.wait(project)
+}
+
+func unlockEnclave(c *cli.Context) error {
+	s, err := openSession(c)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	project, err := s.getInstantiatedProject(c)
+	if err != nil {
+		return err
+	}
+
+	return s.unlock(project)
+}
+
+// unlock unlocks the enclave of the project. If the attributes of the project
+// are not verified, the error gives the reasons.
+func (s *session) unlock(project *models.Project) error {
+	project.RequestUnlockEnclave(s.conf)
+
+	err := s.wait(project)
+	if err == nil {
+		return nil
+	}
+
+	_, details := project.GetLastestTaskMsg()
+	failedReasons, parseErr := models.ParseFailedReasons(details)
+	if parseErr != nil || failedReasons == nil {
+		return err
+	}
+
+	return xerrors.Errorf("the verification of the attributes of the project "+
+		"%s failed:\n%s", project.UID, formatFailedReasons(failedReasons))
+}
+
+func deleteEnclave(c *cli.Context) error {
+	s, err := openSession(c)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	project, err := s.getInstantiatedProject(c)
+	if err != nil {
+		return err
+	}
+
+	project.RequestDeleteEnclave(s.conf)
+
+	return s.wait(project)
+}
+
+func runProject(c *cli.Context) error {
+	values, err := loadAttributes(c.String("file"))
+	if err != nil {
+		return err
+	}
+
+	s, err := openSession(c)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	project, err := s.create(c)
+	if err != nil {
+		return err
+	}
+
+	// The UID is printed first so that the project can be used even if the
+	// next requests fail
+	fmt.Fprintln(c.App.Writer, project.UID)
+
+	project.RequestUpdateAttributes(values, s.conf)
+	err = s.wait(project)
+	if err != nil {
+		return xerrors.Errorf("failed to update the attributes: %v", err)
+	}
+
+	return s.unlock(project)
+}
+
+// formatFailedReasons returns the reasons of a failed verification, one per
+// line
+func formatFailedReasons(failedReasons *catalogc.FailedReasons) string {
+	out := new(strings.Builder)
+
+	for _, fr := range failedReasons.FailedReasons {
+		if fr == nil {
+			continue
+		}
+		fmt.Fprintf(out, "- attribute '%s'", fr.AttributeID)
+		if fr.Dataset != "" {
+			fmt.Fprintf(out, " for the dataset '%s'", fr.Dataset)
+		}
+		fmt.Fprintf(out, ": %s\n", fr.Reason)
+	}
+
+	return out.String()
+}
+
+// printTaskManager is a task manager that prints the events of its tasks as
+// they happen.
+//
+// - implements helpers.TaskManagerI
+type printTaskManager struct {
+	helpers.TaskManagerI
+	out io.Writer
+	// outLock prevents the events of different tasks from mixing
+	outLock sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// newPrintTaskManager returns a printTaskManager that creates its tasks with
+// the given task manager
+func newPrintTaskManager(taskManager helpers.TaskManagerI,
+	out io.Writer) *printTaskManager {
+
+	return &printTaskManager{
+		TaskManagerI: taskManager,
+		out:          out,
+	}
+}
+
+// NewTask creates a new task and prints its events until it ends
+//
+// - implements helpers.TaskManagerI
+func (m *printTaskManager) NewTask(title string) helpers.TaskI {
+	task := m.TaskManagerI.NewTask(title)
+	client := task.Subscribe()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			select {
+			case event := <-client.TaskStream:
+				m.print(title, event)
+			case <-client.Done:
+				// We ensure we empty the stream before exiting
+				for {
+					select {
+					case event := <-client.TaskStream:
+						m.print(title, event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return task
+}
+
+// print prints an event of a task
+func (m *printTaskManager) print(title string, event *helpers.TaskEvent) {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "[%s] %s %s: %s\n", title, event.Type, event.Source,
+		event.Message)
+	if event.Details != "" {
+		fmt.Fprintf(out, "    %s\n",
+			strings.Replace(event.Details, "\n", "\n    ", -1))
+	}
+
+	m.outLock.Lock()
+	io.WriteString(m.out, out.String())
+	m.outLock.Unlock()
+}
+
+// wait waits until all the tasks ended and their events are printed, or until
+// the timeout
+func (m *printTaskManager) wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
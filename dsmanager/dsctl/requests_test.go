@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
+	"github.com/dedis/odyssey/dsmanager/app/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintTaskManager(t *testing.T) {
+	out := new(bytes.Buffer)
+	taskManager := newPrintTaskManager(helpers.NewDefaultTaskManager(), out)
+
+	task := taskManager.NewTask("Test task")
+	task.AddInfo("dsctl", "first", "")
+	task.CloseError("dsctl", "failed", "line 1\nline 2")
+
+	taskManager.wait(time.Second)
+
+	require.Equal(t, 1, taskManager.NumTasks())
+	require.Equal(t, "[Test task] info dsctl: first\n"+
+		"[Test task] closeError dsctl: failed\n"+
+		"    line 1\n"+
+		"    line 2\n", out.String())
+}
+
+func TestWaitRequest(t *testing.T) {
+	request := &models.Request{
+		Description:    "Test request",
+		StatusNotifier: helpers.NewStatusNotifier(),
+	}
+
+	go func() {
+		request.StatusNotifier.UpdateStatus(models.RequestStatusRunning)
+		request.StatusNotifier.UpdateStatusAndClose(models.RequestStatusDone)
+	}()
+
+	status, err := waitRequest(request, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, models.RequestStatusDone, status)
+
+	// A terminated request returns at once
+	status, err = waitRequest(request, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, models.RequestStatusDone, status)
+
+	request.StatusNotifier = helpers.NewStatusNotifier()
+	_, err = waitRequest(request, 10*time.Millisecond)
+	require.EqualError(t, err, "the request 'Test request' did not end "+
+		"after 10ms")
+}
+
+func TestFailedReasons(t *testing.T) {
+	details := "failed to unlock: attr:allowed verification failed, here is why:\n" +
+		`{"failed_reasons":[{"attribute_id":"use_restrictions",` +
+		`"reason":"not allowed","dataset":"Customers"},` +
+		`{"attribute_id":"access","reason":"missing","dataset":""}]}` +
+		" - closing"
+
+	failedReasons, err := models.ParseFailedReasons(details)
+	require.NoError(t, err)
+	require.NotNil(t, failedReasons)
+
+	require.Equal(t, "- attribute 'use_restrictions' for the dataset "+
+		"'Customers': not allowed\n"+
+		"- attribute 'access': missing\n", formatFailedReasons(failedReasons))
+
+	failedReasons, err = models.ParseFailedReasons("Got an unexpected response")
+	require.NoError(t, err)
+	require.Nil(t, failedReasons)
+
+	_, err = models.ParseFailedReasons(
+		"verification failed, here is why:\nnot JSON")
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(),
+		"failed to unmarshal failed reasons"))
+}
@@ -280,6 +280,16 @@ if [ ! -z "$READY" ]; then
     runCheck rm -rf /home/enclave/datasets
     runCheck mkdir -p /home/enclave/datasets
 
+    # The project is needed to get the owners and the manifests of the
+    # datasets from its catalog
+    logInfo "getting the project instance id" "from the VmWare tool"
+    PROJECT_INST_ID=$(vmtoolsd --cmd "info-get guestinfo.ovfenv" | perl -n -e '/key="project_instance_id".*value="(.*)"/ && print $1')
+    logInfo "got the project instance id" "here is the project instance id: $PROJECT_INST_ID"
+    if [ -z "$PROJECT_INST_ID" ]; then
+        logError "did not find the project instance id" "the 'project_instance_id' property is empty"
+        exit 1
+    fi
+
     logInfo "loop over the datasets" "iterating over the instance IDs"
 
     # Iterate over the instance ids
@@ -307,29 +317,112 @@ if [ ! -z "$READY" ]; then
         logInfo "now decrypting" "executing 'csadmin decrypt'"
         secret=$(/home/enclave/csadmin decrypt --key "$keypath" < "/home/enclave/replies/$i.bin" -x | xxd -p)
 
-        logInfo "dowload the dataset" "so let's download dataset $CLOUD_URL"
-        runCheck /home/enclave/mc --config-dir "$MC_CONFIG_PATH" cp "$CLOUD_URL" "/home/enclave/datasets/$DATASET_FILENAME"
-        if [ ! -s "/home/enclave/datasets/$DATASET_FILENAME" ]; then
-            logError "dataset not found" "no file downloaded, or it is zero length"
+        # The owner of the dataset and its signed manifest are taken from the
+        # catalog of the project, since anyone can create a write with any
+        # extra data. The write must be from the owner, and must point to a
+        # manifest if the catalog has one. Only the datasets added to the
+        # catalog before the manifests have none and are not checked.
+        MANIFEST_URL=$(echo "$WRITE_DATA" | perl -n -e '/"ManifestURL": "(.*?)",/ && print $1')
+        IDENTITY_STR=$(echo "$WRITE_DATA" | perl -n -e '/"IdentityStr": "(.*?)"/ && print $1')
+        CATALOG_FILE="/home/enclave/datasets/$DATASET_FILENAME.catalog"
+        MANIFEST_FILE="/home/enclave/datasets/$DATASET_FILENAME.manifest"
+        logInfo "getting the catalog entry" "getting the owner and the manifest of dataset $wid from the catalog with 'pcadmin contract project getManifest'"
+        if ! /home/enclave/pcadmin contract project getManifest -i "$PROJECT_INST_ID" --datasetID "$wid" > "$CATALOG_FILE" 2> /tmp/startup_catalog_log; then
+            logError "failed to get the catalog entry" "the owner and the manifest of dataset $wid could not be read from the catalog: $(cat /tmp/startup_catalog_log)"
+            exit 1
+        fi
+
+        OWNER_IDENTITY=$(/home/enclave/jq-linux64 -r '.identity' < "$CATALOG_FILE")
+        if [ -z "$OWNER_IDENTITY" ] || [ "$IDENTITY_STR" != "$OWNER_IDENTITY" ]; then
+            logError "dataset integrity check failed" "the write of dataset $wid is from '$IDENTITY_STR', but its owner in the catalog is '$OWNER_IDENTITY'"
+            exit 1
+        fi
+
+        HAS_MANIFEST=0
+        MULTI_FILE=0
+        if [ "$(/home/enclave/jq-linux64 '.manifest != null' < "$CATALOG_FILE")" = "true" ]; then
+            HAS_MANIFEST=1
+            if [ -z "$MANIFEST_URL" ]; then
+                logError "dataset integrity check failed" "the catalog entry of dataset $wid has a manifest, but its write has no manifest URL"
+                exit 1
+            fi
+            if ! /home/enclave/jq-linux64 '.manifest' < "$CATALOG_FILE" > "$MANIFEST_FILE"; then
+                logError "failed to read the manifest" "the manifest of dataset $wid could not be extracted from its catalog entry"
+                exit 1
+            fi
+
+            # A multi-file dataset lists its files in the manifest. Each file
+            # is stored under the cloud URL of the dataset.
+            if [ "$(/home/enclave/jq-linux64 '.manifest.files | length' < "$MANIFEST_FILE")" -gt 0 ]; then
+                MULTI_FILE=1
+            fi
+        elif [ -n "$MANIFEST_URL" ]; then
+            logError "dataset integrity check failed" "the write of dataset $wid has a manifest URL, but its catalog entry has no manifest"
             exit 1
+        else
+            logInfo "dataset NOT checked" "the catalog entry of dataset $DATASET_FILENAME ($wid) was added before the signed manifests and has none, so the dataset is used without any integrity check"
+        fi
+
+        if [ $MULTI_FILE -eq 1 ]; then
+            logInfo "dowload the dataset" "so let's download the files of dataset $CLOUD_URL"
+            mkdir -p "/home/enclave/datasets/$DATASET_FILENAME"
+            # The manifest is not verified yet, so the names of the objects
+            # are checked before being used as paths
+            for object in $(/home/enclave/jq-linux64 -r '.manifest.files[].object' < "$MANIFEST_FILE"); do
+                if ! [[ "$object" =~ ^[0-9]+\.aes$ ]]; then
+                    logError "dataset integrity check failed" "unexpected object '$object' in the manifest of $DATASET_FILENAME"
+                    exit 1
+                fi
+                runCheck /home/enclave/mc --config-dir "$MC_CONFIG_PATH" cp "$CLOUD_URL/$object" "/home/enclave/datasets/$DATASET_FILENAME/$object"
+            done
+            VERIFY_DATA=(--dir "/home/enclave/datasets/$DATASET_FILENAME")
+        else
+            logInfo "dowload the dataset" "so let's download dataset $CLOUD_URL"
+            runCheck /home/enclave/mc --config-dir "$MC_CONFIG_PATH" cp "$CLOUD_URL" "/home/enclave/datasets/$DATASET_FILENAME"
+            if [ ! -s "/home/enclave/datasets/$DATASET_FILENAME" ]; then
+                logError "dataset not found" "no file downloaded, or it is zero length"
+                exit 1
+            fi
+            VERIFY_DATA=(--file "/home/enclave/datasets/$DATASET_FILENAME")
+        fi
+
+        if [ $HAS_MANIFEST -eq 1 ]; then
+            logInfo "checking the dataset" "checking the dataset against the manifest signed by $OWNER_IDENTITY"
+            if ! /home/enclave/cryptutil verify --manifest "$MANIFEST_FILE" --identity "$OWNER_IDENTITY" --datasetID "$wid" "${VERIFY_DATA[@]}" > /tmp/startup_verify_log 2>&1; then
+                logError "dataset integrity check failed" "the dataset $DATASET_FILENAME does not match its signed manifest: $(cat /tmp/startup_verify_log)"
+                exit 1
+            fi
+            logInfo "dataset checked" "$(cat /tmp/startup_verify_log)"
         fi
 
         # The basename should end with the .aes extension. So the new filename
-        # will be the basename without the .aes extension.
+        # will be the basename without the .aes extension. A multi-file
+        # dataset is restored in a directory with the name of the dataset.
         NEW_FILENAME=$(basename "$CLOUD_URL" .aes)
+        if [ $MULTI_FILE -eq 1 ]; then
+            logInfo "restoring" "now let's decrypt the files of the dataset with 'cryptutil restore'"
+            if ! /home/enclave/cryptutil restore --manifest "$MANIFEST_FILE" --keyAndInitVal "$secret" --dir "/home/enclave/datasets/$DATASET_FILENAME" --out "/home/scientist/python_project/datasets/$NEW_FILENAME" > /tmp/startup_restore_log 2>&1; then
+                logError "failed to decrypt" "the files of the dataset $DATASET_FILENAME could not be restored: $(cat /tmp/startup_restore_log)"
+                exit 1
+            fi
+            logInfo "dataset decrypted" "dataset restored in the $NEW_FILENAME directory: $(cat /tmp/startup_restore_log)"
+            continue
+        fi
+
         logInfo "decrypting" "now let's decrypt the dataset with 'cryptutil'"
         # we cannot use 'runCheck' with stdin/out operations
-        # WARNING the cryptutil will load all the dataset into memory in order
-        # decrypt it. With big datasets (over 800Mb) that might thus not work
-        # since the enclave has only 1Gb of RAM.
-        /home/enclave/cryptutil decrypt --keyAndInitVal "$secret" --readData < "/home/enclave/datasets/$DATASET_FILENAME" -x > "/home/scientist/python_project/datasets/$NEW_FILENAME"
+        # Datasets in the chunked format are decrypted as a stream, and must
+        # belong to the write instance we got the key from. WARNING
+        # datasets uploaded before the chunked format are still loaded entirely
+        # into memory, which might not work for big ones (over 800Mb) since the
+        # enclave has only 1Gb of RAM.
+        if ! /home/enclave/cryptutil decrypt --keyAndInitVal "$secret" --datasetID "$wid" --readData < "/home/enclave/datasets/$DATASET_FILENAME" -x > "/home/scientist/python_project/datasets/$NEW_FILENAME"; then
+            logError "failed to decrypt" "the dataset $DATASET_FILENAME could not be decrypted, it might have been modified or truncated"
+            exit 1
+        fi
         logInfo "dataset decrypted" "dataset decrypted and saved in $NEW_FILENAME"
     done
 
-    logInfo "getting the project instance id" "from the VmWare tool"
-    PROJECT_INST_ID=$(vmtoolsd --cmd "info-get guestinfo.ovfenv" | perl -n -e '/key="project_instance_id".*value="(.*)"/ && print $1')
-    logInfo "got the project instance id" "here is the project instance id: $PROJECT_INST_ID"
-
     # Note: ideally we should set the status of the contract at the very end.
     # However, we need the private key in order to update the contract, this is
     # why we have to do it now. In case the key folder has not been deleted, we
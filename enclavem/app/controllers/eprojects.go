@@ -20,7 +20,6 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"go.dedis.ch/onet/v3/log"
-	"go.dedis.ch/protobuf"
 )
 
 // EProjectsIndexHandler ...
@@ -107,9 +106,11 @@ func eProjectsIndexGet(w http.ResponseWriter, r *http.Request,
 		fmt.Printf("Failed to get flash: %s\n", err.Error())
 	}
 
-	projectSlice := []*models.EProject{}
-	for _, value := range models.EProjectList {
-		projectSlice = append(projectSlice, value)
+	projectSlice, err := models.GetEProjects()
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/", "failed to get the eprojects: "+
+			err.Error(), w, r, store)
+		return
 	}
 
 	p := &viewData{
@@ -127,7 +128,14 @@ func eProjectsIndexGet(w http.ResponseWriter, r *http.Request,
 func eProjectsIndexDelete(w http.ResponseWriter, r *http.Request,
 	store sessions.Store, conf *models.Config) {
 
-	for k, eproject := range models.EProjectList {
+	eprojects, err := models.GetEProjects()
+	if err != nil {
+		xhelpers.RedirectWithErrorFlash("/eprojects", "failed to get the "+
+			"eprojects: "+err.Error(), w, r, store)
+		return
+	}
+
+	for _, eproject := range eprojects {
 		token, err := helpers.GetToken(w, conf)
 		if err != nil {
 			xhelpers.RedirectWithErrorFlash("/eprojects", "failed to get authentication token: "+err.Error(), w, r, store)
@@ -172,7 +180,12 @@ func eProjectsIndexDelete(w http.ResponseWriter, r *http.Request,
 			return
 		}
 
-		delete(models.EProjectList, k)
+		err = models.DeleteEProject(eproject.InstanceID)
+		if err != nil {
+			xhelpers.RedirectWithErrorFlash("/eprojects", "failed to delete "+
+				"the eproject: "+err.Error(), w, r, store)
+			return
+		}
 	}
 
 	xhelpers.RedirectWithInfoFlash("/eprojects", "eprojects and enclaves deleted", w, r, store)
@@ -188,7 +201,7 @@ func eProjectsShowGet(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	eproject, ok := models.EProjectList[id]
+	eproject, ok := models.GetEProject(id)
 	if !ok || eproject == nil {
 		xhelpers.RedirectWithErrorFlash("/", "eproject not found", w, r, store)
 		return
@@ -252,7 +265,7 @@ func eProjectsShowDelete(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	eproject, ok := models.EProjectList[id]
+	eproject, ok := models.GetEProject(id)
 	if !ok || eproject == nil {
 		tef.FlushTaskEventCloseError("eproject not found", id)
 		return
@@ -516,7 +529,11 @@ removeVapp:
 		return
 	}
 
-	delete(models.EProjectList, id)
+	err = models.DeleteEProject(id)
+	if err != nil {
+		handleError("failed to delete the eproject", err.Error())
+		return
+	}
 
 	tef.FlushTaskEventCloseOK("vApp destroyed ", eproject.EnclaveName)
 
@@ -549,7 +566,7 @@ func eProjectsShowUnlockPost(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	eproject, ok := models.EProjectList[id]
+	eproject, ok := models.GetEProject(id)
 	if !ok || eproject == nil {
 		tef.FlushTaskEventCloseError("EProject not found", id)
 		return
@@ -578,6 +595,9 @@ func eProjectsShowUnlockPost(w http.ResponseWriter, r *http.Request,
 	}
 
 	eproject.Status = models.EProjectStatusUnlockingEnclave
+	saveEProject(eproject)
+	// The status is updated on each return
+	defer saveEProject(eproject)
 
 	log.Lvlf1("We got this post form: %v", r.PostForm)
 	tef.FlushTaskEventInfo("getting the request index", "now let's try to get the request index from the POST form")
@@ -603,7 +623,7 @@ func eProjectsShowUnlockPost(w http.ResponseWriter, r *http.Request,
 	}
 	cmdOut := outb.Bytes()
 	projectContractData := &projectc.ProjectData{}
-	err = protobuf.Decode(cmdOut, projectContractData)
+	err = projectc.DecodeProjectData(cmdOut, projectContractData)
 	if err != nil {
 		handleError("failed to decode project innstance", err.Error())
 		eproject.Status = models.EProjectStatusUnlockingEnclaveErrored
@@ -629,7 +649,27 @@ func eProjectsShowUnlockPost(w http.ResponseWriter, r *http.Request,
 		writeInstIDSlice = append(writeInstIDSlice, instIDStr)
 		tef.FlushTaskEventInfof("sleeping", "sleeping 10 sec before talking to cothority...")
 		time.Sleep(time.Second * 10)
-		cmd := exec.Command("./csadmin", "-c", conf.ConfigPath, "contract",
+
+		// The read is recorded on the project right before it is spawned,
+		// with the same key, so that the conodes can enforce the rate limits
+		// of the dataset.
+		cmd := exec.Command("./pcadmin", "-c", conf.ConfigPath, "contract",
+			"project", "invoke", "recordRead", "-i", eproject.InstanceID,
+			"-bc", conf.BCPath, "-s", conf.KeyID, "--datasetID", instIDStr)
+		tef.FlushTaskEventInfof("recording the read", fmt.Sprintf("%v", cmd.Args))
+		var recordOutb, recordErrb bytes.Buffer
+		cmd.Stdout = &recordOutb
+		cmd.Stderr = &recordErrb
+		err := cmd.Run()
+		if err != nil {
+			handleError("failed to record the read", "failed to record the "+
+				"read on the project: %s - Output: %s - Err: %s", err.Error(),
+				recordOutb.String(), recordErrb.String())
+			eproject.Status = models.EProjectStatusUnlockingEnclaveErrored
+			return
+		}
+
+		cmd = exec.Command("./csadmin", "-c", conf.ConfigPath, "contract",
 			"read", "spawn", "-i", instIDStr, "-bc", conf.BCPath,
 			"-pid", eproject.InstanceID, "-s", conf.KeyID,
 			"--key", enclavePubKey, "-x")
@@ -637,7 +677,7 @@ func eProjectsShowUnlockPost(w http.ResponseWriter, r *http.Request,
 		var outb, errb bytes.Buffer
 		cmd.Stdout = &outb
 		cmd.Stderr = &errb
-		err := cmd.Run()
+		err = cmd.Run()
 		if err != nil {
 			handleError("failed to run the spawn cmd", "failed to spawn the read "+
 				"instance: %s - Output: %s - Err: %s", err.Error(),
@@ -980,3 +1020,12 @@ func eProjectsShowUnlockPost(w http.ResponseWriter, r *http.Request,
 
 	tef.FlushTaskEventCloseOK("enclave unlocked", eproject.EnclaveName)
 }
+
+// saveEProject saves the eproject and only logs the error, as it is done once
+// the response is already streamed.
+func saveEProject(eproject *models.EProject) {
+	err := eproject.Save()
+	if err != nil {
+		log.Errorf("failed to save eproject '%s': %v", eproject.InstanceID, err)
+	}
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/dedis/odyssey/enclavem/app/models"
+	"github.com/dedis/odyssey/projectc"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// WatchRevocations periodically checks the project instance of each eproject.
+// When a data owner revoked one of its datasets from a project, the enclave of
+// this project is deleted.
+// It stops when the done channel is closed.
+func WatchRevocations(store sessions.Store, conf *models.Config,
+	interval time.Duration, done chan bool) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			eprojects, err := models.GetEProjects()
+			if err != nil {
+				log.Errorf("failed to get the eprojects: %v", err)
+				continue
+			}
+			for _, eproject := range eprojects {
+				id := eproject.InstanceID
+				// The enclave is not there yet or is already being handled
+				if eproject.Status == models.EProjectStatusBootingEnclave ||
+					eproject.Status == models.EProjectStatusUnlockingEnclave {
+					continue
+				}
+				err := handleRevocations(store, conf, id, eproject)
+				if err != nil {
+					log.Errorf("failed to handle the revocations of eproject "+
+						"%s: %v", id, err)
+				}
+			}
+		}
+	}
+}
+
+// handleRevocations deletes the enclave if a dataset of the project has been
+// revoked and not yet handled.
+func handleRevocations(store sessions.Store, conf *models.Config, id string,
+	eproject *models.EProject) error {
+
+	outb, err := conf.Executor.Run("./pcadmin", "contract", "project", "get",
+		"-i", eproject.InstanceID, "-bc", conf.BCPath, "-x")
+	if err != nil {
+		return xerrors.Errorf("failed to get the project instance: %v", err)
+	}
+
+	projectData := &projectc.ProjectData{}
+	err = projectc.DecodeProjectData(outb.Bytes(), projectData)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the project instance: %v", err)
+	}
+
+	pending := make([]*projectc.Revocation, 0)
+	for _, revocation := range projectData.RevokedDatasets {
+		if revocation.Outcome == "" {
+			pending = append(pending, revocation)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	log.Lvlf1("found %d revoked dataset(s) on project %s, deleting the enclave",
+		len(pending), eproject.InstanceID)
+
+	// We re-use the deletion flow, which streams its events to the response
+	// writer. Here nobody listens to it so we use a recorder.
+	req, err := http.NewRequest(http.MethodPost, "/eprojects/"+id, nil)
+	if err != nil {
+		return xerrors.Errorf("failed to create request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"instID": id})
+	recorder := httptest.NewRecorder()
+
+	eProjectsShowDelete(recorder, req, store, conf)
+
+	// The eproject is removed from the list only if the deletion succeeded,
+	// otherwise the deletion is tried again at the next check. The outcome of
+	// the revocation can only be recorded on the project instance by the
+	// enclave, with its own key.
+	_, found := models.GetEProject(id)
+	if found {
+		return xerrors.Errorf("failed to delete the enclave after a "+
+			"revocation: %s", recorder.Body.String())
+	}
+
+	log.Lvlf1("deleted the enclave of project %s", eproject.InstanceID)
+
+	return nil
+}
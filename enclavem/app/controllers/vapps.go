@@ -142,6 +142,13 @@ func VappsIndexPost(w http.ResponseWriter, r *http.Request, gs sessions.Store,
 	var bodyBuf []byte
 	var err2 error
 
+	// The status of the eproject is updated on each return
+	defer func() {
+		if project != nil {
+			saveEProject(project)
+		}
+	}()
+
 	tef.FlushTaskEventInfo("parse arguments", "Trying to parse the POST arguments")
 
 	if err != nil {
@@ -371,7 +378,7 @@ func VappsIndexPost(w http.ResponseWriter, r *http.Request, gs sessions.Store,
 		}
 		// If the name is already used, that means the eproject should have
 		// already been created. If not we return an error
-		project, found = models.EProjectList[projectInstID]
+		project, found = models.GetEProject(projectInstID)
 		if !found || project == nil {
 			handleError("EProject not found",
 				"EProject not found at this instanceID: "+projectInstID)
@@ -439,7 +446,7 @@ func VappsIndexPost(w http.ResponseWriter, r *http.Request, gs sessions.Store,
 		EnclaveHref:   vapp.Href,
 		Status:        models.EProjectStatusBootingEnclave,
 	}
-	models.EProjectList[projectInstID] = project
+	saveEProject(project)
 
 	// ------------------------------------------------------------------------
 	// WAIT FOR NEW VAPP TASK TO END
@@ -809,6 +816,7 @@ setproperty:
 	}
 	ipAddr := networkConnectionSection.NetworkConnection.IPAddress
 	project.IPAddr = net.ParseIP(ipAddr)
+	saveEProject(project)
 	if project.IPAddr == nil {
 		handleError("error parsing IP Address",
 			fmt.Sprintf("Got IPAddress: %s", ipAddr))
@@ -1093,6 +1101,7 @@ setproperty:
 	}
 
 	project.PubKey = result
+	saveEProject(project)
 
 	log.LLvlf1("ok, erverything is allright (found '%s'), we can power off the enclave", result)
 	tef.FlushTaskEventImportantInfo("found the pub key", fmt.Sprintf(
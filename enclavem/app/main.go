@@ -3,8 +3,6 @@ package main
 import (
 	"context"
 	"encoding/gob"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -22,7 +21,6 @@ import (
 	"github.com/gorilla/sessions"
 
 	xlog "go.dedis.ch/onet/v3/log"
-	bolt "go.etcd.io/bbolt"
 )
 
 type key int
@@ -48,11 +46,14 @@ func main() {
 		log.Fatal("failed to load config", err)
 	}
 
-	xlog.Info("loading db into memory")
-	err = loadDb()
+	xlog.Info("opening the db")
+	eprojectStore, err := helpers.OpenStore("my.db", "EProjects")
 	if err != nil {
-		log.Fatal("failed to import DB: " + err.Error())
+		log.Fatal("failed to open the DB: " + err.Error())
 	}
+	// The eprojects are saved each time they change and read when they are
+	// needed.
+	models.SetEProjectStore(eprojectStore)
 
 	flag.StringVar(&listenAddr, "listen-addr", ":5000", "server listen address")
 	flag.Parse()
@@ -94,18 +95,15 @@ func main() {
 
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	// Reacts to the datasets revoked by their owner
+	go controllers.WatchRevocations(store, conf, 30*time.Second, done)
 
 	go func() {
 		<-quit
 		logger.Println("Server is shutting down...")
 
-		logger.Println("Saving memory variables into DB...")
-		err := saveDb()
-		if err != nil {
-			xlog.Error("failed to save the db: " + err.Error())
-		}
-
 		atomic.StoreInt32(&healthy, 0)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -125,6 +123,11 @@ func main() {
 	}
 
 	<-done
+
+	err = eprojectStore.Close()
+	if err != nil {
+		xlog.Error("failed to close the db: " + err.Error())
+	}
 	logger.Println("Server stopped")
 }
 
@@ -167,73 +170,6 @@ func tracing(nextRequestID func() string) func(http.Handler) http.Handler {
 	}
 }
 
-func loadDb() error {
-	db, err := bolt.Open("my.db", 0600, nil)
-	if err != nil {
-		return errors.New("failed to open DB: " + err.Error())
-	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("EProjects"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to create 'EProjects' bucket: " + err.Error())
-	}
-
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("EProjects"))
-		b.ForEach(func(k, v []byte) error {
-			project := &models.EProject{}
-			err := json.Unmarshal(v, project)
-			if err != nil {
-				return errors.New("failed to unmarshal eproject: " + err.Error())
-			}
-			models.EProjectList[string(k)] = project
-			return nil
-		})
-		return nil
-	})
-
-	return nil
-}
-
-func saveDb() error {
-	db, err := bolt.Open("my.db", 0600, nil)
-	if err != nil {
-		return errors.New("failed to open DB: " + err.Error())
-	}
-	defer db.Close()
-	err = db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte("EProjects"))
-		if err != nil {
-			return errors.New("failed to delete the EProjects bucket: " + err.Error())
-		}
-		b, err := tx.CreateBucketIfNotExists([]byte("EProjects"))
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		for k, project := range models.EProjectList {
-			projectBuf, err := json.Marshal(project)
-			if err != nil {
-				return errors.New("failed to marshal eproject: " + err.Error())
-			}
-			err = b.Put([]byte(k), projectBuf)
-			if err != nil {
-				return errors.New("failed to save eproject buf: " + err.Error())
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		return errors.New("failed to update 'EProjects' bucket: " + err.Error())
-	}
-	return nil
-}
-
 func faviconHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "assets/images/favicon.ico")
 }
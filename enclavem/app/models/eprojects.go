@@ -1,17 +1,31 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/dedis/odyssey/dsmanager/app/helpers"
 	"go.dedis.ch/onet/v3/log"
 	"golang.org/x/xerrors"
 )
 
-// EProjectList holds all the projects
-var EProjectList = make(map[string]*EProject)
+// eprojectsBucket is the bucket of the store that holds the eprojects
+const eprojectsBucket = "EProjects"
+
+var (
+	// eprojectList holds the eprojects, by instance ID, that have been created
+	// or read from the store. It must be used with eprojectListLock.
+	eprojectList     = make(map[string]*EProject)
+	eprojectListLock sync.Mutex
+
+	// eprojectStore saves the eprojects each time they change. Without it the
+	// eprojects are only kept in memory.
+	eprojectStore *helpers.Store
+)
 
 const (
 	// EProjectStatusBootingEnclave is set when the enclave is booting
@@ -49,6 +63,119 @@ type EProject struct {
 	WriteInstIDs  []string
 }
 
+// SetEProjectStore sets the store where the eprojects are saved and read from.
+// The eprojects are only read when they are needed.
+func SetEProjectStore(store *helpers.Store) {
+	eprojectListLock.Lock()
+	eprojectStore = store
+	eprojectList = make(map[string]*EProject)
+	eprojectListLock.Unlock()
+}
+
+// GetEProject returns the eproject of the given project instance ID. It reads
+// it from the store if it has not been used since the start.
+func GetEProject(id string) (*EProject, bool) {
+	eprojectListLock.Lock()
+	defer eprojectListLock.Unlock()
+
+	eproject, ok := eprojectList[id]
+	if ok || eprojectStore == nil {
+		return eproject, ok
+	}
+
+	buf, err := eprojectStore.Get(eprojectsBucket, id)
+	if err != nil {
+		log.Errorf("failed to read eproject '%s': %v", id, err)
+		return nil, false
+	}
+	if buf == nil {
+		return nil, false
+	}
+
+	eproject = &EProject{}
+	err = json.Unmarshal(buf, eproject)
+	if err != nil {
+		log.Errorf("failed to unmarshal eproject '%s': %v", id, err)
+		return nil, false
+	}
+
+	eprojectList[id] = eproject
+	return eproject, true
+}
+
+// GetEProjects returns all the eprojects, in no particular order
+func GetEProjects() ([]*EProject, error) {
+	eprojectListLock.Lock()
+	defer eprojectListLock.Unlock()
+
+	if eprojectStore == nil {
+		eprojects := make([]*EProject, 0, len(eprojectList))
+		for _, eproject := range eprojectList {
+			eprojects = append(eprojects, eproject)
+		}
+		return eprojects, nil
+	}
+
+	eprojects := []*EProject{}
+	err := eprojectStore.ForEach(eprojectsBucket, func(id string, buf []byte) error {
+		eproject, ok := eprojectList[id]
+		if !ok {
+			eproject = &EProject{}
+			err := json.Unmarshal(buf, eproject)
+			if err != nil {
+				return xerrors.Errorf("failed to unmarshal eproject '%s': %v",
+					id, err)
+			}
+			eprojectList[id] = eproject
+		}
+		eprojects = append(eprojects, eproject)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read the eprojects: %v", err)
+	}
+
+	return eprojects, nil
+}
+
+// DeleteEProject deletes the eproject of the given project instance ID
+func DeleteEProject(id string) error {
+	eprojectListLock.Lock()
+	defer eprojectListLock.Unlock()
+
+	if eprojectStore != nil {
+		err := eprojectStore.Delete(eprojectsBucket, id)
+		if err != nil {
+			return xerrors.Errorf("failed to delete eproject: %v", err)
+		}
+	}
+
+	delete(eprojectList, id)
+	return nil
+}
+
+// Save adds the eproject to the list, under its instance ID, and writes it to
+// the store. It must be called each time the eproject is updated.
+func (e *EProject) Save() error {
+	eprojectListLock.Lock()
+	defer eprojectListLock.Unlock()
+
+	if eprojectStore != nil {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return xerrors.Errorf("failed to marshal eproject: %v", err)
+		}
+
+		err = eprojectStore.Put(eprojectsBucket, e.InstanceID, buf)
+		if err != nil {
+			return xerrors.Errorf("failed to save eproject: %v", err)
+		}
+	}
+
+	eprojectList[e.InstanceID] = e
+	return nil
+}
+
 // ParseKey extract the public key, which is stored in the <type>:<key> format
 func (e EProject) ParseKey() (string, error) {
 	keySlice := strings.Split(e.PubKey, ":")
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/projectc"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// attrInterpreter checks a rule of the "spawn:calypsoread" DARC against the
+// project that wants to read a dataset. The name of the interpreter is the rule
+// type, ie. the "allowed" interpreter handles the "attr:allowed" rules.
+type attrInterpreter interface {
+	// Interpret receives the evaluation context of the read instruction and
+	// the parsed attributes of the rule. It returns the reasons why the
+	// project doesn't satisfy the rule, which are empty if it does. An error
+	// is returned if the rule can not be evaluated.
+	Interpret(ctx *evalContext, query url.Values) (*catalogc.FailedReasons, error)
+}
+
+// maxEvalContexts is the number of evaluation contexts kept in memory. When
+// it is reached the cache is emptied.
+const maxEvalContexts = 256
+
+// evalContexts caches the evaluation context of the read instructions, so that
+// the project is decoded only once for all the rules and interpreters. The key
+// is the hash of the instruction along with the version of the project
+// instance, which makes sure an updated project is decoded again.
+var evalContexts = struct {
+	sync.Mutex
+	contexts map[string]*evalContext
+}{contexts: make(map[string]*evalContext)}
+
+// evalContext holds what the interpreters need to evaluate the rules of a read
+// instruction. It is shared between the interpreters and must not be modified.
+type evalContext struct {
+	// datasetID is the calypso write instance ID of the dataset
+	datasetID string
+	// signer and signerCounter identify the read instruction. They must match
+	// a read recorded on the project.
+	signer        string
+	signerCounter uint64
+	// blockInterval is the block interval of the chain
+	blockInterval time.Duration
+	// project is the decoded project that wants to read the dataset
+	project *projectc.ProjectData
+	// attributes indexes the attributes of the project metadata by ID. In
+	// case of duplicates the first one found, depth first, is kept, like
+	// Metadata.GetAttribute does.
+	attributes map[string]*catalogc.Attribute
+}
+
+// getAttribute returns the project attribute that has the given ID
+func (ctx *evalContext) getAttribute(id string) (*catalogc.Attribute, bool) {
+	attr, found := ctx.attributes[id]
+	return attr, found
+}
+
+// getEvalContext returns the evaluation context of the read instruction,
+// from the cache if the project has already been decoded.
+func getEvalContext(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction) (*evalContext, error) {
+
+	if inst.Spawn == nil {
+		return nil, xerrors.New("expected a spawn instruction")
+	}
+	projectInstID := inst.Spawn.Args.Search("projectInstID")
+	if projectInstID == nil {
+		return nil, xerrors.New("argument 'projectInstID' not found")
+	}
+
+	projectBuf, version, _, _, err := rst.GetValues(projectInstID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the given project instance '%x': %s",
+			projectInstID, err.Error())
+	}
+
+	key := fmt.Sprintf("%x:%d", inst.Hash(), version)
+
+	evalContexts.Lock()
+	defer evalContexts.Unlock()
+
+	ctx, found := evalContexts.contexts[key]
+	if found {
+		return ctx, nil
+	}
+
+	projectC := &projectc.ProjectData{}
+	err = projectc.DecodeProjectData(projectBuf, projectC)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode project instance: %v", err)
+	}
+	if projectC.Metadata == nil {
+		projectC.Metadata = &catalogc.Metadata{}
+	}
+
+	config, err := byzcoin.LoadConfigFromTrie(rst)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load the chain config: %v", err)
+	}
+
+	ctx = &evalContext{
+		datasetID:     inst.InstanceID.String(),
+		blockInterval: config.BlockInterval,
+		project:       projectC,
+		attributes:    make(map[string]*catalogc.Attribute),
+	}
+	if len(inst.SignerIdentities) == 1 && len(inst.SignerCounter) == 1 {
+		ctx.signer = inst.SignerIdentities[0].String()
+		ctx.signerCounter = inst.SignerCounter[0]
+	}
+
+	var index func(*catalogc.Attribute)
+	index = func(attr *catalogc.Attribute) {
+		_, found := ctx.attributes[attr.ID]
+		if !found {
+			ctx.attributes[attr.ID] = attr
+		}
+		for _, subAttr := range attr.Attributes {
+			index(subAttr)
+		}
+	}
+	for _, ag := range projectC.Metadata.AttributesGroups {
+		for _, attr := range ag.Attributes {
+			index(attr)
+		}
+	}
+
+	if len(evalContexts.contexts) >= maxEvalContexts {
+		evalContexts.contexts = make(map[string]*evalContext)
+	}
+	evalContexts.contexts[key] = ctx
+
+	return ctx, nil
+}
+
+// attrInterpreters holds all the interpreters that can be enabled on a conode,
+// indexed by their name.
+var attrInterpreters = map[string]attrInterpreter{
+	"allowed":    allowedInterpreter{},
+	"must_have":  mustHaveInterpreter{},
+	"rate_limit": rateLimitInterpreter{},
+}
+
+// interpretersConfig is the content of the file that tells which interpreters
+// are enabled.
+type interpretersConfig struct {
+	Enabled []string
+}
+
+// loadInterpretersConfig reads the interpreters config file. If the file
+// doesn't exist every known interpreter is enabled.
+func loadInterpretersConfig(path string) (*interpretersConfig, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		log.Lvlf1("no interpreters config found at '%s', enabling all of "+
+			"them", path)
+		conf := &interpretersConfig{}
+		for name := range attrInterpreters {
+			conf.Enabled = append(conf.Enabled, name)
+		}
+		sort.Strings(conf.Enabled)
+		return conf, nil
+	}
+
+	conf := &interpretersConfig{}
+	_, err = toml.DecodeFile(path, conf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the interpreters config: %v", err)
+	}
+
+	return conf, nil
+}
+
+// enableInterpreters registers the interpreters listed in the config on
+// calypso.
+func enableInterpreters(conf *interpretersConfig) error {
+	for _, name := range conf.Enabled {
+		interpreter, found := attrInterpreters[name]
+		if !found {
+			return xerrors.Errorf("unknown interpreter '%s'", name)
+		}
+		log.Lvlf1("enabling the '%s' attribute interpreter", name)
+		calypso.AddReadAttrInterpreter(name, makeReadAttrInterpreter(name,
+			interpreter))
+	}
+	return nil
+}
+
+// makeReadAttrInterpreter wraps an attrInterpreter into the form expected by
+// calypso. It gets the evaluation context of the read spawn and fails if the
+// dataset has been revoked, before handing over to the interpreter.
+func makeReadAttrInterpreter(name string, interpreter attrInterpreter) func(
+	calypso.ContractWrite, byzcoin.ReadOnlyStateTrie,
+	byzcoin.Instruction) func(string) error {
+
+	return func(c calypso.ContractWrite, rst byzcoin.ReadOnlyStateTrie,
+		inst byzcoin.Instruction) func(string) error {
+
+		return func(attr string) error {
+			// Expecting an 'attr' of form:
+			// attribute_id=checked&attribute_id2=hello+world&
+			// which, once parsed, gives map[attribute_id:[checked] attribute_id2:[hello+world]]
+			parsedQuery, err := url.ParseQuery(attr)
+			if err != nil {
+				return err
+			}
+
+			ctx, err := getEvalContext(rst, inst)
+			if err != nil {
+				return err
+			}
+
+			// A dataset revoked by its owner can not be read anymore by the
+			// project, whatever its attributes are.
+			if ctx.project.IsRevoked(ctx.datasetID) {
+				return xerrors.Errorf("dataset '%s' has been revoked by its "+
+					"owner for this project", ctx.datasetID)
+			}
+
+			failedReasons, err := interpreter.Interpret(ctx, parsedQuery)
+			if err != nil {
+				return xerrors.Errorf("attr:%s verification failed: %v", name, err)
+			}
+
+			if failedReasons != nil && !failedReasons.IsEmpty() {
+				jsonStr, err := json.Marshal(failedReasons)
+				if err != nil {
+					return xerrors.Errorf("attr:%s verification failed "+
+						"and we couldn't convert the failed reasons to JSON. "+
+						"Here is string representation: %s", name,
+						failedReasons.String())
+				}
+				return xerrors.Errorf("attr:%s verification failed, here "+
+					"is why:\n%s", name, string(jsonStr))
+			}
+
+			return nil
+		}
+	}
+}
+
+// allowedInterpreter checks if all the selected attributes by the data
+// scientist are allowed the the data owner. Note that the list of attributes
+// described by the allowed rule contains the attributes of type "allowed"
+// (obviously), but also the attributes of type "must_have". We can therefore
+// see the "must_have" type of attributes as a specialization of the "allowed"
+// one.
+type allowedInterpreter struct{}
+
+// Interpret implements attrInterpreter. Each attribute selected by the data
+// scientist should be in the attr:allowed list.
+func (allowedInterpreter) Interpret(ctx *evalContext,
+	query url.Values) (*catalogc.FailedReasons, error) {
+
+	failedReasons := &catalogc.FailedReasons{}
+
+	var isAllowed func(*catalogc.Attribute) error
+	isAllowed = func(attr *catalogc.Attribute) error {
+		if attr.Value == "" {
+			return nil
+		}
+		ok := false
+		for key, vals := range query {
+			if key != attr.ID {
+				continue
+			}
+			if len(vals) != 1 {
+				return xerrors.Errorf("Expected 1 value but got %d. Key: %s, "+
+					"vals: %v", len(vals), key, vals)
+			}
+			val := vals[0]
+			if attr.Value != val {
+				failedReasons.AddReason(attr.ID, fmt.Sprintf(
+					"must have value '%s', but we found value '%s'",
+					val, attr.Value), ctx.datasetID)
+				break
+			}
+			ok = true
+			break
+		}
+		if !ok {
+			failedReasons.AddReason(attr.ID, "This attribute is not allowed",
+				ctx.datasetID)
+		}
+		for _, subAttr := range attr.Attributes {
+			if attr.RuleType != "allowed" {
+				continue
+			}
+			isAllowed(subAttr)
+			// if err != nil {
+			// 	return xerrors.Errorf("attribute '%s' not allowed", subAttr.ID)
+			// }
+		}
+		return nil
+	}
+
+	for _, ag := range ctx.project.Metadata.AttributesGroups {
+		for _, attr := range ag.Attributes {
+			// The "must_have" attributes must be checked by the other rule,
+			// because the user can actually check more "must_have"
+			// attributes that are required.
+			if attr.RuleType != "allowed" {
+				continue
+			}
+			isAllowed(attr)
+			// if err != nil {
+			// 	return xerrors.Errorf("failed to check an allowed attribute: %v", err)
+			// }
+		}
+	}
+
+	return failedReasons, nil
+}
+
+// mustHaveInterpreter checks if the specified "must have" attributes that the
+// data owner set appear in the selected attributes from the data scientist.
+type mustHaveInterpreter struct{}
+
+// Interpret implements attrInterpreter. Each attribute should have a
+// corresponding Metadata.Attribute that has a corresponding value.
+func (mustHaveInterpreter) Interpret(ctx *evalContext,
+	query url.Values) (*catalogc.FailedReasons, error) {
+
+	failedReasons := &catalogc.FailedReasons{}
+
+	for key, vals := range query {
+		if len(vals) != 1 {
+			return nil, xerrors.Errorf("Expected 1 value but got %d. Key: %s, "+
+				"vals: %v", len(vals), key, vals)
+		}
+		val := vals[0]
+		attr, found := ctx.getAttribute(key)
+		if !found {
+			return nil, xerrors.Errorf("Must-have attribute with key '%s' not "+
+				"found in the project metadata", key)
+		}
+		if val != "" && attr.Value != val {
+			failedReasons.AddReason(key, fmt.Sprintf("Expected '%s', got "+
+				"'%s'", val, attr.Value), ctx.datasetID)
+		}
+	}
+
+	return failedReasons, nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/projectc"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+var projectInstID = []byte("project instance id")
+
+var datasetInstID = byzcoin.NewInstanceID([]byte("dataset instance id"))
+
+// reader is the identity that spawns the reads
+var reader = darc.NewSignerEd25519(nil, nil)
+
+// configID is the instance ID of the chain config
+var configID = byzcoin.NewInstanceID(nil)
+
+// mockVersion is incremented for each new mock trie, so that the evaluation
+// contexts cached by a previous test are not used.
+var mockVersion uint64
+
+// mockTrie is a ReadOnlyStateTrie that only knows the values it holds. Calling
+// any other method than GetValues panics.
+type mockTrie struct {
+	byzcoin.ReadOnlyStateTrie
+	values  map[string][]byte
+	version uint64
+}
+
+func (m *mockTrie) GetValues(key []byte) ([]byte, uint64, string, darc.ID, error) {
+	value, found := m.values[string(key)]
+	if !found {
+		return nil, 0, "", nil, xerrors.New("key not set")
+	}
+	if string(key) == string(configID.Slice()) {
+		return value, m.version, byzcoin.ContractConfigID, nil, nil
+	}
+	return value, m.version, projectc.ContractProjectID, nil, nil
+}
+
+// newMockTrie returns a trie that holds the given project and a chain config
+// with a block interval of one minute.
+func newMockTrie(t testing.TB, project *projectc.ProjectData) *mockTrie {
+	buf, err := protobuf.Encode(project)
+	require.NoError(t, err)
+	server := network.NewServerIdentity(cothority.Suite.Point().Base(),
+		network.NewAddress(network.Local, "127.0.0.1:2000"))
+	configBuf, err := protobuf.Encode(&byzcoin.ChainConfig{
+		BlockInterval: time.Minute,
+		Roster:        *onet.NewRoster([]*network.ServerIdentity{server}),
+	})
+	require.NoError(t, err)
+	mockVersion++
+	return &mockTrie{
+		values: map[string][]byte{
+			string(projectInstID):    buf,
+			string(configID.Slice()): configBuf,
+		},
+		version: mockVersion,
+	}
+}
+
+// newReadInstruction returns the spawn of a calypso read on the dataset from
+// the project.
+func newReadInstruction() byzcoin.Instruction {
+	return newReadInstructionOn(datasetInstID)
+}
+
+// newReadInstructionOn returns the spawn of a calypso read on the given
+// dataset from the project.
+func newReadInstructionOn(datasetID byzcoin.InstanceID) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: datasetID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: calypso.ContractReadID,
+			Args: byzcoin.Arguments{
+				{Name: "projectInstID", Value: projectInstID},
+			},
+		},
+		SignerIdentities: []darc.Identity{reader.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+}
+
+// recordRead records the read instruction on the project, like the
+// "recordRead" command of the project contract does.
+func recordRead(project *projectc.ProjectData, inst byzcoin.Instruction,
+	blockIndex int) {
+
+	project.Reads = append(project.Reads, &projectc.Read{
+		DatasetID:  inst.InstanceID.String(),
+		Signer:     inst.SignerIdentities[0].String(),
+		Counter:    inst.SignerCounter[0],
+		Unlock:     project.Unlocks,
+		BlockIndex: blockIndex,
+	})
+}
+
+// newProject returns a project where the data scientist selected the given
+// attributes.
+func newProject(attributes ...*catalogc.Attribute) *projectc.ProjectData {
+	return &projectc.ProjectData{
+		Version: projectc.ProjectDataVersion,
+		Metadata: &catalogc.Metadata{
+			AttributesGroups: []*catalogc.AttributesGroup{
+				{Title: "Use", Attributes: attributes},
+			},
+		},
+	}
+}
+
+// check runs the interpreter as calypso would do it
+func check(t *testing.T, name string, project *projectc.ProjectData,
+	rule string) error {
+
+	interpreter := makeReadAttrInterpreter(name, attrInterpreters[name])
+	return interpreter(calypso.ContractWrite{}, newMockTrie(t, project),
+		newReadInstruction())(rule)
+}
+
+func TestAllowedInterpreter(t *testing.T) {
+	project := newProject(&catalogc.Attribute{
+		ID: "use_restricted", RuleType: "allowed", Value: "checked",
+	}, &catalogc.Attribute{
+		ID: "use_retention", RuleType: "must_have", Value: "checked",
+	})
+
+	err := check(t, "allowed", project, "use_restricted=checked&use_other=checked")
+	require.NoError(t, err)
+
+	// The rule doesn't allow the attribute selected by the data scientist
+	err = check(t, "allowed", project, "use_other=checked")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "attr:allowed verification failed")
+	require.Contains(t, err.Error(), "This attribute is not allowed")
+
+	// The value doesn't match
+	err = check(t, "allowed", project, "use_restricted=other")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must have value 'other'")
+
+	// An attribute without value is not selected, so it is always allowed
+	err = check(t, "allowed", newProject(&catalogc.Attribute{
+		ID: "use_restricted", RuleType: "allowed",
+	}), "")
+	require.NoError(t, err)
+}
+
+func TestAllowedInterpreter_SubAttributes(t *testing.T) {
+	project := newProject(&catalogc.Attribute{
+		ID: "use_purpose", RuleType: "allowed", Value: "checked",
+		Attributes: []*catalogc.Attribute{
+			{ID: "use_purpose_legal", RuleType: "allowed", Value: "checked"},
+		},
+	})
+
+	err := check(t, "allowed", project,
+		"use_purpose=checked&use_purpose_legal=checked")
+	require.NoError(t, err)
+
+	err = check(t, "allowed", project, "use_purpose=checked")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "use_purpose_legal")
+}
+
+func TestMustHaveInterpreter(t *testing.T) {
+	project := newProject(&catalogc.Attribute{
+		ID: "use_restricted", RuleType: "must_have", Value: "checked",
+	}, &catalogc.Attribute{
+		ID: "use_retention", RuleType: "must_have", Value: "",
+	})
+
+	err := check(t, "must_have", project, "use_restricted=checked")
+	require.NoError(t, err)
+
+	// The data scientist didn't select the attribute
+	err = check(t, "must_have", project, "use_retention=checked")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "attr:must_have verification failed")
+	require.Contains(t, err.Error(), "Expected 'checked', got ''")
+
+	// The attribute doesn't exist in the project
+	err = check(t, "must_have", project, "use_unknown=checked")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found in the project metadata")
+
+	// Only one value is expected by attribute
+	err = check(t, "must_have", project, "use_restricted=a&use_restricted=b")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Expected 1 value but got 2")
+}
+
+func TestReadAttrInterpreter_Project(t *testing.T) {
+	project := newProject()
+
+	// The project instance is not in the trie
+	interpreter := makeReadAttrInterpreter("allowed", allowedInterpreter{})
+	err := interpreter(calypso.ContractWrite{}, &mockTrie{},
+		newReadInstruction())("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to get the given project instance")
+
+	// The dataset has been revoked from the project
+	project.RevokedDatasets = []*projectc.Revocation{
+		{DatasetID: datasetInstID.String(), RevokedBy: "ed25519:aef123"},
+	}
+	for name := range attrInterpreters {
+		err = check(t, name, project, "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "has been revoked by its owner")
+	}
+}
+
+func TestLoadInterpretersConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "interpreters")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Without a config file every interpreter is enabled
+	conf, err := loadInterpretersConfig(filepath.Join(dir, "interpreters.toml"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"allowed", "must_have", "rate_limit"}, conf.Enabled)
+
+	path := filepath.Join(dir, "interpreters.toml")
+	err = ioutil.WriteFile(path, []byte(`Enabled = ["must_have"]`), 0644)
+	require.NoError(t, err)
+
+	conf, err = loadInterpretersConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"must_have"}, conf.Enabled)
+
+	err = enableInterpreters(&interpretersConfig{Enabled: []string{"unknown"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown interpreter 'unknown'")
+}
+
+func TestEvalContext_Cache(t *testing.T) {
+	project := newProject(&catalogc.Attribute{
+		ID: "use_restricted", RuleType: "must_have", Value: "checked",
+		Attributes: []*catalogc.Attribute{
+			{ID: "use_restricted_description", Value: "research"},
+		},
+	})
+	inst := newReadInstruction()
+	recordRead(project, inst, 1)
+	rst := newMockTrie(t, project)
+
+	ctx, err := getEvalContext(rst, inst)
+	require.NoError(t, err)
+	require.Equal(t, datasetInstID.String(), ctx.datasetID)
+	require.Equal(t, reader.Identity().String(), ctx.signer)
+	require.Equal(t, uint64(1), ctx.signerCounter)
+	require.Equal(t, time.Minute, ctx.blockInterval)
+
+	attr, found := ctx.getAttribute("use_restricted_description")
+	require.True(t, found)
+	require.Equal(t, "research", attr.Value)
+
+	// The same instruction on the same version of the project gives the same
+	// context
+	ctx2, err := getEvalContext(rst, inst)
+	require.NoError(t, err)
+	require.True(t, ctx == ctx2)
+
+	// Every interpreter uses the same context
+	rules := map[string]string{
+		"allowed":    "use_restricted=checked",
+		"must_have":  "use_restricted=checked",
+		"rate_limit": "read_limit=1%2Funlock",
+	}
+	for name, rule := range rules {
+		err = makeReadAttrInterpreter(name, attrInterpreters[name])(
+			calypso.ContractWrite{}, rst, inst)(rule)
+		require.NoError(t, err)
+	}
+	require.Len(t, evalContexts.contexts[fmt.Sprintf("%x:%d", inst.Hash(),
+		rst.version)].attributes, 2)
+
+	// A new version of the project is decoded again
+	rst.version++
+	ctx3, err := getEvalContext(rst, inst)
+	require.NoError(t, err)
+	require.False(t, ctx == ctx3)
+
+	// Another dataset gets its own context
+	ctx4, err := getEvalContext(rst, newReadInstructionOn(
+		byzcoin.NewInstanceID([]byte("another dataset"))))
+	require.NoError(t, err)
+	require.False(t, ctx3 == ctx4)
+}
+
+// BenchmarkReadAttrInterpreters evaluates the read of each dataset of a
+// project that uses 50 datasets, the same way calypso does it.
+func BenchmarkReadAttrInterpreters(b *testing.B) {
+	attributes := make([]*catalogc.Attribute, 0)
+	allowed := make(url.Values)
+	mustHave := make(url.Values)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("attr_%d", i)
+		attributes = append(attributes, &catalogc.Attribute{
+			ID: id, RuleType: "allowed", Value: "checked",
+			Attributes: []*catalogc.Attribute{
+				{ID: id + "_sub", RuleType: "allowed", Value: "checked"},
+			},
+		})
+		allowed.Set(id, "checked")
+		allowed.Set(id+"_sub", "checked")
+		if i%2 == 0 {
+			mustHave.Set(id, "checked")
+		}
+	}
+
+	project := newProject(attributes...)
+	instructions := make([]byzcoin.Instruction, 50)
+	for i := range instructions {
+		datasetID := byzcoin.NewInstanceID([]byte(fmt.Sprintf("dataset %d", i)))
+		project.Datasets = append(project.Datasets, datasetID)
+		instructions[i] = newReadInstructionOn(datasetID)
+	}
+
+	rules := map[string]string{
+		"allowed":   allowed.Encode(),
+		"must_have": mustHave.Encode(),
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		// Each iteration is a new block, with a new version of the project
+		rst := newMockTrie(b, project)
+		for _, inst := range instructions {
+			for name, rule := range rules {
+				err := makeReadAttrInterpreter(name, attrInterpreters[name])(
+					calypso.ContractWrite{}, rst, inst)(rule)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
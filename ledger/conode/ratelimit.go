@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/projectc"
+	"golang.org/x/xerrors"
+)
+
+// perUnlock is the period of a rate limit that allows a number of reads each
+// time the project is unlocked.
+const perUnlock = "unlock"
+
+// rateLimit is the parsed value of a rate limit attribute, which has the form
+// "<max reads>/<period>", like "1/unlock" or "10/24h".
+type rateLimit struct {
+	maxReads int
+	// period is a duration, or perUnlock
+	period string
+	// duration is set if the period is a duration
+	duration time.Duration
+}
+
+// String returns the value of the rate limit, as set on the attribute
+func (l rateLimit) String() string {
+	return fmt.Sprintf("%d/%s", l.maxReads, l.period)
+}
+
+// parseRateLimit parses the value of a rate limit attribute
+func parseRateLimit(value string) (*rateLimit, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return nil, xerrors.Errorf("expected '<max reads>/<period>', got '%s'",
+			value)
+	}
+
+	maxReads, err := strconv.Atoi(parts[0])
+	if err != nil || maxReads <= 0 {
+		return nil, xerrors.Errorf("the max reads must be a positive number, "+
+			"got '%s'", parts[0])
+	}
+
+	limit := &rateLimit{maxReads: maxReads, period: parts[1]}
+	if limit.period == perUnlock {
+		return limit, nil
+	}
+
+	limit.duration, err = time.ParseDuration(limit.period)
+	if err != nil {
+		return nil, xerrors.Errorf("the period must be '%s' or a duration, "+
+			"like '24h': %v", perUnlock, err)
+	}
+	if limit.duration <= 0 || limit.duration > projectc.MaxReadPeriod {
+		return nil, xerrors.Errorf("the period must be positive and at most "+
+			"%s, got '%s'", projectc.MaxReadPeriod, limit.period)
+	}
+
+	return limit, nil
+}
+
+// rateLimitInterpreter limits the number of reads a project can do on a
+// dataset. Each read must first be recorded on the project instance with the
+// "recordRead" command, by the identity that spawns the read, right before the
+// spawn. The reads are then counted from the state of the project, so that
+// every conode reaches the same decision, which doesn't depend on blocks that
+// have been discarded.
+type rateLimitInterpreter struct{}
+
+// Interpret implements attrInterpreter. Each attribute of the rule is a rate
+// limit that the read must not exceed. The reads counted are the ones
+// recorded up to the one of this read instruction, during the same unlock
+// request for the "unlock" period, or in the blocks that cover the period
+// before it otherwise.
+func (rateLimitInterpreter) Interpret(ctx *evalContext,
+	query url.Values) (*catalogc.FailedReasons, error) {
+
+	failedReasons := &catalogc.FailedReasons{}
+
+	limits := make(map[string]*rateLimit)
+	for key, vals := range query {
+		if len(vals) != 1 {
+			return nil, xerrors.Errorf("Expected 1 value but got %d. Key: %s, "+
+				"vals: %v", len(vals), key, vals)
+		}
+		limit, err := parseRateLimit(vals[0])
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse the rate limit '%s': %v",
+				key, err)
+		}
+		limits[key] = limit
+	}
+
+	index := ctx.project.GetReadIndex(ctx.datasetID, ctx.signer,
+		ctx.signerCounter)
+	if index < 0 {
+		for key := range limits {
+			failedReasons.AddReason(key, "The read has not been recorded on "+
+				"the project with 'recordRead'", ctx.datasetID)
+		}
+		return failedReasons, nil
+	}
+	read := ctx.project.Reads[index]
+
+	for key, limit := range limits {
+		blocks := 0
+		if limit.period != perUnlock {
+			if ctx.blockInterval <= 0 {
+				return nil, xerrors.Errorf("invalid block interval: %s",
+					ctx.blockInterval)
+			}
+			blocks = projectc.PeriodInBlocks(limit.duration, ctx.blockInterval)
+		}
+
+		count := 0
+		for _, previous := range ctx.project.Reads[:index+1] {
+			if previous.DatasetID != ctx.datasetID {
+				continue
+			}
+			if limit.period == perUnlock {
+				if previous.Unlock == read.Unlock {
+					count++
+				}
+			} else if read.BlockIndex-previous.BlockIndex < blocks {
+				count++
+			}
+		}
+
+		if count > limit.maxReads {
+			failedReasons.AddReason(key, fmt.Sprintf("The limit of %s reads "+
+				"is reached", limit), ctx.datasetID)
+		}
+	}
+
+	return failedReasons, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/odyssey/projectc"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/calypso"
+)
+
+// newNthReadInstruction returns the n-th read of the dataset from the project.
+// Each one has a different signer counter.
+func newNthReadInstruction(datasetID byzcoin.InstanceID, n uint64) byzcoin.Instruction {
+	inst := newReadInstructionOn(datasetID)
+	inst.SignerCounter = []uint64{n}
+	return inst
+}
+
+// runRateLimit runs the rate limit interpreter as calypso would do it
+func runRateLimit(t *testing.T, project *projectc.ProjectData,
+	inst byzcoin.Instruction, rule string) error {
+
+	return makeReadAttrInterpreter("rate_limit", rateLimitInterpreter{})(
+		calypso.ContractWrite{}, newMockTrie(t, project), inst)(rule)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := parseRateLimit("1/unlock")
+	require.NoError(t, err)
+	require.Equal(t, 1, limit.maxReads)
+	require.Equal(t, perUnlock, limit.period)
+	require.Equal(t, "1/unlock", limit.String())
+
+	limit, err = parseRateLimit("10/24h")
+	require.NoError(t, err)
+	require.Equal(t, 10, limit.maxReads)
+	require.Equal(t, 24*time.Hour, limit.duration)
+
+	// A limit of zero reads would block every read of the dataset
+	for _, value := range []string{"", "1", "a/unlock", "-1/unlock",
+		"0/unlock", "0/24h", "1/forever", "1/0s", "1/1000h", "1/unlock/2"} {
+
+		_, err = parseRateLimit(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestRateLimitInterpreter_PerUnlock(t *testing.T) {
+	project := newProject()
+	rule := "read_limit=1%2Funlock"
+
+	first := newNthReadInstruction(datasetInstID, 1)
+	recordRead(project, first, 10)
+	err := runRateLimit(t, project, first, rule)
+	require.NoError(t, err)
+
+	// The same read is evaluated again, for example when the block is
+	// verified, and gets the same result
+	err = runRateLimit(t, project, first, rule)
+	require.NoError(t, err)
+
+	second := newNthReadInstruction(datasetInstID, 2)
+	recordRead(project, second, 11)
+	err = runRateLimit(t, project, second, rule)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "attr:rate_limit verification failed")
+	require.Contains(t, err.Error(), "The limit of 1/unlock reads is reached")
+
+	// The first read is still allowed, whatever comes after it
+	err = runRateLimit(t, project, first, rule)
+	require.NoError(t, err)
+
+	// Another dataset has its own limit
+	otherDataset := byzcoin.NewInstanceID([]byte("another dataset"))
+	other := newNthReadInstruction(otherDataset, 3)
+	recordRead(project, other, 12)
+	err = runRateLimit(t, project, other, rule)
+	require.NoError(t, err)
+
+	// A new unlock request starts a new count
+	project.Unlocks++
+	third := newNthReadInstruction(datasetInstID, 4)
+	recordRead(project, third, 13)
+	err = runRateLimit(t, project, third, rule)
+	require.NoError(t, err)
+}
+
+func TestRateLimitInterpreter_Duration(t *testing.T) {
+	project := newProject()
+	// The mock trie has a block interval of one minute, which gives 1440
+	// blocks per day
+	rule := "read_limit=2%2F24h"
+
+	first := newNthReadInstruction(datasetInstID, 1)
+	recordRead(project, first, 100)
+	err := runRateLimit(t, project, first, rule)
+	require.NoError(t, err)
+
+	second := newNthReadInstruction(datasetInstID, 2)
+	recordRead(project, second, 160)
+	err = runRateLimit(t, project, second, rule)
+	require.NoError(t, err)
+
+	third := newNthReadInstruction(datasetInstID, 3)
+	recordRead(project, third, 200)
+	err = runRateLimit(t, project, third, rule)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The limit of 2/24h reads is reached")
+
+	// The two first reads are out of the period. The third one counts even
+	// if it has been rejected, because it has been recorded.
+	fourth := newNthReadInstruction(datasetInstID, 4)
+	recordRead(project, fourth, 160+1440)
+	err = runRateLimit(t, project, fourth, rule)
+	require.NoError(t, err)
+
+	// Every limit of the rule must be satisfied
+	otherDataset := byzcoin.NewInstanceID([]byte("another dataset"))
+	rule += "&other_limit=1%2Funlock"
+	fifth := newNthReadInstruction(otherDataset, 5)
+	recordRead(project, fifth, 1700)
+	err = runRateLimit(t, project, fifth, rule)
+	require.NoError(t, err)
+	sixth := newNthReadInstruction(otherDataset, 6)
+	recordRead(project, sixth, 1701)
+	err = runRateLimit(t, project, sixth, rule)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "other_limit")
+	require.NotContains(t, err.Error(), "read_limit")
+}
+
+func TestRateLimitInterpreter_NotRecorded(t *testing.T) {
+	project := newProject()
+	rule := "read_limit=1%2Funlock"
+
+	err := runRateLimit(t, project, newReadInstruction(), rule)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The read has not been recorded")
+
+	// The record is for the next instruction of the signer, which is not
+	// this one
+	recordRead(project, newNthReadInstruction(datasetInstID, 2), 1)
+	err = runRateLimit(t, project, newNthReadInstruction(datasetInstID, 3), rule)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The read has not been recorded")
+
+	// The record is for another dataset
+	otherDataset := byzcoin.NewInstanceID([]byte("another dataset"))
+	err = runRateLimit(t, project, newNthReadInstruction(otherDataset, 2), rule)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "The read has not been recorded")
+}
+
+func TestRateLimitInterpreter_Invalid(t *testing.T) {
+	project := newProject()
+	inst := newReadInstruction()
+	recordRead(project, inst, 1)
+
+	err := runRateLimit(t, project, inst, "read_limit=many")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to parse the rate limit 'read_limit'")
+}
@@ -1,12 +1,17 @@
 package projectc
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dedis/odyssey/catalogc"
 	"go.dedis.ch/cothority/v3/byzcoin"
@@ -25,6 +30,13 @@ var ContractProjectID = "odysseyproject"
 // eachLine matches the content of non-empty lines
 var eachLine = regexp.MustCompile(`(?m)^(.+)$`)
 
+// sha2Pattern matches the hex encoded SHA-256 of an output
+var sha2Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// MaxReadPeriod is the longest period a rate limit can use. The recorded reads
+// older than that are forgotten.
+const MaxReadPeriod = 30 * 24 * time.Hour
+
 type contractProject struct {
 	byzcoin.BasicContract
 	ProjectData
@@ -63,6 +75,71 @@ type ProjectData struct {
 	EnclavePubKey string
 	Status        ProjectStatus
 	EnclaveURL    string
+	// Title, Description and Organisation are provided by the data scientist
+	// when the project is created. They are stored on-chain so that data
+	// owners can know who is using their datasets and for what purpose.
+	Title        string
+	Description  string
+	Organisation string
+	// RequesterIdentity is the string representation of the identity that
+	// signed the spawn of the project instance.
+	RequesterIdentity string
+	// Outputs lists the outputs that left the enclave. It is filled by the
+	// enclave with the "recordOutput" command.
+	Outputs []*Output
+	// RevokedDatasets lists the datasets that have been revoked by their
+	// owner. A revoked dataset can not be read anymore by the project.
+	RevokedDatasets []*Revocation
+	// Unlocks counts the unlock requests of the project. It is incremented
+	// each time the status goes to "unlocking".
+	Unlocks uint64
+	// Reads lists the reads of datasets recorded with the "recordRead"
+	// command. The conodes count them to enforce the rate limits.
+	Reads []*Read
+	// CatalogID is the instance ID of the catalog where the datasets are
+	// registered. It is set at the spawn and tells who owns each dataset,
+	// which is needed to revoke a dataset.
+	CatalogID byzcoin.InstanceID
+	// Version is the version of the encoding, see DecodeProjectData. It must
+	// stay the last field and keep its explicit tag so that it can be read
+	// from any version of the encoding.
+	Version uint32 `protobuf:"100"`
+}
+
+// Revocation describes a dataset that has been pulled out of the project by
+// its owner.
+type Revocation struct {
+	// DatasetID is the calypso write instance ID of the dataset
+	DatasetID string
+	// RevokedBy is the identity of the owner that revoked the dataset
+	RevokedBy string
+	// Outcome is set by the enclave once it reacted to the revocation.
+	// It is empty as long as the revocation hasn't been handled.
+	Outcome string
+}
+
+// Read records that a dataset is about to be read by the project. It allows
+// the next instruction of the signer, which must be the spawn of the calypso
+// read, to read the dataset.
+type Read struct {
+	// DatasetID is the calypso write instance ID of the dataset
+	DatasetID string
+	// Signer and Counter identify the instruction that can read the dataset
+	Signer  string
+	Counter uint64
+	// Unlock is the unlock request during which the read has been recorded
+	Unlock uint64
+	// BlockIndex is the index of the latest block when the read has been
+	// recorded. The conodes use it to measure the periods of the rate limits.
+	BlockIndex int
+}
+
+// Output describes a result that has been exported from the enclave.
+type Output struct {
+	Name        string
+	Size        uint64
+	SHA2        string
+	Destination string
 }
 
 func (status ProjectStatus) String() string {
@@ -129,6 +206,16 @@ func StatusFromString(status string) (ProjectStatus, error) {
 func (pd ProjectData) String() string {
 	out := new(strings.Builder)
 	out.WriteString("- Project:\n")
+	out.WriteString("-- Title:\n")
+	fmt.Fprintf(out, "--- %s\n", pd.Title)
+	out.WriteString("-- Description:\n")
+	fmt.Fprintf(out, "--- %s\n", pd.Description)
+	out.WriteString("-- Organisation:\n")
+	fmt.Fprintf(out, "--- %s\n", pd.Organisation)
+	out.WriteString("-- Requester identity:\n")
+	fmt.Fprintf(out, "--- %s\n", pd.RequesterIdentity)
+	out.WriteString("-- Catalog ID:\n")
+	fmt.Fprintf(out, "--- %x\n", pd.CatalogID.Slice())
 	out.WriteString("-- Datasets:\n")
 	for _, dataset := range pd.Datasets {
 		fmt.Fprintf(out, "--- %x\n", dataset.Slice())
@@ -141,6 +228,20 @@ func (pd ProjectData) String() string {
 	fmt.Fprintf(out, "--- %s\n", pd.Status)
 	out.WriteString("-- Enclave URL:\n")
 	fmt.Fprintf(out, "--- %s\n", pd.EnclaveURL)
+	out.WriteString("-- Outputs:\n")
+	for _, output := range pd.Outputs {
+		out.WriteString(eachLine.ReplaceAllString(output.String(), "--$1"))
+	}
+	out.WriteString("-- Revoked datasets:\n")
+	for _, revocation := range pd.RevokedDatasets {
+		out.WriteString(eachLine.ReplaceAllString(revocation.String(), "--$1"))
+	}
+	out.WriteString("-- Unlocks:\n")
+	fmt.Fprintf(out, "--- %d\n", pd.Unlocks)
+	out.WriteString("-- Reads:\n")
+	for _, read := range pd.Reads {
+		out.WriteString(eachLine.ReplaceAllString(read.String(), "--$1"))
+	}
 	out.WriteString("-- Metadata:\n")
 	if pd.Metadata != nil {
 		out.WriteString(eachLine.ReplaceAllString(pd.Metadata.String(), "--$1"))
@@ -148,9 +249,85 @@ func (pd ProjectData) String() string {
 	return out.String()
 }
 
+// GetRevocation returns the revocation of the given dataset, or nil if the
+// dataset has not been revoked.
+func (pd ProjectData) GetRevocation(datasetID string) *Revocation {
+	for _, revocation := range pd.RevokedDatasets {
+		if revocation.DatasetID == datasetID {
+			return revocation
+		}
+	}
+	return nil
+}
+
+// IsRevoked tells if the given dataset has been revoked by its owner
+func (pd ProjectData) IsRevoked(datasetID string) bool {
+	return pd.GetRevocation(datasetID) != nil
+}
+
+// GetReadIndex returns the index in Reads of the read of the dataset recorded
+// for the given instruction signer and counter, or -1 if there is none.
+func (pd ProjectData) GetReadIndex(datasetID, signer string,
+	counter uint64) int {
+
+	for i, read := range pd.Reads {
+		if read.DatasetID == datasetID && read.Signer == signer &&
+			read.Counter == counter {
+			return i
+		}
+	}
+	return -1
+}
+
+// PeriodInBlocks returns the number of blocks that cover the given period,
+// based on the block interval of the chain. Contracts don't see the time of
+// the blocks, which is why the periods are measured in blocks. As blocks are
+// only created when there are transactions, a period of blocks lasts at least
+// the given period.
+func PeriodInBlocks(period, blockInterval time.Duration) int {
+	blocks := period / blockInterval
+	if period%blockInterval != 0 {
+		blocks++
+	}
+	return int(blocks)
+}
+
+// String returns a human readable string representation of a revocation
+func (r Revocation) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Revocation:\n")
+	fmt.Fprintf(out, "-- DatasetID: %s\n", r.DatasetID)
+	fmt.Fprintf(out, "-- RevokedBy: %s\n", r.RevokedBy)
+	fmt.Fprintf(out, "-- Outcome: %s\n", r.Outcome)
+	return out.String()
+}
+
+// String returns a human readable string representation of a read
+func (r Read) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Read:\n")
+	fmt.Fprintf(out, "-- DatasetID: %s\n", r.DatasetID)
+	fmt.Fprintf(out, "-- Signer: %s\n", r.Signer)
+	fmt.Fprintf(out, "-- Counter: %d\n", r.Counter)
+	fmt.Fprintf(out, "-- Unlock: %d\n", r.Unlock)
+	fmt.Fprintf(out, "-- BlockIndex: %d\n", r.BlockIndex)
+	return out.String()
+}
+
+// String returns a human readable string representation of an output
+func (o Output) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Output:\n")
+	fmt.Fprintf(out, "-- Name: %s\n", o.Name)
+	fmt.Fprintf(out, "-- Size: %d\n", o.Size)
+	fmt.Fprintf(out, "-- SHA2: %s\n", o.SHA2)
+	fmt.Fprintf(out, "-- Destination: %s\n", o.Destination)
+	return out.String()
+}
+
 func contractProjectFromBytes(in []byte) (byzcoin.Contract, error) {
 	cp := &contractProject{}
-	err := protobuf.Decode(in, &cp.ProjectData)
+	err := DecodeProjectData(in, &cp.ProjectData)
 	if err != nil {
 		return nil, err
 	}
@@ -174,6 +351,10 @@ func (c *contractProject) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Inst
 	// - instids: the list of instance ids (calypso write), a string separated by
 	// 						comas
 	// - pubkey: the public key that will have access to the enclave
+	// - title, description, organisation: (optional) descriptive fields of
+	//                                     the project
+	// - catalogID: (optional) the catalog instance where the datasets are
+	//              registered, which is needed to revoke them
 
 	instID := inst.Spawn.Args.Search("datasetIDs")
 	if instID == nil {
@@ -210,12 +391,39 @@ func (c *contractProject) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Inst
 		datasets[i] = byzcoin.NewInstanceID(instidbuf)
 	}
 
+	var catalogID byzcoin.InstanceID
+	catalogIDBuf := inst.Spawn.Args.Search("catalogID")
+	if len(catalogIDBuf) != 0 {
+		if len(catalogIDBuf) != len(catalogID) {
+			return nil, nil, xerrors.Errorf("catalogID must have %d bytes, "+
+				"got %d", len(catalogID), len(catalogIDBuf))
+		}
+		_, _, contractID, _, err := rst.GetValues(catalogIDBuf)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get the catalog "+
+				"instance: %v", err)
+		}
+		if contractID != catalogc.ContractCatalogID {
+			return nil, nil, xerrors.Errorf("instance '%x' is not a catalog, "+
+				"found contract '%s'", catalogIDBuf, contractID)
+		}
+		catalogID = byzcoin.NewInstanceID(catalogIDBuf)
+	}
+
 	projectData := ProjectData{}
 
+	projectData.Version = ProjectDataVersion
 	projectData.Status = empty
 	projectData.AccessPubKey = pubKeyStr
 	projectData.Datasets = datasets
 	projectData.Metadata = &catalogc.Metadata{}
+	projectData.Title = string(inst.Spawn.Args.Search("title"))
+	projectData.Description = string(inst.Spawn.Args.Search("description"))
+	projectData.Organisation = string(inst.Spawn.Args.Search("organisation"))
+	projectData.CatalogID = catalogID
+	if len(inst.SignerIdentities) > 0 {
+		projectData.RequesterIdentity = inst.SignerIdentities[0].String()
+	}
 	projectDataBuf, err := protobuf.Encode(&projectData)
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to encode back the projectData: %v", err)
@@ -242,11 +450,17 @@ func (c *contractProject) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 		if len(projectDataBuf) == 0 {
 			return nil, nil, xerrors.New("didn't find the 'projectData' argument")
 		}
-		err = protobuf.Decode(projectDataBuf, &projectData)
+		err = DecodeProjectData(projectDataBuf, &projectData)
 		if err != nil {
 			return nil, nil, xerrors.Errorf("failed to decode projectData: %v", err)
 		}
 
+		err = c.checkUpdate(projectData)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to check the update: %v", err)
+		}
+		projectData.Version = c.Version
+
 		projectDataBuf, err = protobuf.Encode(&projectData)
 		if err != nil {
 			return nil, nil, xerrors.Errorf("failed to encode back the projectData: %v", err)
@@ -265,6 +479,11 @@ func (c *contractProject) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 		if err != nil {
 			return nil, nil, xerrors.Errorf("failed to get status from string: %v", err)
 		}
+		// A new unlock request starts a new period for the "1/unlock" like
+		// rate limits.
+		if newStatus == unlocking && c.Status != unlocking {
+			c.Unlocks++
+		}
 		c.Status = newStatus
 		projectDataBuf, err := protobuf.Encode(&c.ProjectData)
 		if err != nil {
@@ -345,26 +564,390 @@ func (c *contractProject) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Ins
 				ContractProjectID, projectDataBuf, darcID),
 		}
 		return sc, cout, nil
+	case "recordOutput":
+		nameBuf := inst.Invoke.Args.Search("name")
+		if len(nameBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'name' argument")
+		}
+		sizeBuf := inst.Invoke.Args.Search("size")
+		if len(sizeBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'size' argument")
+		}
+		size, err := strconv.ParseUint(string(sizeBuf), 10, 64)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to parse size: %v", err)
+		}
+		sha2Buf := inst.Invoke.Args.Search("sha2")
+		if !sha2Pattern.Match(sha2Buf) {
+			return nil, nil, xerrors.Errorf("got unexpected 'sha2': %s", sha2Buf)
+		}
+		destinationBuf := inst.Invoke.Args.Search("destination")
+		if len(destinationBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'destination' argument")
+		}
+		c.Outputs = append(c.Outputs, &Output{
+			Name:        string(nameBuf),
+			Size:        size,
+			SHA2:        string(sha2Buf),
+			Destination: string(destinationBuf),
+		})
+		projectDataBuf, err := protobuf.Encode(&c.ProjectData)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to encode project data: %v", err)
+		}
+		sc := []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractProjectID, projectDataBuf, darcID),
+		}
+		return sc, cout, nil
+	case "recordRead":
+		datasetIDBuf := inst.Invoke.Args.Search("datasetID")
+		if len(datasetIDBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'datasetID' argument")
+		}
+		datasetID := string(datasetIDBuf)
+		if !c.hasDataset(datasetID) {
+			return nil, nil, xerrors.Errorf("dataset '%s' is not part of the "+
+				"project", datasetID)
+		}
+		if c.IsRevoked(datasetID) {
+			return nil, nil, xerrors.Errorf("dataset '%s' has been revoked",
+				datasetID)
+		}
+		if len(inst.SignerIdentities) != 1 || len(inst.SignerCounter) != 1 {
+			return nil, nil, xerrors.New("a read must be recorded by exactly " +
+				"one signer")
+		}
+		// The reads older than the longest period of a rate limit are not
+		// needed anymore.
+		config, err := byzcoin.LoadConfigFromTrie(rst)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to load the chain config: %v", err)
+		}
+		if config.BlockInterval <= 0 {
+			return nil, nil, xerrors.Errorf("invalid block interval: %s",
+				config.BlockInterval)
+		}
+		maxBlocks := PeriodInBlocks(MaxReadPeriod, config.BlockInterval)
+		reads := make([]*Read, 0, len(c.Reads)+1)
+		for _, read := range c.Reads {
+			if rst.GetIndex()-read.BlockIndex < maxBlocks {
+				reads = append(reads, read)
+			}
+		}
+		c.Reads = append(reads, &Read{
+			DatasetID:  datasetID,
+			Signer:     inst.SignerIdentities[0].String(),
+			Counter:    inst.SignerCounter[0] + 1,
+			Unlock:     c.Unlocks,
+			BlockIndex: rst.GetIndex(),
+		})
+		projectDataBuf, err := protobuf.Encode(&c.ProjectData)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to encode project data: %v", err)
+		}
+		sc := []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractProjectID, projectDataBuf, darcID),
+		}
+		return sc, cout, nil
+	case "revokeDataset":
+		datasetIDBuf := inst.Invoke.Args.Search("datasetID")
+		if len(datasetIDBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'datasetID' argument")
+		}
+		datasetID := string(datasetIDBuf)
+		if !c.hasDataset(datasetID) {
+			return nil, nil, xerrors.Errorf("dataset '%s' is not part of the "+
+				"project", datasetID)
+		}
+		if c.IsRevoked(datasetID) {
+			return nil, nil, xerrors.Errorf("dataset '%s' is already revoked",
+				datasetID)
+		}
+		owner, err := getDatasetOwner(rst, c.CatalogID, datasetID)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get the dataset owner: %v", err)
+		}
+		c.RevokedDatasets = append(c.RevokedDatasets, &Revocation{
+			DatasetID: datasetID,
+			RevokedBy: owner.IdentityStr,
+		})
+		projectDataBuf, err := protobuf.Encode(&c.ProjectData)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to encode project data: %v", err)
+		}
+		sc := []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractProjectID, projectDataBuf, darcID),
+		}
+		return sc, cout, nil
+	case "setRevocationOutcome":
+		datasetIDBuf := inst.Invoke.Args.Search("datasetID")
+		if len(datasetIDBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'datasetID' argument")
+		}
+		outcomeBuf := inst.Invoke.Args.Search("outcome")
+		if len(outcomeBuf) == 0 {
+			return nil, nil, xerrors.New("didn't find the 'outcome' argument")
+		}
+		revocation := c.GetRevocation(string(datasetIDBuf))
+		if revocation == nil {
+			return nil, nil, xerrors.Errorf("dataset '%s' has not been revoked",
+				datasetIDBuf)
+		}
+		revocation.Outcome = string(outcomeBuf)
+		projectDataBuf, err := protobuf.Encode(&c.ProjectData)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to encode project data: %v", err)
+		}
+		sc := []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractProjectID, projectDataBuf, darcID),
+		}
+		return sc, cout, nil
 	default:
 		return nil, nil, xerrors.Errorf("Unkown action '%s'", inst.Invoke.Command)
 	}
 }
 
-// VerifyInstruction alows the one that has its key in the "EnclaveKey" field to
-// do anything with the contract. This key should be the temporary key of the
-// enclave.
+// permission describes who can call a command on a project instance
+type permission int
+
+const (
+	// darcOnly commands must be authorized by the DARC of the project
+	darcOnly permission = iota
+	// enclaveOrDarc commands can be called by the enclave key, or be
+	// authorized by the DARC of the project
+	enclaveOrDarc
+	// enclaveOnly commands can only be called by the enclave key
+	enclaveOnly
+	// datasetOwnerOnly commands can only be called by the owner of the
+	// dataset, as registered in the catalog
+	datasetOwnerOnly
+)
+
+// commandPermissions is the permission table of the invoke commands. A command
+// that is not listed here must be authorized by the DARC of the project.
+var commandPermissions = map[string]permission{
+	"update":               darcOnly,
+	"updateStatus":         enclaveOrDarc,
+	"updateMetadata":       darcOnly,
+	"setURL":               darcOnly,
+	"setAccessPubKey":      darcOnly,
+	"setEnclavePubKey":     darcOnly,
+	"recordOutput":         enclaveOnly,
+	"recordRead":           darcOnly,
+	"revokeDataset":        datasetOwnerOnly,
+	"setRevocationOutcome": enclaveOnly,
+}
+
+// VerifyInstruction checks the instruction against the permission table of
+// the commands. The key in the "EnclavePubKey" field, which should be the
+// temporary key of the enclave, can only update the status, record outputs and
+// record the outcome of a revocation. Everything else goes through the DARC of
+// the project, except the revocation of a dataset that must be signed by the
+// owner of the dataset. The signer counters are checked in every case.
 func (c contractProject) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie, instr byzcoin.Instruction, ctxHash []byte) error {
+	if instr.GetType() != byzcoin.InvokeType {
+		return instr.Verify(rst, ctxHash)
+	}
+
+	perm, found := commandPermissions[instr.Invoke.Command]
+	if !found {
+		perm = darcOnly
+	}
+
+	switch perm {
+	case enclaveOrDarc:
+		if isSignedBy(instr, ctxHash, c.EnclavePubKey) {
+			return verifySignerCounters(rst, instr)
+		}
+		return instr.Verify(rst, ctxHash)
+	case enclaveOnly:
+		if isSignedBy(instr, ctxHash, c.EnclavePubKey) {
+			return verifySignerCounters(rst, instr)
+		}
+		return xerrors.Errorf("only the enclave can call '%s'", instr.Invoke.Command)
+	case datasetOwnerOnly:
+		owner, err := getDatasetOwner(rst, c.CatalogID,
+			string(instr.Invoke.Args.Search("datasetID")))
+		if err != nil {
+			return xerrors.Errorf("failed to get the dataset owner: %v", err)
+		}
+		if isSignedBy(instr, ctxHash, owner.IdentityStr) {
+			return verifySignerCounters(rst, instr)
+		}
+		return xerrors.Errorf("only the owner of the dataset can call '%s'",
+			instr.Invoke.Command)
+	default:
+		return instr.Verify(rst, ctxHash)
+	}
+}
 
-	// The enclave has the right to update the project instance. Here we check
-	// if the identity used is the same as the one stored on the "enclavePubKey"
-	// attribute of the contract.
+// isSignedBy tells if the instruction contains a valid signature from the
+// given identity.
+func isSignedBy(instr byzcoin.Instruction, ctxHash []byte,
+	identityStr string) bool {
+
+	if identityStr == "" {
+		return false
+	}
+	// A malformed instruction would otherwise make us read out of the
+	// identities.
+	if len(instr.Signatures) != len(instr.SignerIdentities) {
+		return false
+	}
 	for i := range instr.Signatures {
 		identity := instr.SignerIdentities[i]
 		err := identity.Verify(ctxHash, instr.Signatures[i])
-		if err == nil && identity.String() == c.EnclavePubKey {
-			return nil
+		if err == nil && identity.String() == identityStr {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignerCounters checks that the counters of the instruction follow the
+// ones stored for its signers, like byzcoin.Instruction.Verify does, so that a
+// signed instruction can't be replayed. The instructions accepted without the
+// DARC, by the enclave or the dataset owner, must go through it, as Verify is
+// not called for them.
+func verifySignerCounters(rst byzcoin.ReadOnlyStateTrie,
+	instr byzcoin.Instruction) error {
+
+	if len(instr.SignerCounter) != len(instr.SignerIdentities) {
+		return xerrors.New("the signer counters don't match the signer " +
+			"identities")
+	}
+	for i, identity := range instr.SignerIdentities {
+		counter, err := getSignerCounter(rst, identity.String())
+		if err != nil {
+			return xerrors.Errorf("failed to get the counter of '%s': %v",
+				identity, err)
+		}
+		if instr.SignerCounter[i] != counter+1 {
+			return xerrors.Errorf("wrong counter for '%s': got %d, expected "+
+				"%d", identity, instr.SignerCounter[i], counter+1)
+		}
+	}
+	return nil
+}
+
+// getSignerCounter returns the last counter used by the identity, which is 0
+// if it never signed anything. Byzcoin stores it under the hash of the
+// identity prefixed by "signercounter_".
+func getSignerCounter(rst byzcoin.ReadOnlyStateTrie,
+	identityStr string) (uint64, error) {
+
+	h := sha256.New()
+	h.Write([]byte("signercounter_"))
+	h.Write([]byte(identityStr))
+	key := h.Sum(nil)
+
+	proof, err := rst.GetProof(key)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to get the proof: %v", err)
+	}
+	exist, err := proof.Exists(key)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to check the proof: %v", err)
+	}
+	if !exist {
+		return 0, nil
+	}
+
+	buf, _, _, _, err := rst.GetValues(key)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to get the value: %v", err)
+	}
+	if len(buf) != 8 {
+		return 0, xerrors.Errorf("expected a counter of 8 bytes, got %d",
+			len(buf))
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// checkUpdate returns an error if the project data given to the "update"
+// command changes one of the fields that are only set by the spawn or by a
+// dedicated command. Those commands check who signs them, which "update"
+// would otherwise bypass.
+func (c contractProject) checkUpdate(projectData ProjectData) error {
+	if projectData.RequesterIdentity != c.RequesterIdentity {
+		return xerrors.New("the 'RequesterIdentity' field can not be updated")
+	}
+	if projectData.CatalogID != c.CatalogID {
+		return xerrors.New("the 'CatalogID' field can not be updated")
+	}
+	if projectData.Unlocks != c.Unlocks {
+		return xerrors.New("the 'Unlocks' field can not be updated")
+	}
+	if !sameElements(projectData.Outputs, c.Outputs) {
+		return xerrors.New("the 'Outputs' field can only be updated with " +
+			"'recordOutput'")
+	}
+	if !sameElements(projectData.RevokedDatasets, c.RevokedDatasets) {
+		return xerrors.New("the 'RevokedDatasets' field can only be updated " +
+			"with 'revokeDataset' and 'setRevocationOutcome'")
+	}
+	if !sameElements(projectData.Reads, c.Reads) {
+		return xerrors.New("the 'Reads' field can only be updated with " +
+			"'recordRead'")
+	}
+	return nil
+}
+
+// sameElements tells if two slices have the same elements. A nil and an empty
+// slice are the same, which is not the case with reflect.DeepEqual.
+func sameElements(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// hasDataset tells if the given dataset is part of the project
+func (pd ProjectData) hasDataset(datasetID string) bool {
+	for _, dataset := range pd.Datasets {
+		if dataset.String() == datasetID {
+			return true
 		}
 	}
+	return false
+}
+
+// getDatasetOwner looks up in the catalog of the project the owner of the
+// dataset. The catalog is the one given at the spawn of the project, and never
+// one chosen by the caller, otherwise anyone could spawn a catalog that lists
+// them as the owner of the dataset.
+func getDatasetOwner(rst byzcoin.ReadOnlyStateTrie, catalogID byzcoin.InstanceID,
+	datasetID string) (*catalogc.Owner, error) {
+
+	if catalogID == (byzcoin.InstanceID{}) {
+		return nil, xerrors.New("the project has no catalog")
+	}
+
+	catalogBuf, _, contractID, _, err := rst.GetValues(catalogID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get the catalog instance: %v", err)
+	}
+	if contractID != catalogc.ContractCatalogID {
+		return nil, xerrors.Errorf("instance '%x' is not a catalog, found "+
+			"contract '%s'", catalogID, contractID)
+	}
+
+	catalogData := catalogc.CatalogData{}
+	err = catalogc.DecodeCatalogData(catalogBuf, &catalogData)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the catalog: %v", err)
+	}
+
+	owner := catalogData.GetDatasetOwner(datasetID)
+	if owner == nil {
+		return nil, xerrors.Errorf("dataset '%s' not found in the catalog",
+			datasetID)
+	}
 
-	return instr.Verify(rst, ctxHash)
+	return owner, nil
 }
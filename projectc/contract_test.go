@@ -29,7 +29,8 @@ func TestProjectScenario(t *testing.T) {
 			"invoke:odysseyproject.updateMetadata",
 			"invoke:odysseyproject.setURL",
 			"invoke:odysseyproject.setAccessPubKey",
-			"invoke:odysseyproject.setEnclavePubKey"}, signer.Identity())
+			"invoke:odysseyproject.setEnclavePubKey",
+			"invoke:odysseyproject.recordOutput"}, signer.Identity())
 	require.NoError(t, err)
 	gDarc := &genesisMsg.GenesisDarc
 
@@ -43,6 +44,9 @@ func TestProjectScenario(t *testing.T) {
 	instID1 := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 	instID2 := "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
 	pubKey := "TEST_PUBKEY"
+	title := "TEST_PROJECT_TITLE"
+	description := "TEST_PROJECT_DESCRIPTION"
+	organisation := "TEST_ORGANISATION"
 
 	counter++
 	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
@@ -52,6 +56,9 @@ func TestProjectScenario(t *testing.T) {
 			Args: []byzcoin.Argument{
 				{Name: "datasetIDs", Value: []byte(instID1 + "," + instID2)},
 				{Name: "accessPubKey", Value: []byte(pubKey)},
+				{Name: "title", Value: []byte(title)},
+				{Name: "description", Value: []byte(description)},
+				{Name: "organisation", Value: []byte(organisation)},
 			},
 		},
 		SignerCounter: []uint64{counter},
@@ -98,6 +105,10 @@ func TestProjectScenario(t *testing.T) {
 	require.Equal(t, pubKey, projectData.AccessPubKey)
 	require.NotNil(t, projectData.Metadata)
 	require.Equal(t, empty, projectData.Status)
+	require.Equal(t, title, projectData.Title)
+	require.Equal(t, description, projectData.Description)
+	require.Equal(t, organisation, projectData.Organisation)
+	require.Equal(t, signer.Identity().String(), projectData.RequesterIdentity)
 
 	// ------------------------------------------------------------------------
 	// Update
@@ -448,4 +459,712 @@ func TestProjectScenario(t *testing.T) {
 	require.Equal(t, newStatus, projectData.Status)
 	require.Equal(t, url, projectData.EnclaveURL)
 	require.Equal(t, enclaveKey, projectData.EnclavePubKey)
+
+	// ------------------------------------------------------------------------
+	// recordOutput
+
+	enclaveSigner := darc.NewSignerEd25519(nil, nil)
+
+	invoke = byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "setEnclavePubKey",
+		Args: byzcoin.Arguments{
+			{
+				Name: "pubKey", Value: []byte(enclaveSigner.Identity().String()),
+			},
+		},
+	}
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+
+	err = ctx.FillSignersAndSignWith(signer)
+	require.NoError(t, err)
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	outputSHA2 := "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+
+	invoke = byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "recordOutput",
+		Args: byzcoin.Arguments{
+			{Name: "name", Value: []byte("result.csv")},
+			{Name: "size", Value: []byte("42")},
+			{Name: "sha2", Value: []byte(outputSHA2)},
+			{Name: "destination", Value: []byte("dedis/result.csv")},
+		},
+	}
+
+	// The admin, even if allowed by the DARC, can not record an output
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter + 1},
+	})
+	require.NoError(t, err)
+
+	err = ctx.FillSignersAndSignWith(signer)
+	require.NoError(t, err)
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+
+	err = ctx.FillSignersAndSignWith(enclaveSigner)
+	require.NoError(t, err)
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// The same signed instruction can not be replayed
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Get
+
+	prResp, err = cl.GetProofFromLatest(instIDBuf)
+	require.NoError(t, err)
+
+	err = prResp.Proof.VerifyAndDecode(cothority.Suite, ContractProjectID, &projectData)
+	require.NoError(t, err)
+
+	require.Equal(t, enclaveSigner.Identity().String(), projectData.EnclavePubKey)
+	require.Equal(t, 1, len(projectData.Outputs))
+	require.Equal(t, "result.csv", projectData.Outputs[0].Name)
+	require.Equal(t, uint64(42), projectData.Outputs[0].Size)
+	require.Equal(t, outputSHA2, projectData.Outputs[0].SHA2)
+	require.Equal(t, "dedis/result.csv", projectData.Outputs[0].Destination)
+
+	// ------------------------------------------------------------------------
+	// The admin, even if allowed by the DARC, can not rewrite the outputs with
+	// an update
+
+	projectData.Outputs[0].Destination = "dedis/elsewhere.csv"
+	prjectDataBuf, err = protobuf.Encode(&projectData)
+	require.NoError(t, err)
+
+	invoke = byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "update",
+		Args: byzcoin.Arguments{
+			{Name: "projectData", Value: prjectDataBuf},
+		},
+	}
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter + 1},
+	})
+	require.NoError(t, err)
+
+	err = ctx.FillSignersAndSignWith(signer)
+	require.NoError(t, err)
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// The enclave can update the status but not the other fields
+
+	invoke = byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "updateStatus",
+		Args: byzcoin.Arguments{
+			{Name: "status", Value: []byte(unlockedOK.String())},
+		},
+	}
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+
+	err = ctx.FillSignersAndSignWith(enclaveSigner)
+	require.NoError(t, err)
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	invoke = byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "setAccessPubKey",
+		Args: byzcoin.Arguments{
+			{Name: "pubKey", Value: []byte("ENCLAVE_ACCESS_KEY")},
+		},
+	}
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID(instIDBuf),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{3},
+	})
+	require.NoError(t, err)
+
+	err = ctx.FillSignersAndSignWith(enclaveSigner)
+	require.NoError(t, err)
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	prResp, err = cl.GetProofFromLatest(instIDBuf)
+	require.NoError(t, err)
+
+	err = prResp.Proof.VerifyAndDecode(cothority.Suite, ContractProjectID, &projectData)
+	require.NoError(t, err)
+
+	require.Equal(t, unlockedOK, projectData.Status)
+	require.Equal(t, newAccessPubKey, projectData.AccessPubKey)
+}
+
+func TestProjectRevokeDataset(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	counter := uint64(0)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	owner := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:odysseyproject", "spawn:odysseycatalog",
+			"invoke:odysseycatalog.addOwner",
+			"invoke:odysseyproject.revokeDataset",
+			"invoke:odysseyproject.setEnclavePubKey",
+			"invoke:odysseyproject.setRevocationOutcome",
+			"invoke:odysseyproject.update"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	datasetID := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	// ------------------------------------------------------------------------
+	// Spawn a catalog with an owner that has one dataset
+
+	counter++
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: catalogc.ContractCatalogID,
+			Args:       []byzcoin.Argument{},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	catalogID := ctx.Instructions[0].DeriveID("")
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: catalogID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: catalogc.ContractCatalogID,
+			Command:    "addOwner",
+			Args: byzcoin.Arguments{
+				{Name: "firstname", Value: []byte("John")},
+				{Name: "lastname", Value: []byte("Doe")},
+				{Name: "identityStr", Value: []byte(owner.Identity().String())},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	dataset := catalogc.Dataset{
+		CalypsoWriteID: datasetID,
+		Title:          "TEST_DATASET",
+		IdentityStr:    owner.Identity().String(),
+	}
+	datasetBuf, err := protobuf.Encode(&dataset)
+	require.NoError(t, err)
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: catalogID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: catalogc.ContractCatalogID,
+			Command:    "addDataset",
+			Args: byzcoin.Arguments{
+				{Name: "identityStr", Value: []byte(owner.Identity().String())},
+				{Name: "calypsoWriteID", Value: []byte(datasetID)},
+				{Name: "dataset", Value: datasetBuf},
+			},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(owner))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Spawn a project that uses the dataset
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractProjectID,
+			Args: []byzcoin.Argument{
+				{Name: "datasetIDs", Value: []byte(datasetID)},
+				{Name: "accessPubKey", Value: []byte("TEST_PUBKEY")},
+				{Name: "catalogID", Value: catalogID.Slice()},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	instID := ctx.Instructions[0].DeriveID("")
+	instIDBuf := instID.Slice()
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Spawn another catalog where the signer claims to own the dataset
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: catalogc.ContractCatalogID,
+			Args:       []byzcoin.Argument{},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	fakeCatalogID := ctx.Instructions[0].DeriveID("")
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: fakeCatalogID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: catalogc.ContractCatalogID,
+			Command:    "addOwner",
+			Args: byzcoin.Arguments{
+				{Name: "firstname", Value: []byte("Eve")},
+				{Name: "lastname", Value: []byte("Doe")},
+				{Name: "identityStr", Value: []byte(signer.Identity().String())},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	fakeDataset := catalogc.Dataset{
+		CalypsoWriteID: datasetID,
+		Title:          "TEST_DATASET",
+		IdentityStr:    signer.Identity().String(),
+	}
+	fakeDatasetBuf, err := protobuf.Encode(&fakeDataset)
+	require.NoError(t, err)
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: fakeCatalogID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: catalogc.ContractCatalogID,
+			Command:    "addDataset",
+			Args: byzcoin.Arguments{
+				{Name: "identityStr", Value: []byte(signer.Identity().String())},
+				{Name: "calypsoWriteID", Value: []byte(datasetID)},
+				{Name: "dataset", Value: fakeDatasetBuf},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Revoke by someone that is not the owner, even if allowed by the DARC and
+	// if the instruction points to a catalog where it owns the dataset
+
+	invoke := byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "revokeDataset",
+		Args: byzcoin.Arguments{
+			{Name: "datasetID", Value: []byte(datasetID)},
+			{Name: "catalogID", Value: fakeCatalogID.Slice()},
+		},
+	}
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter + 1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Revoke by the owner, with a counter that has already been used by the
+	// owner to add the dataset
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(owner))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Revoke by the owner
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(owner))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// The same signed instruction can not be replayed
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	prResp, err := cl.GetProofFromLatest(instIDBuf)
+	require.NoError(t, err)
+
+	var projectData ProjectData
+	err = prResp.Proof.VerifyAndDecode(cothority.Suite, ContractProjectID, &projectData)
+	require.NoError(t, err)
+
+	require.True(t, projectData.IsRevoked(datasetID))
+	require.Equal(t, owner.Identity().String(), projectData.RevokedDatasets[0].RevokedBy)
+	require.Equal(t, "", projectData.RevokedDatasets[0].Outcome)
+
+	// ------------------------------------------------------------------------
+	// Set the outcome
+
+	enclaveSigner := darc.NewSignerEd25519(nil, nil)
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: instID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractProjectID,
+			Command:    "setEnclavePubKey",
+			Args: byzcoin.Arguments{
+				{Name: "pubKey", Value: []byte(enclaveSigner.Identity().String())},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	invoke = byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "setRevocationOutcome",
+		Args: byzcoin.Arguments{
+			{Name: "datasetID", Value: []byte(datasetID)},
+			{Name: "outcome", Value: []byte("enclave deleted")},
+		},
+	}
+
+	// The admin, even if allowed by the DARC, can not set the outcome
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter + 1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(enclaveSigner))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	prResp, err = cl.GetProofFromLatest(instIDBuf)
+	require.NoError(t, err)
+
+	err = prResp.Proof.VerifyAndDecode(cothority.Suite, ContractProjectID, &projectData)
+	require.NoError(t, err)
+
+	require.Equal(t, "enclave deleted", projectData.RevokedDatasets[0].Outcome)
+
+	// ------------------------------------------------------------------------
+	// The DARC can not drop the revocation with an update
+
+	projectData.RevokedDatasets = nil
+	projectDataBuf, err := protobuf.Encode(&projectData)
+	require.NoError(t, err)
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: instID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractProjectID,
+			Command:    "update",
+			Args: byzcoin.Arguments{
+				{Name: "projectData", Value: projectDataBuf},
+			},
+		},
+		SignerCounter: []uint64{counter + 1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+}
+
+func TestProjectRecordRead(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	counter := uint64(0)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:odysseyproject", "invoke:odysseyproject.updateStatus",
+			"invoke:odysseyproject.recordRead"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	datasetID := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	counter++
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractProjectID,
+			Args: []byzcoin.Argument{
+				{Name: "datasetIDs", Value: []byte(datasetID)},
+				{Name: "accessPubKey", Value: []byte("TEST_PUBKEY")},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	instID := ctx.Instructions[0].DeriveID("")
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// An unlock request, the status is set twice like the enclave manager
+	// does when it retries.
+
+	for i := 0; i < 2; i++ {
+		counter++
+		ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+			InstanceID: instID,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractProjectID,
+				Command:    "updateStatus",
+				Args: byzcoin.Arguments{
+					{Name: "status", Value: []byte(unlocking.String())},
+				},
+			},
+			SignerCounter: []uint64{counter},
+		})
+		require.NoError(t, err)
+		require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+		_, err = cl.AddTransactionAndWait(ctx, 10)
+		require.NoError(t, err)
+
+		local.WaitDone(genesisMsg.BlockInterval)
+	}
+
+	// ------------------------------------------------------------------------
+	// Record a read of a dataset that is not part of the project
+
+	invoke := byzcoin.Invoke{
+		ContractID: ContractProjectID,
+		Command:    "recordRead",
+		Args: byzcoin.Arguments{
+			{Name: "datasetID", Value: []byte(
+				"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")},
+		},
+	}
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter + 1},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	// ------------------------------------------------------------------------
+	// Record a read of the dataset
+
+	invoke.Args = byzcoin.Arguments{
+		{Name: "datasetID", Value: []byte(datasetID)},
+	}
+
+	counter++
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    instID,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter},
+	})
+	require.NoError(t, err)
+	require.Nil(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+
+	prResp, err := cl.GetProofFromLatest(instID.Slice())
+	require.NoError(t, err)
+
+	var projectData ProjectData
+	err = prResp.Proof.VerifyAndDecode(cothority.Suite, ContractProjectID, &projectData)
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(1), projectData.Unlocks)
+	require.Equal(t, 1, len(projectData.Reads))
+	require.Equal(t, datasetID, projectData.Reads[0].DatasetID)
+	require.Equal(t, signer.Identity().String(), projectData.Reads[0].Signer)
+	// The read is the next instruction of the signer
+	require.Equal(t, counter+1, projectData.Reads[0].Counter)
+	require.Equal(t, uint64(1), projectData.Reads[0].Unlock)
+	require.Equal(t, 0, projectData.GetReadIndex(datasetID,
+		signer.Identity().String(), counter+1))
+	require.Equal(t, -1, projectData.GetReadIndex(datasetID,
+		signer.Identity().String(), counter))
+}
+
+func TestIsSignedBy(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	ctxHash := []byte("ctxHash")
+	sig, err := signer.Sign(ctxHash)
+	require.NoError(t, err)
+
+	instr := byzcoin.Instruction{
+		SignerIdentities: []darc.Identity{signer.Identity()},
+		Signatures:       [][]byte{sig},
+	}
+	require.True(t, isSignedBy(instr, ctxHash, signer.Identity().String()))
+	require.False(t, isSignedBy(instr, []byte("other"), signer.Identity().String()))
+	require.False(t, isSignedBy(instr, ctxHash, ""))
+
+	// More signatures than identities
+	instr.Signatures = append(instr.Signatures, sig)
+	require.False(t, isSignedBy(instr, ctxHash, signer.Identity().String()))
 }
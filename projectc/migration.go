@@ -0,0 +1,72 @@
+package projectc
+
+import (
+	"github.com/dedis/odyssey/catalogc"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ProjectDataVersion is the version of the ProjectData encoding produced by
+// this package. It must be incremented, along with a new entry in
+// projectMigrations, each time a change to ProjectData (or one of its nested
+// types) can not be read by the previous decoder.
+const ProjectDataVersion uint32 = 1
+
+// projectMigrations upgrades an encoded ProjectData from the version used as
+// key to the next one. Encodings made before the version tag existed have the
+// version 0.
+var projectMigrations = catalogc.Migrations{
+	0: migrateProjectDataV0,
+}
+
+// DecodeProjectData decodes a ProjectData, upgrading it first if it has been
+// encoded with a previous version. It must be used instead of protobuf.Decode
+// on every ProjectData read from the ledger.
+func DecodeProjectData(buf []byte, pd *ProjectData) error {
+	buf, err := projectMigrations.Upgrade(buf, "project data",
+		ProjectDataVersion)
+	if err != nil {
+		return err
+	}
+
+	err = protobuf.Decode(buf, pd)
+	if err != nil {
+		return xerrors.Errorf("failed to decode the project data: %v", err)
+	}
+
+	return nil
+}
+
+// DecodeProjectProof verifies the proof, like byzcoin.Proof.VerifyAndDecode
+// does, and decodes the project instance with the given ID that it holds with
+// DecodeProjectData.
+func DecodeProjectProof(proof byzcoin.Proof, instID []byte,
+	pd *ProjectData) error {
+
+	buf, err := catalogc.GetInstanceFromProof(proof, instID, ContractProjectID)
+	if err != nil {
+		return err
+	}
+
+	return DecodeProjectData(buf, pd)
+}
+
+// migrateProjectDataV0 tags an unversioned encoding with the version 1, see
+// migrateCatalogDataV0 in catalogc.
+func migrateProjectDataV0(buf []byte) ([]byte, error) {
+	pd := ProjectData{}
+	err := protobuf.Decode(buf, &pd)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode: %v", err)
+	}
+
+	pd.Version = 1
+
+	buf, err = protobuf.Encode(&pd)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode: %v", err)
+	}
+
+	return buf, nil
+}
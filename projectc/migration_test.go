@@ -0,0 +1,95 @@
+package projectc
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
+)
+
+// loadFixture reads an hex encoded fixture from the testdata folder
+func loadFixture(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	buf, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	require.NoError(t, err)
+	return buf
+}
+
+// The baseline fixture has been encoded with the first layout of ProjectData,
+// which only had the datasets, metadata, keys, status and URL.
+func TestDecodeProjectData_Baseline(t *testing.T) {
+	buf := loadFixture(t, "project_baseline.hex")
+
+	pd := ProjectData{}
+	err := DecodeProjectData(buf, &pd)
+	require.NoError(t, err)
+
+	require.Equal(t, ProjectDataVersion, pd.Version)
+	require.Len(t, pd.Datasets, 2)
+	require.Equal(t, strings.Repeat("aa", 32), pd.Datasets[0].String())
+	require.Equal(t, strings.Repeat("bb", 32), pd.Datasets[1].String())
+	require.Equal(t, "ed25519:aef123", pd.AccessPubKey)
+	require.Equal(t, "ed25519:bcd456", pd.EnclavePubKey)
+	require.Equal(t, unlockedOK, pd.Status)
+	require.Equal(t, "https://enclave.example.com", pd.EnclaveURL)
+	require.Len(t, pd.Metadata.AttributesGroups, 1)
+	require.Equal(t, "use_restricted",
+		pd.Metadata.AttributesGroups[0].Attributes[0].ID)
+	require.Equal(t, "", pd.Title)
+	require.Len(t, pd.Outputs, 0)
+	require.Len(t, pd.RevokedDatasets, 0)
+}
+
+// The v0 fixture has been encoded with the last layout that had no version
+// tag.
+func TestDecodeProjectData_V0(t *testing.T) {
+	buf := loadFixture(t, "project_v0.hex")
+
+	pd := ProjectData{}
+	err := DecodeProjectData(buf, &pd)
+	require.NoError(t, err)
+
+	require.Equal(t, ProjectDataVersion, pd.Version)
+	require.Len(t, pd.Datasets, 1)
+	require.Equal(t, unlockedOK, pd.Status)
+	require.Equal(t, "Road safety", pd.Title)
+	require.Equal(t, "Study of road accidents", pd.Description)
+	require.Equal(t, "EPFL", pd.Organisation)
+	require.Equal(t, "ed25519:aef123", pd.RequesterIdentity)
+	require.Len(t, pd.Outputs, 1)
+	require.Equal(t, "result.csv", pd.Outputs[0].Name)
+	require.Equal(t, uint64(42), pd.Outputs[0].Size)
+	require.Equal(t, "s3://results", pd.Outputs[0].Destination)
+	require.Len(t, pd.RevokedDatasets, 1)
+	require.True(t, pd.IsRevoked("aa"))
+}
+
+func TestDecodeProjectData_Current(t *testing.T) {
+	pd := ProjectData{
+		Version:      ProjectDataVersion,
+		Title:        "Road safety",
+		AccessPubKey: "ed25519:aef123",
+	}
+	buf, err := protobuf.Encode(&pd)
+	require.NoError(t, err)
+
+	pd2 := ProjectData{}
+	err = DecodeProjectData(buf, &pd2)
+	require.NoError(t, err)
+	require.Equal(t, pd.Version, pd2.Version)
+	require.Equal(t, pd.Title, pd2.Title)
+	require.Equal(t, pd.AccessPubKey, pd2.AccessPubKey)
+}
+
+func TestDecodeProjectData_Future(t *testing.T) {
+	buf, err := protobuf.Encode(&ProjectData{Version: ProjectDataVersion + 1})
+	require.NoError(t, err)
+
+	err = DecodeProjectData(buf, &ProjectData{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only understands up to")
+}
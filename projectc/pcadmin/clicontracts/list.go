@@ -0,0 +1,366 @@
+package clicontracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dedis/odyssey/projectc"
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// dateLayout is the layout expected by the --from and --to flags
+const dateLayout = "2006-01-02"
+
+// listPageSize is the number of blocks we ask for each pagination request
+const listPageSize = 10000
+
+// projectListItem is the representation of a project printed by the list
+// command.
+type projectListItem struct {
+	InstanceID   string    `json:"instanceID"`
+	BlockIndex   int       `json:"blockIndex"`
+	Created      time.Time `json:"created"`
+	Title        string    `json:"title"`
+	Organisation string    `json:"organisation"`
+	Requester    string    `json:"requester"`
+	Status       string    `json:"status"`
+	AccessPubKey string    `json:"accessPubKey"`
+	Datasets     []string  `json:"datasets"`
+}
+
+// projectFilter holds the criteria given by the user to select projects. An
+// empty criterion matches every project.
+type projectFilter struct {
+	status    string
+	dataset   string
+	accessKey string
+	from      time.Time
+	to        time.Time
+}
+
+// matchCreated tells if the creation time satisfies the date criteria. It
+// only needs the block of the spawn, so that we can skip the projects before
+// fetching their state.
+func (f projectFilter) matchCreated(created time.Time) bool {
+	if !f.from.IsZero() && created.Before(f.from) {
+		return false
+	}
+	// The "to" date is inclusive
+	if !f.to.IsZero() && !created.Before(f.to.AddDate(0, 0, 1)) {
+		return false
+	}
+	return true
+}
+
+// match tells if the project satisfies all the criteria
+func (f projectFilter) match(item *projectListItem) bool {
+	if f.status != "" && item.Status != f.status {
+		return false
+	}
+	if f.accessKey != "" && item.AccessPubKey != f.accessKey {
+		return false
+	}
+	if !f.matchCreated(item.Created) {
+		return false
+	}
+	if f.dataset != "" {
+		for _, dataset := range item.Datasets {
+			if dataset == f.dataset {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ProjectList goes through the chain to find all the project instances that
+// have been spawned, and prints the ones that match the given filters.
+func ProjectList(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	filter, err := parseProjectFilter(c)
+	if err != nil {
+		return xerrors.Errorf("failed to parse the filters: %v", err)
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	items, err := indexProjects(cl, cfg, filter)
+	if err != nil {
+		return xerrors.Errorf("failed to index the projects: %v", err)
+	}
+
+	result := make([]*projectListItem, 0)
+	for _, item := range items {
+		if filter.match(item) {
+			result = append(result, item)
+		}
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(result)
+		if err != nil {
+			return xerrors.Errorf("failed to encode the projects: %v", err)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE ID\tCREATED\tSTATUS\tTITLE\tORGANISATION\tDATASETS")
+	for _, item := range result {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", item.InstanceID,
+			item.Created.Format(time.RFC3339), item.Status, item.Title,
+			item.Organisation, len(item.Datasets))
+	}
+	err = w.Flush()
+	if err != nil {
+		return xerrors.Errorf("failed to write the table: %v", err)
+	}
+
+	return nil
+}
+
+// parseProjectFilter reads and validates the filter flags
+func parseProjectFilter(c *cli.Context) (projectFilter, error) {
+	filter := projectFilter{
+		status:    c.String("status"),
+		dataset:   strings.ToLower(c.String("dataset")),
+		accessKey: c.String("accessKey"),
+	}
+
+	if filter.status != "" {
+		_, err := projectc.StatusFromString(filter.status)
+		if err != nil {
+			return filter, xerrors.Errorf("unknown status: %v", err)
+		}
+	}
+
+	var err error
+	if c.String("from") != "" {
+		filter.from, err = time.ParseInLocation(dateLayout, c.String("from"),
+			time.Local)
+		if err != nil {
+			return filter, xerrors.Errorf("failed to parse --from, expected "+
+				"format is %s: %v", dateLayout, err)
+		}
+	}
+	if c.String("to") != "" {
+		filter.to, err = time.ParseInLocation(dateLayout, c.String("to"),
+			time.Local)
+		if err != nil {
+			return filter, xerrors.Errorf("failed to parse --to, expected "+
+				"format is %s: %v", dateLayout, err)
+		}
+	}
+
+	return filter, nil
+}
+
+// indexProjects reads all the blocks of the chain and returns the projects
+// spawned by the accepted transactions, with their latest state. The projects
+// created out of the dates of the filter are skipped before their state is
+// fetched.
+func indexProjects(cl *byzcoin.Client, cfg lib.Config,
+	filter projectFilter) ([]*projectListItem, error) {
+
+	items := make([]*projectListItem, 0)
+	startID := cfg.ByzCoinID
+	skipFirst := false
+
+	for {
+		pageItems, lastID, n, err := indexProjectsPage(cl, cfg, startID,
+			skipFirst, filter)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pageItems...)
+
+		// We reached the end of the chain
+		if n < listPageSize {
+			return items, nil
+		}
+		// The next page starts with the last block of this one
+		startID = lastID
+		skipFirst = true
+	}
+}
+
+// indexProjectsPage reads the blocks of one pagination request, starting from
+// the given block. It returns the projects found, the ID of the last block
+// received and the number of blocks received.
+func indexProjectsPage(cl *byzcoin.Client, cfg lib.Config,
+	startID skipchain.SkipBlockID, skipFirst bool,
+	filter projectFilter) ([]*projectListItem, skipchain.SkipBlockID, int, error) {
+
+	msg := &byzcoin.PaginateRequest{
+		StartID:  startID,
+		PageSize: 1,
+		NumPages: listPageSize,
+		Backward: false,
+	}
+	ret := &byzcoin.PaginateResponse{}
+	streamingCon, err := cl.Stream(cfg.Roster.RandomServerIdentity(), msg)
+	if err != nil {
+		return nil, nil, 0, xerrors.Errorf("failed to call PaginateRequest: %v", err)
+	}
+	defer streamingCon.Close()
+
+	items := make([]*projectListItem, 0)
+	lastID := startID
+
+	nblocks := 0
+	for ; nblocks < listPageSize; nblocks++ {
+		err = streamingCon.ReadMessage(ret)
+		if err != nil {
+			return nil, nil, nblocks, xerrors.Errorf("failed to read from "+
+				"stream: %v", err)
+		}
+		// This is normal when it reaches the end of the chain
+		if ret.ErrorCode == 4 {
+			break
+		}
+		if ret.ErrorCode != 0 {
+			return nil, nil, nblocks, xerrors.Errorf("Got a non zero error "+
+				"code: %d, %v", ret.ErrorCode, ret.ErrorText)
+		}
+		if len(ret.Blocks) == 0 {
+			return nil, nil, nblocks, xerrors.Errorf("Expected to have one "+
+				"block, but got: %v", ret.Blocks)
+		}
+
+		block := ret.Blocks[0]
+		lastID = block.Hash
+
+		// The first block is the last one of the previous page
+		if nblocks == 0 && skipFirst {
+			continue
+		}
+
+		blockItems, err := getBlockProjects(cl, block, filter)
+		if err != nil {
+			return nil, nil, nblocks, xerrors.Errorf("failed to read block "+
+				"%d: %v", block.Index, err)
+		}
+		items = append(items, blockItems...)
+	}
+
+	return items, lastID, nblocks, nil
+}
+
+// getBlockProjects returns the projects spawned by the accepted transactions
+// of the block, if the block is in the dates of the filter.
+func getBlockProjects(cl *byzcoin.Client, block *skipchain.SkipBlock,
+	filter projectFilter) ([]*projectListItem, error) {
+
+	dataBody := &byzcoin.DataBody{}
+	err := protobuf.Decode(block.Payload, dataBody)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dataBody: %v", err)
+	}
+	if len(dataBody.TxResults) == 0 {
+		return nil, nil
+	}
+
+	dataHeader := &byzcoin.DataHeader{}
+	err = protobuf.Decode(block.Data, dataHeader)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dataHeader: %v", err)
+	}
+	created := time.Unix(0, dataHeader.Timestamp)
+	if !filter.matchCreated(created) {
+		return nil, nil
+	}
+
+	items := make([]*projectListItem, 0)
+	for _, txResult := range dataBody.TxResults {
+		if !txResult.Accepted {
+			continue
+		}
+		for _, instr := range txResult.ClientTransaction.Instructions {
+			if instr.GetType() != byzcoin.SpawnType ||
+				instr.Spawn.ContractID != projectc.ContractProjectID {
+				continue
+			}
+
+			item, err := getProjectListItem(cl, instr.DeriveID(""))
+			if err != nil {
+				return nil, xerrors.Errorf("failed to get project: %v", err)
+			}
+			if item == nil {
+				continue
+			}
+			item.BlockIndex = block.Index
+			item.Created = created
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// getProjectListItem fetches the latest state of the project instance. It
+// returns nil if the instance doesn't exist anymore.
+func getProjectListItem(cl *byzcoin.Client,
+	instID byzcoin.InstanceID) (*projectListItem, error) {
+
+	pr, err := cl.GetProofFromLatest(instID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get proof: %v", err)
+	}
+
+	exist, err := pr.Proof.InclusionProof.Exists(instID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("error while checking if proof exist: %v", err)
+	}
+	if !exist {
+		return nil, nil
+	}
+
+	_, buf, contractID, _, err := pr.Proof.KeyValue()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get value from proof: %v", err)
+	}
+	if contractID != projectc.ContractProjectID {
+		return nil, xerrors.Errorf("instance '%s' is not a project, found "+
+			"contract '%s'", instID, contractID)
+	}
+
+	projectData := projectc.ProjectData{}
+	err = projectc.DecodeProjectData(buf, &projectData)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the project: %v", err)
+	}
+
+	datasets := make([]string, len(projectData.Datasets))
+	for i, dataset := range projectData.Datasets {
+		datasets[i] = dataset.String()
+	}
+
+	return &projectListItem{
+		InstanceID:   instID.String(),
+		Title:        projectData.Title,
+		Organisation: projectData.Organisation,
+		Requester:    projectData.RequesterIdentity,
+		Status:       projectData.Status.String(),
+		AccessPubKey: projectData.AccessPubKey,
+		Datasets:     datasets,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package clicontracts
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+// newListContext returns a context with the filter flags of the list command
+// set to the given arguments.
+func newListContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("list", flag.ContinueOnError)
+	for _, name := range []string{"status", "dataset", "accessKey", "from", "to"} {
+		set.String(name, "", "")
+	}
+	require.NoError(t, set.Parse(args))
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestParseProjectFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		filter projectFilter
+		err    string
+	}{
+		{
+			name: "no filter",
+		},
+		{
+			name: "all the filters",
+			args: []string{"--status", "unlocking", "--dataset", "AB12",
+				"--accessKey", "key", "--from", "2020-01-01", "--to", "2020-03-31"},
+			filter: projectFilter{
+				status:    "unlocking",
+				dataset:   "ab12",
+				accessKey: "key",
+				from:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local),
+				to:        time.Date(2020, 3, 31, 0, 0, 0, 0, time.Local),
+			},
+		},
+		{
+			name: "unknown status",
+			args: []string{"--status", "unknown"},
+			err:  "unknown status",
+		},
+		{
+			name: "wrong from date",
+			args: []string{"--from", "01.01.2020"},
+			err:  "failed to parse --from",
+		},
+		{
+			name: "wrong to date",
+			args: []string{"--to", "2020-01-01T10:00:00Z"},
+			err:  "failed to parse --to",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := parseProjectFilter(newListContext(t, test.args...))
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.filter, filter)
+		})
+	}
+}
+
+func TestProjectFilter_Match(t *testing.T) {
+	item := &projectListItem{
+		Created:      time.Date(2020, 3, 31, 18, 0, 0, 0, time.Local),
+		Status:       "unlocking",
+		AccessPubKey: "key",
+		Datasets:     []string{"aa", "bb"},
+	}
+	day := func(d int) time.Time {
+		return time.Date(2020, 3, d, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name   string
+		filter projectFilter
+		match  bool
+	}{
+		{"no filter", projectFilter{}, true},
+		{"same status", projectFilter{status: "unlocking"}, true},
+		{"other status", projectFilter{status: "unlockedOK"}, false},
+		{"same access key", projectFilter{accessKey: "key"}, true},
+		{"other access key", projectFilter{accessKey: "other"}, false},
+		{"used dataset", projectFilter{dataset: "bb"}, true},
+		{"other dataset", projectFilter{dataset: "cc"}, false},
+		{"from the same day", projectFilter{from: day(31)}, true},
+		{"from the next day", projectFilter{from: day(31).AddDate(0, 0, 1)}, false},
+		// The "to" date is inclusive
+		{"to the same day", projectFilter{to: day(31)}, true},
+		{"to the day before", projectFilter{to: day(30)}, false},
+		{"all the criteria", projectFilter{status: "unlocking",
+			accessKey: "key", dataset: "aa", from: day(1), to: day(31)}, true},
+		{"one criterion fails", projectFilter{status: "unlocking",
+			accessKey: "key", dataset: "cc", from: day(1), to: day(31)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.match, test.filter.match(item))
+			// matchCreated only checks the dates
+			if test.filter.from.IsZero() && test.filter.to.IsZero() {
+				require.True(t, test.filter.matchCreated(item.Created))
+			}
+		})
+	}
+}
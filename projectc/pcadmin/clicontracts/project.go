@@ -2,18 +2,23 @@ package clicontracts
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/dedis/odyssey/catalogc"
+	"github.com/dedis/odyssey/cryptutil/envelope"
 	"github.com/dedis/odyssey/projectc"
 	"github.com/urfave/cli"
-	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
 	"go.dedis.ch/cothority/v3/darc"
@@ -71,6 +76,14 @@ func ProjectSpawn(c *cli.Context) error {
 	}
 
 	pubKey := c.String("pubKey")
+	title := c.String("title")
+	description := c.String("description")
+	organisation := c.String("organisation")
+
+	catalogIDBuf, err := hex.DecodeString(c.String("catalogID"))
+	if err != nil {
+		return errors.New("failed to decode the catalogID string: " + err.Error())
+	}
 
 	counters, err := cl.GetSignerCounters(signer.Identity().String())
 	if err != nil {
@@ -88,6 +101,18 @@ func ProjectSpawn(c *cli.Context) error {
 				{
 					Name: "accessPubKey", Value: []byte(pubKey),
 				},
+				{
+					Name: "title", Value: []byte(title),
+				},
+				{
+					Name: "description", Value: []byte(description),
+				},
+				{
+					Name: "organisation", Value: []byte(organisation),
+				},
+				{
+					Name: "catalogID", Value: catalogIDBuf,
+				},
 			},
 		},
 		SignerCounter: []uint64{counters.Counters[0] + 1},
@@ -115,7 +140,7 @@ func ProjectSpawn(c *cli.Context) error {
 	}
 
 	result := projectc.ProjectData{}
-	err = protobuf.Decode(resultBuf, &result)
+	err = projectc.DecodeProjectData(resultBuf, &result)
 	if err != nil {
 		return errors.New("couldn't decode the result: " + err.Error())
 	}
@@ -169,7 +194,7 @@ func ProjectdInvokeUpdate(c *cli.Context) error {
 	}
 
 	var projectData projectc.ProjectData
-	err = proof.VerifyAndDecode(cothority.Suite, projectc.ContractProjectID, &projectData)
+	err = projectc.DecodeProjectProof(proof, instIDBuf, &projectData)
 	if err != nil {
 		return errors.New("couldn't get a project instance: " + err.Error())
 	}
@@ -656,6 +681,370 @@ func ProjectdInvokeSetEnclavePubKey(c *cli.Context) error {
 	return lib.WaitPropagation(c, cl)
 }
 
+// ProjectdInvokeRecordOutput records an output that left the enclave. The size
+// and the SHA-256 are computed from the given file.
+func ProjectdInvokeRecordOutput(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDstr := c.String("instid")
+	if instIDstr == "" {
+		return errors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instIDstr)
+	if err != nil {
+		return errors.New("failed to decode the instid string: " + err.Error())
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return errors.New("failed to parse the signer: " + err.Error())
+	}
+
+	filePath := c.String("file")
+	if filePath == "" {
+		return errors.New("please provide the output file with --file")
+	}
+
+	destination := c.String("destination")
+	if destination == "" {
+		return errors.New("please provide the output destination with --destination")
+	}
+
+	name := c.String("name")
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return xerrors.Errorf("failed to open output file: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return xerrors.Errorf("failed to hash output file: %v", err)
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("failed to get counters: %v", err)
+	}
+
+	invoke := byzcoin.Invoke{
+		ContractID: projectc.ContractProjectID,
+		Command:    "recordOutput",
+		Args: []byzcoin.Argument{
+			{
+				Name:  "name",
+				Value: []byte(name),
+			},
+			{
+				Name:  "size",
+				Value: []byte(strconv.FormatInt(size, 10)),
+			},
+			{
+				Name:  "sha2",
+				Value: []byte(hex.EncodeToString(hash.Sum(nil))),
+			},
+			{
+				Name:  "destination",
+				Value: []byte(destination),
+			},
+		},
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID([]byte(instIDBuf)),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return errors.New("failed to add transaction and wait: " + err.Error())
+	}
+
+	newInstID := ctx.Instructions[0].DeriveID("").Slice()
+	fmt.Printf("Value contract updated! (instance ID is %x)\n", newInstID)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// ProjectdInvokeRecordRead records on the project that the signer is about to
+// read a dataset. The read must be the next instruction of the signer, which
+// is what the conodes check to enforce the rate limits.
+func ProjectdInvokeRecordRead(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDstr := c.String("instid")
+	if instIDstr == "" {
+		return errors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instIDstr)
+	if err != nil {
+		return errors.New("failed to decode the instid string: " + err.Error())
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return errors.New("failed to parse the signer: " + err.Error())
+	}
+
+	datasetID := c.String("datasetID")
+	if datasetID == "" {
+		return errors.New("please provide a dataset with --datasetID")
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("failed to get counters: %v", err)
+	}
+
+	invoke := byzcoin.Invoke{
+		ContractID: projectc.ContractProjectID,
+		Command:    "recordRead",
+		Args: []byzcoin.Argument{
+			{
+				Name:  "datasetID",
+				Value: []byte(datasetID),
+			},
+		},
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID([]byte(instIDBuf)),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return errors.New("failed to add transaction and wait: " + err.Error())
+	}
+
+	newInstID := ctx.Instructions[0].DeriveID("").Slice()
+	fmt.Printf("Value contract updated! (instance ID is %x)\n", newInstID)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// ProjectdInvokeRevokeDataset revokes a dataset from the project. It must be
+// signed by the owner of the dataset.
+func ProjectdInvokeRevokeDataset(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDstr := c.String("instid")
+	if instIDstr == "" {
+		return errors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instIDstr)
+	if err != nil {
+		return errors.New("failed to decode the instid string: " + err.Error())
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return errors.New("failed to parse the signer: " + err.Error())
+	}
+
+	datasetID := c.String("datasetID")
+	if datasetID == "" {
+		return errors.New("please provide a dataset with --datasetID")
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("failed to get counters: %v", err)
+	}
+
+	invoke := byzcoin.Invoke{
+		ContractID: projectc.ContractProjectID,
+		Command:    "revokeDataset",
+		Args: []byzcoin.Argument{
+			{
+				Name:  "datasetID",
+				Value: []byte(datasetID),
+			},
+		},
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID([]byte(instIDBuf)),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return errors.New("failed to add transaction and wait: " + err.Error())
+	}
+
+	newInstID := ctx.Instructions[0].DeriveID("").Slice()
+	fmt.Printf("Value contract updated! (instance ID is %x)\n", newInstID)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// ProjectdInvokeSetRevocationOutcome records how the revocation of a dataset
+// has been handled.
+func ProjectdInvokeSetRevocationOutcome(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDstr := c.String("instid")
+	if instIDstr == "" {
+		return errors.New("--instid flag is required")
+	}
+	instIDBuf, err := hex.DecodeString(instIDstr)
+	if err != nil {
+		return errors.New("failed to decode the instid string: " + err.Error())
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return errors.New("failed to parse the signer: " + err.Error())
+	}
+
+	datasetID := c.String("datasetID")
+	if datasetID == "" {
+		return errors.New("please provide a dataset with --datasetID")
+	}
+
+	outcome := c.String("outcome")
+	if outcome == "" {
+		return errors.New("please provide an outcome with --outcome")
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("failed to get counters: %v", err)
+	}
+
+	invoke := byzcoin.Invoke{
+		ContractID: projectc.ContractProjectID,
+		Command:    "setRevocationOutcome",
+		Args: []byzcoin.Argument{
+			{
+				Name:  "datasetID",
+				Value: []byte(datasetID),
+			},
+			{
+				Name:  "outcome",
+				Value: []byte(outcome),
+			},
+		},
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID:    byzcoin.NewInstanceID([]byte(instIDBuf)),
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return errors.New("failed to create transaction: " + err.Error())
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return errors.New("failed to add transaction and wait: " + err.Error())
+	}
+
+	newInstID := ctx.Instructions[0].DeriveID("").Slice()
+	fmt.Printf("Value contract updated! (instance ID is %x)\n", newInstID)
+
+	return lib.WaitPropagation(c, cl)
+}
+
 // ProjectGet checks the proof and prints the content of the Write contract.
 func ProjectGet(c *cli.Context) error {
 
@@ -698,7 +1087,7 @@ func ProjectGet(c *cli.Context) error {
 	}
 
 	var projectData projectc.ProjectData
-	err = proof.VerifyAndDecode(cothority.Suite, projectc.ContractProjectID, &projectData)
+	err = projectc.DecodeProjectProof(proof, instIDBuf, &projectData)
 	if err != nil {
 		return errors.New("couldn't get a project instance: " + err.Error())
 	}
@@ -720,3 +1109,103 @@ func ProjectGet(c *cli.Context) error {
 
 	return nil
 }
+
+// datasetManifest is printed by the getManifest command. Manifest is nil if
+// the dataset has been added to the catalog before the manifests.
+type datasetManifest struct {
+	Identity string                   `json:"identity"`
+	Manifest *envelope.SignedManifest `json:"manifest"`
+}
+
+// ProjectGetManifest prints, in JSON, the owner of a dataset of the project
+// and the manifest of the dataset, as stored in the catalog of the project.
+// The enclave uses them to check the datasets it downloads.
+func ProjectGetManifest(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDBuf, err := hex.DecodeString(c.String("instid"))
+	if err != nil || len(instIDBuf) == 0 {
+		return errors.New("please provide the hex encoded project instance " +
+			"ID with --instid")
+	}
+
+	datasetID := c.String("datasetID")
+	if datasetID == "" {
+		return errors.New("--datasetID flag is required")
+	}
+
+	pr, err := cl.GetProofFromLatest(instIDBuf)
+	if err != nil {
+		return errors.New("couldn't get proof: " + err.Error())
+	}
+
+	var projectData projectc.ProjectData
+	err = projectc.DecodeProjectProof(pr.Proof, instIDBuf, &projectData)
+	if err != nil {
+		return errors.New("couldn't get a project instance: " + err.Error())
+	}
+
+	found := false
+	for _, dataset := range projectData.Datasets {
+		if dataset.String() == datasetID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return xerrors.Errorf("dataset '%s' is not part of the project",
+			datasetID)
+	}
+
+	if projectData.CatalogID.Equal(byzcoin.InstanceID{}) {
+		return errors.New("the project has no catalog, the owner of the " +
+			"dataset can not be found")
+	}
+	catalogIDBuf := projectData.CatalogID.Slice()
+
+	pr, err = cl.GetProofFromLatest(catalogIDBuf)
+	if err != nil {
+		return errors.New("couldn't get proof of the catalog: " + err.Error())
+	}
+
+	var catalogData catalogc.CatalogData
+	err = catalogc.DecodeCatalogProof(pr.Proof, catalogIDBuf, &catalogData)
+	if err != nil {
+		return errors.New("couldn't get a catalog instance: " + err.Error())
+	}
+
+	owner := catalogData.GetDatasetOwner(datasetID)
+	if owner == nil {
+		return xerrors.Errorf("dataset '%s' not found in the catalog",
+			datasetID)
+	}
+	dataset := owner.GetDataset(datasetID)
+
+	// The catalog contract already checks it, but we don't want the enclave
+	// to rely on a manifest signed by someone else.
+	err = dataset.VerifyManifest()
+	if err != nil {
+		return xerrors.Errorf("wrong manifest for dataset '%s': %v",
+			datasetID, err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(datasetManifest{
+		Identity: owner.IdentityStr,
+		Manifest: dataset.Manifest,
+	})
+	if err != nil {
+		return errors.New("failed to encode the manifest: " + err.Error())
+	}
+
+	return nil
+}
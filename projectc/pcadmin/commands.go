@@ -40,6 +40,22 @@ var cmds = cli.Commands{
 								Name:  "pubKey, pk",
 								Usage: "an RSA public key string of type 'ssh-rsa XXX...' (optional)",
 							},
+							cli.StringFlag{
+								Name:  "title",
+								Usage: "the title of the project (optional)",
+							},
+							cli.StringFlag{
+								Name:  "description",
+								Usage: "the purpose statement of the project (optional)",
+							},
+							cli.StringFlag{
+								Name:  "organisation, org",
+								Usage: "the organisation requesting the project (optional)",
+							},
+							cli.StringFlag{
+								Name:  "catalogID, cid",
+								Usage: "the instance ID of the catalog where the datasets are registered, needed to revoke them (optional)",
+							},
 						},
 					},
 					{
@@ -210,6 +226,114 @@ var cmds = cli.Commands{
 									},
 								},
 							},
+							{
+								Name:   "recordOutput",
+								Usage:  "records an output that left the enclave. Only the enclave can call it",
+								Action: clicontracts.ProjectdInvokeRecordOutput,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "instid, i",
+										Usage: "the instance ID of the project contract",
+									},
+									cli.StringFlag{
+										Name:  "sign, s",
+										Usage: "public key of the signing entity, must be the enclave public key",
+									},
+									cli.StringFlag{
+										Name:  "file, f",
+										Usage: "path to the output file, used to compute its size and SHA-256 (required)",
+									},
+									cli.StringFlag{
+										Name:  "name, n",
+										Usage: "the name of the output (default is the file name)",
+									},
+									cli.StringFlag{
+										Name:  "destination, d",
+										Usage: "where the output has been sent, for example its cloud URL (required)",
+									},
+								},
+							},
+							{
+								Name:   "recordRead",
+								Usage:  "records that the signer is about to read a dataset. The read must be the next instruction of the signer",
+								Action: clicontracts.ProjectdInvokeRecordRead,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "instid, i",
+										Usage: "the instance ID of the project contract",
+									},
+									cli.StringFlag{
+										Name:  "sign, s",
+										Usage: "public key of the signing entity, which must then spawn the read (default is the admin public key)",
+									},
+									cli.StringFlag{
+										Name:  "datasetID, did",
+										Usage: "the calypso write instance ID of the dataset to read (required)",
+									},
+								},
+							},
+							{
+								Name:   "revokeDataset",
+								Usage:  "revokes a dataset from the project. Must be signed by the owner of the dataset",
+								Action: clicontracts.ProjectdInvokeRevokeDataset,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "instid, i",
+										Usage: "the instance ID of the project contract",
+									},
+									cli.StringFlag{
+										Name:  "sign, s",
+										Usage: "public key of the signing entity, must be the owner of the dataset",
+									},
+									cli.StringFlag{
+										Name:  "datasetID, did",
+										Usage: "the calypso write instance ID of the dataset to revoke (required)",
+									},
+								},
+							},
+							{
+								Name:   "setRevocationOutcome",
+								Usage:  "records how the revocation of a dataset has been handled",
+								Action: clicontracts.ProjectdInvokeSetRevocationOutcome,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "instid, i",
+										Usage: "the instance ID of the project contract",
+									},
+									cli.StringFlag{
+										Name:  "sign, s",
+										Usage: "public key of the signing entity (default is the admin public key)",
+									},
+									cli.StringFlag{
+										Name:  "datasetID, did",
+										Usage: "the calypso write instance ID of the revoked dataset (required)",
+									},
+									cli.StringFlag{
+										Name:  "outcome",
+										Usage: "a description of what has been done following the revocation (required)",
+									},
+								},
+							},
 						},
 					},
 					{
@@ -232,6 +356,62 @@ var cmds = cli.Commands{
 							},
 						},
 					},
+					{
+						Name:   "getManifest",
+						Usage:  "prints in JSON the owner of a dataset of the project and its signed manifest, as stored in the catalog of the project",
+						Action: clicontracts.ProjectGetManifest,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "instid, i",
+								Usage: "the project instance id (required)",
+							},
+							cli.StringFlag{
+								Name:  "datasetID, did",
+								Usage: "the dataset, given by its Calypso write instance ID (required)",
+							},
+						},
+					},
+					{
+						Name:   "list",
+						Usage:  "lists the project instances spawned on the chain, with optional filters",
+						Action: clicontracts.ProjectList,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "status",
+								Usage: "only list the projects with this status, like 'unlocking' (optional)",
+							},
+							cli.StringFlag{
+								Name:  "dataset, d",
+								Usage: "only list the projects that use this dataset (calypso write instance ID) (optional)",
+							},
+							cli.StringFlag{
+								Name:  "accessKey, ak",
+								Usage: "only list the projects with this access public key (optional)",
+							},
+							cli.StringFlag{
+								Name:  "from",
+								Usage: "only list the projects created on or after this date, as YYYY-MM-DD (optional)",
+							},
+							cli.StringFlag{
+								Name:  "to",
+								Usage: "only list the projects created on or before this date, as YYYY-MM-DD (optional)",
+							},
+							cli.BoolFlag{
+								Name:  "json, j",
+								Usage: "print the projects as JSON instead of a table",
+							},
+						},
+					},
 				},
 			},
 		},